@@ -0,0 +1,64 @@
+// cmd/breachcorpus/main.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"remus_synerge/pkg/passpolicy"
+)
+
+// breachcorpus converts a list of breached passwords, either plaintext or
+// Have I Been Pwned "HASH:COUNT" lines, into the compact corpus file read by
+// BREACHED_PASSWORDS_FILE.
+func main() {
+	output := flag.String("o", "breached-passwords.bin", "corpus file to write")
+	prefixLength := flag.Int("prefix", passpolicy.DefaultPrefixLength, "hash bytes stored per password")
+	minCount := flag.Int("min-count", 0, "skip hashes seen fewer times than this")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [input ...]\n\nReads standard input when no input files are given.\n\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var inputs []io.Reader
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		// Keep the last line of one file apart from the first of the next.
+		inputs = append(inputs, f, strings.NewReader("\n"))
+	}
+	if len(inputs) == 0 {
+		inputs = append(inputs, os.Stdin)
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		fatal(err)
+	}
+
+	count, err := passpolicy.BuildCorpus(out, io.MultiReader(inputs...), passpolicy.BuildOptions{
+		PrefixLength: *prefixLength,
+		MinCount:     *minCount,
+	})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*output)
+		fatal(err)
+	}
+
+	fmt.Printf("Wrote %d passwords to %s\n", count, *output)
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "breachcorpus:", err)
+	os.Exit(1)
+}
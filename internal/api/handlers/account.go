@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/mailer"
+	"remus_synerge/pkg/passpolicy"
+)
+
+// acceptedMessage is returned whether or not the address belongs to a user,
+// so these endpoints cannot be used to find registered addresses.
+const acceptedMessage = "If the address belongs to an account, an email has been sent"
+
+// AccountHandler implements account recovery and email verification through
+// single-use tokens sent by email.
+type AccountHandler struct {
+	userRepo         repository.UserRepository
+	userTokenRepo    repository.UserTokenRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	authService      *middleware.AuthService
+	mailer           mailer.Mailer
+	templates        *mailer.Templates
+	linkBaseURL      string
+	resetTTL         time.Duration
+	verificationTTL  time.Duration
+	passwordPolicy   *passpolicy.Policy
+	loginGuard       *middleware.LoginGuard
+	logger           zerolog.Logger
+}
+
+type EmailRequest struct {
+	Email string `json:"email"`
+}
+
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// NewAccountHandler creates the handler. Links in emails point to
+// linkBaseURL + "/reset-password" and "/verify-email", with the token in
+// the query string.
+func NewAccountHandler(userRepo repository.UserRepository, userTokenRepo repository.UserTokenRepository, refreshTokenRepo repository.RefreshTokenRepository, authService *middleware.AuthService, m mailer.Mailer, templates *mailer.Templates, linkBaseURL string, resetTTL, verificationTTL time.Duration, logger zerolog.Logger) *AccountHandler {
+	h := &AccountHandler{
+		userRepo:         userRepo,
+		userTokenRepo:    userTokenRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		authService:      authService,
+		mailer:           m,
+		templates:        templates,
+		linkBaseURL:      strings.TrimSuffix(linkBaseURL, "/"),
+		resetTTL:         resetTTL,
+		verificationTTL:  verificationTTL,
+		passwordPolicy:   passpolicy.Default(),
+		logger:           logger,
+	}
+
+	go h.cleanupLoop()
+
+	return h
+}
+
+// SetPasswordPolicy replaces the default policy for new passwords.
+func (h *AccountHandler) SetPasswordPolicy(policy *passpolicy.Policy) {
+	h.passwordPolicy = policy
+}
+
+// SetLoginGuard lets a password reset or an unlock link clear a login
+// lockout.
+func (h *AccountHandler) SetLoginGuard(guard *middleware.LoginGuard) {
+	h.loginGuard = guard
+}
+
+func (h *AccountHandler) cleanupLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if _, err := h.userTokenRepo.DeleteExpiredUserTokens(ctx, time.Now()); err != nil {
+			h.logger.Error().Err(err).Msg("Failed to delete expired user tokens")
+		}
+		cancel()
+	}
+}
+
+func (h *AccountHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	user, err := h.userRepo.GetUserByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		sendRepositoryError(w, h.logger, err, "User", "Failed to request password reset")
+		return
+	}
+	if err != nil {
+		h.logger.Info().Str("email", req.Email).Msg("Password reset requested for unknown email")
+		h.sendJSONResponse(w, http.StatusAccepted, MessageResponse{Message: acceptedMessage})
+		return
+	}
+
+	if err := h.sendToken(ctx, user, models.TokenPurposePasswordReset); err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to send password reset email")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to send email")
+		return
+	}
+
+	h.logger.Info().Int("user_id", user.ID).Msg("Password reset requested")
+	h.sendJSONResponse(w, http.StatusAccepted, MessageResponse{Message: acceptedMessage})
+}
+
+// ResetPassword sets a new password and ends every session of the user,
+// since the reset usually means the old password is compromised.
+func (h *AccountHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.Token == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	// Check the password against the user before the token is used up, so
+	// that a rejected password does not cost the link.
+	user, token, ok := h.lookupToken(ctx, w, models.TokenPurposePasswordReset, req.Token)
+	if !ok {
+		return
+	}
+	if !strings.EqualFold(user.Email, token.Email) {
+		// The link went to an address the user has since replaced.
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if !h.checkPassword(w, req.Password, user.Username, user.Email) {
+		return
+	}
+
+	user, token, ok = h.consumeToken(ctx, w, models.TokenPurposePasswordReset, req.Token)
+	if !ok {
+		return
+	}
+
+	hashedPassword, err := h.authService.HashPassword(req.Password)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to hash password")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process password")
+		return
+	}
+
+	err = h.updateTokenUser(ctx, user, token, func(user *models.User) bool {
+		now := time.Now()
+		user.Password = hashedPassword
+		user.UpdatedAt = now
+		// Receiving the reset email proves control of the address.
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+		}
+		return true
+	})
+	if errors.Is(err, errTokenEmailChanged) {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", user.ID).Logger(), err, "User", "Failed to reset password")
+		return
+	}
+
+	if err := h.authService.RevokeAllTokens(ctx, user.ID); err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to revoke access tokens after password reset")
+	}
+	if err := h.refreshTokenRepo.RevokeUserRefreshTokens(ctx, user.ID); err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to revoke refresh tokens after password reset")
+	}
+	h.resetLoginGuard(ctx, user)
+
+	h.logger.Info().Int("user_id", user.ID).Msg("Password reset")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *AccountHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	user, token, ok := h.consumeToken(ctx, w, models.TokenPurposeEmailVerification, req.Token)
+	if !ok {
+		return
+	}
+
+	err := h.updateTokenUser(ctx, user, token, func(user *models.User) bool {
+		if user.EmailVerifiedAt != nil {
+			return false
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		return true
+	})
+	if errors.Is(err, errTokenEmailChanged) {
+		// The user changed address after the email was sent.
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", user.ID).Logger(), err, "User", "Failed to verify email")
+		return
+	}
+
+	h.logger.Info().Int("user_id", user.ID).Msg("Email verified")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UnlockAccount lifts a login lockout using the link sent when the account
+// was locked.
+func (h *AccountHandler) UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Token is required")
+		return
+	}
+
+	user, _, ok := h.consumeToken(ctx, w, models.TokenPurposeAccountUnlock, req.Token)
+	if !ok {
+		return
+	}
+
+	h.resetLoginGuard(ctx, user)
+	h.logger.Info().Int("user_id", user.ID).Msg("Account unlocked by email")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResendVerification is public so that users who cannot log in before
+// verifying can ask for a new link.
+func (h *AccountHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req EmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	user, err := h.userRepo.GetUserByEmail(ctx, req.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		sendRepositoryError(w, h.logger, err, "User", "Failed to resend verification email")
+		return
+	}
+	if err != nil || user.EmailVerifiedAt != nil {
+		h.sendJSONResponse(w, http.StatusAccepted, MessageResponse{Message: acceptedMessage})
+		return
+	}
+
+	if err := h.SendVerificationEmail(ctx, user); err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to send verification email")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to send email")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusAccepted, MessageResponse{Message: acceptedMessage})
+}
+
+// SendVerificationEmail sends a verification link for the user's current
+// address. It implements EmailVerifier.
+func (h *AccountHandler) SendVerificationEmail(ctx context.Context, user *models.User) error {
+	return h.sendToken(ctx, user, models.TokenPurposeEmailVerification)
+}
+
+// SendUnlockEmail sends a link that lifts a login lockout. It implements
+// LockoutNotifier.
+func (h *AccountHandler) SendUnlockEmail(ctx context.Context, user *models.User) error {
+	return h.sendToken(ctx, user, models.TokenPurposeAccountUnlock)
+}
+
+// sendToken stores a new token, which replaces any earlier one for the same
+// purpose, and emails the link. Delivery happens in the background so that
+// response times do not depend on whether an email was sent.
+func (h *AccountHandler) sendToken(ctx context.Context, user *models.User, purpose string) error {
+	raw, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	var templateName, path string
+	var ttl time.Duration
+	switch purpose {
+	case models.TokenPurposePasswordReset:
+		templateName, path, ttl = mailer.TemplatePasswordReset, "/reset-password", h.resetTTL
+	case models.TokenPurposeAccountUnlock:
+		templateName, path, ttl = mailer.TemplateAccountUnlock, "/unlock-account", h.resetTTL
+	default:
+		templateName, path, ttl = mailer.TemplateVerifyEmail, "/verify-email", h.verificationTTL
+	}
+
+	err = h.userTokenRepo.CreateUserToken(ctx, &models.UserToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashSecret(raw),
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+
+	msg, err := h.templates.Render(templateName, user.Email, &mailer.TemplateData{
+		Username:  user.Username,
+		Email:     user.Email,
+		Link:      h.linkBaseURL + path + "?" + url.Values{"token": {raw}}.Encode(),
+		ExpiresIn: formatDuration(ttl),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to render email: %w", err)
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := h.mailer.Send(ctx, msg); err != nil {
+			h.logger.Error().Err(err).Int("user_id", user.ID).Str("purpose", purpose).Msg("Failed to deliver email")
+		}
+	}()
+	return nil
+}
+
+func (h *AccountHandler) consumeToken(ctx context.Context, w http.ResponseWriter, purpose, raw string) (*models.User, *models.UserToken, bool) {
+	token, err := h.userTokenRepo.ConsumeUserToken(ctx, purpose, hashSecret(raw))
+	if errors.Is(err, repository.ErrUserTokenNotFound) {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid or expired token")
+		return nil, nil, false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Str("purpose", purpose).Msg("Failed to consume token")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process token")
+		return nil, nil, false
+	}
+	return h.tokenUser(ctx, w, token)
+}
+
+// lookupToken is consumeToken without using the token up, for requests
+// that must pass further checks first.
+func (h *AccountHandler) lookupToken(ctx context.Context, w http.ResponseWriter, purpose, raw string) (*models.User, *models.UserToken, bool) {
+	token, err := h.userTokenRepo.GetUserToken(ctx, purpose, hashSecret(raw))
+	if errors.Is(err, repository.ErrUserTokenNotFound) {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid or expired token")
+		return nil, nil, false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Str("purpose", purpose).Msg("Failed to look up token")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process token")
+		return nil, nil, false
+	}
+	return h.tokenUser(ctx, w, token)
+}
+
+// tokenUser loads the user a token was issued to.
+func (h *AccountHandler) tokenUser(ctx context.Context, w http.ResponseWriter, token *models.UserToken) (*models.User, *models.UserToken, bool) {
+	user, err := h.userRepo.GetUserByID(ctx, token.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		h.logger.Warn().Int("user_id", token.UserID).Msg("User not found for token")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid or expired token")
+		return nil, nil, false
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", token.UserID).Logger(), err, "User", "Failed to process token")
+		return nil, nil, false
+	}
+	return user, token, true
+}
+
+// errTokenEmailChanged means the user's email changed after the token was
+// sent to the old one.
+var errTokenEmailChanged = errors.New("email changed since the token was sent")
+
+// userUpdateAttempts bounds how often updateTokenUser rereads a user that
+// keeps changing under it.
+const userUpdateAttempts = 3
+
+// updateTokenUser applies change to the user a token was consumed for and
+// saves it, unless change reports there is nothing to save. The token is
+// already used up, so a concurrent edit must not fail the request: the user
+// is reread and change applied again, as long as the email is still the one
+// the token was sent to.
+func (h *AccountHandler) updateTokenUser(ctx context.Context, user *models.User, token *models.UserToken, change func(*models.User) bool) error {
+	for attempt := 1; ; attempt++ {
+		if !strings.EqualFold(user.Email, token.Email) {
+			return errTokenEmailChanged
+		}
+		if !change(user) {
+			return nil
+		}
+
+		_, err := h.userRepo.UpdateUser(ctx, user)
+		if !errors.Is(err, repository.ErrUserVersionConflict) || attempt == userUpdateAttempts {
+			return err
+		}
+		if user, err = h.userRepo.GetUserByID(ctx, user.ID); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *AccountHandler) resetLoginGuard(ctx context.Context, user *models.User) {
+	if h.loginGuard == nil {
+		return
+	}
+	if err := h.loginGuard.Reset(ctx, user.Email); err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to reset login throttle")
+	}
+}
+
+// formatDuration renders whole hours or minutes for use in email text.
+func formatDuration(d time.Duration) string {
+	if d >= time.Hour && d%time.Hour == 0 {
+		if hours := int(d / time.Hour); hours != 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	if minutes := int(d / time.Minute); minutes != 1 {
+		return fmt.Sprintf("%d minutes", minutes)
+	}
+	return "1 minute"
+}
+
+func (h *AccountHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+// checkPassword applies the password policy and writes the error response
+// when the password is refused.
+func (h *AccountHandler) checkPassword(w http.ResponseWriter, password string, userInputs ...string) bool {
+	if err := h.passwordPolicy.Check(password, userInputs...); err != nil {
+		if passpolicy.IsViolation(err) {
+			h.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+		h.logger.Error().Err(err).Msg("Failed to check password policy")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process password")
+		return false
+	}
+	return true
+}
+
+func (h *AccountHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
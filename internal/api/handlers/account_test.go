@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/mailer"
+)
+
+// Mock user token repository for testing
+type mockUserTokenRepository struct {
+	mu     sync.Mutex
+	tokens []*models.UserToken
+}
+
+func newMockUserTokenRepository() *mockUserTokenRepository {
+	return &mockUserTokenRepository{}
+}
+
+func (m *mockUserTokenRepository) CreateUserToken(ctx context.Context, token *models.UserToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, existing := range m.tokens {
+		if existing.UserID == token.UserID && existing.Purpose == token.Purpose && existing.UsedAt == nil {
+			existing.UsedAt = &now
+		}
+	}
+	token.ID = len(m.tokens) + 1
+	token.CreatedAt = now
+	m.tokens = append(m.tokens, token)
+	return nil
+}
+
+func (m *mockUserTokenRepository) GetUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash && token.UsedAt == nil && now.Before(token.ExpiresAt) {
+			copied := *token
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrUserTokenNotFound
+}
+
+func (m *mockUserTokenRepository) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash && token.UsedAt == nil && now.Before(token.ExpiresAt) {
+			token.UsedAt = &now
+			return token, nil
+		}
+	}
+	return nil, repository.ErrUserTokenNotFound
+}
+
+func (m *mockUserTokenRepository) DeleteExpiredUserTokens(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+// Mock login throttle repository for testing
+type mockLoginThrottleRepository struct {
+	throttles map[string]*models.LoginThrottle
+}
+
+func newMockLoginThrottleRepository() *mockLoginThrottleRepository {
+	return &mockLoginThrottleRepository{throttles: make(map[string]*models.LoginThrottle)}
+}
+
+func (m *mockLoginThrottleRepository) GetLoginThrottles(ctx context.Context, keys []string) ([]*models.LoginThrottle, error) {
+	var throttles []*models.LoginThrottle
+	for _, key := range keys {
+		if throttle, exists := m.throttles[key]; exists {
+			throttles = append(throttles, throttle)
+		}
+	}
+	return throttles, nil
+}
+
+func (m *mockLoginThrottleRepository) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginThrottle, error) {
+	throttle, exists := m.throttles[key]
+	if !exists {
+		throttle = &models.LoginThrottle{Key: key}
+		m.throttles[key] = throttle
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = at
+	return throttle, nil
+}
+
+func (m *mockLoginThrottleRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	m.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func (m *mockLoginThrottleRepository) ClearLoginThrottle(ctx context.Context, key string) error {
+	delete(m.throttles, key)
+	return nil
+}
+
+func (m *mockLoginThrottleRepository) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// recordingMailer collects sent messages. Delivery is asynchronous, so tests
+// wait on the channel.
+type recordingMailer struct {
+	sent chan *mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg *mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+var linkPattern = regexp.MustCompile(`https?://\S+`)
+
+// receiveToken waits for the next email and returns the token in its link.
+func (m *recordingMailer) receiveToken(t *testing.T, to string) string {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		if msg.To != to {
+			t.Fatalf("expected email to %s, got %s", to, msg.To)
+		}
+		link, err := url.Parse(linkPattern.FindString(msg.Text))
+		if err != nil || link.Query().Get("token") == "" {
+			t.Fatalf("expected a link with a token, got %q", msg.Text)
+		}
+		return link.Query().Get("token")
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected an email to be sent")
+	}
+	return ""
+}
+
+func newTestAccountHandler(t *testing.T) (*AccountHandler, *AuthHandler, *recordingMailer) {
+	authHandler, userRepo, refreshRepo := newTestAuthHandler(t)
+	templates, err := mailer.LoadTemplates("")
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+	mail := &recordingMailer{sent: make(chan *mailer.Message, 10)}
+	handler := NewAccountHandler(userRepo, newMockUserTokenRepository(), refreshRepo, authHandler.authService, mail, templates,
+		"https://app.example.com/", time.Hour, 24*time.Hour, zerolog.New(zerolog.NewTestWriter(t)))
+	return handler, authHandler, mail
+}
+
+func TestAccountHandler_PasswordReset(t *testing.T) {
+	handler, authHandler, mail := newTestAccountHandler(t)
+	session := login(t, authHandler)
+
+	if rr := postJSON(http.HandlerFunc(handler.ForgotPassword), "/auth/password/forgot", "", EmailRequest{Email: "nobody@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected unknown email to be accepted, got %d", rr.Code)
+	}
+
+	rr := postJSON(http.HandlerFunc(handler.ForgotPassword), "/auth/password/forgot", "", EmailRequest{Email: "test@example.com"})
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	token := mail.receiveToken(t, "test@example.com")
+
+	reset := http.HandlerFunc(handler.ResetPassword)
+	if rr := postJSON(reset, "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "short"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected short password to be rejected, got %d", rr.Code)
+	}
+	// A password rejected for the user's own name does not use up the link
+	if rr := postJSON(reset, "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "my-testuser-pw"}); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "username") {
+		t.Errorf("expected password based on the username to be rejected, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := postJSON(reset, "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "new-password"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected reset to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := postJSON(reset, "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "another-password"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a used token to be rejected, got %d", rr.Code)
+	}
+
+	if rr := refresh(authHandler, session.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected existing sessions to be revoked, got %d", rr.Code)
+	}
+
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "test@example.com", Password: "new-password"})
+	rr = httptest.NewRecorder()
+	authHandler.Login(rr, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected login with the new password, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAccountHandler_PasswordResetAfterEmailChange(t *testing.T) {
+	handler, authHandler, mail := newTestAccountHandler(t)
+	userRepo := authHandler.userRepo
+
+	if rr := postJSON(http.HandlerFunc(handler.ForgotPassword), "/auth/password/forgot", "", EmailRequest{Email: "test@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	token := mail.receiveToken(t, "test@example.com")
+
+	// A link sent to a previous address must not reset the password.
+	user := getTestUser(t, userRepo, 1)
+	user.Email = "changed@example.com"
+	if _, err := userRepo.UpdateUser(context.Background(), user); err != nil {
+		t.Fatalf("failed to change the email: %v", err)
+	}
+	if rr := postJSON(http.HandlerFunc(handler.ResetPassword), "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "new-password"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected token for a previous address to be rejected, got %d", rr.Code)
+	}
+
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "changed@example.com", Password: "password123"})
+	rr := httptest.NewRecorder()
+	authHandler.Login(rr, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the old password to still work, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// racingUserRepository lets another edit of the user land between each read
+// and the first update, as a concurrent request would.
+type racingUserRepository struct {
+	repository.UserRepository
+	raced bool
+}
+
+func (r *racingUserRepository) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	if !r.raced {
+		r.raced = true
+		other, err := r.UserRepository.GetUserByID(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		displayName := "Edited Meanwhile"
+		other.DisplayName = &displayName
+		if _, err := r.UserRepository.UpdateUser(ctx, other); err != nil {
+			return nil, err
+		}
+	}
+	return r.UserRepository.UpdateUser(ctx, user)
+}
+
+func TestAccountHandler_TokensSurviveConcurrentEdits(t *testing.T) {
+	handler, authHandler, mail := newTestAccountHandler(t)
+	userRepo := authHandler.userRepo
+	handler.userRepo = &racingUserRepository{UserRepository: userRepo}
+
+	if rr := postJSON(http.HandlerFunc(handler.ResendVerification), "/auth/email/resend", "", EmailRequest{Email: "test@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected resend to be accepted, got %d", rr.Code)
+	}
+	token := mail.receiveToken(t, "test@example.com")
+	if rr := postJSON(http.HandlerFunc(handler.VerifyEmail), "/auth/email/verify", "", TokenRequest{Token: token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected verification to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if user := getTestUser(t, userRepo, 1); user.EmailVerifiedAt == nil || user.DisplayName == nil || *user.DisplayName != "Edited Meanwhile" {
+		t.Errorf("expected the email verified and the other edit kept, got %+v", user)
+	}
+
+	handler.userRepo = &racingUserRepository{UserRepository: userRepo}
+	if rr := postJSON(http.HandlerFunc(handler.ForgotPassword), "/auth/password/forgot", "", EmailRequest{Email: "test@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	token = mail.receiveToken(t, "test@example.com")
+	if rr := postJSON(http.HandlerFunc(handler.ResetPassword), "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "new-password"}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected reset to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "test@example.com", Password: "new-password"})
+	rr := httptest.NewRecorder()
+	authHandler.Login(rr, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected login with the new password, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAccountHandler_DatabaseUnavailable(t *testing.T) {
+	handler, authHandler, mail := newTestAccountHandler(t)
+
+	if rr := postJSON(http.HandlerFunc(handler.ForgotPassword), "/auth/password/forgot", "", EmailRequest{Email: "test@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	token := mail.receiveToken(t, "test@example.com")
+
+	handler.userRepo = unavailableUserRepository{authHandler.userRepo}
+	rr := postJSON(http.HandlerFunc(handler.ResetPassword), "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "new-password"})
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	}
+
+	// The link survives the outage
+	handler.userRepo = authHandler.userRepo
+	if rr := postJSON(http.HandlerFunc(handler.ResetPassword), "/auth/password/reset", "", ResetPasswordRequest{Token: token, Password: "new-password"}); rr.Code != http.StatusNoContent {
+		t.Errorf("expected the retried reset to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAccountHandler_VerifyEmail(t *testing.T) {
+	handler, authHandler, mail := newTestAccountHandler(t)
+	authHandler.RequireVerifiedEmail(true)
+	userRepo := authHandler.userRepo
+
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "test@example.com", Password: "password123"})
+	rr := httptest.NewRecorder()
+	authHandler.Login(rr, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body)))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected login to be blocked until verified, got %d", rr.Code)
+	}
+
+	// Read after the login, which upgraded the password hash
+	user := getTestUser(t, userRepo, 1)
+
+	verify := http.HandlerFunc(handler.VerifyEmail)
+
+	// A link sent to a previous address must not verify the current one.
+	handler.SendVerificationEmail(context.Background(), user)
+	stale := mail.receiveToken(t, "test@example.com")
+	user.Email = "changed@example.com"
+	if _, err := userRepo.UpdateUser(context.Background(), user); err != nil {
+		t.Fatalf("failed to change the email: %v", err)
+	}
+	if rr := postJSON(verify, "/auth/email/verify", "", TokenRequest{Token: stale}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected token for a previous address to be rejected, got %d", rr.Code)
+	}
+	user.Email = "test@example.com"
+	if _, err := userRepo.UpdateUser(context.Background(), user); err != nil {
+		t.Fatalf("failed to change the email back: %v", err)
+	}
+
+	if rr := postJSON(http.HandlerFunc(handler.ResendVerification), "/auth/email/resend", "", EmailRequest{Email: "test@example.com"}); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected resend to be accepted, got %d", rr.Code)
+	}
+	token := mail.receiveToken(t, "test@example.com")
+
+	if rr := postJSON(verify, "/auth/email/verify", "", TokenRequest{Token: token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected verification to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if user := getTestUser(t, userRepo, 1); user.EmailVerifiedAt == nil {
+		t.Fatal("expected email to be marked verified")
+	}
+
+	login(t, authHandler)
+}
+
+func TestAccountHandler_LoginLockout(t *testing.T) {
+	handler, authHandler, mail := newTestAccountHandler(t)
+	guard := middleware.NewLoginGuard(newMockLoginThrottleRepository(), middleware.LoginGuardConfig{
+		FreeAttempts:     10,
+		IPFreeAttempts:   100,
+		LockoutThreshold: 3,
+		LockoutDuration:  15 * time.Minute,
+		FailureWindow:    time.Hour,
+	}, zerolog.New(zerolog.NewTestWriter(t)))
+	authHandler.SetLoginGuard(guard, handler)
+	handler.SetLoginGuard(guard)
+
+	attempt := func(email, password string) *httptest.ResponseRecorder {
+		return postJSON(http.HandlerFunc(authHandler.Login), "/auth/login", "", middleware.LoginRequest{Email: email, Password: password})
+	}
+
+	// Known and unknown addresses behave the same.
+	for _, email := range []string{"test@example.com", "nobody@example.com"} {
+		for i := 1; i < 3; i++ {
+			if rr := attempt(email, "wrong-password"); rr.Code != http.StatusUnauthorized {
+				t.Fatalf("%s: expected failure %d to be rejected with %d, got %d", email, i, http.StatusUnauthorized, rr.Code)
+			}
+		}
+		rr := attempt(email, "wrong-password")
+		if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") != "900" {
+			t.Fatalf("%s: expected lockout with Retry-After 900, got %d %q", email, rr.Code, rr.Header().Get("Retry-After"))
+		}
+	}
+
+	if rr := attempt("test@example.com", "password123"); rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the correct password to be refused while locked, got %d", rr.Code)
+	}
+
+	// Only the real account gets an unlock email.
+	token := mail.receiveToken(t, "test@example.com")
+	select {
+	case msg := <-mail.sent:
+		t.Fatalf("unexpected email to %s", msg.To)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if rr := postJSON(http.HandlerFunc(handler.UnlockAccount), "/auth/unlock", "", TokenRequest{Token: token}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected unlock to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := attempt("test@example.com", "password123"); rr.Code != http.StatusOK {
+		t.Errorf("expected login after unlock, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
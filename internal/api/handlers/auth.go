@@ -2,29 +2,74 @@ package handlers
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
 	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
 	"remus_synerge/internal/repository"
 )
 
 type AuthHandler struct {
-	userRepo    repository.UserRepository
-	authService *middleware.AuthService
-	logger      zerolog.Logger
+	userRepo         repository.UserRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	roleRepo         repository.RoleRepository
+	mfaRepo          repository.MFARepository
+	authService      *middleware.AuthService
+	requireVerified  bool
+	loginGuard       *middleware.LoginGuard
+	lockoutNotifier  LockoutNotifier
+	sessions         *middleware.SessionStore
+	dummyHashOnce    sync.Once
+	dummyHash        string
+	logger           zerolog.Logger
 }
 
-func NewAuthHandler(userRepo repository.UserRepository, authService *middleware.AuthService, logger zerolog.Logger) *AuthHandler {
+// LockoutNotifier tells a user that their account was locked after repeated
+// failed logins and offers a way to unlock it.
+type LockoutNotifier interface {
+	SendUnlockEmail(ctx context.Context, user *models.User) error
+}
+
+func NewAuthHandler(userRepo repository.UserRepository, refreshTokenRepo repository.RefreshTokenRepository, roleRepo repository.RoleRepository, mfaRepo repository.MFARepository, authService *middleware.AuthService, logger zerolog.Logger) *AuthHandler {
 	return &AuthHandler{
-		userRepo:    userRepo,
-		authService: authService,
-		logger:      logger,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		roleRepo:         roleRepo,
+		mfaRepo:          mfaRepo,
+		authService:      authService,
+		logger:           logger,
 	}
 }
 
+// RequireVerifiedEmail makes password login fail until the user has
+// verified their email address.
+func (h *AuthHandler) RequireVerifiedEmail(require bool) {
+	h.requireVerified = require
+}
+
+// SetLoginGuard enables throttling and lockout of password and second-factor
+// attempts. notifier, if set, is told when an existing account gets locked.
+func (h *AuthHandler) SetLoginGuard(guard *middleware.LoginGuard, notifier LockoutNotifier) {
+	h.loginGuard = guard
+	h.lockoutNotifier = notifier
+}
+
+// SetSessionStore enables recording each login as a session that the user
+// can list and revoke.
+func (h *AuthHandler) SetSessionStore(sessions *middleware.SessionStore) {
+	h.sessions = sessions
+}
+
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
@@ -42,40 +87,49 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get user by email
+	if !h.checkLoginGuard(ctx, w, r, req.Email) {
+		return
+	}
+
+	// Unknown addresses and wrong passwords take the same path and the same
+	// time, so neither the response nor the log reveals which one it was.
 	user, err := h.userRepo.GetUserByEmail(ctx, req.Email)
-	if err != nil {
-		h.logger.Error().Err(err).Str("email", req.Email).Msg("User not found")
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		sendRepositoryError(w, h.logger, err, "User", "Login failed")
+		return
+	}
+	if !h.verifyPassword(ctx, user, req.Password) {
+		h.logger.Warn().Msg("Login failed: invalid credentials")
+		if h.recordLoginFailure(ctx, w, r, req.Email, user) {
+			return
+		}
 		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
 
-	// Compare password
-	if err := h.authService.ComparePassword(user.Password, req.Password); err != nil {
-		h.logger.Error().Err(err).Str("email", req.Email).Msg("Invalid password")
-		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid credentials")
+	// Checked after the password so the response does not reveal whether an
+	// address is registered.
+	if h.requireVerified && user.EmailVerifiedAt == nil {
+		h.logger.Warn().Int("user_id", user.ID).Msg("Login blocked until email is verified")
+		h.sendErrorResponse(w, http.StatusForbidden, "Email address has not been verified")
 		return
 	}
 
-	// Generate JWT token
-	token, expiresAt, err := h.authService.GenerateToken(user.ID, user.Username, user.Email)
+	response, err := h.completeLogin(ctx, r, user)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to generate token")
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to start session")
 		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	response := middleware.LoginResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
-		User: middleware.UserInfo{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-		},
+	if !h.sendLoginResponse(w, r, response) {
+		return
 	}
-
-	h.sendJSONResponse(w, http.StatusOK, response)
+	if _, pending := response.(*middleware.MFAChallengeResponse); pending {
+		h.logger.Info().Int("user_id", user.ID).Msg("Password verified, second factor required")
+		return
+	}
+	h.resetLoginGuard(ctx, user)
 	h.logger.Info().
 		Int("user_id", user.ID).
 		Str("username", user.Username).
@@ -83,42 +137,502 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		Msg("User logged in successfully")
 }
 
+// completeLogin starts a session for a user who passed the first factor or,
+// if the user has two-factor authentication enabled, returns the challenge
+// for the second login step.
+func (h *AuthHandler) completeLogin(ctx context.Context, r *http.Request, user *models.User) (interface{}, error) {
+	mfa, err := h.mfaRepo.GetMFA(ctx, user.ID)
+	if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+		return nil, fmt.Errorf("failed to load mfa enrollment: %w", err)
+	}
+
+	if mfa != nil && mfa.Enabled {
+		token, expiresAt, err := h.authService.GenerateMFAToken(user.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &middleware.MFAChallengeResponse{
+			MFARequired: true,
+			MFAToken:    token,
+			ExpiresAt:   expiresAt,
+		}, nil
+	}
+
+	return h.startSession(ctx, r, user)
+}
+
+// LoginMFA is the second login step for users with two-factor
+// authentication. It exchanges the token from Login and a TOTP or recovery
+// code for a session.
+func (h *AuthHandler) LoginMFA(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req middleware.MFALoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode MFA login request")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.MFAToken == "" || req.Code == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "MFA token and code are required")
+		return
+	}
+
+	claims, err := h.authService.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		h.logger.Warn().Err(err).Msg("Invalid MFA token")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(ctx, claims.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		h.logger.Warn().Int("user_id", claims.UserID).Msg("User not found for MFA login")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", claims.UserID).Logger(), err, "User", "Failed to log in")
+		return
+	}
+
+	// Second-factor guesses count against the same address as passwords.
+	if !h.checkLoginGuard(ctx, w, r, user.Email) {
+		return
+	}
+
+	mfa, err := h.mfaRepo.GetMFA(ctx, claims.UserID)
+	if err != nil || !mfa.Enabled {
+		// Two-factor authentication was turned off after the first step.
+		h.logger.Warn().Err(err).Int("user_id", claims.UserID).Msg("MFA login without active enrollment")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	if err := verifySecondFactor(ctx, h.mfaRepo, mfa, req.Code, true); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			h.logger.Warn().Int("user_id", claims.UserID).Msg("Invalid MFA code")
+			if h.recordLoginFailure(ctx, w, r, user.Email, user) {
+				return
+			}
+			h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid verification code")
+			return
+		}
+		h.logger.Error().Err(err).Int("user_id", claims.UserID).Msg("Failed to verify MFA code")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+
+	response, err := h.startSession(ctx, r, user)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to start session")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	if !h.sendLoginResponse(w, r, response) {
+		return
+	}
+	h.resetLoginGuard(ctx, user)
+	h.logger.Info().
+		Int("user_id", user.ID).
+		Str("username", user.Username).
+		Msg("User logged in with second factor")
+}
+
+// verifyPassword reports whether password matches the user's, and upgrades
+// the stored hash if it was made with outdated settings. Unknown users (nil)
+// and users without a password are checked against a dummy hash so that the
+// check takes as long as for a real account.
+func (h *AuthHandler) verifyPassword(ctx context.Context, user *models.User, password string) bool {
+	if user == nil || user.Password == "" {
+		h.dummyHashOnce.Do(func() {
+			hash, err := h.authService.HashPassword("dummy password for unknown users")
+			if err != nil {
+				h.logger.Error().Err(err).Msg("Failed to create dummy password hash")
+			}
+			h.dummyHash = hash
+		})
+		h.authService.VerifyPassword(h.dummyHash, password)
+		return false
+	}
+
+	match, rehash, err := h.authService.VerifyPassword(user.Password, password)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to verify password hash")
+		return false
+	}
+	if match && rehash {
+		h.rehashPassword(ctx, user, password)
+	}
+	return match
+}
+
+// rehashPassword replaces an outdated password hash while the plaintext is
+// at hand. Failures are logged and retried on the next login.
+func (h *AuthHandler) rehashPassword(ctx context.Context, user *models.User, password string) {
+	hash, err := h.authService.HashPassword(password)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to rehash password")
+		return
+	}
+	err = h.userRepo.UpdatePassword(ctx, user.ID, user.Password, hash)
+	if errors.Is(err, repository.ErrUserVersionConflict) {
+		// The password was changed or reset since it was checked
+		h.logger.Info().Int("user_id", user.ID).Msg("Skipped rehash of a password changed since login")
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to store rehashed password")
+		return
+	}
+	user.Password = hash
+	h.logger.Info().Int("user_id", user.ID).Msg("Upgraded password hash")
+}
+
+// checkLoginGuard writes a 429 response and returns false if login attempts
+// for email are currently throttled.
+func (h *AuthHandler) checkLoginGuard(ctx context.Context, w http.ResponseWriter, r *http.Request, email string) bool {
+	if h.loginGuard == nil {
+		return true
+	}
+
+	wait, err := h.loginGuard.Check(ctx, r, email)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to check login throttle")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process login")
+		return false
+	}
+	if wait > 0 {
+		h.sendThrottledResponse(w, wait)
+		return false
+	}
+	return true
+}
+
+// recordLoginFailure counts a failed attempt. If it locked the address, it
+// notifies the owner, writes a 429 response and returns true.
+func (h *AuthHandler) recordLoginFailure(ctx context.Context, w http.ResponseWriter, r *http.Request, email string, user *models.User) bool {
+	if h.loginGuard == nil {
+		return false
+	}
+
+	locked, err := h.loginGuard.RecordFailure(ctx, r, email)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to record login failure")
+		return false
+	}
+	if !locked {
+		return false
+	}
+
+	if user != nil && h.lockoutNotifier != nil {
+		if err := h.lockoutNotifier.SendUnlockEmail(ctx, user); err != nil {
+			h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to send unlock email")
+		}
+	}
+	h.sendThrottledResponse(w, h.loginGuard.LockoutDuration())
+	return true
+}
+
+func (h *AuthHandler) resetLoginGuard(ctx context.Context, user *models.User) {
+	if h.loginGuard == nil {
+		return
+	}
+	if err := h.loginGuard.Reset(ctx, user.Email); err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to reset login throttle")
+	}
+}
+
+func (h *AuthHandler) sendThrottledResponse(w http.ResponseWriter, wait time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int((wait+time.Second-1)/time.Second)))
+	h.sendErrorResponse(w, http.StatusTooManyRequests, "Too many failed login attempts, try again later")
+}
+
+// startSession issues an access token and a refresh token in a new family
+// for a user who has just authenticated with r. The family ID doubles as
+// the session ID.
+func (h *AuthHandler) startSession(ctx context.Context, r *http.Request, user *models.User) (*middleware.LoginResponse, error) {
+	subject, err := h.tokenSubject(ctx, user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user roles: %w", err)
+	}
+
+	familyID, err := generateFamilyID()
+	if err != nil {
+		return nil, err
+	}
+	subject.SessionID = familyID
+
+	if h.sessions != nil {
+		if _, err := h.sessions.Start(ctx, r, user.ID, familyID); err != nil {
+			return nil, fmt.Errorf("failed to record session: %w", err)
+		}
+	}
+
+	token, expiresAt, err := h.authService.GenerateToken(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshHash, refreshExpiresAt, err := h.authService.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = h.refreshTokenRepo.CreateRefreshToken(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: refreshHash,
+		ExpiresAt: refreshExpiresAt,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &middleware.LoginResponse{
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+		User: middleware.UserInfo{
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Roles:    subject.Roles,
+		},
+	}, nil
+}
+
 func (h *AuthHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
-	// Get user info from context (set by auth middleware)
-	userID, ok := middleware.GetUserIDFromContext(r.Context())
-	if !ok {
-		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	// Browsers in cookie auth mode send the refresh token as a cookie and
+	// may post no body at all
+	var req middleware.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error().Err(err).Msg("Failed to decode refresh request")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		token, err := h.authService.RefreshTokenFromCookie(r)
+		if err != nil {
+			h.sendErrorResponse(w, http.StatusForbidden, "Missing or invalid CSRF token")
+			return
+		}
+		req.RefreshToken = token
+	}
+	if req.RefreshToken == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Refresh token is required")
+		return
+	}
+
+	// Load what the new access token needs before rotating, so that a failed
+	// read leaves the presented token usable for a retry. The rotation below
+	// still decides whether the token is valid.
+	presentedHash := h.authService.HashRefreshToken(req.RefreshToken)
+	presented, err := h.refreshTokenRepo.GetRefreshTokenByHash(ctx, presentedHash)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger, err, "Refresh token", "Failed to refresh token")
+		return
+	}
+
+	// Reload the user so the new access token reflects current account data
+	user, err := h.userRepo.GetUserByID(ctx, presented.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", presented.UserID).Logger(), err, "User", "Failed to refresh token")
 		return
 	}
 
-	username, _ := middleware.GetUsernameFromContext(r.Context())
-	email, _ := middleware.GetEmailFromContext(r.Context())
+	subject, err := h.tokenSubject(ctx, user)
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", user.ID).Logger(), err, "User", "Failed to generate token")
+		return
+	}
 
-	// Generate new token
-	token, expiresAt, err := h.authService.GenerateToken(userID, username, email)
+	refreshToken, refreshHash, refreshExpiresAt, err := h.authService.GenerateRefreshToken()
 	if err != nil {
 		h.logger.Error().Err(err).Msg("Failed to generate refresh token")
 		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
+	// Rotate the presented token; the repository revokes the whole family
+	// if a token that was already rotated is presented again.
+	rotated, err := h.refreshTokenRepo.RotateRefreshToken(ctx, presentedHash, &models.RefreshToken{
+		TokenHash: refreshHash,
+		ExpiresAt: refreshExpiresAt,
+	})
+	switch {
+	case errors.Is(err, repository.ErrRefreshTokenReused):
+		h.logger.Warn().
+			Int("user_id", rotated.UserID).
+			Str("family_id", rotated.FamilyID).
+			Msg("Refresh token reuse detected, revoked token family")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	case errors.Is(err, repository.ErrRefreshTokenNotFound),
+		errors.Is(err, repository.ErrRefreshTokenExpired),
+		errors.Is(err, repository.ErrRefreshTokenRevoked):
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid refresh token")
+		return
+	case err != nil:
+		sendRepositoryError(w, h.logger, err, "Refresh token", "Failed to refresh token")
+		return
+	}
+
+	subject.SessionID = rotated.FamilyID
+	if h.sessions != nil {
+		h.sessions.Touch(rotated.FamilyID)
+	}
+
+	token, expiresAt, err := h.authService.GenerateToken(subject)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to generate token")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
 	response := middleware.LoginResponse{
-		Token:     token,
-		ExpiresAt: expiresAt,
+		Token:            token,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
 		User: middleware.UserInfo{
-			ID:       userID,
-			Username: username,
-			Email:    email,
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Roles:    subject.Roles,
 		},
 	}
 
-	h.sendJSONResponse(w, http.StatusOK, response)
+	if !h.sendLoginResponse(w, r, &response) {
+		return
+	}
 	h.logger.Info().
-		Int("user_id", userID).
-		Str("username", username).
+		Int("user_id", user.ID).
+		Str("username", user.Username).
 		Msg("Token refreshed successfully")
 }
 
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	claims, ok := middleware.GetClaimsFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	// The refresh token is optional; without it only the access token is revoked
+	var req middleware.LogoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.logger.Error().Err(err).Msg("Failed to decode logout request")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if req.RefreshToken == "" {
+		// The middleware has already checked the CSRF token
+		if cookie, err := r.Cookie(middleware.RefreshTokenCookie); err == nil {
+			req.RefreshToken = cookie.Value
+		}
+	}
+
+	if err := h.authService.RevokeToken(ctx, claims); err != nil {
+		h.logger.Error().Err(err).Int("user_id", claims.UserID).Msg("Failed to revoke access token")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	// Ending the session also revokes its refresh tokens and any other
+	// access tokens issued to it.
+	if h.sessions != nil && claims.SessionID != "" {
+		err := h.sessions.Revoke(ctx, claims.SessionID)
+		if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			h.logger.Error().Err(err).Int("user_id", claims.UserID).Msg("Failed to revoke session")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	if req.RefreshToken != "" {
+		refreshToken, err := h.refreshTokenRepo.GetRefreshTokenByHash(ctx, h.authService.HashRefreshToken(req.RefreshToken))
+		if err != nil && !errors.Is(err, repository.ErrRefreshTokenNotFound) {
+			h.logger.Error().Err(err).Int("user_id", claims.UserID).Msg("Failed to look up refresh token")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+
+		if refreshToken != nil && refreshToken.UserID == claims.UserID {
+			if err := h.refreshTokenRepo.RevokeRefreshTokenFamily(ctx, refreshToken.FamilyID); err != nil {
+				h.logger.Error().Err(err).Int("user_id", claims.UserID).Msg("Failed to revoke refresh token")
+				h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to log out")
+				return
+			}
+		}
+	}
+
+	h.authService.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+	h.logger.Info().Int("user_id", claims.UserID).Msg("User logged out")
+}
+
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	claims, ok := middleware.GetClaimsFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.authService.RevokeAllTokens(ctx, claims.UserID); err != nil {
+		h.logger.Error().Err(err).Int("user_id", claims.UserID).Msg("Failed to revoke access tokens")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	if err := h.refreshTokenRepo.RevokeUserRefreshTokens(ctx, claims.UserID); err != nil {
+		h.logger.Error().Err(err).Int("user_id", claims.UserID).Msg("Failed to revoke refresh tokens")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	h.authService.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+	h.logger.Info().Int("user_id", claims.UserID).Msg("User logged out of all sessions")
+}
+
+// CSRFToken returns the CSRF token of the browser session, for frontends on
+// another origin that cannot read the cookie. CORS keeps other sites from
+// reading the response.
+func (h *AuthHandler) CSRFToken(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(middleware.CSRFCookie)
+	if !h.authService.CookieAuthEnabled() || err != nil || cookie.Value == "" {
+		h.sendErrorResponse(w, http.StatusNotFound, "No browser session")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSONResponse(w, http.StatusOK, middleware.CSRFResponse{CSRFToken: cookie.Value})
+}
+
 func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	// Get user info from context (set by auth middleware)
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
@@ -132,8 +646,7 @@ func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.userRepo.GetUserByID(ctx, userID)
 	if err != nil {
-		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to get user profile")
-		h.sendErrorResponse(w, http.StatusNotFound, "User not found")
+		sendRepositoryError(w, h.logger.With().Int("user_id", userID).Logger(), err, "User", "Failed to get user profile")
 		return
 	}
 
@@ -148,6 +661,22 @@ func (h *AuthHandler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	h.sendJSONResponse(w, http.StatusOK, response)
 }
 
+// sendLoginResponse writes the result of a login or refresh, setting the
+// session cookies in cookie auth mode. It returns false if it wrote an
+// error instead.
+func (h *AuthHandler) sendLoginResponse(w http.ResponseWriter, r *http.Request, response interface{}) bool {
+	if login, ok := response.(*middleware.LoginResponse); ok {
+		if _, err := h.authService.SetSessionCookies(w, r, login); err != nil {
+			h.logger.Error().Err(err).Int("user_id", login.User.ID).Msg("Failed to set session cookies")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+			return false
+		}
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+	return true
+}
+
 func (h *AuthHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
@@ -161,4 +690,27 @@ func (h *AuthHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, m
 		Error:   http.StatusText(statusCode),
 		Message: message,
 	})
-}
\ No newline at end of file
+}
+
+// tokenSubject loads the user's current roles for a new access token.
+func (h *AuthHandler) tokenSubject(ctx context.Context, user *models.User) (middleware.TokenSubject, error) {
+	roles, err := h.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return middleware.TokenSubject{}, err
+	}
+
+	return middleware.TokenSubject{
+		UserID:   user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Roles:    middleware.WithDefaultRole(roles),
+	}, nil
+}
+
+func generateFamilyID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
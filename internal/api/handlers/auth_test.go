@@ -0,0 +1,565 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/crypto/bcrypt"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/config"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// Mock refresh token repository for testing
+type mockRefreshTokenRepository struct {
+	tokens map[string]*models.RefreshToken
+	nextID int
+}
+
+func newMockRefreshTokenRepository() *mockRefreshTokenRepository {
+	return &mockRefreshTokenRepository{
+		tokens: make(map[string]*models.RefreshToken),
+	}
+}
+
+func (m *mockRefreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (*models.RefreshToken, error) {
+	m.nextID++
+	token.ID = m.nextID
+	token.CreatedAt = time.Now()
+	m.tokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *mockRefreshTokenRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	if token, exists := m.tokens[tokenHash]; exists {
+		return token, nil
+	}
+	return nil, repository.ErrRefreshTokenNotFound
+}
+
+func (m *mockRefreshTokenRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	current, exists := m.tokens[tokenHash]
+	if !exists || current.ClientID != next.ClientID {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+
+	now := time.Now()
+	switch {
+	case current.RevokedAt != nil:
+		return current, repository.ErrRefreshTokenRevoked
+	case current.UsedAt != nil:
+		m.RevokeRefreshTokenFamily(ctx, current.FamilyID)
+		return current, repository.ErrRefreshTokenReused
+	case !now.Before(current.ExpiresAt):
+		return current, repository.ErrRefreshTokenExpired
+	}
+
+	current.UsedAt = &now
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	next.ParentID = &current.ID
+	if next.Scope == "" {
+		next.Scope = current.Scope
+	}
+	return m.CreateRefreshToken(ctx, next)
+}
+
+func (m *mockRefreshTokenRepository) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockRefreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	now := time.Now()
+	for _, token := range m.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+// Mock token revocation repository for testing
+type mockTokenRevocationRepository struct {
+	revoked    map[string]*models.RevokedToken
+	validAfter map[int]time.Time
+}
+
+func newMockTokenRevocationRepository() *mockTokenRevocationRepository {
+	return &mockTokenRevocationRepository{
+		revoked:    make(map[string]*models.RevokedToken),
+		validAfter: make(map[int]time.Time),
+	}
+}
+
+func (m *mockTokenRevocationRepository) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	m.revoked[token.JTI] = token
+	return nil
+}
+
+func (m *mockTokenRevocationRepository) ListRevokedTokens(ctx context.Context, now time.Time) ([]*models.RevokedToken, error) {
+	var tokens []*models.RevokedToken
+	for _, token := range m.revoked {
+		if token.ExpiresAt.After(now) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (m *mockTokenRevocationRepository) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockTokenRevocationRepository) SetTokensValidAfter(ctx context.Context, userID int, validAfter time.Time) error {
+	m.validAfter[userID] = validAfter
+	return nil
+}
+
+func (m *mockTokenRevocationRepository) ListTokensValidAfter(ctx context.Context, since time.Time) (map[int]time.Time, error) {
+	cutoffs := make(map[int]time.Time)
+	for userID, validAfter := range m.validAfter {
+		if validAfter.After(since) {
+			cutoffs[userID] = validAfter
+		}
+	}
+	return cutoffs, nil
+}
+
+// Mock role repository for testing
+type mockRoleRepository struct {
+	userRoles map[int][]string
+}
+
+func newMockRoleRepository() *mockRoleRepository {
+	return &mockRoleRepository{
+		userRoles: make(map[int][]string),
+	}
+}
+
+func (m *mockRoleRepository) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	return []*models.Role{
+		{ID: 1, Name: "admin", Permissions: []string{"*"}},
+		{ID: 2, Name: "user"},
+	}, nil
+}
+
+func (m *mockRoleRepository) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	return m.userRoles[userID], nil
+}
+
+func (m *mockRoleRepository) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+	for _, role := range roles {
+		if role != "admin" && role != "user" {
+			return repository.ErrRoleNotFound
+		}
+	}
+	m.userRoles[userID] = roles
+	return nil
+}
+
+func newTestAuthHandler(t *testing.T) (*AuthHandler, repository.UserRepository, *mockRefreshTokenRepository) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	userRepo := newTestUserRepository()
+	refreshRepo := newMockRefreshTokenRepository()
+	authService, err := middleware.NewAuthService(config.SecurityConfig{
+		JWTSecret:         "test-secret",
+		JWTExpiration:     900,
+		RefreshTokenTTL:   3600,
+		Argon2Memory:      64,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+	authService.SetRevocationStore(middleware.NewRevocationStore(newMockTokenRevocationRepository(), time.Hour, 15*time.Minute, logger))
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash password: %v", err)
+	}
+	addTestUser(t, userRepo, &models.User{
+		ID:        1,
+		Username:  "testuser",
+		Email:     "test@example.com",
+		Password:  string(hashedPassword),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	})
+
+	return NewAuthHandler(userRepo, refreshRepo, newMockRoleRepository(), newMockMFARepository(), authService, logger), userRepo, refreshRepo
+}
+
+func login(t *testing.T, handler *AuthHandler) middleware.LoginResponse {
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "test@example.com", Password: "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.Login(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected login status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp middleware.LoginResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected login response, got: %s", rr.Body.String())
+	}
+	return resp
+}
+
+func refresh(handler *AuthHandler, refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(middleware.RefreshRequest{RefreshToken: refreshToken})
+	req := httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handler.RefreshToken(rr, req)
+	return rr
+}
+
+func TestAuthHandler_LoginRehashesPassword(t *testing.T) {
+	handler, userRepo, _ := newTestAuthHandler(t)
+	legacyHash := getTestUser(t, userRepo, 1).Password
+
+	login(t, handler)
+	upgraded := getTestUser(t, userRepo, 1).Password
+	if !strings.HasPrefix(upgraded, "$argon2id$") {
+		t.Fatalf("expected bcrypt hash to be upgraded to argon2id, got %q", upgraded)
+	}
+	if upgraded == legacyHash {
+		t.Fatal("expected stored hash to change")
+	}
+
+	// The upgraded hash is current, so it is kept on the next login.
+	login(t, handler)
+	if getTestUser(t, userRepo, 1).Password != upgraded {
+		t.Error("expected a current hash not to be replaced")
+	}
+}
+
+func TestAuthHandler_RehashKeepsChangedPassword(t *testing.T) {
+	handler, userRepo, _ := newTestAuthHandler(t)
+	stale := getTestUser(t, userRepo, 1)
+
+	// The password is reset between the login's check and its rehash
+	changed := getTestUser(t, userRepo, 1)
+	changed.Password = "reset-hash"
+	if _, err := userRepo.UpdateUser(context.Background(), changed); err != nil {
+		t.Fatalf("failed to change password: %v", err)
+	}
+
+	handler.rehashPassword(context.Background(), stale, "password123")
+	if got := getTestUser(t, userRepo, 1).Password; got != "reset-hash" {
+		t.Errorf("expected the reset password to be kept, got %q", got)
+	}
+}
+
+func TestAuthHandler_RefreshTokenRotation(t *testing.T) {
+	handler, _, _ := newTestAuthHandler(t)
+
+	loginResp := login(t, handler)
+	if loginResp.RefreshToken == "" {
+		t.Fatal("expected refresh token in login response")
+	}
+	if len(loginResp.User.Roles) != 1 || loginResp.User.Roles[0] != "user" {
+		t.Errorf("expected default role in login response, got %v", loginResp.User.Roles)
+	}
+
+	rr := refresh(handler, loginResp.RefreshToken)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var refreshResp middleware.LoginResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &refreshResp); err != nil {
+		t.Fatalf("expected login response, got: %s", rr.Body.String())
+	}
+	if refreshResp.RefreshToken == "" || refreshResp.RefreshToken == loginResp.RefreshToken {
+		t.Errorf("expected a new refresh token after rotation")
+	}
+
+	// Replaying the rotated token must fail and revoke the family
+	if rr := refresh(handler, loginResp.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for reused token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := refresh(handler, refreshResp.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for token in revoked family, got %d", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestAuthHandler_RefreshToken(t *testing.T) {
+	handler, _, _ := newTestAuthHandler(t)
+
+	tests := []struct {
+		name           string
+		refreshToken   string
+		expectedStatus int
+	}{
+		{
+			name:           "missing refresh token",
+			refreshToken:   "",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown refresh token",
+			refreshToken:   "not-a-real-token",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := refresh(handler, tt.refreshToken)
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+
+			var errorResp ErrorResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &errorResp); err != nil {
+				t.Errorf("expected error response, got: %s", rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestAuthHandler_DatabaseUnavailable(t *testing.T) {
+	handler, userRepo, _ := newTestAuthHandler(t)
+	session := login(t, handler)
+	handler.userRepo = unavailableUserRepository{userRepo}
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	rr := httptest.NewRecorder()
+	middleware.AuthMiddleware(handler.authService)(http.HandlerFunc(handler.GetProfile)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected profile status %d, got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	}
+
+	if rr := refresh(handler, session.RefreshToken); rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected refresh status %d, got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	}
+
+	mfaToken, _, err := handler.authService.GenerateMFAToken(1)
+	if err != nil {
+		t.Fatalf("failed to generate MFA token: %v", err)
+	}
+	rr = postJSON(http.HandlerFunc(handler.LoginMFA), "/auth/login/mfa", "", middleware.MFALoginRequest{MFAToken: mfaToken, Code: "123456"})
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected MFA login status %d, got %d: %s", http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+	}
+
+	// The failed refresh must not have used up the token
+	handler.userRepo = userRepo
+	if rr := refresh(handler, session.RefreshToken); rr.Code != http.StatusOK {
+		t.Errorf("expected the retried refresh to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	handler, _, _ := newTestAuthHandler(t)
+	protected := middleware.AuthMiddleware(handler.authService)
+
+	tests := []struct {
+		name   string
+		logout http.HandlerFunc
+	}{
+		{name: "logout", logout: handler.Logout},
+		{name: "logout everywhere", logout: handler.LogoutAll},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loginResp := login(t, handler)
+
+			body, _ := json.Marshal(middleware.LogoutRequest{RefreshToken: loginResp.RefreshToken})
+			req := httptest.NewRequest(http.MethodPost, "/auth/logout", bytes.NewBuffer(body))
+			req.Header.Set("Authorization", "Bearer "+loginResp.Token)
+			rr := httptest.NewRecorder()
+			protected(tt.logout).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusNoContent {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+			}
+
+			// The access token must now be rejected
+			req = httptest.NewRequest(http.MethodGet, "/auth/profile", nil)
+			req.Header.Set("Authorization", "Bearer "+loginResp.Token)
+			rr = httptest.NewRecorder()
+			protected(http.HandlerFunc(handler.GetProfile)).ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d for revoked token, got %d", http.StatusUnauthorized, rr.Code)
+			}
+
+			// And so must the refresh token
+			if rr := refresh(handler, loginResp.RefreshToken); rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d for revoked refresh token, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_LogoutAllRevokesOtherDevices(t *testing.T) {
+	handler, _, _ := newTestAuthHandler(t)
+	protected := middleware.AuthMiddleware(handler.authService)
+
+	// Both logins land in the same second as the logout, which the cutoff
+	// must still cover.
+	caller := login(t, handler)
+	other := login(t, handler)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/logout-all", nil)
+	req.Header.Set("Authorization", "Bearer "+caller.Token)
+	rr := httptest.NewRecorder()
+	protected(http.HandlerFunc(handler.LogoutAll)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+other.Token)
+	rr = httptest.NewRecorder()
+	protected(http.HandlerFunc(handler.GetProfile)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d for the other device's token, got %d", http.StatusUnauthorized, rr.Code)
+	}
+
+	// Logging in again right away works: the cutoff is kept to the
+	// millisecond, which only a login within the same one would share.
+	time.Sleep(2 * time.Millisecond)
+	again := login(t, handler)
+	req = httptest.NewRequest(http.MethodGet, "/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+again.Token)
+	rr = httptest.NewRecorder()
+	protected(http.HandlerFunc(handler.GetProfile)).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a fresh login to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+// withCookies copies the cookies set on rr onto req, as a browser would.
+func withCookies(req *http.Request, rr *httptest.ResponseRecorder) *http.Request {
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+	return req
+}
+
+func TestAuthHandler_CookieSession(t *testing.T) {
+	handler, _, _ := newTestAuthHandler(t)
+	authService := handler.authService
+	authService.SetCookieConfig(&middleware.CookieConfig{Secure: true, SameSite: http.SameSiteLaxMode, RefreshPath: "/api/v1/auth"})
+
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "test@example.com", Password: "password123"})
+	loginRR := httptest.NewRecorder()
+	handler.Login(loginRR, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body)))
+	if loginRR.Code != http.StatusOK {
+		t.Fatalf("expected login status %d, got %d: %s", http.StatusOK, loginRR.Code, loginRR.Body.String())
+	}
+
+	csrf := loginRR.Header().Get(middleware.CSRFHeader)
+	if csrf == "" {
+		t.Fatal("expected the CSRF token in the response header")
+	}
+	cookies := make(map[string]*http.Cookie)
+	for _, cookie := range loginRR.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+		if !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+			t.Errorf("expected cookie %s to be Secure and SameSite=Lax", cookie.Name)
+		}
+	}
+	if c := cookies[middleware.AccessTokenCookie]; c == nil || !c.HttpOnly {
+		t.Error("expected an HttpOnly access token cookie")
+	}
+	if c := cookies[middleware.RefreshTokenCookie]; c == nil || !c.HttpOnly || c.Path != "/api/v1/auth" {
+		t.Error("expected an HttpOnly refresh token cookie limited to the auth endpoints")
+	}
+	if c := cookies[middleware.CSRFCookie]; c == nil || c.HttpOnly || c.Value != csrf {
+		t.Error("expected a readable CSRF cookie matching the header")
+	}
+
+	serve := func(method, csrfHeader string) int {
+		req := withCookies(httptest.NewRequest(method, "/", nil), loginRR)
+		if csrfHeader != "" {
+			req.Header.Set(middleware.CSRFHeader, csrfHeader)
+		}
+		rr := httptest.NewRecorder()
+		middleware.AuthMiddleware(authService)(http.HandlerFunc(handler.GetProfile)).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve(http.MethodGet, ""); code != http.StatusOK {
+		t.Errorf("expected cookie GET to be accepted, got %d", code)
+	}
+	if code := serve(http.MethodPost, ""); code != http.StatusForbidden {
+		t.Errorf("expected cookie POST without CSRF token to be forbidden, got %d", code)
+	}
+	if code := serve(http.MethodPost, "forged"); code != http.StatusForbidden {
+		t.Errorf("expected cookie POST with a wrong CSRF token to be forbidden, got %d", code)
+	}
+	if code := serve(http.MethodPost, csrf); code != http.StatusOK {
+		t.Errorf("expected cookie POST with CSRF token to be accepted, got %d", code)
+	}
+
+	// The refresh token cookie also needs the CSRF token, and refreshing keeps it.
+	refreshRR := httptest.NewRecorder()
+	handler.RefreshToken(refreshRR, withCookies(httptest.NewRequest(http.MethodPost, "/auth/refresh", nil), loginRR))
+	if refreshRR.Code != http.StatusForbidden {
+		t.Errorf("expected cookie refresh without CSRF token to be forbidden, got %d", refreshRR.Code)
+	}
+	req := withCookies(httptest.NewRequest(http.MethodPost, "/auth/refresh", nil), loginRR)
+	req.Header.Set(middleware.CSRFHeader, csrf)
+	refreshRR = httptest.NewRecorder()
+	handler.RefreshToken(refreshRR, req)
+	if refreshRR.Code != http.StatusOK {
+		t.Fatalf("expected cookie refresh to succeed, got %d: %s", refreshRR.Code, refreshRR.Body.String())
+	}
+	if refreshRR.Header().Get(middleware.CSRFHeader) != csrf {
+		t.Error("expected refresh to keep the CSRF token")
+	}
+
+	// Logging out revokes the refresh token from the cookie and clears the cookies.
+	req = withCookies(httptest.NewRequest(http.MethodPost, "/auth/logout", nil), refreshRR)
+	req.AddCookie(&http.Cookie{Name: middleware.CSRFCookie, Value: csrf})
+	req.Header.Set(middleware.CSRFHeader, csrf)
+	logoutRR := httptest.NewRecorder()
+	middleware.AuthMiddleware(authService)(http.HandlerFunc(handler.Logout)).ServeHTTP(logoutRR, req)
+	if logoutRR.Code != http.StatusNoContent {
+		t.Fatalf("expected logout to succeed, got %d: %s", logoutRR.Code, logoutRR.Body.String())
+	}
+	for _, cookie := range logoutRR.Result().Cookies() {
+		if cookie.MaxAge >= 0 {
+			t.Errorf("expected cookie %s to be cleared", cookie.Name)
+		}
+	}
+	var refreshed middleware.LoginResponse
+	json.Unmarshal(refreshRR.Body.Bytes(), &refreshed)
+	if rr := refresh(handler, refreshed.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the logged out refresh token to be rejected, got %d", rr.Code)
+	}
+}
+
+func TestAuthHandler_BearerNeedsNoCSRF(t *testing.T) {
+	handler, _, _ := newTestAuthHandler(t)
+	handler.authService.SetCookieConfig(&middleware.CookieConfig{SameSite: http.SameSiteLaxMode, RefreshPath: "/"})
+	session := login(t, handler)
+
+	rr := serveAuthenticated(handler.authService, handler.GetProfile, http.MethodPost, session.Token, nil)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected bearer POST to be accepted without CSRF token, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
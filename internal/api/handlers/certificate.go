@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// CertificateHandler manages which client certificates authenticate as
+// which service account or user.
+type CertificateHandler struct {
+	bindingRepo repository.CertificateBindingRepository
+	apiKeyRepo  repository.APIKeyRepository
+	userRepo    repository.UserRepository
+	roleRepo    repository.RoleRepository
+	authService *middleware.AuthService
+	logger      zerolog.Logger
+}
+
+// CreateCertificateBindingRequest binds Identity to exactly one of a service
+// account, with Scopes, or a user.
+type CreateCertificateBindingRequest struct {
+	Identity         string   `json:"identity"`
+	ServiceAccountID *int     `json:"service_account_id,omitempty"`
+	UserID           *int     `json:"user_id,omitempty"`
+	Scopes           []string `json:"scopes,omitempty"`
+}
+
+func NewCertificateHandler(bindingRepo repository.CertificateBindingRepository, apiKeyRepo repository.APIKeyRepository, userRepo repository.UserRepository,
+	roleRepo repository.RoleRepository, authService *middleware.AuthService, logger zerolog.Logger) *CertificateHandler {
+	return &CertificateHandler{
+		bindingRepo: bindingRepo,
+		apiKeyRepo:  apiKeyRepo,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		authService: authService,
+		logger:      logger,
+	}
+}
+
+func (h *CertificateHandler) CreateBinding(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req CreateCertificateBindingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode request body")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	identity, err := middleware.NormalizeCertificateIdentity(req.Identity)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if (req.ServiceAccountID == nil) == (req.UserID == nil) {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Exactly one of service_account_id and user_id is required")
+		return
+	}
+
+	principal, _ := middleware.GetPrincipalFromContext(r.Context())
+	binding := &models.CertificateBinding{
+		Identity:         identity,
+		ServiceAccountID: req.ServiceAccountID,
+		UserID:           req.UserID,
+		Scopes:           []string{},
+	}
+	if principal != nil && principal.Type == middleware.PrincipalUser {
+		binding.CreatedBy = &principal.ID
+	}
+
+	// Nobody can hand out access they do not hold themselves
+	if req.ServiceAccountID != nil {
+		scopes := uniqueStrings(req.Scopes)
+		if len(scopes) == 0 {
+			h.sendErrorResponse(w, http.StatusBadRequest, "at least one scope is required")
+			return
+		}
+		for _, scope := range scopes {
+			if principal == nil || !middleware.HasPermission(principal.Permissions, scope) {
+				h.sendErrorResponse(w, http.StatusBadRequest, "cannot grant scope "+scope)
+				return
+			}
+		}
+		binding.Scopes = scopes
+
+		account, err := h.apiKeyRepo.GetServiceAccountByID(ctx, *req.ServiceAccountID)
+		if errors.Is(err, repository.ErrServiceAccountNotFound) {
+			h.sendErrorResponse(w, http.StatusNotFound, "Service account not found")
+			return
+		}
+		if err != nil {
+			h.logger.Error().Err(err).Int("service_account_id", *req.ServiceAccountID).Msg("Failed to get service account")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create certificate binding")
+			return
+		}
+		binding.PrincipalName = account.Name
+	} else {
+		if len(req.Scopes) > 0 {
+			h.sendErrorResponse(w, http.StatusBadRequest, "Users act with their roles; scopes are only for service accounts")
+			return
+		}
+
+		user, err := h.userRepo.GetUserByID(ctx, *req.UserID)
+		if err != nil {
+			sendRepositoryError(w, h.logger.With().Int("user_id", *req.UserID).Logger(), err, "User", "Failed to create certificate binding")
+			return
+		}
+		roles, err := h.roleRepo.GetUserRoles(ctx, user.ID)
+		if err != nil {
+			h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to get user roles")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create certificate binding")
+			return
+		}
+		if principal == nil || !h.authService.CanActAs(principal, middleware.WithDefaultRole(roles)) {
+			h.sendErrorResponse(w, http.StatusForbidden, "Cannot bind a certificate to a user with more privileges")
+			return
+		}
+		binding.PrincipalName = user.Username
+	}
+
+	if err := h.bindingRepo.CreateCertificateBinding(ctx, binding); err != nil {
+		if errors.Is(err, repository.ErrCertificateBindingExists) {
+			h.sendErrorResponse(w, http.StatusConflict, "Certificate identity is already bound")
+			return
+		}
+		h.logger.Error().Err(err).Str("identity", identity).Msg("Failed to create certificate binding")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create certificate binding")
+		return
+	}
+
+	h.logger.Info().
+		Int("binding_id", binding.ID).
+		Str("identity", binding.Identity).
+		Str("principal", binding.PrincipalName).
+		Strs("scopes", binding.Scopes).
+		Msg("Certificate binding created")
+	h.sendJSONResponse(w, http.StatusCreated, binding)
+}
+
+func (h *CertificateHandler) ListBindings(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	bindings, err := h.bindingRepo.ListCertificateBindings(ctx)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list certificate bindings")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list certificate bindings")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, bindings)
+}
+
+func (h *CertificateHandler) DeleteBinding(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid certificate binding ID")
+		return
+	}
+
+	if err := h.bindingRepo.DeleteCertificateBinding(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrCertificateBindingNotFound) {
+			h.sendErrorResponse(w, http.StatusNotFound, "Certificate binding not found")
+			return
+		}
+		h.logger.Error().Err(err).Int("binding_id", id).Msg("Failed to delete certificate binding")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete certificate binding")
+		return
+	}
+
+	h.logger.Info().Int("binding_id", id).Msg("Certificate binding deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *CertificateHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *CertificateHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
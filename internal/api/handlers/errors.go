@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/repository"
+)
+
+// retryAfterSeconds is how long clients are asked to wait when the database
+// is unavailable.
+const retryAfterSeconds = "5"
+
+// sendRepositoryError responds to an error from a repository: 404 if the
+// record does not exist, 409 if a write conflicts with another record, 503
+// if the database is unavailable, and 500 with the failure message for
+// anything else. resource names the record in messages, e.g. "User".
+func sendRepositoryError(w http.ResponseWriter, logger zerolog.Logger, err error, resource, failure string) {
+	status := http.StatusInternalServerError
+	response := ErrorResponse{Message: failure}
+
+	var conflict *repository.ErrConflict
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		status, response.Message = http.StatusNotFound, resource+" not found"
+	case errors.As(err, &conflict):
+		status, response.Field = http.StatusConflict, conflict.Field
+		response.Message = resource + " conflicts with an existing one"
+		if conflict.Field != "" {
+			response.Message = fmt.Sprintf("%s with this %s already exists", resource, conflict.Field)
+		}
+	case errors.Is(err, repository.ErrUnavailable):
+		logger.Warn().Err(err).Msg(failure)
+		status, response.Message = http.StatusServiceUnavailable, "The database is temporarily unavailable, please retry"
+		w.Header().Set("Retry-After", retryAfterSeconds)
+	default:
+		logger.Error().Err(err).Msg(failure)
+	}
+
+	response.Error = http.StatusText(status)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/repository"
+)
+
+func TestSendRepositoryError(t *testing.T) {
+	tests := []struct {
+		err        error
+		status     int
+		message    string
+		field      string
+		retryAfter bool
+	}{
+		{repository.ErrUserNotFound, http.StatusNotFound, "User not found", "", false},
+		{&repository.ErrConflict{Field: "email"}, http.StatusConflict, "User with this email already exists", "email", false},
+		{&repository.ErrConflict{}, http.StatusConflict, "User conflicts with an existing one", "", false},
+		{fmt.Errorf("%w: connection refused", repository.ErrUnavailable), http.StatusServiceUnavailable, "The database is temporarily unavailable, please retry", "", true},
+		{errors.New("syntax error"), http.StatusInternalServerError, "Failed to get user", "", false},
+	}
+
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		sendRepositoryError(rr, zerolog.Nop(), tt.err, "User", "Failed to get user")
+
+		var response ErrorResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatalf("%v: invalid body: %v", tt.err, err)
+		}
+		if rr.Code != tt.status || response.Error != http.StatusText(tt.status) || response.Message != tt.message || response.Field != tt.field {
+			t.Errorf("%v: unexpected response %d %+v", tt.err, rr.Code, response)
+		}
+		if (rr.Header().Get("Retry-After") != "") != tt.retryAfter {
+			t.Errorf("%v: unexpected Retry-After %q", tt.err, rr.Header().Get("Retry-After"))
+		}
+	}
+}
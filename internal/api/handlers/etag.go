@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"remus_synerge/internal/models"
+)
+
+// userETag is the strong entity tag of a user, derived from its version.
+func userETag(user *models.User) string {
+	return `"` + strconv.Itoa(user.Version) + `"`
+}
+
+// etagMatches reports whether an If-Match or If-None-Match header value
+// lists etag or is "*". If-Match uses strong comparison, so a weak tag
+// (W/"...") only matches when weak is set, as for If-None-Match.
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
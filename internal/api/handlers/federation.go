@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/config"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/oidc"
+)
+
+const (
+	loginStateCookie = "oidc_state"
+	loginStateTTL    = 10 * time.Minute
+)
+
+var (
+	errSignupDisabled   = errors.New("signup through this provider is disabled")
+	errEmailNotVerified = errors.New("provider did not assert a verified email")
+)
+
+// FederationHandler signs users in through upstream OpenID Connect providers.
+// Sessions are started exactly as for a password login.
+type FederationHandler struct {
+	auth         *AuthHandler
+	identityRepo repository.IdentityRepository
+	connectors   map[string]*connector
+	names        []string
+	httpClient   *http.Client
+	logger       zerolog.Logger
+}
+
+// connector discovers its provider on first use, so that a provider being
+// unreachable at startup only breaks logins through that provider.
+type connector struct {
+	config   config.OIDCProviderConfig
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+type FederatedProvider struct {
+	Name     string `json:"name"`
+	LoginURL string `json:"login_url"`
+}
+
+func NewFederationHandler(auth *AuthHandler, identityRepo repository.IdentityRepository, providers []config.OIDCProviderConfig, logger zerolog.Logger) *FederationHandler {
+	h := &FederationHandler{
+		auth:         auth,
+		identityRepo: identityRepo,
+		connectors:   make(map[string]*connector),
+		httpClient:   &http.Client{Timeout: 10 * time.Second},
+		logger:       logger,
+	}
+	for _, provider := range providers {
+		h.connectors[provider.Name] = &connector{config: provider}
+		h.names = append(h.names, provider.Name)
+	}
+	return h
+}
+
+func (c *connector) discover(ctx context.Context, client *http.Client) (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.provider != nil {
+		return c.provider, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       c.config.Issuer,
+		ClientID:     c.config.ClientID,
+		ClientSecret: c.config.ClientSecret,
+		RedirectURL:  c.config.RedirectURL,
+		Scopes:       c.config.Scopes,
+	}, client)
+	if err != nil {
+		return nil, err
+	}
+	c.provider = provider
+	return provider, nil
+}
+
+func (h *FederationHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []FederatedProvider{}
+	for _, name := range h.names {
+		providers = append(providers, FederatedProvider{
+			Name:     name,
+			LoginURL: "/api/v1/auth/oidc/" + name + "/login",
+		})
+	}
+	h.sendJSONResponse(w, http.StatusOK, providers)
+}
+
+// Login redirects the browser to the provider. State, nonce and the PKCE
+// verifier travel in a signed cookie scoped to the callback.
+func (h *FederationHandler) Login(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	c, exists := h.connectors[mux.Vars(r)["provider"]]
+	if !exists {
+		h.sendErrorResponse(w, http.StatusNotFound, "Unknown identity provider")
+		return
+	}
+
+	provider, err := c.discover(ctx, h.httpClient)
+	if err != nil {
+		h.logger.Error().Err(err).Str("provider", c.config.Name).Msg("OIDC discovery failed")
+		h.sendErrorResponse(w, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+
+	claims := &middleware.LoginStateClaims{Provider: c.config.Name}
+	for _, value := range []*string{&claims.State, &claims.Nonce, &claims.Verifier} {
+		if *value, err = oidc.RandomString(32); err != nil {
+			h.logger.Error().Err(err).Msg("Failed to generate login state")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to start login")
+			return
+		}
+	}
+
+	stateToken, err := h.auth.authService.GenerateLoginState(claims, loginStateTTL)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to sign login state")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to start login")
+		return
+	}
+
+	http.SetCookie(w, h.stateCookie(c, stateToken, int(loginStateTTL.Seconds())))
+	http.Redirect(w, r, provider.AuthCodeURL(claims.State, claims.Nonce, oidc.CodeChallenge(claims.Verifier)), http.StatusFound)
+}
+
+// Callback completes the login and responds like the password login,
+// including the two-factor challenge for users who enabled it.
+func (h *FederationHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	c, exists := h.connectors[mux.Vars(r)["provider"]]
+	if !exists {
+		h.sendErrorResponse(w, http.StatusNotFound, "Unknown identity provider")
+		return
+	}
+
+	// The state is single use whatever the outcome.
+	http.SetCookie(w, h.stateCookie(c, "", -1))
+
+	query := r.URL.Query()
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.logger.Warn().Str("provider", c.config.Name).Str("error", providerErr).
+			Str("description", query.Get("error_description")).Msg("Provider rejected login")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Login was rejected by the identity provider")
+		return
+	}
+
+	cookie, err := r.Cookie(loginStateCookie)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Missing login state")
+		return
+	}
+	state, err := h.auth.authService.ValidateLoginState(cookie.Value)
+	if err != nil || state.Provider != c.config.Name ||
+		subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid login state")
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Missing authorization code")
+		return
+	}
+
+	provider, err := c.discover(ctx, h.httpClient)
+	if err != nil {
+		h.logger.Error().Err(err).Str("provider", c.config.Name).Msg("OIDC discovery failed")
+		h.sendErrorResponse(w, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+
+	token, err := provider.Exchange(ctx, code, state.Verifier)
+	if err != nil {
+		h.logger.Error().Err(err).Str("provider", c.config.Name).Msg("Failed to exchange authorization code")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Failed to authenticate with the identity provider")
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, state.Nonce)
+	if err != nil {
+		h.logger.Error().Err(err).Str("provider", c.config.Name).Msg("Invalid ID token")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Failed to authenticate with the identity provider")
+		return
+	}
+
+	user, err := h.resolveUser(ctx, c, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errSignupDisabled):
+			h.sendErrorResponse(w, http.StatusForbidden, "No account is linked to this identity")
+		case errors.Is(err, errEmailNotVerified):
+			h.sendErrorResponse(w, http.StatusForbidden, "The identity provider did not verify your email address")
+		default:
+			sendRepositoryError(w, h.logger.With().Str("provider", c.config.Name).Str("subject", claims.Subject).Logger(), err, "User", "Failed to sign in")
+		}
+		return
+	}
+
+	response, err := h.auth.completeLogin(ctx, r, user)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to start session")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	if !h.auth.sendLoginResponse(w, r, response) {
+		return
+	}
+	h.logger.Info().
+		Int("user_id", user.ID).
+		Str("provider", c.config.Name).
+		Str("subject", claims.Subject).
+		Msg("User logged in through identity provider")
+}
+
+// ListIdentities returns the provider identities linked to the caller.
+func (h *FederationHandler) ListIdentities(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	identities, err := h.identityRepo.ListUserIdentities(ctx, userID)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to list identities")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list identities")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, identities)
+}
+
+// resolveUser finds the user for a verified ID token. A linked identity
+// always wins. Otherwise the identity is linked to the user with the same
+// email, which requires the provider to have verified that email, or a new
+// user is provisioned if the provider allows signup.
+func (h *FederationHandler) resolveUser(ctx context.Context, c *connector, claims *oidc.Claims) (*models.User, error) {
+	now := time.Now()
+
+	identity, err := h.identityRepo.GetIdentity(ctx, c.config.Name, claims.Subject)
+	if err == nil {
+		if err := h.identityRepo.UpdateIdentityLogin(ctx, identity.ID, claims.Email, now); err != nil {
+			h.logger.Warn().Err(err).Int("identity_id", identity.ID).Msg("Failed to record identity login")
+		}
+		return h.auth.userRepo.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+
+	user, err := h.auth.userRepo.GetUserByEmail(ctx, claims.Email)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		if !c.config.AllowSignup {
+			return nil, errSignupDisabled
+		}
+		if user, err = h.provisionUser(ctx, claims); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	err = h.identityRepo.CreateIdentity(ctx, &models.UserIdentity{
+		UserID:      user.ID,
+		Provider:    c.config.Name,
+		Subject:     claims.Subject,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	})
+	if errors.Is(err, repository.ErrIdentityExists) {
+		// A concurrent login linked the identity first.
+		identity, err := h.identityRepo.GetIdentity(ctx, c.config.Name, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+		return h.auth.userRepo.GetUserByID(ctx, identity.UserID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.logger.Info().Int("user_id", user.ID).Str("provider", c.config.Name).Str("subject", claims.Subject).Msg("Linked federated identity")
+	return user, nil
+}
+
+// provisionUser creates a user without a password, so that it can only sign
+// in through a provider until a password is set.
+func (h *FederationHandler) provisionUser(ctx context.Context, claims *oidc.Claims) (*models.User, error) {
+	// Only provider-verified addresses get here, so the user starts verified.
+	now := time.Now()
+	newUser := func(username string) *models.User {
+		return &models.User{
+			Username:        username,
+			Email:           claims.Email,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+			EmailVerifiedAt: &now,
+		}
+	}
+
+	username := federatedUsername(claims)
+	user, err := h.auth.userRepo.CreateUser(ctx, newUser(username))
+	var conflict *repository.ErrConflict
+	if errors.As(err, &conflict) && conflict.Field == "username" {
+		// Retry once with a suffix
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return nil, err
+		}
+		if len(username) > 43 {
+			username = username[:43]
+		}
+		username += "-" + hex.EncodeToString(suffix)
+		user, err = h.auth.userRepo.CreateUser(ctx, newUser(username))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	h.logger.Info().Int("user_id", user.ID).Str("username", user.Username).Msg("Provisioned federated user")
+	return user, nil
+}
+
+// federatedUsername derives a username from the preferred username or the
+// local part of the email, limited to characters that are safe everywhere.
+func federatedUsername(claims *oidc.Claims) string {
+	candidate := claims.PreferredUsername
+	if candidate == "" {
+		candidate, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(candidate) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+	}
+
+	username := b.String()
+	if len(username) > 50 {
+		username = username[:50]
+	}
+	for len(username) < 3 {
+		username += "_"
+	}
+	return username
+}
+
+func (h *FederationHandler) stateCookie(c *connector, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     loginStateCookie,
+		Value:    value,
+		Path:     "/api/v1/auth/oidc/" + c.config.Name + "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(c.config.RedirectURL, "https://"),
+		// Lax so the cookie is sent on the top-level redirect back from the
+		// provider.
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+func (h *FederationHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *FederationHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
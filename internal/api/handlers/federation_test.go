@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/config"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/oidc/oidctest"
+)
+
+// Mock identity repository for testing
+type mockIdentityRepository struct {
+	identities map[int]*models.UserIdentity
+}
+
+func newMockIdentityRepository() *mockIdentityRepository {
+	return &mockIdentityRepository{identities: make(map[int]*models.UserIdentity)}
+}
+
+func (m *mockIdentityRepository) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	if _, err := m.GetIdentity(ctx, identity.Provider, identity.Subject); err == nil {
+		return repository.ErrIdentityExists
+	}
+	identity.ID = len(m.identities) + 1
+	m.identities[identity.ID] = identity
+	return nil
+}
+
+func (m *mockIdentityRepository) GetIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	for _, identity := range m.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, repository.ErrIdentityNotFound
+}
+
+func (m *mockIdentityRepository) ListUserIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	identities := []*models.UserIdentity{}
+	for _, identity := range m.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (m *mockIdentityRepository) UpdateIdentityLogin(ctx context.Context, id int, email string, loginAt time.Time) error {
+	identity, exists := m.identities[id]
+	if !exists {
+		return repository.ErrIdentityNotFound
+	}
+	identity.Email = email
+	identity.LastLoginAt = &loginAt
+	return nil
+}
+
+type federationTestEnv struct {
+	handler      *FederationHandler
+	issuer       *oidctest.Issuer
+	userRepo     repository.UserRepository
+	identityRepo *mockIdentityRepository
+}
+
+func newFederationTestEnv(t *testing.T) *federationTestEnv {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	issuer := oidctest.NewIssuer("remus", "upstream-secret")
+	t.Cleanup(issuer.Close)
+
+	authService, err := middleware.NewAuthService(config.SecurityConfig{JWTExpiration: 900, RefreshTokenTTL: 3600, Development: true}, logger)
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+
+	userRepo := newTestUserRepository()
+	addTestUser(t, userRepo, &models.User{ID: 1, Username: "testuser", Email: "test@example.com"})
+	identityRepo := newMockIdentityRepository()
+
+	providers := []config.OIDCProviderConfig{}
+	for _, name := range []string{"corp", "partner"} {
+		providers = append(providers, config.OIDCProviderConfig{
+			Name:         name,
+			Issuer:       issuer.URL,
+			ClientID:     issuer.ClientID,
+			ClientSecret: issuer.ClientSecret,
+			RedirectURL:  "http://localhost:8080/api/v1/auth/oidc/" + name + "/callback",
+			Scopes:       []string{"openid", "email", "profile"},
+			AllowSignup:  name == "corp",
+		})
+	}
+
+	authHandler := NewAuthHandler(userRepo, newMockRefreshTokenRepository(), newMockRoleRepository(), newMockMFARepository(), authService, logger)
+	return &federationTestEnv{
+		handler:      NewFederationHandler(authHandler, identityRepo, providers, logger),
+		issuer:       issuer,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+	}
+}
+
+// login runs the browser side of a federated login: it follows the redirect
+// to the fake issuer and returns the callback request the issuer sends back.
+func (env *federationTestEnv) login(t *testing.T, provider string, user oidctest.User) *http.Request {
+	env.issuer.SetUser(user)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/"+provider+"/login", nil)
+	req = mux.SetURLVars(req, map[string]string{"provider": provider})
+	rr := httptest.NewRecorder()
+	env.handler.Login(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected redirect to provider, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("authorization request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("expected redirect to callback, got %d", resp.StatusCode)
+	}
+
+	callbackReq := httptest.NewRequest(http.MethodGet, callback.RequestURI(), nil)
+	callbackReq = mux.SetURLVars(callbackReq, map[string]string{"provider": provider})
+	for _, cookie := range rr.Result().Cookies() {
+		callbackReq.AddCookie(cookie)
+	}
+	return callbackReq
+}
+
+func (env *federationTestEnv) callback(req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	env.handler.Callback(rr, req)
+	return rr
+}
+
+func TestFederationHandler_Callback(t *testing.T) {
+	tests := []struct {
+		name           string
+		provider       string
+		user           oidctest.User
+		expectedStatus int
+		expectedUserID int
+	}{
+		{
+			name:           "provisions new user",
+			provider:       "corp",
+			user:           oidctest.User{Subject: "emp-100", Email: "new.hire@example.com", EmailVerified: true, PreferredUsername: "New.Hire"},
+			expectedStatus: http.StatusOK,
+			expectedUserID: 2,
+		},
+		{
+			name:           "links existing user by verified email",
+			provider:       "corp",
+			user:           oidctest.User{Subject: "emp-1", Email: "test@example.com", EmailVerified: true},
+			expectedStatus: http.StatusOK,
+			expectedUserID: 1,
+		},
+		{
+			name:           "does not link unverified email",
+			provider:       "corp",
+			user:           oidctest.User{Subject: "emp-1", Email: "test@example.com"},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "signup disabled",
+			provider:       "partner",
+			user:           oidctest.User{Subject: "ext-7", Email: "someone@partner.example", EmailVerified: true},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "signup disabled still links existing user",
+			provider:       "partner",
+			user:           oidctest.User{Subject: "ext-1", Email: "test@example.com", EmailVerified: true},
+			expectedStatus: http.StatusOK,
+			expectedUserID: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newFederationTestEnv(t)
+
+			rr := env.callback(env.login(t, tt.provider, tt.user))
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				if len(env.identityRepo.identities) != 0 {
+					t.Errorf("expected no linked identity, got %d", len(env.identityRepo.identities))
+				}
+				return
+			}
+
+			var response middleware.LoginResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if response.Token == "" || response.RefreshToken == "" {
+				t.Error("expected access and refresh tokens")
+			}
+			if response.User.ID != tt.expectedUserID {
+				t.Errorf("expected user %d, got %d", tt.expectedUserID, response.User.ID)
+			}
+
+			identity, err := env.identityRepo.GetIdentity(context.Background(), tt.provider, tt.user.Subject)
+			if err != nil || identity.UserID != tt.expectedUserID {
+				t.Errorf("expected identity linked to user %d, got %+v", tt.expectedUserID, identity)
+			}
+		})
+	}
+}
+
+func TestFederationHandler_LinkedIdentityWins(t *testing.T) {
+	env := newFederationTestEnv(t)
+
+	user := oidctest.User{Subject: "emp-1", Email: "test@example.com", EmailVerified: true}
+	if rr := env.callback(env.login(t, "corp", user)); rr.Code != http.StatusOK {
+		t.Fatalf("expected first login to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The provider now reports another, unverified address for the same
+	// subject; the existing link must still be used.
+	user.Email = "renamed@example.com"
+	user.EmailVerified = false
+	rr := env.callback(env.login(t, "corp", user))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected second login to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var response middleware.LoginResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.User.ID != 1 {
+		t.Errorf("expected user 1, got %d", response.User.ID)
+	}
+	if page, _ := env.userRepo.ListUsers(context.Background(), repository.UserListFilter{Limit: 10, IncludeTotal: true}); *page.Total != 1 {
+		t.Errorf("expected no new user, got %d users", *page.Total)
+	}
+	if identity, _ := env.identityRepo.GetIdentity(context.Background(), "corp", "emp-1"); identity.Email != "renamed@example.com" {
+		t.Errorf("expected identity email to be updated, got %q", identity.Email)
+	}
+}
+
+func TestFederationHandler_DatabaseUnavailable(t *testing.T) {
+	env := newFederationTestEnv(t)
+	env.handler.auth.userRepo = unavailableUserRepository{env.userRepo}
+
+	// An outage must neither provision a second account for the email nor
+	// pass for a missing account.
+	for _, provider := range []string{"corp", "partner"} {
+		user := oidctest.User{Subject: "emp-1", Email: "test@example.com", EmailVerified: true}
+		if rr := env.callback(env.login(t, provider, user)); rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected status %d, got %d: %s", provider, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+		}
+	}
+	if page, _ := env.userRepo.ListUsers(context.Background(), repository.UserListFilter{Limit: 10, IncludeTotal: true}); *page.Total != 1 {
+		t.Errorf("expected no new user, got %d users", *page.Total)
+	}
+	if len(env.identityRepo.identities) != 0 {
+		t.Errorf("expected no linked identity, got %d", len(env.identityRepo.identities))
+	}
+}
+
+func TestFederationHandler_InvalidState(t *testing.T) {
+	user := oidctest.User{Subject: "emp-1", Email: "test@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name   string
+		modify func(req *http.Request) *http.Request
+	}{
+		{
+			name: "missing state cookie",
+			modify: func(req *http.Request) *http.Request {
+				req.Header.Del("Cookie")
+				return req
+			},
+		},
+		{
+			name: "state mismatch",
+			modify: func(req *http.Request) *http.Request {
+				query := req.URL.Query()
+				query.Set("state", "forged")
+				req.URL.RawQuery = query.Encode()
+				return req
+			},
+		},
+		{
+			name: "state issued for another provider",
+			modify: func(req *http.Request) *http.Request {
+				return mux.SetURLVars(req, map[string]string{"provider": "partner"})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := newFederationTestEnv(t)
+
+			rr := env.callback(tt.modify(env.login(t, "corp", user)))
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected status %d, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+			}
+			if len(env.identityRepo.identities) != 0 {
+				t.Error("expected no linked identity")
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+)
+
+// ImpersonationHandler lets support staff use the API as another user. The
+// tokens it issues carry the real caller in the act claim, cannot be
+// refreshed, and every request made with them is audited.
+type ImpersonationHandler struct {
+	auth   *AuthHandler
+	audit  *middleware.AuditLog
+	logger zerolog.Logger
+}
+
+type ImpersonateRequest struct {
+	Reason string `json:"reason" validate:"required"`
+}
+
+type ImpersonateResponse struct {
+	Token     string              `json:"token"`
+	ExpiresAt time.Time           `json:"expires_at"`
+	User      middleware.UserInfo `json:"user"`
+	Actor     middleware.UserInfo `json:"actor"`
+}
+
+func NewImpersonationHandler(auth *AuthHandler, audit *middleware.AuditLog, logger zerolog.Logger) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		auth:   auth,
+		audit:  audit,
+		logger: logger,
+	}
+}
+
+// Impersonate issues a short-lived access token for the user in the URL.
+// Only users may impersonate, and only users whose roles grant nothing the
+// caller lacks.
+func (h *ImpersonationHandler) Impersonate(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	principal, ok := middleware.GetPrincipalFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+	if principal.Type != middleware.PrincipalUser || principal.Actor != nil {
+		h.sendErrorResponse(w, http.StatusForbidden, "Only users can impersonate")
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if userID == principal.ID {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Cannot impersonate yourself")
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "A reason is required")
+		return
+	}
+
+	user, err := h.auth.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to get user")
+		h.sendErrorResponse(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	subject, err := h.auth.tokenSubject(ctx, user)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to load user roles")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	if !h.auth.authService.CanActAs(principal, subject.Roles) {
+		h.sendErrorResponse(w, http.StatusForbidden, "Cannot impersonate a user with more privileges")
+		return
+	}
+
+	subject.Actor = &middleware.ActorClaim{
+		Subject:  middleware.UserSubject(principal.ID),
+		UserID:   principal.ID,
+		Username: principal.Name,
+	}
+	token, expiresAt, err := h.auth.authService.GenerateToken(subject)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to generate impersonation token")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	// No token is handed out unless the grant is on the audit trail
+	if err := h.audit.RecordImpersonation(ctx, r, principal, user.ID, req.Reason); err != nil {
+		h.logger.Error().Err(err).Int("actor_id", principal.ID).Int("user_id", user.ID).Msg("Failed to record impersonation")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, ImpersonateResponse{
+		Token:     token,
+		ExpiresAt: expiresAt,
+		User: middleware.UserInfo{
+			ID:       user.ID,
+			Username: user.Username,
+			Email:    user.Email,
+			Roles:    subject.Roles,
+		},
+		Actor: middleware.UserInfo{
+			ID:       principal.ID,
+			Username: principal.Name,
+			Roles:    principal.Roles,
+		},
+	})
+
+	h.logger.Info().
+		Int("actor_id", principal.ID).
+		Int("user_id", user.ID).
+		Str("reason", req.Reason).
+		Time("expires_at", expiresAt).
+		Msg("Impersonation started")
+}
+
+func (h *ImpersonationHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *ImpersonationHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+)
+
+// Mock audit repository for testing
+type mockAuditRepository struct {
+	events []*models.AuditEvent
+}
+
+func (m *mockAuditRepository) RecordEvent(ctx context.Context, event *models.AuditEvent) error {
+	event.ID = int64(len(m.events) + 1)
+	m.events = append(m.events, event)
+	return nil
+}
+
+func TestImpersonationHandler_Impersonate(t *testing.T) {
+	authHandler, userRepo, _ := newTestAuthHandler(t)
+	authService := authHandler.authService
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+
+	addTestUser(t, userRepo, &models.User{ID: 2, Username: "support", Email: "support@example.com"})
+	authHandler.roleRepo.SetUserRoles(context.Background(), 2, []string{"admin"})
+	authService.SetAuthorizer(middleware.NewAuthorizer(authHandler.roleRepo, time.Hour, logger))
+	auditRepo := &mockAuditRepository{}
+	audit := middleware.NewAuditLog(auditRepo, logger)
+	authService.SetAuditLog(audit)
+
+	handler := NewImpersonationHandler(authHandler, audit, logger)
+	userHandler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+
+	var logs bytes.Buffer
+	r := mux.NewRouter()
+	r.Use(middleware.LoggingMiddleware(zerolog.New(&logs)))
+	protected := r.PathPrefix("/api/v1").Subrouter()
+	protected.Use(middleware.AuthMiddleware(authService))
+	protected.Handle("/users/{id:[0-9]+}/impersonate", middleware.RejectImpersonation(http.HandlerFunc(handler.Impersonate))).Methods("POST")
+	protected.HandleFunc("/users/{id:[0-9]+}", userHandler.UpdateUser).Methods("PUT")
+	protected.HandleFunc("/auth/profile", authHandler.GetProfile).Methods("GET")
+
+	support, _, _ := authService.GenerateToken(middleware.TokenSubject{UserID: 2, Username: "support", Roles: []string{"user", "admin"}})
+	user := login(t, authHandler)
+
+	if rr := postJSON(r, "/api/v1/users/1/impersonate", support, ImpersonateRequest{}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a reason to be required, got %d", rr.Code)
+	}
+	if rr := postJSON(r, "/api/v1/users/2/impersonate", user.Token, ImpersonateRequest{Reason: "escalate"}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected impersonating a more privileged user to be forbidden, got %d", rr.Code)
+	}
+
+	rr := postJSON(r, "/api/v1/users/1/impersonate", support, ImpersonateRequest{Reason: "ticket 4521"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var resp ImpersonateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp.User.ID != 1 || resp.Actor.ID != 2 {
+		t.Fatalf("unexpected response: %s", rr.Body.String())
+	}
+
+	claims, err := authService.ValidateToken(resp.Token)
+	if err != nil {
+		t.Fatalf("expected a valid token, got %v", err)
+	}
+	if claims.UserID != 1 || claims.Actor == nil || claims.Actor.Subject != middleware.UserSubject(2) || claims.Actor.UserID != 2 {
+		t.Errorf("expected the act claim to name the support user, got %+v", claims.Actor)
+	}
+	if ttl := time.Until(resp.ExpiresAt); ttl > authService.AccessTokenTTL() {
+		t.Errorf("expected a short-lived token, got %v", ttl)
+	}
+
+	if len(auditRepo.events) != 1 || auditRepo.events[0].Action != models.AuditImpersonationStart || auditRepo.events[0].Reason != "ticket 4521" {
+		t.Fatalf("expected the grant to be audited, got %+v", auditRepo.events)
+	}
+
+	// Requests made while impersonating are audited and logged with both users.
+	logs.Reset()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+resp.Token)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the impersonated user's profile, got %d", rr.Code)
+	}
+	event := auditRepo.events[len(auditRepo.events)-1]
+	if event.Action != models.AuditImpersonationRequest || event.ActorID != 2 || event.UserID != 1 || event.Status != http.StatusOK {
+		t.Errorf("expected the request to be audited, got %+v", event)
+	}
+	if !strings.Contains(logs.String(), `"user_id":1`) || !strings.Contains(logs.String(), `"actor_id":2`) {
+		t.Errorf("expected the request log to name both users, got %s", logs.String())
+	}
+
+	// Credentials cannot be changed, nor can impersonation be chained.
+	for _, body := range []UpdateUserRequest{{Password: "N3w-Passw0rd!x"}, {Email: "attacker@example.com"}} {
+		payload, _ := json.Marshal(body)
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/users/1", bytes.NewBuffer(payload))
+		req.Header.Set("Authorization", "Bearer "+resp.Token)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected %+v to be forbidden while impersonating, got %d", body, rr.Code)
+		}
+	}
+	if rr := postJSON(r, "/api/v1/users/2/impersonate", resp.Token, ImpersonateRequest{Reason: "again"}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected chained impersonation to be forbidden, got %d", rr.Code)
+	}
+}
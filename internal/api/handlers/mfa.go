@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/totp"
+)
+
+const (
+	recoveryCodeCount = 10
+	// totpSkew accepts the previous and next code to allow for clock drift.
+	totpSkew = 1
+)
+
+var errInvalidMFACode = errors.New("invalid verification code")
+
+var recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MFAHandler manages a user's own TOTP enrollment and recovery codes. The
+// login step itself is AuthHandler.LoginMFA.
+type MFAHandler struct {
+	mfaRepo repository.MFARepository
+	issuer  string
+	logger  zerolog.Logger
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code"`
+}
+
+type MFAStatusResponse struct {
+	Enabled                bool `json:"enabled"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TOTPEnrollmentResponse carries the new secret. OTPAuthURL is the payload
+// for the QR code scanned by authenticator apps.
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// RecoveryCodesResponse is the only response that contains recovery codes.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// NewMFAHandler creates the handler. issuer is the account issuer shown in
+// authenticator apps.
+func NewMFAHandler(mfaRepo repository.MFARepository, issuer string, logger zerolog.Logger) *MFAHandler {
+	return &MFAHandler{
+		mfaRepo: mfaRepo,
+		issuer:  issuer,
+		logger:  logger,
+	}
+}
+
+func (h *MFAHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	mfa, err := h.mfaRepo.GetMFA(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotFound) || (err == nil && !mfa.Enabled) {
+		h.sendJSONResponse(w, http.StatusOK, MFAStatusResponse{})
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to get MFA enrollment")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to get MFA status")
+		return
+	}
+
+	remaining, err := h.mfaRepo.CountRecoveryCodes(ctx, userID)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to count recovery codes")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to get MFA status")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, MFAStatusResponse{
+		Enabled:                true,
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+// EnrollTOTP starts an enrollment. It only takes effect once ConfirmTOTP
+// receives a code generated from the new secret.
+func (h *MFAHandler) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	mfa, err := h.mfaRepo.GetMFA(ctx, userID)
+	if err != nil && !errors.Is(err, repository.ErrMFANotFound) {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to get MFA enrollment")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+	if mfa != nil && mfa.Enabled {
+		h.sendErrorResponse(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to generate TOTP secret")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	if err := h.mfaRepo.SaveMFASecret(ctx, userID, secret); err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to save TOTP secret")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to start enrollment")
+		return
+	}
+
+	account, _ := middleware.GetEmailFromContext(r.Context())
+	if account == "" {
+		account, _ = middleware.GetUsernameFromContext(r.Context())
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, TOTPEnrollmentResponse{
+		Secret:     secret,
+		OTPAuthURL: totp.URI(h.issuer, account, secret),
+	})
+}
+
+// ConfirmTOTP enables two-factor authentication with the first valid code
+// and returns the initial recovery codes.
+func (h *MFAHandler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, req, ok := h.decodeCodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	mfa, err := h.mfaRepo.GetMFA(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotFound) {
+		h.sendErrorResponse(w, http.StatusNotFound, "No enrollment in progress")
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to get MFA enrollment")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify code")
+		return
+	}
+	if mfa.Enabled {
+		h.sendErrorResponse(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, valid := totp.Validate(mfa.Secret, strings.TrimSpace(req.Code), time.Now(), totpSkew)
+	if !valid {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid verification code")
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to generate recovery codes")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+
+	if err := h.mfaRepo.EnableMFA(ctx, userID, step, hashes); err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to enable MFA")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+
+	h.logger.Info().Int("user_id", userID).Msg("Two-factor authentication enabled")
+	h.sendJSONResponse(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns two-factor authentication off. It requires a current
+// TOTP or recovery code so that a stolen access token is not enough.
+func (h *MFAHandler) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, req, ok := h.decodeCodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	mfa, ok := h.enabledMFA(ctx, w, userID)
+	if !ok {
+		return
+	}
+
+	if !h.verifyCode(ctx, w, mfa, req.Code, true) {
+		return
+	}
+
+	if err := h.mfaRepo.DisableMFA(ctx, userID); err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to disable MFA")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+
+	h.logger.Info().Int("user_id", userID).Msg("Two-factor authentication disabled")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes. It requires a TOTP
+// code; a recovery code cannot be used to mint new ones.
+func (h *MFAHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	userID, req, ok := h.decodeCodeRequest(w, r)
+	if !ok {
+		return
+	}
+
+	mfa, ok := h.enabledMFA(ctx, w, userID)
+	if !ok {
+		return
+	}
+
+	if !h.verifyCode(ctx, w, mfa, req.Code, false) {
+		return
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to generate recovery codes")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+
+	if err := h.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to replace recovery codes")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+
+	h.logger.Info().Int("user_id", userID).Msg("Recovery codes regenerated")
+	h.sendJSONResponse(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *MFAHandler) decodeCodeRequest(w http.ResponseWriter, r *http.Request) (int, MFACodeRequest, bool) {
+	var req MFACodeRequest
+
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return 0, req, false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode request body")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return 0, req, false
+	}
+
+	if strings.TrimSpace(req.Code) == "" {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Code is required")
+		return 0, req, false
+	}
+
+	return userID, req, true
+}
+
+func (h *MFAHandler) enabledMFA(ctx context.Context, w http.ResponseWriter, userID int) (*models.UserMFA, bool) {
+	mfa, err := h.mfaRepo.GetMFA(ctx, userID)
+	if errors.Is(err, repository.ErrMFANotFound) || (err == nil && !mfa.Enabled) {
+		h.sendErrorResponse(w, http.StatusConflict, "Two-factor authentication is not enabled")
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to get MFA enrollment")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify code")
+		return nil, false
+	}
+	return mfa, true
+}
+
+func (h *MFAHandler) verifyCode(ctx context.Context, w http.ResponseWriter, mfa *models.UserMFA, code string, allowRecovery bool) bool {
+	err := verifySecondFactor(ctx, h.mfaRepo, mfa, code, allowRecovery)
+	if errors.Is(err, errInvalidMFACode) {
+		h.logger.Warn().Int("user_id", mfa.UserID).Msg("Invalid MFA code")
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid verification code")
+		return false
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", mfa.UserID).Msg("Failed to verify MFA code")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to verify code")
+		return false
+	}
+	return true
+}
+
+// verifySecondFactor accepts a TOTP code that has not been used before or,
+// if allowRecovery is set, an unused recovery code, which is then spent.
+func verifySecondFactor(ctx context.Context, mfaRepo repository.MFARepository, mfa *models.UserMFA, code string, allowRecovery bool) error {
+	code = strings.TrimSpace(code)
+
+	if step, valid := totp.Validate(mfa.Secret, code, time.Now(), totpSkew); valid {
+		err := mfaRepo.UseTOTPStep(ctx, mfa.UserID, step)
+		if errors.Is(err, repository.ErrMFACodeReused) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	if !allowRecovery || len(code) == totp.Digits {
+		return errInvalidMFACode
+	}
+
+	err := mfaRepo.UseRecoveryCode(ctx, mfa.UserID, hashSecret(normalizeRecoveryCode(code)))
+	if errors.Is(err, repository.ErrRecoveryCodeInvalid) {
+		return errInvalidMFACode
+	}
+	return err
+}
+
+// generateRecoveryCodes returns codes formatted for display, such as
+// "abcd-efgh-ijkl-mnop", and their hashes for storage.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(recoveryCodeEncoding.EncodeToString(b))
+		codes = append(codes, raw[0:4]+"-"+raw[4:8]+"-"+raw[8:12]+"-"+raw[12:16])
+		hashes = append(hashes, hashSecret(raw))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode ignores case, dashes and spaces so codes can be
+// typed the way they were printed or not.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+func (h *MFAHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *MFAHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/totp"
+)
+
+// Mock MFA repository for testing
+type mockMFARepository struct {
+	enrollments   map[int]*models.UserMFA
+	recoveryCodes map[int]map[string]bool
+}
+
+func newMockMFARepository() *mockMFARepository {
+	return &mockMFARepository{
+		enrollments:   make(map[int]*models.UserMFA),
+		recoveryCodes: make(map[int]map[string]bool),
+	}
+}
+
+func (m *mockMFARepository) GetMFA(ctx context.Context, userID int) (*models.UserMFA, error) {
+	mfa, exists := m.enrollments[userID]
+	if !exists {
+		return nil, repository.ErrMFANotFound
+	}
+	return mfa, nil
+}
+
+func (m *mockMFARepository) SaveMFASecret(ctx context.Context, userID int, secret string) error {
+	if mfa, exists := m.enrollments[userID]; exists && mfa.Enabled {
+		return nil
+	}
+	m.enrollments[userID] = &models.UserMFA{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (m *mockMFARepository) EnableMFA(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	mfa, exists := m.enrollments[userID]
+	if !exists || mfa.Enabled {
+		return repository.ErrMFANotFound
+	}
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.EnabledAt = &now
+	mfa.LastUsedStep = step
+	return m.ReplaceRecoveryCodes(ctx, userID, recoveryCodeHashes)
+}
+
+func (m *mockMFARepository) DisableMFA(ctx context.Context, userID int) error {
+	if _, exists := m.enrollments[userID]; !exists {
+		return repository.ErrMFANotFound
+	}
+	delete(m.enrollments, userID)
+	delete(m.recoveryCodes, userID)
+	return nil
+}
+
+func (m *mockMFARepository) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	mfa := m.enrollments[userID]
+	if mfa == nil || step <= mfa.LastUsedStep {
+		return repository.ErrMFACodeReused
+	}
+	mfa.LastUsedStep = step
+	return nil
+}
+
+func (m *mockMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	m.recoveryCodes[userID] = make(map[string]bool)
+	for _, codeHash := range codeHashes {
+		m.recoveryCodes[userID][codeHash] = false
+	}
+	return nil
+}
+
+func (m *mockMFARepository) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	used, exists := m.recoveryCodes[userID][codeHash]
+	if !exists || used {
+		return repository.ErrRecoveryCodeInvalid
+	}
+	m.recoveryCodes[userID][codeHash] = true
+	return nil
+}
+
+func (m *mockMFARepository) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	count := 0
+	for _, used := range m.recoveryCodes[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func postJSON(handler http.Handler, path, token string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(payload))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func currentCode(t *testing.T, secret string, offset int64) string {
+	code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("failed to compute code: %v", err)
+	}
+	return code
+}
+
+func TestMFAHandler_Enrollment(t *testing.T) {
+	authHandler, _, _ := newTestAuthHandler(t)
+	mfaRepo := authHandler.mfaRepo.(*mockMFARepository)
+	handler := NewMFAHandler(mfaRepo, "Remus Synerge", zerolog.New(zerolog.NewTestWriter(t)))
+	protected := middleware.AuthMiddleware(authHandler.authService)
+	token := login(t, authHandler).Token
+
+	rr := postJSON(protected(http.HandlerFunc(handler.EnrollTOTP)), "/auth/mfa/totp", token, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected enrollment status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var enrollment TOTPEnrollmentResponse
+	json.Unmarshal(rr.Body.Bytes(), &enrollment)
+	if !strings.HasPrefix(enrollment.OTPAuthURL, "otpauth://totp/Remus%20Synerge:test@example.com?") {
+		t.Errorf("unexpected otpauth url: %s", enrollment.OTPAuthURL)
+	}
+
+	confirm := protected(http.HandlerFunc(handler.ConfirmTOTP))
+	if rr := postJSON(confirm, "/auth/mfa/totp/verify", token, MFACodeRequest{Code: "000000"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected wrong code to be rejected with %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if mfaRepo.enrollments[1].Enabled {
+		t.Fatal("expected enrollment to stay disabled after a wrong code")
+	}
+
+	code := currentCode(t, enrollment.Secret, 0)
+	rr = postJSON(confirm, "/auth/mfa/totp/verify", token, MFACodeRequest{Code: code})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected confirmation status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var recovery RecoveryCodesResponse
+	json.Unmarshal(rr.Body.Bytes(), &recovery)
+	if len(recovery.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("expected %d recovery codes, got %d", recoveryCodeCount, len(recovery.RecoveryCodes))
+	}
+
+	if rr := postJSON(protected(http.HandlerFunc(handler.EnrollTOTP)), "/auth/mfa/totp", token, nil); rr.Code != http.StatusConflict {
+		t.Errorf("expected re-enrollment to conflict, got %d", rr.Code)
+	}
+
+	// The code used for confirmation cannot be replayed.
+	regenerate := protected(http.HandlerFunc(handler.RegenerateRecoveryCodes))
+	if rr := postJSON(regenerate, "/auth/mfa/recovery-codes", token, MFACodeRequest{Code: code}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected replayed code to be rejected, got %d", rr.Code)
+	}
+	if rr := postJSON(regenerate, "/auth/mfa/recovery-codes", token, MFACodeRequest{Code: recovery.RecoveryCodes[0]}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected recovery code to be refused for regeneration, got %d", rr.Code)
+	}
+
+	disable := protected(http.HandlerFunc(handler.DisableTOTP))
+	if rr := postJSON(disable, "/auth/mfa/totp/disable", token, MFACodeRequest{Code: strings.ToUpper(recovery.RecoveryCodes[1])}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected disable with recovery code to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, exists := mfaRepo.enrollments[1]; exists {
+		t.Error("expected enrollment to be removed")
+	}
+}
+
+func TestAuthHandler_LoginMFA(t *testing.T) {
+	handler, _, _ := newTestAuthHandler(t)
+	accessToken := login(t, handler).Token
+
+	mfaRepo := handler.mfaRepo.(*mockMFARepository)
+	secret, _ := totp.GenerateSecret()
+	mfaRepo.SaveMFASecret(context.Background(), 1, secret)
+	codes, hashes, _ := generateRecoveryCodes()
+	mfaRepo.EnableMFA(context.Background(), 1, 0, hashes)
+
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "test@example.com", Password: "password123"})
+	rr := httptest.NewRecorder()
+	handler.Login(rr, httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body)))
+	var challenge middleware.MFAChallengeResponse
+	json.Unmarshal(rr.Body.Bytes(), &challenge)
+	if rr.Code != http.StatusOK || !challenge.MFARequired || challenge.MFAToken == "" {
+		t.Fatalf("expected MFA challenge, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if strings.Contains(rr.Body.String(), "refresh_token") {
+		t.Fatal("expected no tokens before the second factor")
+	}
+
+	validCode := currentCode(t, secret, 0)
+	loginMFA := http.HandlerFunc(handler.LoginMFA)
+
+	tests := []struct {
+		name           string
+		request        middleware.MFALoginRequest
+		expectedStatus int
+	}{
+		{
+			name:           "wrong code",
+			request:        middleware.MFALoginRequest{MFAToken: challenge.MFAToken, Code: "000000"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "access token instead of mfa token",
+			request:        middleware.MFALoginRequest{MFAToken: accessToken, Code: validCode},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "valid totp code",
+			request:        middleware.MFALoginRequest{MFAToken: challenge.MFAToken, Code: validCode},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "replayed totp code",
+			request:        middleware.MFALoginRequest{MFAToken: challenge.MFAToken, Code: validCode},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "recovery code",
+			request:        middleware.MFALoginRequest{MFAToken: challenge.MFAToken, Code: codes[0]},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "spent recovery code",
+			request:        middleware.MFALoginRequest{MFAToken: challenge.MFAToken, Code: codes[0]},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(loginMFA, "/auth/login/mfa", "", tt.request)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var resp middleware.LoginResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			if resp.Token == "" || resp.RefreshToken == "" || resp.User.ID != 1 {
+				t.Errorf("expected a full session, got %s", rr.Body.String())
+			}
+		})
+	}
+}
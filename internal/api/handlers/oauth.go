@@ -0,0 +1,921 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// OAuth grant types
+const (
+	grantAuthorizationCode = "authorization_code"
+	grantRefreshToken      = "refresh_token"
+	grantClientCredentials = "client_credentials"
+)
+
+const authorizationCodeTTL = time.Minute
+
+// Scopes that describe the user rather than an API permission.
+var oidcScopes = []string{"openid", "profile", "email"}
+
+type OAuthHandler struct {
+	oauthRepo        repository.OAuthRepository
+	userRepo         repository.UserRepository
+	refreshTokenRepo repository.RefreshTokenRepository
+	authService      *middleware.AuthService
+	loginURL         string
+	logger           zerolog.Logger
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// IntrospectionResponse follows RFC 7662 section 2.2.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	Exp       int64  `json:"exp,omitempty"`
+	Iat       int64  `json:"iat,omitempty"`
+	Sub       string `json:"sub,omitempty"`
+	Aud       string `json:"aud,omitempty"`
+	Iss       string `json:"iss,omitempty"`
+	Jti       string `json:"jti,omitempty"`
+}
+
+type UserInfoResponse struct {
+	Sub               string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+}
+
+// AuthorizeResponse tells a login page where to send the browser next.
+type AuthorizeResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// oauthError is an error reported to the client in the format of RFC 6749
+// section 5.2.
+type oauthError struct {
+	code        string
+	description string
+}
+
+func (e *oauthError) Error() string {
+	return e.code + ": " + e.description
+}
+
+type authorizationRequest struct {
+	client        *models.OAuthClient
+	redirectURI   string
+	scope         string
+	state         string
+	nonce         string
+	codeChallenge string
+}
+
+func NewOAuthHandler(oauthRepo repository.OAuthRepository, userRepo repository.UserRepository, refreshTokenRepo repository.RefreshTokenRepository, authService *middleware.AuthService, loginURL string, logger zerolog.Logger) *OAuthHandler {
+	h := &OAuthHandler{
+		oauthRepo:        oauthRepo,
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		authService:      authService,
+		loginURL:         loginURL,
+		logger:           logger,
+	}
+
+	// Start cleanup goroutine
+	go h.cleanupLoop()
+
+	return h
+}
+
+func (h *OAuthHandler) cleanupLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		// Keep used codes around for a while so that replays are still detected
+		if _, err := h.oauthRepo.DeleteExpiredAuthorizationCodes(ctx, time.Now().Add(-time.Hour)); err != nil {
+			h.logger.Error().Err(err).Msg("Failed to delete expired authorization codes")
+		}
+		cancel()
+	}
+}
+
+func (h *OAuthHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := h.authService.Issuer()
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.sendJSONResponse(w, http.StatusOK, OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		ScopesSupported:                   oidcScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{grantAuthorizationCode, grantRefreshToken, grantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{h.authService.SigningAlgorithm()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "nonce", "email", "preferred_username"},
+	})
+}
+
+// Authorize is the browser-facing authorization endpoint. Users that are not
+// signed in are sent to the login page with the original request attached.
+func (h *OAuthHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	req, err := h.parseAuthorizationRequest(ctx, r.URL.Query())
+	if err != nil {
+		h.handleAuthorizationError(w, r, req, err)
+		return
+	}
+
+	principal, ok := middleware.GetPrincipalFromContext(r.Context())
+	if !ok || principal.Type != middleware.PrincipalUser {
+		if h.loginURL != "" {
+			separator := "?"
+			if strings.Contains(h.loginURL, "?") {
+				separator = "&"
+			}
+			http.Redirect(w, r, h.loginURL+separator+r.URL.RawQuery, http.StatusFound)
+			return
+		}
+
+		http.Redirect(w, r, req.errorURL(&oauthError{"login_required", "User authentication is required"}, h.authService.Issuer()), http.StatusFound)
+		return
+	}
+	// A code would turn an impersonation session into ordinary, unaudited
+	// tokens for the impersonated user.
+	if principal.Actor != nil {
+		http.Redirect(w, r, req.errorURL(&oauthError{"access_denied", "Impersonation sessions cannot authorize clients"}, h.authService.Issuer()), http.StatusFound)
+		return
+	}
+
+	redirectTo, err := h.issueAuthorizationCode(ctx, req, principal.ID)
+	if err != nil {
+		h.handleAuthorizationError(w, r, nil, err)
+		return
+	}
+
+	http.Redirect(w, r, redirectTo, http.StatusFound)
+}
+
+// ApproveAuthorization lets a login page that holds the user's access token
+// complete an authorization request. It returns the redirect instead of
+// following it.
+func (h *OAuthHandler) ApproveAuthorization(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	principal, ok := middleware.GetPrincipalFromContext(r.Context())
+	if !ok || principal.Type != middleware.PrincipalUser {
+		h.sendOAuthError(w, &oauthError{"access_denied", "Only users can authorize clients"})
+		return
+	}
+	if principal.Actor != nil {
+		h.sendOAuthError(w, &oauthError{"access_denied", "Impersonation sessions cannot authorize clients"})
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		h.sendOAuthError(w, &oauthError{"invalid_request", "Invalid form body"})
+		return
+	}
+
+	req, err := h.parseAuthorizationRequest(ctx, r.Form)
+	if err != nil {
+		var oauthErr *oauthError
+		if req != nil && errors.As(err, &oauthErr) {
+			h.sendJSONResponse(w, http.StatusOK, AuthorizeResponse{RedirectTo: req.errorURL(oauthErr, h.authService.Issuer())})
+			return
+		}
+		h.sendAuthorizationError(w, err)
+		return
+	}
+
+	redirectTo, err := h.issueAuthorizationCode(ctx, req, principal.ID)
+	if err != nil {
+		h.sendAuthorizationError(w, err)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, AuthorizeResponse{RedirectTo: redirectTo})
+}
+
+// parseAuthorizationRequest validates an authorization request. Errors found
+// before the redirect URI is verified are returned without a request and must
+// be shown to the user; later errors are returned to the client by redirect.
+func (h *OAuthHandler) parseAuthorizationRequest(ctx context.Context, params url.Values) (*authorizationRequest, error) {
+	client, err := h.oauthRepo.GetClient(ctx, params.Get("client_id"))
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, &oauthError{"invalid_client", "Unknown client"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURI := params.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if !containsString(client.RedirectURIs, redirectURI) {
+		return nil, &oauthError{"invalid_request", "Unregistered redirect_uri"}
+	}
+
+	req := &authorizationRequest{
+		client:      client,
+		redirectURI: redirectURI,
+		state:       params.Get("state"),
+		nonce:       params.Get("nonce"),
+	}
+
+	if params.Get("response_type") != "code" {
+		return req, &oauthError{"unsupported_response_type", "Only the code response type is supported"}
+	}
+	if !containsString(client.GrantTypes, grantAuthorizationCode) {
+		return req, &oauthError{"unauthorized_client", "Client may not use the authorization code grant"}
+	}
+
+	req.codeChallenge = params.Get("code_challenge")
+	if params.Get("code_challenge_method") != "S256" || len(req.codeChallenge) < 43 || len(req.codeChallenge) > 128 {
+		return req, &oauthError{"invalid_request", "PKCE with code_challenge_method S256 is required"}
+	}
+
+	scope, err := grantScope(client, params.Get("scope"))
+	if err != nil {
+		return req, err
+	}
+	req.scope = scope
+
+	return req, nil
+}
+
+func (h *OAuthHandler) issueAuthorizationCode(ctx context.Context, req *authorizationRequest, userID int) (string, error) {
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	familyID, err := generateFamilyID()
+	if err != nil {
+		return "", err
+	}
+
+	err = h.oauthRepo.CreateAuthorizationCode(ctx, &models.AuthorizationCode{
+		CodeHash:      hashSecret(code),
+		ClientID:      req.client.ClientID,
+		UserID:        userID,
+		RedirectURI:   req.redirectURI,
+		Scope:         req.scope,
+		Nonce:         req.nonce,
+		CodeChallenge: req.codeChallenge,
+		FamilyID:      familyID,
+		ExpiresAt:     time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to store authorization code: %w", err)
+	}
+
+	h.logger.Info().
+		Str("client_id", req.client.ClientID).
+		Int("user_id", userID).
+		Str("scope", req.scope).
+		Msg("Authorization code issued")
+
+	return req.redirectURL(url.Values{"code": {code}}, h.authService.Issuer()), nil
+}
+
+func (req *authorizationRequest) redirectURL(params url.Values, issuer string) string {
+	u, _ := url.Parse(req.redirectURI)
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.state != "" {
+		query.Set("state", req.state)
+	}
+	// RFC 9207 issuer identification
+	query.Set("iss", issuer)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (req *authorizationRequest) errorURL(err *oauthError, issuer string) string {
+	return req.redirectURL(url.Values{
+		"error":             {err.code},
+		"error_description": {err.description},
+	}, issuer)
+}
+
+func (h *OAuthHandler) handleAuthorizationError(w http.ResponseWriter, r *http.Request, req *authorizationRequest, err error) {
+	var oauthErr *oauthError
+	if req != nil && errors.As(err, &oauthErr) {
+		http.Redirect(w, r, req.errorURL(oauthErr, h.authService.Issuer()), http.StatusFound)
+		return
+	}
+	h.sendAuthorizationError(w, err)
+}
+
+func (h *OAuthHandler) sendAuthorizationError(w http.ResponseWriter, err error) {
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		h.sendOAuthError(w, oauthErr)
+		return
+	}
+
+	h.logger.Error().Err(err).Msg("Failed to process authorization request")
+	h.sendOAuthError(w, &oauthError{"server_error", "Failed to process authorization request"})
+}
+
+// Token is the token endpoint (RFC 6749 section 3.2).
+func (h *OAuthHandler) Token(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := r.ParseForm(); err != nil {
+		h.sendOAuthError(w, &oauthError{"invalid_request", "Invalid form body"})
+		return
+	}
+
+	client, err := h.authenticateClient(ctx, r)
+	if err != nil {
+		h.sendTokenError(w, err)
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	switch grantType {
+	case grantAuthorizationCode, grantRefreshToken, grantClientCredentials:
+	default:
+		h.sendOAuthError(w, &oauthError{"unsupported_grant_type", "Unsupported grant type"})
+		return
+	}
+	if !containsString(client.GrantTypes, grantType) {
+		h.sendOAuthError(w, &oauthError{"unauthorized_client", "Client may not use this grant type"})
+		return
+	}
+
+	var response *TokenResponse
+	switch grantType {
+	case grantAuthorizationCode:
+		response, err = h.exchangeAuthorizationCode(ctx, client, r.PostForm)
+	case grantRefreshToken:
+		response, err = h.exchangeRefreshToken(ctx, client, r.PostForm)
+	case grantClientCredentials:
+		response, err = h.exchangeClientCredentials(client, r.PostForm)
+	}
+	if err != nil {
+		h.sendTokenError(w, err)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// authenticateClient identifies the client from HTTP Basic credentials or
+// the client_id and client_secret form fields. Public clients only send
+// client_id.
+func (h *OAuthHandler) authenticateClient(ctx context.Context, r *http.Request) (*models.OAuthClient, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1: credentials are form-encoded before Basic encoding
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, &oauthError{"invalid_client", "Client authentication failed"}
+	}
+
+	client, err := h.oauthRepo.GetClient(ctx, clientID)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, &oauthError{"invalid_client", "Client authentication failed"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.SecretHash == "" {
+		if secret != "" {
+			return nil, &oauthError{"invalid_client", "Client authentication failed"}
+		}
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, &oauthError{"invalid_client", "Client authentication failed"}
+	}
+
+	return client, nil
+}
+
+func (h *OAuthHandler) exchangeAuthorizationCode(ctx context.Context, client *models.OAuthClient, params url.Values) (*TokenResponse, error) {
+	// Check the code before using it up, so that a request that fails the
+	// checks, e.g. another client presenting it, cannot burn it.
+	codeHash := hashSecret(params.Get("code"))
+	code, err := h.oauthRepo.GetAuthorizationCode(ctx, codeHash)
+	if errors.Is(err, repository.ErrAuthorizationCodeNotFound) {
+		return nil, &oauthError{"invalid_grant", "Invalid authorization code"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if code.ClientID != client.ClientID {
+		return nil, &oauthError{"invalid_grant", "Invalid authorization code"}
+	}
+	if code.UsedAt != nil {
+		return nil, h.authorizationCodeReused(ctx, code)
+	}
+	if redirectURI := params.Get("redirect_uri"); redirectURI != "" && redirectURI != code.RedirectURI {
+		return nil, &oauthError{"invalid_grant", "redirect_uri does not match the authorization request"}
+	}
+	if time.Now().After(code.ExpiresAt) {
+		return nil, &oauthError{"invalid_grant", "Authorization code has expired"}
+	}
+	if !verifyCodeChallenge(code.CodeChallenge, params.Get("code_verifier")) {
+		return nil, &oauthError{"invalid_grant", "Invalid code_verifier"}
+	}
+
+	// A concurrent exchange of the same code may have won since
+	code, err = h.oauthRepo.ConsumeAuthorizationCode(ctx, codeHash)
+	if errors.Is(err, repository.ErrAuthorizationCodeUsed) {
+		return nil, h.authorizationCodeReused(ctx, code)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := h.userRepo.GetUserByID(ctx, code.UserID)
+	if err != nil {
+		return nil, &oauthError{"invalid_grant", "User no longer exists"}
+	}
+
+	response, err := h.issueTokens(client, user, code.Scope, code.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if containsString(client.GrantTypes, grantRefreshToken) {
+		refreshToken, refreshHash, refreshExpiresAt, err := h.authService.GenerateRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = h.refreshTokenRepo.CreateRefreshToken(ctx, &models.RefreshToken{
+			UserID:    user.ID,
+			FamilyID:  code.FamilyID,
+			TokenHash: refreshHash,
+			ClientID:  client.ClientID,
+			Scope:     code.Scope,
+			ExpiresAt: refreshExpiresAt,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to store refresh token: %w", err)
+		}
+		response.RefreshToken = refreshToken
+	}
+
+	return response, nil
+}
+
+// authorizationCodeReused handles a code its own client presents a second
+// time. RFC 6749 section 4.1.2: revoke what was issued for it.
+func (h *OAuthHandler) authorizationCodeReused(ctx context.Context, code *models.AuthorizationCode) error {
+	h.logger.Warn().
+		Str("client_id", code.ClientID).
+		Int("user_id", code.UserID).
+		Msg("Authorization code reuse detected, revoking token family")
+	if err := h.refreshTokenRepo.RevokeRefreshTokenFamily(ctx, code.FamilyID); err != nil {
+		return err
+	}
+	return &oauthError{"invalid_grant", "Invalid authorization code"}
+}
+
+func (h *OAuthHandler) exchangeRefreshToken(ctx context.Context, client *models.OAuthClient, params url.Values) (*TokenResponse, error) {
+	presentedHash := h.authService.HashRefreshToken(params.Get("refresh_token"))
+
+	current, err := h.refreshTokenRepo.GetRefreshTokenByHash(ctx, presentedHash)
+	if errors.Is(err, repository.ErrRefreshTokenNotFound) || (err == nil && current.ClientID != client.ClientID) {
+		return nil, &oauthError{"invalid_grant", "Invalid refresh token"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The client may ask for a subset of the originally granted scope
+	scope := ""
+	if requested := params.Get("scope"); requested != "" {
+		for _, s := range strings.Fields(requested) {
+			if !middleware.HasScope(current.Scope, s) {
+				return nil, &oauthError{"invalid_scope", "Requested scope exceeds the original grant"}
+			}
+		}
+		scope = strings.Join(strings.Fields(requested), " ")
+	}
+
+	refreshToken, refreshHash, refreshExpiresAt, err := h.authService.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := h.refreshTokenRepo.RotateRefreshToken(ctx, presentedHash, &models.RefreshToken{
+		TokenHash: refreshHash,
+		ClientID:  client.ClientID,
+		Scope:     scope,
+		ExpiresAt: refreshExpiresAt,
+	})
+	switch {
+	case errors.Is(err, repository.ErrRefreshTokenReused):
+		h.logger.Warn().
+			Str("client_id", client.ClientID).
+			Int("user_id", current.UserID).
+			Str("family_id", current.FamilyID).
+			Msg("Refresh token reuse detected, revoking token family")
+		return nil, &oauthError{"invalid_grant", "Invalid refresh token"}
+	case errors.Is(err, repository.ErrRefreshTokenNotFound),
+		errors.Is(err, repository.ErrRefreshTokenExpired),
+		errors.Is(err, repository.ErrRefreshTokenRevoked):
+		return nil, &oauthError{"invalid_grant", "Invalid refresh token"}
+	case err != nil:
+		return nil, err
+	}
+
+	user, err := h.userRepo.GetUserByID(ctx, next.UserID)
+	if err != nil {
+		return nil, &oauthError{"invalid_grant", "User no longer exists"}
+	}
+
+	response, err := h.issueTokens(client, user, next.Scope, "")
+	if err != nil {
+		return nil, err
+	}
+	response.RefreshToken = refreshToken
+
+	return response, nil
+}
+
+func (h *OAuthHandler) exchangeClientCredentials(client *models.OAuthClient, params url.Values) (*TokenResponse, error) {
+	if client.SecretHash == "" {
+		return nil, &oauthError{"unauthorized_client", "Public clients may not use the client credentials grant"}
+	}
+
+	scope, err := grantScope(client, params.Get("scope"))
+	if err != nil {
+		return nil, err
+	}
+
+	// There is no user, so user scopes are dropped
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !containsString(oidcScopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	scope = strings.Join(scopes, " ")
+
+	accessToken, claims, err := h.authService.GenerateOAuthToken(client.ClientID, 0, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   claims.ExpiresAt - claims.IssuedAt,
+		Scope:       scope,
+	}, nil
+}
+
+// issueTokens creates the access token, and the ID token if openid was
+// granted, for a user.
+func (h *OAuthHandler) issueTokens(client *models.OAuthClient, user *models.User, scope, nonce string) (*TokenResponse, error) {
+	accessToken, claims, err := h.authService.GenerateOAuthToken(client.ClientID, user.ID, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   claims.ExpiresAt - claims.IssuedAt,
+		Scope:       scope,
+	}
+
+	if middleware.HasScope(scope, "openid") {
+		idClaims := &middleware.IDTokenClaims{Nonce: nonce}
+		idClaims.Subject = middleware.UserSubject(user.ID)
+		if middleware.HasScope(scope, "email") {
+			idClaims.Email = user.Email
+		}
+		if middleware.HasScope(scope, "profile") {
+			idClaims.PreferredUsername = user.Username
+		}
+
+		response.IDToken, err = h.authService.GenerateIDToken(client.ClientID, idClaims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+// Introspect implements token introspection (RFC 7662) for confidential
+// clients.
+func (h *OAuthHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := r.ParseForm(); err != nil {
+		h.sendOAuthError(w, &oauthError{"invalid_request", "Invalid form body"})
+		return
+	}
+
+	client, err := h.authenticateClient(ctx, r)
+	if err == nil && client.SecretHash == "" {
+		err = &oauthError{"invalid_client", "Client authentication required"}
+	}
+	if err != nil {
+		h.sendTokenError(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	response := IntrospectionResponse{Active: false}
+
+	if claims, err := h.authService.ValidateOAuthToken(token); err == nil {
+		response = IntrospectionResponse{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			TokenType: "Bearer",
+			Exp:       claims.ExpiresAt,
+			Iat:       claims.IssuedAt,
+			Sub:       claims.Subject,
+			Aud:       claims.Audience,
+			Iss:       claims.Issuer,
+			Jti:       claims.Id,
+		}
+	} else if refresh, err := h.refreshTokenRepo.GetRefreshTokenByHash(ctx, h.authService.HashRefreshToken(token)); err == nil &&
+		refresh.ClientID == client.ClientID && refresh.UsedAt == nil && refresh.RevokedAt == nil && time.Now().Before(refresh.ExpiresAt) {
+		response = IntrospectionResponse{
+			Active:    true,
+			Scope:     refresh.Scope,
+			ClientID:  refresh.ClientID,
+			TokenType: "refresh_token",
+			Exp:       refresh.ExpiresAt.Unix(),
+			Iat:       refresh.CreatedAt.Unix(),
+			Sub:       middleware.UserSubject(refresh.UserID),
+			Iss:       h.authService.Issuer(),
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// Revoke implements token revocation (RFC 7009). Unknown tokens and tokens
+// of other clients are ignored as the RFC requires.
+func (h *OAuthHandler) Revoke(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	if err := r.ParseForm(); err != nil {
+		h.sendOAuthError(w, &oauthError{"invalid_request", "Invalid form body"})
+		return
+	}
+
+	client, err := h.authenticateClient(ctx, r)
+	if err != nil {
+		h.sendTokenError(w, err)
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		h.sendOAuthError(w, &oauthError{"invalid_request", "token is required"})
+		return
+	}
+
+	if refresh, err := h.refreshTokenRepo.GetRefreshTokenByHash(ctx, h.authService.HashRefreshToken(token)); err == nil {
+		if refresh.ClientID == client.ClientID {
+			if err := h.refreshTokenRepo.RevokeRefreshTokenFamily(ctx, refresh.FamilyID); err != nil {
+				h.sendTokenError(w, err)
+				return
+			}
+			h.logger.Info().Str("client_id", client.ClientID).Int("user_id", refresh.UserID).Msg("Refresh token revoked")
+		}
+	} else if claims, err := h.authService.ValidateOAuthToken(token); err == nil && claims.ClientID == client.ClientID {
+		if claims.UserID == 0 {
+			h.sendOAuthError(w, &oauthError{"unsupported_token_type", "Client credentials tokens cannot be revoked"})
+			return
+		}
+		if err := h.authService.RevokeOAuthToken(ctx, claims); err != nil {
+			h.sendTokenError(w, err)
+			return
+		}
+		h.logger.Info().Str("client_id", client.ClientID).Int("user_id", claims.UserID).Msg("Access token revoked")
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// UserInfo returns claims about the user an access token was issued for.
+func (h *OAuthHandler) UserInfo(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	const bearerPrefix = "Bearer "
+	authHeader := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authHeader, bearerPrefix) {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Missing access token")
+		return
+	}
+
+	claims, err := h.authService.ValidateOAuthToken(authHeader[len(bearerPrefix):])
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		h.sendErrorResponse(w, http.StatusUnauthorized, "Invalid access token")
+		return
+	}
+
+	if claims.UserID == 0 || !middleware.HasScope(claims.Scope, "openid") {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		h.sendErrorResponse(w, http.StatusForbidden, "The openid scope is required")
+		return
+	}
+
+	user, err := h.userRepo.GetUserByID(ctx, claims.UserID)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User no longer exists")
+		return
+	}
+
+	response := UserInfoResponse{Sub: middleware.UserSubject(user.ID)}
+	if middleware.HasScope(claims.Scope, "profile") {
+		response.PreferredUsername = user.Username
+	}
+	if middleware.HasScope(claims.Scope, "email") {
+		response.Email = user.Email
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// grantScope checks requested scopes against the client registration. An
+// empty request grants everything the client is registered for.
+func grantScope(client *models.OAuthClient, requested string) (string, error) {
+	if requested == "" {
+		return strings.Join(client.Scopes, " "), nil
+	}
+
+	var scopes []string
+	for _, scope := range strings.Fields(requested) {
+		if !containsString(client.Scopes, scope) {
+			return "", &oauthError{"invalid_scope", fmt.Sprintf("Scope %s is not allowed for this client", scope)}
+		}
+		if !containsString(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return strings.Join(scopes, " "), nil
+}
+
+// verifyCodeChallenge checks a PKCE verifier against an S256 challenge.
+func verifyCodeChallenge(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+func generateOpaqueToken() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// hashSecret hashes high-entropy secrets such as codes and client secrets.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *OAuthHandler) sendTokenError(w http.ResponseWriter, err error) {
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) {
+		h.sendOAuthError(w, oauthErr)
+		return
+	}
+
+	h.logger.Error().Err(err).Msg("Failed to process token request")
+	h.sendOAuthError(w, &oauthError{"server_error", "Failed to process token request"})
+}
+
+func (h *OAuthHandler) sendOAuthError(w http.ResponseWriter, err *oauthError) {
+	statusCode := http.StatusBadRequest
+	switch err.code {
+	case "invalid_client":
+		statusCode = http.StatusUnauthorized
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	case "access_denied":
+		statusCode = http.StatusForbidden
+	case "server_error":
+		statusCode = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	h.sendJSONResponse(w, statusCode, OAuthErrorResponse{
+		Error:            err.code,
+		ErrorDescription: err.description,
+	})
+}
+
+func (h *OAuthHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *OAuthHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+type OAuthClientHandler struct {
+	oauthRepo repository.OAuthRepository
+	logger    zerolog.Logger
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	Scopes       []string `json:"scopes"`
+	Public       bool     `json:"public"`
+}
+
+// CreateOAuthClientResponse is the only response that contains the secret.
+type CreateOAuthClientResponse struct {
+	*models.OAuthClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+func NewOAuthClientHandler(oauthRepo repository.OAuthRepository, logger zerolog.Logger) *OAuthClientHandler {
+	return &OAuthClientHandler{
+		oauthRepo: oauthRepo,
+		logger:    logger,
+	}
+}
+
+func (h *OAuthClientHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req CreateOAuthClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode request body")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	client, err := h.validateCreateClientRequest(req)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	idBytes := make([]byte, 16)
+	if _, err := rand.Read(idBytes); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to generate client ID")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create client")
+		return
+	}
+	client.ClientID = hex.EncodeToString(idBytes)
+
+	var secret string
+	if !req.Public {
+		secret, err = generateOpaqueToken()
+		if err != nil {
+			h.logger.Error().Err(err).Msg("Failed to generate client secret")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create client")
+			return
+		}
+		client.SecretHash = hashSecret(secret)
+	}
+
+	if err := h.oauthRepo.CreateClient(ctx, client); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to create OAuth client")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create client")
+		return
+	}
+
+	h.logger.Info().Str("client_id", client.ClientID).Str("name", client.Name).Msg("OAuth client registered")
+	h.sendJSONResponse(w, http.StatusCreated, CreateOAuthClientResponse{
+		OAuthClient:  client,
+		ClientSecret: secret,
+	})
+}
+
+func (h *OAuthClientHandler) ListClients(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	clients, err := h.oauthRepo.ListClients(ctx)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list OAuth clients")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list clients")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, clients)
+}
+
+func (h *OAuthClientHandler) DeleteClient(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	clientID := mux.Vars(r)["clientId"]
+	if err := h.oauthRepo.DeleteClient(ctx, clientID); err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			h.sendErrorResponse(w, http.StatusNotFound, "Client not found")
+			return
+		}
+		h.logger.Error().Err(err).Str("client_id", clientID).Msg("Failed to delete OAuth client")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete client")
+		return
+	}
+
+	h.logger.Info().Str("client_id", clientID).Msg("OAuth client deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *OAuthClientHandler) validateCreateClientRequest(req CreateOAuthClientRequest) (*models.OAuthClient, error) {
+	name := strings.TrimSpace(req.Name)
+	if len(name) < 3 || len(name) > 100 {
+		return nil, fmt.Errorf("name must be between 3 and 100 characters")
+	}
+
+	grantTypes := uniqueStrings(req.GrantTypes)
+	if len(grantTypes) == 0 {
+		grantTypes = []string{grantAuthorizationCode, grantRefreshToken}
+	}
+	for _, grantType := range grantTypes {
+		switch grantType {
+		case grantAuthorizationCode, grantRefreshToken:
+		case grantClientCredentials:
+			if req.Public {
+				return nil, fmt.Errorf("public clients cannot use the client_credentials grant")
+			}
+		default:
+			return nil, fmt.Errorf("unsupported grant type: %s", grantType)
+		}
+	}
+
+	redirectURIs := uniqueStrings(req.RedirectURIs)
+	if containsString(grantTypes, grantAuthorizationCode) && len(redirectURIs) == 0 {
+		return nil, fmt.Errorf("at least one redirect URI is required")
+	}
+	for _, redirectURI := range redirectURIs {
+		if err := validateRedirectURI(redirectURI); err != nil {
+			return nil, err
+		}
+	}
+
+	scopes := uniqueStrings(req.Scopes)
+	if len(scopes) == 0 {
+		scopes = append(scopes, oidcScopes...)
+	}
+	for _, scope := range scopes {
+		if strings.ContainsAny(scope, " \t\"\\") {
+			return nil, fmt.Errorf("invalid scope: %s", scope)
+		}
+	}
+
+	return &models.OAuthClient{
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		GrantTypes:   grantTypes,
+		Scopes:       scopes,
+	}, nil
+}
+
+// validateRedirectURI requires an absolute URI without a fragment. Plain HTTP
+// is only allowed for loopback addresses used by native apps and local
+// development.
+func validateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return fmt.Errorf("invalid redirect URI: %s", redirectURI)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect URI must use https: %s", redirectURI)
+}
+
+func (h *OAuthClientHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *OAuthClientHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
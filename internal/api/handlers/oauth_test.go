@@ -0,0 +1,539 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/config"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// Mock OAuth repository for testing
+type mockOAuthRepository struct {
+	clients map[string]*models.OAuthClient
+	codes   map[string]*models.AuthorizationCode
+}
+
+func newMockOAuthRepository() *mockOAuthRepository {
+	return &mockOAuthRepository{
+		clients: make(map[string]*models.OAuthClient),
+		codes:   make(map[string]*models.AuthorizationCode),
+	}
+}
+
+func (m *mockOAuthRepository) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	client.ID = len(m.clients) + 1
+	m.clients[client.ClientID] = client
+	return nil
+}
+
+func (m *mockOAuthRepository) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	client, exists := m.clients[clientID]
+	if !exists {
+		return nil, repository.ErrOAuthClientNotFound
+	}
+	return client, nil
+}
+
+func (m *mockOAuthRepository) ListClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	var clients []*models.OAuthClient
+	for _, client := range m.clients {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (m *mockOAuthRepository) DeleteClient(ctx context.Context, clientID string) error {
+	if _, exists := m.clients[clientID]; !exists {
+		return repository.ErrOAuthClientNotFound
+	}
+	delete(m.clients, clientID)
+	return nil
+}
+
+func (m *mockOAuthRepository) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	code.ID = len(m.codes) + 1
+	m.codes[code.CodeHash] = code
+	return nil
+}
+
+func (m *mockOAuthRepository) GetAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	code, exists := m.codes[codeHash]
+	if !exists {
+		return nil, repository.ErrAuthorizationCodeNotFound
+	}
+	copied := *code
+	return &copied, nil
+}
+
+func (m *mockOAuthRepository) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	code, exists := m.codes[codeHash]
+	if !exists {
+		return nil, repository.ErrAuthorizationCodeNotFound
+	}
+	if code.UsedAt != nil {
+		return code, repository.ErrAuthorizationCodeUsed
+	}
+	now := time.Now()
+	code.UsedAt = &now
+	return code, nil
+}
+
+func (m *mockOAuthRepository) DeleteExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+const (
+	testClientSecret = "client-secret"
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "dBjftJeZ4CVP-mJ92K9LgvZoBQm5Lb1R0wmKz3Q8xXk"
+)
+
+type oauthTestEnv struct {
+	handler     *OAuthHandler
+	authService *middleware.AuthService
+	oauthRepo   *mockOAuthRepository
+	refreshRepo *mockRefreshTokenRepository
+	userToken   string
+}
+
+func newOAuthTestEnv(t *testing.T) *oauthTestEnv {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+
+	authService, err := middleware.NewAuthService(config.SecurityConfig{
+		JWTKeyDir:           t.TempDir(),
+		JWTSigningAlgorithm: "ES256",
+		JWTKeyRotation:      3600,
+		JWTExpiration:       900,
+		RefreshTokenTTL:     3600,
+		OAuthIssuer:         "https://id.example.com",
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+	authService.SetRevocationStore(middleware.NewRevocationStore(newMockTokenRevocationRepository(), time.Hour, 15*time.Minute, logger))
+
+	userRepo := newTestUserRepository()
+	addTestUser(t, userRepo, &models.User{ID: 1, Username: "testuser", Email: "test@example.com"})
+
+	oauthRepo := newMockOAuthRepository()
+	oauthRepo.clients["test-client"] = &models.OAuthClient{
+		ClientID:     "test-client",
+		SecretHash:   hashSecret(testClientSecret),
+		Name:         "Test App",
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   []string{grantAuthorizationCode, grantRefreshToken, grantClientCredentials},
+		Scopes:       []string{"openid", "profile", "email", "users:read"},
+	}
+
+	userToken, _, err := authService.GenerateToken(middleware.TokenSubject{UserID: 1, Username: "testuser", Email: "test@example.com"})
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	refreshRepo := newMockRefreshTokenRepository()
+	return &oauthTestEnv{
+		handler:     NewOAuthHandler(oauthRepo, userRepo, refreshRepo, authService, "", logger),
+		authService: authService,
+		oauthRepo:   oauthRepo,
+		refreshRepo: refreshRepo,
+		userToken:   userToken,
+	}
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// authorize runs the authorization request as the signed in test user and
+// returns the redirect the login page would follow.
+func (env *oauthTestEnv) authorize(t *testing.T, params url.Values) *url.URL {
+	req := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+env.userToken)
+
+	rr := httptest.NewRecorder()
+	middleware.AuthMiddleware(env.authService)(http.HandlerFunc(env.handler.ApproveAuthorization)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected authorize status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp AuthorizeResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	redirect, err := url.Parse(resp.RedirectTo)
+	if err != nil {
+		t.Fatalf("invalid redirect: %v", err)
+	}
+	return redirect
+}
+
+func (env *oauthTestEnv) authorizeCode(t *testing.T) string {
+	redirect := env.authorize(t, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"test-client"},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {codeChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	})
+
+	code := redirect.Query().Get("code")
+	if code == "" {
+		t.Fatalf("expected code in redirect, got %s", redirect)
+	}
+	return code
+}
+
+func (env *oauthTestEnv) post(handler http.HandlerFunc, params url.Values, secret string) *httptest.ResponseRecorder {
+	return env.postAs(handler, "test-client", params, secret)
+}
+
+func (env *oauthTestEnv) postAs(handler http.HandlerFunc, clientID string, params url.Values, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if secret != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func (env *oauthTestEnv) introspect(t *testing.T, token string) IntrospectionResponse {
+	rr := env.post(env.handler.Introspect, url.Values{"token": {token}}, testClientSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected introspection status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp IntrospectionResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestOAuthHandler_AuthorizationCodeFlow(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	redirect := env.authorize(t, url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"test-client"},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {codeChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	})
+	if redirect.Query().Get("state") != "xyz" || redirect.Query().Get("iss") != "https://id.example.com" {
+		t.Errorf("expected state and issuer in redirect, got %s", redirect)
+	}
+
+	params := url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {redirect.Query().Get("code")},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	}
+	rr := env.post(env.handler.Token, params, testClientSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected token status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var tokens TokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.IDToken == "" {
+		t.Fatalf("expected access, refresh and ID tokens, got %+v", tokens)
+	}
+
+	// The ID token is signed with the server key and bound to the client
+	idClaims := &middleware.IDTokenClaims{}
+	if err := env.authService.ParseClaims(tokens.IDToken, idClaims); err != nil {
+		t.Fatalf("failed to verify ID token: %v", err)
+	}
+	if idClaims.Audience != "test-client" || idClaims.Nonce != "n-0S6_WzA2Mj" || idClaims.Email != "test@example.com" || idClaims.Subject != "user_1" {
+		t.Errorf("unexpected ID token claims: %+v", idClaims)
+	}
+
+	// Access tokens for clients are not accepted by the first party API
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/profile", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rr = httptest.NewRecorder()
+	middleware.AuthMiddleware(env.authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected client token to be rejected by AuthMiddleware, got %d", rr.Code)
+	}
+
+	// UserInfo returns the claims granted by scope
+	req = httptest.NewRequest(http.MethodGet, "/oauth/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rr = httptest.NewRecorder()
+	env.handler.UserInfo(rr, req)
+
+	var userInfo UserInfoResponse
+	json.Unmarshal(rr.Body.Bytes(), &userInfo)
+	if rr.Code != http.StatusOK || userInfo.Sub != "user_1" || userInfo.Email != "test@example.com" || userInfo.PreferredUsername != "" {
+		t.Errorf("unexpected userinfo response %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if resp := env.introspect(t, tokens.RefreshToken); !resp.Active || resp.TokenType != "refresh_token" {
+		t.Errorf("expected active refresh token, got %+v", resp)
+	}
+
+	// Refreshing rotates the token and may narrow the scope
+	rr = env.post(env.handler.Token, url.Values{
+		"grant_type":    {grantRefreshToken},
+		"refresh_token": {tokens.RefreshToken},
+		"scope":         {"openid"},
+	}, testClientSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected refresh status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var refreshed TokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &refreshed)
+	if refreshed.Scope != "openid" || refreshed.RefreshToken == tokens.RefreshToken {
+		t.Errorf("expected rotated token with narrowed scope, got %+v", refreshed)
+	}
+
+	// Replaying the code fails and revokes everything issued for it
+	rr = env.post(env.handler.Token, params, testClientSecret)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "invalid_grant") {
+		t.Fatalf("expected invalid_grant for a replayed code, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if resp := env.introspect(t, refreshed.RefreshToken); resp.Active {
+		t.Error("expected refresh token family to be revoked after code replay")
+	}
+}
+
+func TestOAuthHandler_ImpersonationCannotAuthorize(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	token, _, err := env.authService.GenerateToken(middleware.TokenSubject{
+		UserID:   1,
+		Username: "testuser",
+		Email:    "test@example.com",
+		Actor:    &middleware.ActorClaim{Subject: "2", UserID: 2, Username: "support"},
+	})
+	if err != nil {
+		t.Fatalf("failed to generate impersonation token: %v", err)
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"test-client"},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"code_challenge":        {codeChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+params.Encode(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	middleware.OptionalAuthMiddleware(env.authService)(http.HandlerFunc(env.handler.Authorize)).ServeHTTP(rr, req)
+
+	redirect, err := url.Parse(rr.Header().Get("Location"))
+	if rr.Code != http.StatusFound || err != nil {
+		t.Fatalf("expected a redirect, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if redirect.Query().Get("code") != "" || redirect.Query().Get("error") != "access_denied" {
+		t.Errorf("expected access_denied without a code, got %s", redirect)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(params.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr = httptest.NewRecorder()
+	middleware.AuthMiddleware(env.authService)(http.HandlerFunc(env.handler.ApproveAuthorization)).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden || strings.Contains(rr.Body.String(), "code=") {
+		t.Errorf("expected approval to be refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestOAuthHandler_TokenErrors(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	tests := []struct {
+		name           string
+		params         func() url.Values
+		secret         string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name: "wrong code verifier",
+			params: func() url.Values {
+				return url.Values{
+					"grant_type":    {grantAuthorizationCode},
+					"code":          {env.authorizeCode(t)},
+					"code_verifier": {strings.Repeat("a", 43)},
+				}
+			},
+			secret:         testClientSecret,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_grant",
+		},
+		{
+			name: "wrong redirect uri",
+			params: func() url.Values {
+				return url.Values{
+					"grant_type":    {grantAuthorizationCode},
+					"code":          {env.authorizeCode(t)},
+					"redirect_uri":  {"https://evil.example.com/callback"},
+					"code_verifier": {testCodeVerifier},
+				}
+			},
+			secret:         testClientSecret,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_grant",
+		},
+		{
+			name: "wrong client secret",
+			params: func() url.Values {
+				return url.Values{"grant_type": {grantClientCredentials}}
+			},
+			secret:         "wrong-secret",
+			expectedStatus: http.StatusUnauthorized,
+			expectedError:  "invalid_client",
+		},
+		{
+			name: "unsupported grant type",
+			params: func() url.Values {
+				return url.Values{"grant_type": {"password"}}
+			},
+			secret:         testClientSecret,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "unsupported_grant_type",
+		},
+		{
+			name: "scope not registered for client",
+			params: func() url.Values {
+				return url.Values{"grant_type": {grantClientCredentials}, "scope": {"users:delete"}}
+			},
+			secret:         testClientSecret,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "invalid_scope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := env.post(env.handler.Token, tt.params(), tt.secret)
+
+			var resp OAuthErrorResponse
+			json.Unmarshal(rr.Body.Bytes(), &resp)
+			if rr.Code != tt.expectedStatus || resp.Error != tt.expectedError {
+				t.Errorf("expected %d %s, got %d: %s", tt.expectedStatus, tt.expectedError, rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestOAuthHandler_RejectedExchangeKeepsCode(t *testing.T) {
+	env := newOAuthTestEnv(t)
+	env.oauthRepo.clients["other-client"] = &models.OAuthClient{
+		ClientID:     "other-client",
+		SecretHash:   hashSecret("other-secret"),
+		Name:         "Other App",
+		RedirectURIs: []string{testRedirectURI},
+		GrantTypes:   []string{grantAuthorizationCode},
+		Scopes:       []string{"openid"},
+	}
+
+	code := env.authorizeCode(t)
+	params := url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {testCodeVerifier},
+	}
+
+	// Neither a wrong verifier nor another client can use the code up
+	rr := env.post(env.handler.Token, url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {strings.Repeat("a", 43)},
+	}, testClientSecret)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for a wrong verifier, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+	rr = env.postAs(env.handler.Token, "other-client", params, "other-secret")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for another client, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+
+	rr = env.post(env.handler.Token, params, testClientSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected token status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var tokens TokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+
+	// Another client replaying the used code does not revoke what it issued
+	rr = env.postAs(env.handler.Token, "other-client", params, "other-secret")
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for another client's replay, got %d: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+	if resp := env.introspect(t, tokens.RefreshToken); !resp.Active {
+		t.Error("expected refresh token to stay active after another client's replay")
+	}
+}
+
+func TestOAuthHandler_ClientCredentialsAndRevocation(t *testing.T) {
+	env := newOAuthTestEnv(t)
+
+	rr := env.post(env.handler.Token, url.Values{"grant_type": {grantClientCredentials}}, testClientSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected token status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var tokens TokenResponse
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	if tokens.Scope != "users:read" || tokens.RefreshToken != "" || tokens.IDToken != "" {
+		t.Errorf("expected a client token limited to API scopes, got %+v", tokens)
+	}
+	if resp := env.introspect(t, tokens.AccessToken); !resp.Active || resp.Sub != "test-client" {
+		t.Errorf("expected active client token, got %+v", resp)
+	}
+
+	// User tokens can be revoked before they expire
+	rr = env.post(env.handler.Token, url.Values{
+		"grant_type":    {grantAuthorizationCode},
+		"code":          {env.authorizeCode(t)},
+		"code_verifier": {testCodeVerifier},
+	}, testClientSecret)
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+
+	rr = env.post(env.handler.Revoke, url.Values{"token": {tokens.AccessToken}}, testClientSecret)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected revoke status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if resp := env.introspect(t, tokens.AccessToken); resp.Active {
+		t.Error("expected revoked access token to be inactive")
+	}
+
+	// Unknown tokens are accepted silently
+	rr = env.post(env.handler.Revoke, url.Values{"token": {"unknown"}}, testClientSecret)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected revoke status %d for unknown token, got %d", http.StatusOK, rr.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/repository"
+)
+
+type RoleHandler struct {
+	roleRepo repository.RoleRepository
+	userRepo repository.UserRepository
+	logger   zerolog.Logger
+}
+
+type UserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type UserRolesResponse struct {
+	UserID int      `json:"user_id"`
+	Roles  []string `json:"roles"`
+}
+
+func NewRoleHandler(roleRepo repository.RoleRepository, userRepo repository.UserRepository, logger zerolog.Logger) *RoleHandler {
+	return &RoleHandler{
+		roleRepo: roleRepo,
+		userRepo: userRepo,
+		logger:   logger,
+	}
+}
+
+func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	roles, err := h.roleRepo.ListRoles(ctx)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list roles")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list roles")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, roles)
+}
+
+func (h *RoleHandler) GetUserRoles(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	roles, err := h.roleRepo.GetUserRoles(ctx, id)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", id).Msg("Failed to get user roles")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to get user roles")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, UserRolesResponse{
+		UserID: id,
+		Roles:  middleware.WithDefaultRole(roles),
+	})
+}
+
+func (h *RoleHandler) SetUserRoles(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req UserRolesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode request body")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if _, err := h.userRepo.GetUserByID(ctx, id); err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", id).Logger(), err, "User", "Failed to get user")
+		return
+	}
+
+	roles := uniqueStrings(req.Roles)
+	if err := h.roleRepo.SetUserRoles(ctx, id, roles); err != nil {
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			h.sendErrorResponse(w, http.StatusBadRequest, "Unknown role")
+			return
+		}
+		h.logger.Error().Err(err).Int("user_id", id).Msg("Failed to set user roles")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to set user roles")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, UserRolesResponse{
+		UserID: id,
+		Roles:  middleware.WithDefaultRole(roles),
+	})
+	h.logger.Info().Int("user_id", id).Strs("roles", roles).Msg("User roles updated")
+}
+
+func (h *RoleHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *RoleHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
+
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, value := range values {
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
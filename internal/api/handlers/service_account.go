@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+type ServiceAccountHandler struct {
+	apiKeyRepo repository.APIKeyRepository
+	logger     zerolog.Logger
+}
+
+type CreateServiceAccountRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	AllowedIPs []string   `json:"allowed_ips,omitempty"`
+}
+
+// CreateAPIKeyResponse is the only response that contains the key itself.
+type CreateAPIKeyResponse struct {
+	*models.APIKey
+	Key string `json:"key"`
+}
+
+func NewServiceAccountHandler(apiKeyRepo repository.APIKeyRepository, logger zerolog.Logger) *ServiceAccountHandler {
+	return &ServiceAccountHandler{
+		apiKeyRepo: apiKeyRepo,
+		logger:     logger,
+	}
+}
+
+func (h *ServiceAccountHandler) CreateServiceAccount(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req CreateServiceAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode request body")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if len(req.Name) < 3 || len(req.Name) > 64 {
+		h.sendErrorResponse(w, http.StatusBadRequest, "name must be between 3 and 64 characters")
+		return
+	}
+
+	account := &models.ServiceAccount{
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	if principal, ok := middleware.GetPrincipalFromContext(r.Context()); ok && principal.Type == middleware.PrincipalUser {
+		account.CreatedBy = &principal.ID
+	}
+
+	if err := h.apiKeyRepo.CreateServiceAccount(ctx, account); err != nil {
+		if errors.Is(err, repository.ErrServiceAccountExists) {
+			h.sendErrorResponse(w, http.StatusConflict, "Service account with this name already exists")
+			return
+		}
+		h.logger.Error().Err(err).Msg("Failed to create service account")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create service account")
+		return
+	}
+
+	h.logger.Info().Int("service_account_id", account.ID).Str("name", account.Name).Msg("Service account created")
+	h.sendJSONResponse(w, http.StatusCreated, account)
+}
+
+func (h *ServiceAccountHandler) ListServiceAccounts(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	accounts, err := h.apiKeyRepo.ListServiceAccounts(ctx)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to list service accounts")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list service accounts")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, accounts)
+}
+
+func (h *ServiceAccountHandler) DeleteServiceAccount(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid service account ID")
+		return
+	}
+
+	if err := h.apiKeyRepo.DeleteServiceAccount(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrServiceAccountNotFound) {
+			h.sendErrorResponse(w, http.StatusNotFound, "Service account not found")
+			return
+		}
+		h.logger.Error().Err(err).Int("service_account_id", id).Msg("Failed to delete service account")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to delete service account")
+		return
+	}
+
+	h.logger.Info().Int("service_account_id", id).Msg("Service account deleted")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *ServiceAccountHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	accountID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid service account ID")
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error().Err(err).Msg("Failed to decode request body")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	granted, _ := middleware.GetPermissionsFromContext(r.Context())
+	scopes, cidrs, err := h.validateCreateAPIKeyRequest(req, granted)
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.apiKeyRepo.GetServiceAccountByID(ctx, accountID); err != nil {
+		if errors.Is(err, repository.ErrServiceAccountNotFound) {
+			h.sendErrorResponse(w, http.StatusNotFound, "Service account not found")
+			return
+		}
+		h.logger.Error().Err(err).Int("service_account_id", accountID).Msg("Failed to get service account")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	key, prefix, hash, err := middleware.GenerateAPIKey()
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Failed to generate API key")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	apiKey := &models.APIKey{
+		ServiceAccountID: accountID,
+		Name:             strings.TrimSpace(req.Name),
+		Prefix:           prefix,
+		KeyHash:          hash,
+		Scopes:           scopes,
+		AllowedCIDRs:     cidrs,
+		ExpiresAt:        req.ExpiresAt,
+	}
+	if err := h.apiKeyRepo.CreateAPIKey(ctx, apiKey); err != nil {
+		h.logger.Error().Err(err).Int("service_account_id", accountID).Msg("Failed to store API key")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create API key")
+		return
+	}
+
+	h.logger.Info().
+		Int("service_account_id", accountID).
+		Int("api_key_id", apiKey.ID).
+		Str("prefix", prefix).
+		Strs("scopes", scopes).
+		Msg("API key created")
+
+	h.sendJSONResponse(w, http.StatusCreated, CreateAPIKeyResponse{
+		APIKey: apiKey,
+		Key:    key,
+	})
+}
+
+func (h *ServiceAccountHandler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	accountID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid service account ID")
+		return
+	}
+
+	keys, err := h.apiKeyRepo.ListAPIKeys(ctx, accountID)
+	if err != nil {
+		h.logger.Error().Err(err).Int("service_account_id", accountID).Msg("Failed to list API keys")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list API keys")
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, keys)
+}
+
+func (h *ServiceAccountHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid service account ID")
+		return
+	}
+	keyID, err := strconv.Atoi(vars["keyId"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid API key ID")
+		return
+	}
+
+	if err := h.apiKeyRepo.RevokeAPIKey(ctx, accountID, keyID); err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			h.sendErrorResponse(w, http.StatusNotFound, "API key not found")
+			return
+		}
+		h.logger.Error().Err(err).Int("api_key_id", keyID).Msg("Failed to revoke API key")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to revoke API key")
+		return
+	}
+
+	h.logger.Info().Int("service_account_id", accountID).Int("api_key_id", keyID).Msg("API key revoked")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateCreateAPIKeyRequest returns the normalised scopes and networks. A
+// key may only be granted scopes the caller holds itself.
+func (h *ServiceAccountHandler) validateCreateAPIKeyRequest(req CreateAPIKeyRequest, granted []string) ([]string, []string, error) {
+	if len(req.Name) > 64 {
+		return nil, nil, fmt.Errorf("name must be at most 64 characters")
+	}
+
+	scopes := uniqueStrings(req.Scopes)
+	if len(scopes) == 0 {
+		return nil, nil, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if !middleware.HasPermission(granted, scope) {
+			return nil, nil, fmt.Errorf("cannot grant scope %s", scope)
+		}
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	cidrs, err := middleware.ParseCIDRs(req.AllowedIPs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return scopes, cidrs, nil
+}
+
+func (h *ServiceAccountHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *ServiceAccountHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
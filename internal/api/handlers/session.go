@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// SessionHandler lets users see and end their logins, and administrators
+// do the same for any user.
+type SessionHandler struct {
+	sessionRepo repository.SessionRepository
+	sessions    *middleware.SessionStore
+	logger      zerolog.Logger
+}
+
+type SessionResponse struct {
+	*models.Session
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+func NewSessionHandler(sessionRepo repository.SessionRepository, sessions *middleware.SessionStore, logger zerolog.Logger) *SessionHandler {
+	return &SessionHandler{
+		sessionRepo: sessionRepo,
+		sessions:    sessions,
+		logger:      logger,
+	}
+}
+
+// ListSessions returns the caller's active sessions.
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaimsFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	h.listSessions(w, r, claims.UserID)
+}
+
+// RevokeSession ends one of the caller's sessions.
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.GetClaimsFromContext(r.Context())
+	if !ok {
+		h.sendErrorResponse(w, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	h.revokeSession(w, r, claims.UserID)
+}
+
+// ListUserSessions returns the active sessions of any user.
+func (h *SessionHandler) ListUserSessions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	h.listSessions(w, r, userID)
+}
+
+// RevokeUserSession ends a session of any user.
+func (h *SessionHandler) RevokeUserSession(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	h.revokeSession(w, r, userID)
+}
+
+func (h *SessionHandler) listSessions(w http.ResponseWriter, r *http.Request, userID int) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessions, err := h.sessionRepo.ListUserSessions(ctx, userID)
+	if err != nil {
+		h.logger.Error().Err(err).Int("user_id", userID).Msg("Failed to list sessions")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+
+	var currentID string
+	if claims, ok := middleware.GetClaimsFromContext(r.Context()); ok {
+		currentID = claims.SessionID
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			Session: session,
+			Current: session.ID == currentID,
+		})
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// revokeSession ends the session in the URL if it belongs to userID.
+// Sessions of other users are reported as not found.
+func (h *SessionHandler) revokeSession(w http.ResponseWriter, r *http.Request, userID int) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	sessionID := mux.Vars(r)["sessionId"]
+	session, err := h.sessionRepo.GetSession(ctx, sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) || (err == nil && session.UserID != userID) {
+		h.sendErrorResponse(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Str("session_id", sessionID).Msg("Failed to get session")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	if session.RevokedAt == nil {
+		if err := h.sessions.Revoke(ctx, session.ID); err != nil {
+			h.logger.Error().Err(err).Str("session_id", session.ID).Msg("Failed to revoke session")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to revoke session")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	event := h.logger.Info().Int("user_id", userID).Str("session_id", session.ID)
+	if principal, ok := middleware.GetPrincipalFromContext(r.Context()); ok && principal.ID != userID {
+		event = event.Int("revoked_by", principal.ID)
+	}
+	event.Msg("Session revoked")
+}
+
+func (h *SessionHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func (h *SessionHandler) sendErrorResponse(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Error:   http.StatusText(statusCode),
+		Message: message,
+	})
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// Mock session repository for testing. Revoking a session revokes its
+// refresh tokens in refreshRepo, as the real repository does.
+type mockSessionRepository struct {
+	sessions    map[string]*models.Session
+	refreshRepo *mockRefreshTokenRepository
+}
+
+func newMockSessionRepository(refreshRepo *mockRefreshTokenRepository) *mockSessionRepository {
+	return &mockSessionRepository{
+		sessions:    make(map[string]*models.Session),
+		refreshRepo: refreshRepo,
+	}
+}
+
+func (m *mockSessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *mockSessionRepository) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	if session, exists := m.sessions[id]; exists {
+		return session, nil
+	}
+	return nil, repository.ErrSessionNotFound
+}
+
+func (m *mockSessionRepository) ListUserSessions(ctx context.Context, userID int) ([]*models.Session, error) {
+	var sessions []*models.Session
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (m *mockSessionRepository) TouchSessions(ctx context.Context, seen map[string]time.Time) error {
+	for id, at := range seen {
+		if session, exists := m.sessions[id]; exists && session.LastSeenAt.Before(at) {
+			session.LastSeenAt = at
+		}
+	}
+	return nil
+}
+
+func (m *mockSessionRepository) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	session, exists := m.sessions[id]
+	if !exists {
+		return repository.ErrSessionNotFound
+	}
+	session.RevokedAt = &at
+	return m.refreshRepo.RevokeRefreshTokenFamily(ctx, id)
+}
+
+func (m *mockSessionRepository) RevokeUserSessions(ctx context.Context, userID int, at time.Time) ([]string, error) {
+	var ids []string
+	for _, session := range m.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = &at
+			if err := m.refreshRepo.RevokeRefreshTokenFamily(ctx, session.ID); err != nil {
+				return nil, err
+			}
+			ids = append(ids, session.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockSessionRepository) ListRevokedSessions(ctx context.Context, since time.Time) ([]string, error) {
+	var ids []string
+	for _, session := range m.sessions {
+		if session.RevokedAt != nil && session.RevokedAt.After(since) {
+			ids = append(ids, session.ID)
+		}
+	}
+	return ids, nil
+}
+
+func (m *mockSessionRepository) DeleteStaleSessions(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func newTestSessionHandler(t *testing.T) (*SessionHandler, *AuthHandler, *mockSessionRepository) {
+	authHandler, _, refreshRepo := newTestAuthHandler(t)
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	sessionRepo := newMockSessionRepository(refreshRepo)
+	store := middleware.NewSessionStore(sessionRepo, time.Hour, 15*time.Minute, logger)
+	authHandler.authService.SetSessionStore(store)
+	authHandler.SetSessionStore(store)
+	return NewSessionHandler(sessionRepo, store, logger), authHandler, sessionRepo
+}
+
+func loginFrom(t *testing.T, handler *AuthHandler, userAgent string) middleware.LoginResponse {
+	body, _ := json.Marshal(middleware.LoginRequest{Email: "test@example.com", Password: "password123"})
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBuffer(body))
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	rr := httptest.NewRecorder()
+	handler.Login(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected login status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var resp middleware.LoginResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected login response, got: %s", rr.Body.String())
+	}
+	return resp
+}
+
+// serveAuthenticated runs handler behind AuthMiddleware with the given
+// route variables.
+func serveAuthenticated(authService *middleware.AuthService, handler http.HandlerFunc, method, token string, vars map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req = mux.SetURLVars(req, vars)
+	rr := httptest.NewRecorder()
+	middleware.AuthMiddleware(authService)(handler).ServeHTTP(rr, req)
+	return rr
+}
+
+func TestSessionHandler_ListAndRevoke(t *testing.T) {
+	handler, authHandler, sessionRepo := newTestSessionHandler(t)
+	authService := authHandler.authService
+
+	laptop := loginFrom(t, authHandler, "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15")
+	phone := loginFrom(t, authHandler, "Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Mobile Safari/537.36")
+
+	rr := serveAuthenticated(authService, handler.ListSessions, http.MethodGet, laptop.Token, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var sessions []SessionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &sessions); err != nil || len(sessions) != 2 {
+		t.Fatalf("expected two sessions, got: %s", rr.Body.String())
+	}
+
+	var phoneID string
+	for _, session := range sessions {
+		if session.IPAddress != "203.0.113.7" {
+			t.Errorf("expected client IP to be recorded, got %q", session.IPAddress)
+		}
+		switch session.DeviceLabel {
+		case "Safari on macOS":
+			if !session.Current {
+				t.Error("expected the laptop session to be marked current")
+			}
+		case "Chrome on Android":
+			phoneID = session.ID
+			if session.Current {
+				t.Error("expected the phone session not to be marked current")
+			}
+		default:
+			t.Errorf("unexpected device label %q", session.DeviceLabel)
+		}
+	}
+
+	// Another user's session is not found rather than forbidden.
+	sessionRepo.sessions["foreign"] = &models.Session{ID: "foreign", UserID: 2}
+	if rr := serveAuthenticated(authService, handler.RevokeSession, http.MethodDelete, laptop.Token, map[string]string{"sessionId": "foreign"}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected another user's session to be hidden, got %d", rr.Code)
+	}
+
+	if rr := serveAuthenticated(authService, handler.RevokeSession, http.MethodDelete, laptop.Token, map[string]string{"sessionId": phoneID}); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected revoke to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Both the access and the refresh token of the revoked session stop
+	// working; the other session is unaffected.
+	rr = serveAuthenticated(authService, handler.ListSessions, http.MethodGet, phone.Token, nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked session's access token to be rejected, got %d", rr.Code)
+	}
+	if rr := refresh(authHandler, phone.RefreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the revoked session's refresh token to be rejected, got %d", rr.Code)
+	}
+	if rr := refresh(authHandler, laptop.RefreshToken); rr.Code != http.StatusOK {
+		t.Errorf("expected the other session to keep working, got %d", rr.Code)
+	}
+
+	// Refreshed tokens stay in their session.
+	refreshed := refresh(authHandler, login(t, authHandler).RefreshToken)
+	var resp middleware.LoginResponse
+	json.Unmarshal(refreshed.Body.Bytes(), &resp)
+	claims, err := authService.ValidateToken(resp.Token)
+	if err != nil || sessionRepo.sessions[claims.SessionID] == nil {
+		t.Errorf("expected refreshed token to carry its session ID, got %v", err)
+	}
+}
+
+func TestSessionHandler_AdminRevoke(t *testing.T) {
+	handler, authHandler, _ := newTestSessionHandler(t)
+	authService := authHandler.authService
+	session := login(t, authHandler)
+	admin, _, _ := authService.GenerateToken(middleware.TokenSubject{UserID: 99, Username: "admin", Roles: []string{"admin"}})
+
+	rr := serveAuthenticated(authService, handler.ListUserSessions, http.MethodGet, admin, map[string]string{"id": "1"})
+	var sessions []SessionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &sessions); err != nil || len(sessions) != 1 {
+		t.Fatalf("expected one session, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if sessions[0].Current {
+		t.Error("expected another user's session not to be marked current")
+	}
+
+	vars := map[string]string{"id": "1", "sessionId": sessions[0].ID}
+	if rr := serveAuthenticated(authService, handler.RevokeUserSession, http.MethodDelete, admin, vars); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected revoke to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, err := authService.ValidateToken(session.Token); err != middleware.ErrSessionRevoked {
+		t.Errorf("expected %v, got %v", middleware.ErrSessionRevoked, err)
+	}
+
+	vars["id"] = "2"
+	if rr := serveAuthenticated(authService, handler.RevokeUserSession, http.MethodDelete, admin, vars); rr.Code != http.StatusNotFound {
+		t.Errorf("expected a session of another user to be not found, got %d", rr.Code)
+	}
+}
+
+func TestSessionHandler_LogoutAllEndsSessions(t *testing.T) {
+	handler, authHandler, sessionRepo := newTestSessionHandler(t)
+	authService := authHandler.authService
+	laptop := login(t, authHandler)
+	login(t, authHandler)
+	sessionRepo.sessions["foreign"] = &models.Session{ID: "foreign", UserID: 2}
+
+	if rr := serveAuthenticated(authService, authHandler.LogoutAll, http.MethodPost, laptop.Token, nil); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected logout to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The ended sessions are no longer listed; other users keep theirs.
+	if sessions, _ := sessionRepo.ListUserSessions(context.Background(), 1); len(sessions) != 0 {
+		t.Errorf("expected no sessions after logging out everywhere, got %d", len(sessions))
+	}
+	if sessionRepo.sessions["foreign"].RevokedAt != nil {
+		t.Error("expected another user's session to be unaffected")
+	}
+
+	// Tokens issued in the millisecond of the logout are revoked with it
+	time.Sleep(2 * time.Millisecond)
+	session := login(t, authHandler)
+	rr := serveAuthenticated(authService, handler.ListSessions, http.MethodGet, session.Token, nil)
+	var sessions []SessionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &sessions); err != nil || len(sessions) != 1 || !sessions[0].Current {
+		t.Errorf("expected only the new session to be listed, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -2,23 +2,46 @@ package handlers
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
-	"golang.org/x/crypto/bcrypt"
+	"remus_synerge/internal/api/middleware"
 	"remus_synerge/internal/models"
 	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/jsonpatch"
+	"remus_synerge/pkg/passhash"
+	"remus_synerge/pkg/passpolicy"
 )
 
 type UserHandler struct {
-	userRepo repository.UserRepository
-	logger   zerolog.Logger
+	userRepo       repository.UserRepository
+	passwords      passhash.PasswordHasher
+	passwordPolicy *passpolicy.Policy
+	emailVerifier  EmailVerifier
+	tokenRevoker   TokenRevoker
+	logger         zerolog.Logger
+}
+
+// TokenRevoker invalidates the access tokens already issued to a user.
+type TokenRevoker interface {
+	RevokeAllTokens(ctx context.Context, userID int) error
+}
+
+// EmailVerifier sends a verification link for the user's current address.
+type EmailVerifier interface {
+	SendVerificationEmail(ctx context.Context, user *models.User) error
 }
 
 type CreateUserRequest struct {
@@ -34,22 +57,111 @@ type UpdateUserRequest struct {
 }
 
 type UserResponse struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              int        `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	DisplayName     *string    `json:"display_name"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
+}
+
+// UserListResponse is one page of users. NextCursor is empty on the last
+// page and Total is only set when requested with total=true.
+type UserListResponse struct {
+	Users      []UserResponse `json:"users"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	Total      *int           `json:"total,omitempty"`
+}
+
+// UserSearchResponse is one page of search results, best match first.
+type UserSearchResponse struct {
+	Results    []UserSearchHit `json:"results"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// UserSearchHit is a matching user with its relevance and the username and
+// email with the matched words wrapped in <mark> tags, HTML-escaped.
+type UserSearchHit struct {
+	UserResponse
+	Rank      float64           `json:"rank"`
+	Highlight map[string]string `json:"highlight"`
+}
+
+// Page sizes for ListUsers and SearchUsers
+const (
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+const maxUserSearchLength = 100
+
+// userListCursor is the opaque cursor handed to clients. It records the
+// sort order so it cannot be replayed against a different one.
+type userListCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// acceptPatch lists the patch formats PatchUser accepts, for the
+// Accept-Patch header (RFC 5789).
+var acceptPatch = jsonpatch.MergePatchMediaType + ", " + jsonpatch.JSONPatchMediaType
+
+// patchableUserFields are the members of the document PatchUser applies
+// patches to. The password reads as null and can only be set.
+var patchableUserFields = []string{"username", "email", "display_name", "password"}
+
+const maxDisplayNameLength = 100
+
+// userPatch is the validated result of applying a patch.
+type userPatch struct {
+	Username    string
+	Email       string
+	DisplayName *string
+	Password    *string
 }
 
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
+	// Field is the conflicting field of a 409 response, if known.
+	Field string `json:"field,omitempty"`
 }
 
-func NewUserHandler(userRepo repository.UserRepository, logger zerolog.Logger) *UserHandler {
+func NewUserHandler(userRepo repository.UserRepository, passwords passhash.PasswordHasher, logger zerolog.Logger) *UserHandler {
 	return &UserHandler{
-		userRepo: userRepo,
-		logger:   logger,
+		userRepo:       userRepo,
+		passwords:      passwords,
+		passwordPolicy: passpolicy.Default(),
+		logger:         logger,
+	}
+}
+
+// SetPasswordPolicy replaces the default policy for new passwords.
+func (h *UserHandler) SetPasswordPolicy(policy *passpolicy.Policy) {
+	h.passwordPolicy = policy
+}
+
+// SetEmailVerifier enables verification emails for new and changed
+// addresses.
+func (h *UserHandler) SetEmailVerifier(verifier EmailVerifier) {
+	h.emailVerifier = verifier
+}
+
+// SetTokenRevoker makes deleting a user end their access at once rather
+// than when their access tokens expire.
+func (h *UserHandler) SetTokenRevoker(revoker TokenRevoker) {
+	h.tokenRevoker = revoker
+}
+
+func (h *UserHandler) sendVerificationEmail(ctx context.Context, user *models.User) {
+	if h.emailVerifier == nil {
+		return
+	}
+	if err := h.emailVerifier.SendVerificationEmail(ctx, user); err != nil {
+		h.logger.Error().Err(err).Int("user_id", user.ID).Msg("Failed to send verification email")
 	}
 }
 
@@ -70,16 +182,12 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user already exists
-	existingUser, err := h.userRepo.GetUserByEmail(ctx, req.Email)
-	if err == nil && existingUser != nil {
-		h.logger.Error().Str("email", req.Email).Msg("User already exists")
-		h.sendErrorResponse(w, http.StatusConflict, "User with this email already exists")
+	if !h.checkPassword(w, req.Password, req.Username, req.Email) {
 		return
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.passwords.Hash(req.Password)
 	if err != nil {
 		h.logger.Error().Err(err).Msg("Failed to hash password")
 		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process password")
@@ -89,18 +197,21 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	user := &models.User{
 		Username:  req.Username,
 		Email:     req.Email,
-		Password:  string(hashedPassword),
+		Password:  hashedPassword,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
 
+	// The unique indexes reject taken usernames and emails, without racing
+	// a lookup
 	createdUser, err := h.userRepo.CreateUser(ctx, user)
 	if err != nil {
-		h.logger.Error().Err(err).Msg("Failed to create user")
-		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to create user")
+		sendRepositoryError(w, h.logger, err, "User", "Failed to create user")
 		return
 	}
 
+	h.sendVerificationEmail(ctx, createdUser)
+
 	response := UserResponse{
 		ID:        createdUser.ID,
 		Username:  createdUser.Username,
@@ -132,22 +243,285 @@ func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.userRepo.GetUserByID(ctx, id)
 	if err != nil {
-		h.logger.Error().Err(err).Int("user_id", id).Msg("Failed to get user")
-		h.sendErrorResponse(w, http.StatusNotFound, "User not found")
+		sendRepositoryError(w, h.logger.With().Int("user_id", id).Logger(), err, "User", "Failed to get user")
 		return
 	}
 
-	response := UserResponse{
-		ID:        user.ID,
-		Username:  user.Username,
-		Email:     user.Email,
-		CreatedAt: user.CreatedAt,
-		UpdatedAt: user.UpdatedAt,
+	etag := userETag(user)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Accept-Patch", acceptPatch)
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatches(match, etag, true) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, newUserResponse(user))
+}
+
+// ListUsers returns a page of users, filtered by the username, email,
+// created_after, created_before and status query parameters and ordered by
+// sort ("created_at", or "-created_at" for descending). Further pages are
+// fetched by passing back the cursor from the Link header or body.
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	filter, err := parseUserListFilter(r.URL.Query())
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, err := h.userRepo.ListUsers(ctx, filter)
+	if err != nil {
+		sendRepositoryError(w, h.logger, err, "User", "Failed to list users")
+		return
+	}
+
+	response := UserListResponse{
+		Users: make([]UserResponse, 0, len(page.Users)),
+		Total: page.Total,
+	}
+	for _, user := range page.Users {
+		response.Users = append(response.Users, newUserResponse(user))
+	}
+
+	sort := r.URL.Query().Get("sort")
+	links := []string{userListLink(r.URL, "", "first")}
+	if page.Next != nil {
+		response.NextCursor = encodeUserListCursor(userListCursor{Sort: sort, Value: page.Next.Value, ID: page.Next.ID})
+		links = append(links, userListLink(r.URL, response.NextCursor, "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+	if page.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.Itoa(*page.Total))
+	}
+
+	h.sendJSONResponse(w, http.StatusOK, response)
+}
+
+// SearchUsers finds users by username and email for the q query parameter,
+// tolerating typos. Callers without users:read only ever find themselves.
+func (h *UserHandler) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	query := r.URL.Query()
+	search := repository.UserSearch{
+		Query: strings.TrimSpace(query.Get("q")),
+		Limit: defaultUserPageSize,
+	}
+	if len(search.Query) > maxUserSearchLength {
+		h.sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("q must be at most %d characters", maxUserSearchLength))
+		return
+	}
+	terms := repository.SearchTerms(search.Query)
+	if len(terms) == 0 {
+		h.sendErrorResponse(w, http.StatusBadRequest, "q must contain a letter or digit")
+		return
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxUserPageSize {
+			h.sendErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxUserPageSize))
+			return
+		}
+		search.Limit = limit
+	}
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeUserListCursor(value)
+		if _, rankErr := strconv.ParseFloat(cursor.Value, 64); err != nil || rankErr != nil || cursor.Sort != "rank" {
+			h.sendErrorResponse(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		search.After = &repository.UserCursor{Value: cursor.Value, ID: cursor.ID}
+	}
+
+	permissions, _ := middleware.GetPermissionsFromContext(r.Context())
+	if !middleware.HasPermission(permissions, middleware.PermUsersRead) {
+		userID, ok := middleware.GetUserIDFromContext(r.Context())
+		if !ok {
+			h.sendErrorResponse(w, http.StatusForbidden, "Insufficient permissions")
+			return
+		}
+		search.UserID = &userID
+	}
+
+	page, err := h.userRepo.SearchUsers(ctx, search)
+	if err != nil {
+		sendRepositoryError(w, h.logger, err, "User", "Failed to search users")
+		return
+	}
+
+	response := UserSearchResponse{Results: make([]UserSearchHit, 0, len(page.Results))}
+	for _, result := range page.Results {
+		response.Results = append(response.Results, UserSearchHit{
+			UserResponse: newUserResponse(result.User),
+			Rank:         result.Rank,
+			Highlight: map[string]string{
+				"username": highlightTerms(result.User.Username, terms),
+				"email":    highlightTerms(result.User.Email, terms),
+			},
+		})
 	}
 
+	links := []string{userListLink(r.URL, "", "first")}
+	if page.Next != nil {
+		response.NextCursor = encodeUserListCursor(userListCursor{Sort: "rank", Value: page.Next.Value, ID: page.Next.ID})
+		links = append(links, userListLink(r.URL, response.NextCursor, "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+
 	h.sendJSONResponse(w, http.StatusOK, response)
 }
 
+// highlightTerms HTML-escapes value and wraps every case-insensitive
+// occurrence of the terms in <mark> tags. Misspelled matches have nothing
+// to mark.
+func highlightTerms(value string, terms []string) string {
+	lower := strings.ToLower(value)
+	if len(lower) != len(value) {
+		// Lowercasing changed byte offsets; better no marks than wrong ones
+		return html.EscapeString(value)
+	}
+
+	marked := make([]bool, len(value))
+	for _, term := range terms {
+		for start := 0; ; {
+			i := strings.Index(lower[start:], term)
+			if i == -1 {
+				break
+			}
+			for j := start + i; j < start+i+len(term); j++ {
+				marked[j] = true
+			}
+			start += i + len(term)
+		}
+	}
+
+	var b strings.Builder
+	for start := 0; start < len(value); {
+		end := start
+		for end < len(value) && marked[end] == marked[start] {
+			end++
+		}
+		if marked[start] {
+			b.WriteString("<mark>" + html.EscapeString(value[start:end]) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(value[start:end]))
+		}
+		start = end
+	}
+	return b.String()
+}
+
+// parseUserListFilter reads the ListUsers query parameters.
+func parseUserListFilter(query url.Values) (repository.UserListFilter, error) {
+	filter := repository.UserListFilter{
+		UsernamePrefix: query.Get("username"),
+		EmailPrefix:    query.Get("email"),
+		Status:         query.Get("status"),
+		SortBy:         strings.TrimPrefix(query.Get("sort"), "-"),
+		Descending:     strings.HasPrefix(query.Get("sort"), "-"),
+		Limit:          defaultUserPageSize,
+	}
+
+	if filter.SortBy == "" {
+		filter.SortBy = repository.UserSortID
+	}
+	if !containsString(repository.UserSortFields, filter.SortBy) {
+		return filter, fmt.Errorf("sort must be one of %s, optionally prefixed with -", strings.Join(repository.UserSortFields, ", "))
+	}
+	if filter.Status != "" && !containsString(repository.UserStatuses, filter.Status) {
+		return filter, fmt.Errorf("status must be one of %s", strings.Join(repository.UserStatuses, ", "))
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxUserPageSize {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxUserPageSize)
+		}
+		filter.Limit = limit
+	}
+
+	for param, target := range map[string]**time.Time{"created_after": &filter.CreatedAfter, "created_before": &filter.CreatedBefore} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		at, err := parseTimeParam(value)
+		if err != nil {
+			return filter, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", param)
+		}
+		*target = &at
+	}
+
+	if value := query.Get("total"); value != "" {
+		total, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("total must be true or false")
+		}
+		filter.IncludeTotal = total
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeUserListCursor(value)
+		if err != nil || cursor.Sort != query.Get("sort") {
+			return filter, fmt.Errorf("invalid cursor")
+		}
+		filter.After = &repository.UserCursor{Value: cursor.Value, ID: cursor.ID}
+	}
+	return filter, nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+func encodeUserListCursor(cursor userListCursor) string {
+	payload, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func decodeUserListCursor(value string) (userListCursor, error) {
+	var cursor userListCursor
+	payload, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(payload, &cursor)
+	return cursor, err
+}
+
+// userListLink formats an RFC 8288 link to the page of the current query
+// starting at cursor.
+func userListLink(current *url.URL, cursor, rel string) string {
+	query := current.Query()
+	query.Del("cursor")
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+	link := url.URL{Path: current.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", link.String(), rel)
+}
+
+func newUserResponse(user *models.User) UserResponse {
+	return UserResponse{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		DisplayName:     user.DisplayName,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+		DeletedAt:       user.DeletedAt,
+	}
+}
+
 func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 	defer cancel()
@@ -172,11 +546,23 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Support staff acting as the user must not take over the account,
+	// which a new email address would allow through a password reset
+	if _, impersonated := middleware.GetActorFromContext(r.Context()); impersonated && (req.Password != "" || req.Email != "") {
+		h.sendErrorResponse(w, http.StatusForbidden, "Password and email cannot be changed while impersonating a user")
+		return
+	}
+
 	// Get existing user
 	existingUser, err := h.userRepo.GetUserByID(ctx, id)
 	if err != nil {
-		h.logger.Error().Err(err).Int("user_id", id).Msg("Failed to get user")
-		h.sendErrorResponse(w, http.StatusNotFound, "User not found")
+		sendRepositoryError(w, h.logger.With().Int("user_id", id).Logger(), err, "User", "Failed to get user")
+		return
+	}
+
+	// The update only applies to the version the client last saw
+	if match := r.Header.Get("If-Match"); match != "" && !etagMatches(match, userETag(existingUser), false) {
+		h.sendErrorResponse(w, http.StatusPreconditionFailed, "User has been modified since it was read")
 		return
 	}
 
@@ -184,38 +570,236 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if req.Username != "" {
 		existingUser.Username = req.Username
 	}
-	if req.Email != "" {
+	emailChanged := req.Email != "" && req.Email != existingUser.Email
+	if emailChanged {
 		existingUser.Email = req.Email
+		existingUser.EmailVerifiedAt = nil
 	}
 	if req.Password != "" {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if !h.checkPassword(w, req.Password, existingUser.Username, existingUser.Email) {
+			return
+		}
+		hashedPassword, err := h.passwords.Hash(req.Password)
 		if err != nil {
 			h.logger.Error().Err(err).Msg("Failed to hash password")
 			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process password")
 			return
 		}
-		existingUser.Password = string(hashedPassword)
+		existingUser.Password = hashedPassword
 	}
 
-	existingUser.UpdatedAt = time.Now()
+	h.saveUser(ctx, w, r, existingUser, emailChanged)
+}
+
+// PatchUser applies a JSON Merge Patch (RFC 7396) or a JSON Patch
+// (RFC 6902) to the username, email, display_name and password of a user.
+// Unlike PUT, it can clear display_name by setting it to null.
+func (h *UserHandler) PatchUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
 
-	updatedUser, err := h.userRepo.UpdateUser(ctx, existingUser)
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		h.logger.Error().Err(err).Int("user_id", id).Msg("Failed to update user")
-		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to update user")
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
 		return
 	}
 
-	response := UserResponse{
-		ID:        updatedUser.ID,
-		Username:  updatedUser.Username,
-		Email:     updatedUser.Email,
-		CreatedAt: updatedUser.CreatedAt,
-		UpdatedAt: updatedUser.UpdatedAt,
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != jsonpatch.MergePatchMediaType && mediaType != jsonpatch.JSONPatchMediaType {
+		w.Header().Set("Accept-Patch", acceptPatch)
+		h.sendErrorResponse(w, http.StatusUnsupportedMediaType, "Content-Type must be one of "+acceptPatch)
+		return
 	}
 
-	h.sendJSONResponse(w, http.StatusOK, response)
-	h.logger.Info().Int("user_id", id).Msg("User updated successfully")
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1024*1024))
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	// Check the patch before loading the user, so malformed patches and
+	// forbidden paths fail the same way whatever the user's state
+	var apply func(doc map[string]interface{}) (interface{}, error)
+	if mediaType == jsonpatch.MergePatchMediaType {
+		var patch map[string]interface{}
+		if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+			h.sendErrorResponse(w, http.StatusBadRequest, "A merge patch must be a JSON object")
+			return
+		}
+		for field := range patch {
+			if !containsString(patchableUserFields, field) {
+				h.sendErrorResponse(w, http.StatusUnprocessableEntity, fmt.Sprintf("%q cannot be patched", field))
+				return
+			}
+		}
+		apply = func(doc map[string]interface{}) (interface{}, error) {
+			return jsonpatch.MergePatch(doc, patch), nil
+		}
+	} else {
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			h.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for _, op := range patch {
+			if err := checkUserPatchOperation(op); err != nil {
+				h.sendErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+				return
+			}
+		}
+		apply = func(doc map[string]interface{}) (interface{}, error) {
+			return patch.Apply(doc)
+		}
+	}
+
+	existingUser, err := h.userRepo.GetUserByID(ctx, id)
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", id).Logger(), err, "User", "Failed to get user")
+		return
+	}
+	if match := r.Header.Get("If-Match"); match != "" && !etagMatches(match, userETag(existingUser), false) {
+		h.sendErrorResponse(w, http.StatusPreconditionFailed, "User has been modified since it was read")
+		return
+	}
+
+	doc := map[string]interface{}{
+		"username":     existingUser.Username,
+		"email":        existingUser.Email,
+		"display_name": nil,
+		"password":     nil,
+	}
+	if existingUser.DisplayName != nil {
+		doc["display_name"] = *existingUser.DisplayName
+	}
+
+	patched, err := apply(doc)
+	if errors.Is(err, jsonpatch.ErrTestFailed) {
+		h.sendErrorResponse(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	result, problems := validateUserPatch(patched)
+	if len(problems) > 0 {
+		h.sendErrorResponse(w, http.StatusUnprocessableEntity, strings.Join(problems, "; "))
+		return
+	}
+
+	emailChanged := result.Email != existingUser.Email
+	if _, impersonated := middleware.GetActorFromContext(r.Context()); impersonated && (result.Password != nil || emailChanged) {
+		h.sendErrorResponse(w, http.StatusForbidden, "Password and email cannot be changed while impersonating a user")
+		return
+	}
+
+	existingUser.Username = result.Username
+	existingUser.DisplayName = result.DisplayName
+	if emailChanged {
+		existingUser.Email = result.Email
+		existingUser.EmailVerifiedAt = nil
+	}
+	if result.Password != nil {
+		if !h.checkPassword(w, *result.Password, existingUser.Username, existingUser.Email) {
+			return
+		}
+		hashedPassword, err := h.passwords.Hash(*result.Password)
+		if err != nil {
+			h.logger.Error().Err(err).Msg("Failed to hash password")
+			h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process password")
+			return
+		}
+		existingUser.Password = hashedPassword
+	}
+
+	h.saveUser(ctx, w, r, existingUser, emailChanged)
+}
+
+// checkUserPatchOperation only lets JSON Patch operations touch patchable
+// fields, and only set the password, never read it.
+func checkUserPatchOperation(op jsonpatch.Operation) error {
+	pointers := []string{op.Path}
+	if op.Op == "move" || op.Op == "copy" {
+		pointers = append(pointers, op.From)
+	}
+	for _, pointer := range pointers {
+		if !strings.HasPrefix(pointer, "/") || !containsString(patchableUserFields, pointer[1:]) {
+			return fmt.Errorf("%q cannot be patched", pointer)
+		}
+	}
+	if (op.Path == "/password" && op.Op != "add" && op.Op != "replace") || op.From == "/password" {
+		return fmt.Errorf("password can only be set with add or replace")
+	}
+	return nil
+}
+
+// validateUserPatch checks every field of a patched user document and
+// returns the problems found.
+func validateUserPatch(patched interface{}) (userPatch, []string) {
+	var result userPatch
+	var problems []string
+	doc, ok := patched.(map[string]interface{})
+	if !ok {
+		return result, []string{"the patched user must be a JSON object"}
+	}
+
+	result.Username, ok = doc["username"].(string)
+	if !ok || len(result.Username) < 3 || len(result.Username) > 50 {
+		problems = append(problems, "username must be a string of 3 to 50 characters")
+	}
+	result.Email, ok = doc["email"].(string)
+	if !ok || !isValidEmail(result.Email) {
+		problems = append(problems, "email must be a valid email address")
+	}
+
+	switch value := doc["display_name"].(type) {
+	case nil:
+	case string:
+		value = strings.TrimSpace(value)
+		if value == "" || len([]rune(value)) > maxDisplayNameLength {
+			problems = append(problems, fmt.Sprintf("display_name must be null or 1 to %d characters", maxDisplayNameLength))
+		}
+		result.DisplayName = &value
+	default:
+		problems = append(problems, "display_name must be a string or null")
+	}
+
+	switch value := doc["password"].(type) {
+	case nil:
+	case string:
+		result.Password = &value
+	default:
+		problems = append(problems, "password must be a string")
+	}
+	return result, problems
+}
+
+// saveUser stores the changes made to user and responds with the result.
+// A lost race is reported as 412 to conditional requests and 409 otherwise.
+func (h *UserHandler) saveUser(ctx context.Context, w http.ResponseWriter, r *http.Request, user *models.User, emailChanged bool) {
+	user.UpdatedAt = time.Now()
+
+	updatedUser, err := h.userRepo.UpdateUser(ctx, user)
+	if errors.Is(err, repository.ErrUserVersionConflict) {
+		if r.Header.Get("If-Match") != "" {
+			h.sendErrorResponse(w, http.StatusPreconditionFailed, "User has been modified since it was read")
+			return
+		}
+		h.sendErrorResponse(w, http.StatusConflict, "User was modified concurrently, please retry")
+		return
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", user.ID).Logger(), err, "User", "Failed to update user")
+		return
+	}
+
+	if emailChanged {
+		h.sendVerificationEmail(ctx, updatedUser)
+	}
+
+	w.Header().Set("ETag", userETag(updatedUser))
+	h.sendJSONResponse(w, http.StatusOK, newUserResponse(updatedUser))
+	h.logger.Info().Int("user_id", user.ID).Msg("User updated successfully")
 }
 
 func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
@@ -235,17 +819,49 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.userRepo.DeleteUser(ctx, id)
-	if err != nil {
-		h.logger.Error().Err(err).Int("user_id", id).Msg("Failed to delete user")
-		h.sendErrorResponse(w, http.StatusNotFound, "User not found")
+	if err := h.userRepo.DeleteUser(ctx, id); err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", id).Logger(), err, "User", "Failed to delete user")
 		return
 	}
 
+	// Refreshing already fails for a deleted user; this ends their access
+	// tokens too
+	if h.tokenRevoker != nil {
+		if err := h.tokenRevoker.RevokeAllTokens(ctx, id); err != nil {
+			h.logger.Error().Err(err).Int("user_id", id).Msg("Failed to revoke tokens of deleted user")
+		}
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 	h.logger.Info().Int("user_id", id).Msg("User deleted successfully")
 }
 
+// RestoreUser undoes the deletion of a user that has not been purged yet.
+func (h *UserHandler) RestoreUser(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		h.sendErrorResponse(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := h.userRepo.RestoreUser(ctx, id)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		h.sendErrorResponse(w, http.StatusNotFound, "No deleted user with this ID")
+		return
+	}
+	if err != nil {
+		sendRepositoryError(w, h.logger.With().Int("user_id", id).Logger(), err, "User", "Failed to restore user")
+		return
+	}
+
+	w.Header().Set("ETag", userETag(user))
+	h.sendJSONResponse(w, http.StatusOK, newUserResponse(user))
+	h.logger.Info().Int("user_id", id).Msg("User restored")
+}
+
 func (h *UserHandler) validateCreateUserRequest(req CreateUserRequest) error {
 	if req.Username == "" || len(req.Username) < 3 || len(req.Username) > 50 {
 		return fmt.Errorf("username must be between 3 and 50 characters")
@@ -253,12 +869,27 @@ func (h *UserHandler) validateCreateUserRequest(req CreateUserRequest) error {
 	if req.Email == "" || !isValidEmail(req.Email) {
 		return fmt.Errorf("valid email is required")
 	}
-	if req.Password == "" || len(req.Password) < 8 {
-		return fmt.Errorf("password must be at least 8 characters")
+	if req.Password == "" {
+		return fmt.Errorf("password is required")
 	}
 	return nil
 }
 
+// checkPassword applies the password policy and writes the error response
+// when the password is refused.
+func (h *UserHandler) checkPassword(w http.ResponseWriter, password string, userInputs ...string) bool {
+	if err := h.passwordPolicy.Check(password, userInputs...); err != nil {
+		if passpolicy.IsViolation(err) {
+			h.sendErrorResponse(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+		h.logger.Error().Err(err).Msg("Failed to check password policy")
+		h.sendErrorResponse(w, http.StatusInternalServerError, "Failed to process password")
+		return false
+	}
+	return true
+}
+
 func (h *UserHandler) sendJSONResponse(w http.ResponseWriter, statusCode int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
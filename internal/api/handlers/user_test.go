@@ -4,74 +4,80 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
+	"remus_synerge/internal/api/middleware"
 	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/passhash"
+	"remus_synerge/pkg/passpolicy"
 )
 
-// Mock repository for testing
-type mockUserRepository struct {
-	users map[int]*models.User
+// newTestUserRepository returns an empty in-memory user repository.
+func newTestUserRepository() repository.UserRepository {
+	return repository.NewMemoryUserRepository(repository.NewMemoryDB())
 }
 
-func newMockUserRepository() *mockUserRepository {
-	return &mockUserRepository{
-		users: make(map[int]*models.User),
+// addTestUser stores user. Users get IDs 1, 2, ... in the order they are
+// added, and a user that asks for an ID must get it.
+func addTestUser(t *testing.T, repo repository.UserRepository, user *models.User) *models.User {
+	t.Helper()
+	id := user.ID
+	created, err := repo.CreateUser(context.Background(), user)
+	if err != nil {
+		t.Fatalf("failed to add user %s: %v", user.Username, err)
 	}
+	if id != 0 && created.ID != id {
+		t.Fatalf("expected user %s to get ID %d, got %d", user.Username, id, created.ID)
+	}
+	return created
 }
 
-func (m *mockUserRepository) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
-	if user.Email == "existing@example.com" {
-		return nil, errors.New("user already exists")
+// getTestUser returns the stored user with the given ID.
+func getTestUser(t *testing.T, repo repository.UserRepository, id int) *models.User {
+	t.Helper()
+	user, err := repo.GetUserByID(context.Background(), id)
+	if err != nil {
+		t.Fatalf("failed to get user %d: %v", id, err)
 	}
-	
-	user.ID = len(m.users) + 1
-	m.users[user.ID] = user
-	return user, nil
+	return user
 }
 
-func (m *mockUserRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
-	if user, exists := m.users[id]; exists {
-		return user, nil
-	}
-	return nil, errors.New("user not found")
+// unavailableUserRepository fails user lookups as if the database
+// connection had dropped.
+type unavailableUserRepository struct {
+	repository.UserRepository
 }
 
-func (m *mockUserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	for _, user := range m.users {
-		if user.Email == email {
-			return user, nil
-		}
-	}
-	return nil, errors.New("user not found")
+func (r unavailableUserRepository) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	return nil, fmt.Errorf("%w: connection refused", repository.ErrUnavailable)
 }
 
-func (m *mockUserRepository) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
-	if _, exists := m.users[user.ID]; !exists {
-		return nil, errors.New("user not found")
-	}
-	m.users[user.ID] = user
-	return user, nil
+func (r unavailableUserRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return nil, fmt.Errorf("%w: connection refused", repository.ErrUnavailable)
 }
 
-func (m *mockUserRepository) DeleteUser(ctx context.Context, id int) error {
-	if _, exists := m.users[id]; !exists {
-		return errors.New("user not found")
+// newTestPasswordHasher returns an argon2id hasher with minimal cost.
+func newTestPasswordHasher(t *testing.T) passhash.PasswordHasher {
+	hasher, err := passhash.New(passhash.Config{Argon2: passhash.Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}})
+	if err != nil {
+		t.Fatalf("failed to create password hasher: %v", err)
 	}
-	delete(m.users, id)
-	return nil
+	return hasher
 }
 
 func TestUserHandler_CreateUser(t *testing.T) {
 	logger := zerolog.New(zerolog.NewTestWriter(t))
-	mockRepo := newMockUserRepository()
-	handler := NewUserHandler(mockRepo, logger)
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+	addTestUser(t, userRepo, &models.User{Username: "existing", Email: "existing@example.com"})
 
 	tests := []struct {
 		name           string
@@ -118,6 +124,16 @@ func TestUserHandler_CreateUser(t *testing.T) {
 			expectedStatus: http.StatusBadRequest,
 			expectedError:  true,
 		},
+		{
+			name: "email taken",
+			requestBody: CreateUserRequest{
+				Username: "testuser2",
+				Email:    "existing@example.com",
+				Password: "password123",
+			},
+			expectedStatus: http.StatusConflict,
+			expectedError:  true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -150,8 +166,8 @@ func TestUserHandler_CreateUser(t *testing.T) {
 
 func TestUserHandler_GetUser(t *testing.T) {
 	logger := zerolog.New(zerolog.NewTestWriter(t))
-	mockRepo := newMockUserRepository()
-	handler := NewUserHandler(mockRepo, logger)
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
 
 	// Create a test user
 	testUser := &models.User{
@@ -162,7 +178,7 @@ func TestUserHandler_GetUser(t *testing.T) {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	mockRepo.users[1] = testUser
+	addTestUser(t, userRepo, testUser)
 
 	tests := []struct {
 		name           string
@@ -223,8 +239,8 @@ func TestUserHandler_GetUser(t *testing.T) {
 
 func TestUserHandler_UpdateUser(t *testing.T) {
 	logger := zerolog.New(zerolog.NewTestWriter(t))
-	mockRepo := newMockUserRepository()
-	handler := NewUserHandler(mockRepo, logger)
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
 
 	// Create a test user
 	testUser := &models.User{
@@ -235,7 +251,7 @@ func TestUserHandler_UpdateUser(t *testing.T) {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	mockRepo.users[1] = testUser
+	addTestUser(t, userRepo, testUser)
 
 	tests := []struct {
 		name           string
@@ -301,10 +317,52 @@ func TestUserHandler_UpdateUser(t *testing.T) {
 	}
 }
 
+func TestUserHandler_PasswordPolicy(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+	handler.SetPasswordPolicy(&passpolicy.Policy{MinLength: 8, MinScore: 3})
+
+	create := func(password string) *httptest.ResponseRecorder {
+		return postJSON(http.HandlerFunc(handler.CreateUser), "/users", "", CreateUserRequest{
+			Username: "marvin",
+			Email:    "marvin@example.com",
+			Password: password,
+		})
+	}
+	if rr := create("password123"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a common password to be rejected, got %d", rr.Code)
+	}
+	if rr := create("Marvin-x7#Kq9!v"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a password containing the username to be rejected, got %d", rr.Code)
+	}
+	if rr := create("x7#Kq9!vLp2@"); rr.Code != http.StatusCreated {
+		t.Fatalf("expected a strong password to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	update := func(req UpdateUserRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(req)
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodPut, "/users/1", bytes.NewBuffer(body)), map[string]string{"id": "1"})
+		rr := httptest.NewRecorder()
+		handler.UpdateUser(rr, r)
+		return rr
+	}
+	if rr := update(UpdateUserRequest{Password: "qwertyuiop"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected update to apply the policy, got %d", rr.Code)
+	}
+	// The new username counts, not the old one.
+	if rr := update(UpdateUserRequest{Username: "zaphod", Password: "Zaphod-x7#Kq9!v"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a password containing the new username to be rejected, got %d", rr.Code)
+	}
+	if rr := update(UpdateUserRequest{Password: "Lp2@x7#Kq9!v"}); rr.Code != http.StatusOK {
+		t.Errorf("expected a strong password to be accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
 func TestUserHandler_DeleteUser(t *testing.T) {
 	logger := zerolog.New(zerolog.NewTestWriter(t))
-	mockRepo := newMockUserRepository()
-	handler := NewUserHandler(mockRepo, logger)
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
 
 	// Create a test user
 	testUser := &models.User{
@@ -315,7 +373,7 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
 	}
-	mockRepo.users[1] = testUser
+	addTestUser(t, userRepo, testUser)
 
 	tests := []struct {
 		name           string
@@ -363,4 +421,332 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestUserHandler_ListUsers(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	verified := start
+	for i, name := range []string{"alice", "bob", "alfred", "carol", "Albert"} {
+		user := &models.User{ID: i + 1, Username: name, Email: strings.ToLower(name) + "@example.com", CreatedAt: start.AddDate(0, 0, i)}
+		if i%2 == 0 {
+			user.EmailVerifiedAt = &verified
+		}
+		addTestUser(t, userRepo, user)
+	}
+
+	list := func(target string) (*httptest.ResponseRecorder, UserListResponse) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rr := httptest.NewRecorder()
+		handler.ListUsers(rr, req)
+		var resp UserListResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+	usernames := func(resp UserListResponse) string {
+		var names []string
+		for _, user := range resp.Users {
+			names = append(names, user.Username)
+		}
+		return strings.Join(names, ",")
+	}
+
+	// Walk every page by following the Link header
+	var pages []string
+	target := "/api/v1/users?sort=-created_at&limit=2&total=true"
+	for target != "" {
+		rr, resp := list(target)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if resp.Total == nil || *resp.Total != 5 || rr.Header().Get("X-Total-Count") != "5" {
+			t.Errorf("expected a total of 5, got %v", resp.Total)
+		}
+		pages = append(pages, usernames(resp))
+
+		target = ""
+		for _, link := range strings.Split(rr.Header().Get("Link"), ", ") {
+			if strings.HasSuffix(link, `rel="next"`) {
+				target = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+			}
+		}
+		if (target == "") != (resp.NextCursor == "") {
+			t.Errorf("expected the next link to match next_cursor %q", resp.NextCursor)
+		}
+	}
+	if got := strings.Join(pages, "|"); got != "Albert,carol|alfred,bob|alice" {
+		t.Errorf("unexpected pages %s", got)
+	}
+
+	_, resp := list("/api/v1/users?username=AL&status=verified&sort=username")
+	if got := usernames(resp); got != "Albert,alfred,alice" {
+		t.Errorf("expected verified users starting with al, got %s", got)
+	}
+	_, resp = list("/api/v1/users?created_after=2024-01-02&created_before=2024-01-04")
+	if got := usernames(resp); got != "bob,alfred" || resp.Total != nil {
+		t.Errorf("expected users created on Jan 2 and 3 without a total, got %s", got)
+	}
+
+	_, resp = list("/api/v1/users?sort=username&limit=1")
+	for _, target := range []string{
+		"/api/v1/users?sort=password",
+		"/api/v1/users?status=locked",
+		"/api/v1/users?limit=1000",
+		"/api/v1/users?created_after=yesterday",
+		"/api/v1/users?cursor=not-a-cursor",
+		"/api/v1/users?sort=email&cursor=" + resp.NextCursor,
+	} {
+		if rr, _ := list(target); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected, got %d", target, rr.Code)
+		}
+	}
+}
+
+func TestUserHandler_SearchUsers(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+
+	for i, user := range []struct{ username, email string }{
+		{"john_doe", "jd@example.com"},
+		{"mary", "john.smith@example.com"},
+		{"<script>", "johnny@example.com"},
+		{"bob", "bob@example.com"},
+	} {
+		addTestUser(t, userRepo, &models.User{ID: i + 1, Username: user.username, Email: user.email})
+	}
+
+	search := func(target string, userID int, permissions ...string) (*httptest.ResponseRecorder, UserSearchResponse) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		ctx := context.WithValue(req.Context(), "user_id", userID)
+		ctx = context.WithValue(ctx, "permissions", permissions)
+		rr := httptest.NewRecorder()
+		handler.SearchUsers(rr, req.WithContext(ctx))
+		var resp UserSearchResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		return rr, resp
+	}
+
+	rr, resp := search("/api/v1/users/search?q=John&limit=2", 4, middleware.PermUsersRead)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if len(resp.Results) != 2 || resp.Results[0].ID != 1 || resp.Results[1].ID != 2 || resp.NextCursor == "" {
+		t.Fatalf("expected the username match first and a next page, got %+v", resp)
+	}
+	if got := resp.Results[0].Highlight["username"]; got != "<mark>john</mark>_doe" {
+		t.Errorf("unexpected username highlight %q", got)
+	}
+	if got := resp.Results[1].Highlight["email"]; got != "<mark>john</mark>.smith@example.com" {
+		t.Errorf("unexpected email highlight %q", got)
+	}
+	if !strings.Contains(rr.Header().Get("Link"), `rel="next"`) {
+		t.Errorf("expected a next link, got %q", rr.Header().Get("Link"))
+	}
+
+	_, resp = search("/api/v1/users/search?q=John&limit=2&cursor="+resp.NextCursor, 4, middleware.PermUsersRead)
+	if len(resp.Results) != 1 || resp.Results[0].ID != 3 || resp.NextCursor != "" {
+		t.Fatalf("expected the last match on the second page, got %+v", resp)
+	}
+	if got := resp.Results[0].Highlight["username"]; got != "&lt;script&gt;" {
+		t.Errorf("expected the username to be escaped, got %q", got)
+	}
+
+	// Without users:read callers only find themselves
+	if _, resp := search("/api/v1/users/search?q=john", 2); len(resp.Results) != 1 || resp.Results[0].ID != 2 {
+		t.Errorf("expected only the caller, got %+v", resp.Results)
+	}
+
+	for _, target := range []string{"/api/v1/users/search", "/api/v1/users/search?q=--", "/api/v1/users/search?q=john&cursor=bogus"} {
+		if rr, _ := search(target, 4, middleware.PermUsersRead); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected %s to be rejected, got %d", target, rr.Code)
+		}
+	}
+}
+
+type mockTokenRevoker struct {
+	revoked []int
+}
+
+func (m *mockTokenRevoker) RevokeAllTokens(ctx context.Context, userID int) error {
+	m.revoked = append(m.revoked, userID)
+	return nil
+}
+
+func TestUserHandler_RestoreUser(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+	revoker := &mockTokenRevoker{}
+	handler.SetTokenRevoker(revoker)
+
+	addTestUser(t, userRepo, &models.User{ID: 1, Username: "alice", Email: "alice@example.com"})
+	addTestUser(t, userRepo, &models.User{ID: 2, Username: "bob", Email: "bob@example.com"})
+
+	serve := func(handle http.HandlerFunc, method, id string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(method, "/users/"+id, nil), map[string]string{"id": id})
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	if rr := serve(handler.DeleteUser, http.MethodDelete, "1"); rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if len(revoker.revoked) != 1 || revoker.revoked[0] != 1 {
+		t.Errorf("expected the deleted user's tokens to be revoked, got %v", revoker.revoked)
+	}
+	if rr := serve(handler.GetUser, http.MethodGet, "1"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected a deleted user to be hidden, got %d", rr.Code)
+	}
+	if rr := serve(handler.DeleteUser, http.MethodDelete, "1"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected deleting twice to fail, got %d", rr.Code)
+	}
+	if rr := serve(handler.RestoreUser, http.MethodPost, "2"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected restoring a user that is not deleted to fail, got %d", rr.Code)
+	}
+
+	// Deleted users only show up when asked for
+	req := httptest.NewRequest(http.MethodGet, "/users?status=deleted", nil)
+	rr := httptest.NewRecorder()
+	handler.ListUsers(rr, req)
+	var list UserListResponse
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Users) != 1 || list.Users[0].ID != 1 || list.Users[0].DeletedAt == nil {
+		t.Errorf("expected the deleted user, got %+v", list.Users)
+	}
+
+	rr = serve(handler.RestoreUser, http.MethodPost, "1")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := serve(handler.GetUser, http.MethodGet, "1"); rr.Code != http.StatusOK {
+		t.Errorf("expected the restored user, got %d", rr.Code)
+	}
+
+	// The email is free for reuse once deleted, and then blocks the restore
+	serve(handler.DeleteUser, http.MethodDelete, "1")
+	addTestUser(t, userRepo, &models.User{ID: 3, Username: "alice2", Email: "alice@example.com"})
+	if rr := serve(handler.RestoreUser, http.MethodPost, "1"); rr.Code != http.StatusConflict {
+		t.Errorf("expected a conflict, got %d", rr.Code)
+	}
+}
+
+func TestUserHandler_ConditionalRequests(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+	addTestUser(t, userRepo, &models.User{ID: 1, Username: "alice", Email: "alice@example.com", Version: 1})
+
+	serve := func(handle http.HandlerFunc, method string, body interface{}, headers map[string]string) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		req := mux.SetURLVars(httptest.NewRequest(method, "/users/1", bytes.NewBuffer(payload)), map[string]string{"id": "1"})
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		handle(rr, req)
+		return rr
+	}
+
+	rr := serve(handler.GetUser, http.MethodGet, nil, nil)
+	etag := rr.Header().Get("ETag")
+	if rr.Code != http.StatusOK || etag != `"1"` {
+		t.Fatalf("expected the user with an ETag, got %d %q", rr.Code, etag)
+	}
+	if rr := serve(handler.GetUser, http.MethodGet, nil, map[string]string{"If-None-Match": `"0", W/` + etag}); rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected %d without a body, got %d", http.StatusNotModified, rr.Code)
+	}
+
+	// The first admin wins; the second one's update was based on a stale read
+	rr = serve(handler.UpdateUser, http.MethodPut, UpdateUserRequest{Username: "alice1"}, map[string]string{"If-Match": etag})
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected the update to bump the ETag, got %d %q", rr.Code, rr.Header().Get("ETag"))
+	}
+	if rr := serve(handler.UpdateUser, http.MethodPut, UpdateUserRequest{Username: "alice2"}, map[string]string{"If-Match": etag}); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected status %d, got %d", http.StatusPreconditionFailed, rr.Code)
+	}
+	if rr := serve(handler.UpdateUser, http.MethodPut, UpdateUserRequest{Username: "alice2"}, map[string]string{"If-Match": `W/"2"`}); rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected a weak ETag not to satisfy If-Match, got %d", rr.Code)
+	}
+	if getTestUser(t, userRepo, 1).Username != "alice1" {
+		t.Errorf("expected the first update to stick, got %s", getTestUser(t, userRepo, 1).Username)
+	}
+
+	if rr := serve(handler.GetUser, http.MethodGet, nil, map[string]string{"If-None-Match": etag}); rr.Code != http.StatusOK {
+		t.Errorf("expected a stale If-None-Match to return the user, got %d", rr.Code)
+	}
+	if rr := serve(handler.UpdateUser, http.MethodPut, UpdateUserRequest{Username: "alice3"}, map[string]string{"If-Match": "*"}); rr.Code != http.StatusOK {
+		t.Errorf("expected If-Match: * to match, got %d", rr.Code)
+	}
+}
+
+func TestUserHandler_PatchUser(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	userRepo := newTestUserRepository()
+	handler := NewUserHandler(userRepo, newTestPasswordHasher(t), logger)
+	displayName := "Alice"
+	addTestUser(t, userRepo, &models.User{ID: 1, Username: "alice", Email: "alice@example.com", DisplayName: &displayName, Version: 1})
+
+	patch := func(contentType, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(body)), map[string]string{"id": "1"})
+		req.Header.Set("Content-Type", contentType)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rr := httptest.NewRecorder()
+		handler.PatchUser(rr, req)
+		return rr
+	}
+
+	rr := patch("application/merge-patch+json", `{"username":"alice1","display_name":null}`, nil)
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") != `"2"` {
+		t.Fatalf("expected the merge patch to apply, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response UserResponse
+	json.NewDecoder(rr.Body).Decode(&response)
+	if response.Username != "alice1" || response.DisplayName != nil || response.Email != "alice@example.com" {
+		t.Errorf("expected only the patched fields to change, got %+v", response)
+	}
+
+	rr = patch("application/json-patch+json", `[{"op":"test","path":"/username","value":"alice1"},{"op":"add","path":"/display_name","value":" Alice L. "}]`, map[string]string{"If-Match": `"2"`})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the JSON patch to apply, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if user := getTestUser(t, userRepo, 1); user.DisplayName == nil || *user.DisplayName != "Alice L." {
+		t.Errorf("expected the trimmed display name to be stored, got %v", user.DisplayName)
+	}
+
+	for _, tt := range []struct {
+		name, contentType, body string
+		headers                 map[string]string
+		want                    int
+	}{
+		{"failed test", "application/json-patch+json", `[{"op":"test","path":"/username","value":"alice"},{"op":"replace","path":"/username","value":"bob"}]`, nil, http.StatusConflict},
+		{"stale If-Match", "application/merge-patch+json", `{"username":"bob"}`, map[string]string{"If-Match": `"1"`}, http.StatusPreconditionFailed},
+		{"unknown member", "application/merge-patch+json", `{"id":2}`, nil, http.StatusUnprocessableEntity},
+		{"unknown path", "application/json-patch+json", `[{"op":"replace","path":"/email_verified_at","value":null}]`, nil, http.StatusUnprocessableEntity},
+		{"nested path", "application/json-patch+json", `[{"op":"add","path":"/username/0","value":"x"}]`, nil, http.StatusUnprocessableEntity},
+		{"password read", "application/json-patch+json", `[{"op":"copy","from":"/password","path":"/display_name"}]`, nil, http.StatusUnprocessableEntity},
+		{"removed username", "application/json-patch+json", `[{"op":"remove","path":"/username"}]`, nil, http.StatusUnprocessableEntity},
+		{"invalid email", "application/merge-patch+json", `{"email":"not-an-email","display_name":7}`, nil, http.StatusUnprocessableEntity},
+		{"malformed patch", "application/json-patch+json", `{"op":"add"}`, nil, http.StatusBadRequest},
+		{"not a merge patch", "application/merge-patch+json", `["username"]`, nil, http.StatusBadRequest},
+		{"plain JSON", "application/json", `{"username":"bob"}`, nil, http.StatusUnsupportedMediaType},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr := patch(tt.contentType, tt.body, tt.headers); rr.Code != tt.want {
+				t.Errorf("expected status %d, got %d: %s", tt.want, rr.Code, rr.Body.String())
+			}
+		})
+	}
+	if user := getTestUser(t, userRepo, 1); user.Username != "alice1" || user.Version != 3 {
+		t.Errorf("expected rejected patches to leave the user alone, got %+v", user)
+	}
+
+	if rr := patch("application/merge-patch+json", `{"password":"Lp2@x7#Kq9!v"}`, nil); rr.Code != http.StatusOK || getTestUser(t, userRepo, 1).Password == "" {
+		t.Errorf("expected the password to be set, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
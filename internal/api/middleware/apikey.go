@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// APIKeyPrefix marks credentials issued by this service so that leaked keys
+// are easy to recognise in logs and secret scanners.
+const APIKeyPrefix = "rsk_"
+
+var (
+	ErrInvalidAPIKey      = errors.New("invalid api key")
+	ErrAPIKeyExpired      = errors.New("api key has expired")
+	ErrAPIKeyRevoked      = errors.New("api key has been revoked")
+	ErrAPIKeyIPNotAllowed = errors.New("api key is not allowed from this address")
+)
+
+// APIKeyAuthenticator resolves API keys to service account principals.
+type APIKeyAuthenticator struct {
+	repo          repository.APIKeyRepository
+	touchInterval time.Duration
+	logger        zerolog.Logger
+}
+
+func NewAPIKeyAuthenticator(repo repository.APIKeyRepository, logger zerolog.Logger) *APIKeyAuthenticator {
+	return &APIKeyAuthenticator{
+		repo:          repo,
+		touchInterval: time.Minute,
+		logger:        logger,
+	}
+}
+
+// GenerateAPIKey returns a new key, the prefix that identifies it and the
+// hash that is persisted in its place. The key itself is never stored.
+func GenerateAPIKey() (string, string, string, error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+
+	prefix := APIKeyPrefix + hex.EncodeToString(id)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	return key, prefix, HashAPIKey(key), nil
+}
+
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseCIDRs validates an allow list of addresses. Bare IPs are accepted and
+// normalised to single-host networks.
+func ParseCIDRs(values []string) ([]string, error) {
+	cidrs := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address: %s", value)
+			}
+			if ip.To4() != nil {
+				value += "/32"
+			} else {
+				value += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network: %s", value)
+		}
+		cidrs = append(cidrs, network.String())
+	}
+	return cidrs, nil
+}
+
+// Authenticate checks the key and returns the principal it acts as. remoteIP
+// is matched against the key's allow list, if it has one.
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, key, remoteIP string) (*Principal, error) {
+	if !strings.HasPrefix(key, APIKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := a.repo.GetAPIKeyByHash(ctx, HashAPIKey(key))
+	if errors.Is(err, repository.ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if apiKey.RevokedAt != nil {
+		return nil, ErrAPIKeyRevoked
+	}
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return nil, ErrAPIKeyExpired
+	}
+	if !ipAllowed(apiKey.AllowedCIDRs, remoteIP) {
+		return nil, ErrAPIKeyIPNotAllowed
+	}
+
+	account, err := a.repo.GetServiceAccountByID(ctx, apiKey.ServiceAccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > a.touchInterval {
+		go a.touch(apiKey, now)
+	}
+
+	return &Principal{
+		Type:        PrincipalService,
+		ID:          account.ID,
+		Name:        account.Name,
+		Permissions: apiKey.Scopes,
+		APIKeyID:    apiKey.ID,
+	}, nil
+}
+
+// touch records key usage off the request path; it only needs to be roughly
+// accurate, so updates are throttled to touchInterval.
+func (a *APIKeyAuthenticator) touch(key *models.APIKey, usedAt time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.repo.TouchAPIKey(ctx, key.ID, usedAt); err != nil {
+		a.logger.Error().Err(err).Int("api_key_id", key.ID).Msg("Failed to record api key usage")
+	}
+}
+
+func ipAllowed(cidrs []string, remoteIP string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+
+	ip := net.ParseIP(remoteIP)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err == nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
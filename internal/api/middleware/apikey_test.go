@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/config"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// Mock API key repository for testing
+type mockAPIKeyRepository struct {
+	accounts map[int]*models.ServiceAccount
+	keys     map[string]*models.APIKey
+}
+
+func (m *mockAPIKeyRepository) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	account.ID = len(m.accounts) + 1
+	m.accounts[account.ID] = account
+	return nil
+}
+
+func (m *mockAPIKeyRepository) GetServiceAccountByID(ctx context.Context, id int) (*models.ServiceAccount, error) {
+	account, exists := m.accounts[id]
+	if !exists {
+		return nil, repository.ErrServiceAccountNotFound
+	}
+	return account, nil
+}
+
+func (m *mockAPIKeyRepository) ListServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error) {
+	var accounts []*models.ServiceAccount
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (m *mockAPIKeyRepository) DeleteServiceAccount(ctx context.Context, id int) error {
+	delete(m.accounts, id)
+	return nil
+}
+
+func (m *mockAPIKeyRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.ID = len(m.keys) + 1
+	m.keys[key.KeyHash] = key
+	return nil
+}
+
+func (m *mockAPIKeyRepository) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	key, exists := m.keys[keyHash]
+	if !exists {
+		return nil, repository.ErrAPIKeyNotFound
+	}
+	return key, nil
+}
+
+func (m *mockAPIKeyRepository) ListAPIKeys(ctx context.Context, serviceAccountID int) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	for _, key := range m.keys {
+		if key.ServiceAccountID == serviceAccountID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *mockAPIKeyRepository) RevokeAPIKey(ctx context.Context, serviceAccountID, keyID int) error {
+	return nil
+}
+
+func (m *mockAPIKeyRepository) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	return nil
+}
+
+func TestAuthMiddleware_APIKeys(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	authService, err := NewAuthService(config.SecurityConfig{JWTExpiration: 900, Development: true}, logger)
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+
+	repo := &mockAPIKeyRepository{
+		accounts: map[int]*models.ServiceAccount{1: {ID: 1, Name: "batch-export"}},
+		keys:     make(map[string]*models.APIKey),
+	}
+	authService.SetAPIKeyAuthenticator(NewAPIKeyAuthenticator(repo, logger))
+
+	past := time.Now().Add(-time.Hour)
+	newKey := func(expiresAt, revokedAt *time.Time, cidrs []string) string {
+		key, prefix, hash, err := GenerateAPIKey()
+		if err != nil {
+			t.Fatalf("failed to generate api key: %v", err)
+		}
+		repo.CreateAPIKey(context.Background(), &models.APIKey{
+			ServiceAccountID: 1,
+			Prefix:           prefix,
+			KeyHash:          hash,
+			Scopes:           []string{PermUsersRead},
+			AllowedCIDRs:     cidrs,
+			ExpiresAt:        expiresAt,
+			RevokedAt:        revokedAt,
+			LastUsedAt:       &past,
+		})
+		return key
+	}
+
+	validKey := newKey(nil, nil, nil)
+	expiredKey := newKey(&past, nil, nil)
+	revokedKey := newKey(nil, &past, nil)
+	restrictedKey := newKey(nil, nil, []string{"10.0.0.0/8"})
+
+	token, _, err := authService.GenerateToken(TokenSubject{UserID: 7, Username: "testuser", Email: "test@example.com"})
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	var principal *Principal
+	handler := AuthMiddleware(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ = GetPrincipalFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		remoteAddr     string
+		expectedStatus int
+		expectedType   string
+		expectedID     int
+	}{
+		{
+			name:           "bearer token",
+			headers:        map[string]string{"Authorization": "Bearer " + token},
+			expectedStatus: http.StatusOK,
+			expectedType:   PrincipalUser,
+			expectedID:     7,
+		},
+		{
+			name:           "api key in authorization header",
+			headers:        map[string]string{"Authorization": "ApiKey " + validKey},
+			expectedStatus: http.StatusOK,
+			expectedType:   PrincipalService,
+			expectedID:     1,
+		},
+		{
+			name:           "api key in x-api-key header",
+			headers:        map[string]string{"X-API-Key": validKey},
+			expectedStatus: http.StatusOK,
+			expectedType:   PrincipalService,
+			expectedID:     1,
+		},
+		{
+			name:           "unknown api key",
+			headers:        map[string]string{"X-API-Key": APIKeyPrefix + "deadbeef_unknown"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "expired api key",
+			headers:        map[string]string{"X-API-Key": expiredKey},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "revoked api key",
+			headers:        map[string]string{"X-API-Key": revokedKey},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "api key from allowed network",
+			headers:        map[string]string{"X-API-Key": restrictedKey},
+			remoteAddr:     "10.1.2.3:51000",
+			expectedStatus: http.StatusOK,
+			expectedType:   PrincipalService,
+			expectedID:     1,
+		},
+		{
+			name:           "api key from other network ignores forwarded address",
+			headers:        map[string]string{"X-API-Key": restrictedKey, "X-Forwarded-For": "10.1.2.3"},
+			remoteAddr:     "192.0.2.1:51000",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "unknown scheme",
+			headers:        map[string]string{"Authorization": "Basic dXNlcjpwYXNz"},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = nil
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/1", nil)
+			if tt.remoteAddr != "" {
+				req.RemoteAddr = tt.remoteAddr
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			if principal == nil || principal.Type != tt.expectedType || principal.ID != tt.expectedID {
+				t.Errorf("expected %s principal %d, got %+v", tt.expectedType, tt.expectedID, principal)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// AuditLog writes sensitive actions to the audit trail. Every event is also
+// logged, so the trail survives in the logs if the database write fails.
+type AuditLog struct {
+	repo   repository.AuditRepository
+	logger zerolog.Logger
+}
+
+func NewAuditLog(repo repository.AuditRepository, logger zerolog.Logger) *AuditLog {
+	return &AuditLog{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Record appends event to the audit trail.
+func (a *AuditLog) Record(ctx context.Context, event *models.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	a.logger.Info().
+		Str("action", event.Action).
+		Int("actor_id", event.ActorID).
+		Int("user_id", event.UserID).
+		Str("method", event.Method).
+		Str("path", event.Path).
+		Int("status", event.Status).
+		Str("ip", event.IPAddress).
+		Str("reason", event.Reason).
+		Msg("Audit event")
+
+	return a.repo.RecordEvent(ctx, event)
+}
+
+// RecordImpersonation records actor starting to impersonate userID.
+func (a *AuditLog) RecordImpersonation(ctx context.Context, r *http.Request, actor *Principal, userID int, reason string) error {
+	return a.Record(ctx, &models.AuditEvent{
+		Action:    models.AuditImpersonationStart,
+		ActorID:   actor.ID,
+		UserID:    userID,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		IPAddress: getClientIP(r),
+		Reason:    reason,
+	})
+}
+
+// RecordRequest records a request made while impersonating a user. It runs
+// after the handler, so it does not use the request context, which may
+// have been cancelled.
+func (a *AuditLog) RecordRequest(r *http.Request, principal *Principal, status int) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := a.Record(ctx, &models.AuditEvent{
+		Action:    models.AuditImpersonationRequest,
+		ActorID:   principal.Actor.ID,
+		UserID:    principal.ID,
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Status:    status,
+		IPAddress: getClientIP(r),
+	})
+	if err != nil {
+		a.logger.Error().Err(err).Int("actor_id", principal.Actor.ID).Int("user_id", principal.ID).Msg("Failed to record audit event")
+	}
+}
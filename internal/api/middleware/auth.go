@@ -3,61 +3,214 @@ package middleware
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/rs/zerolog"
-	"golang.org/x/crypto/bcrypt"
+	"remus_synerge/internal/config"
+	"remus_synerge/pkg/passhash"
 )
 
 type JWTClaims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	UserID   int      `json:"user_id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles,omitempty"`
+	// SessionID ties the token to the login it came from, so revoking
+	// the session revokes the token.
+	SessionID string `json:"sid,omitempty"`
+	// Actor is set on impersonation tokens and names the user acting as
+	// the subject.
+	Actor *ActorClaim `json:"act,omitempty"`
+	// IssuedAtMillis is the issue time in milliseconds, so that a token
+	// issued right after a revocation cutoff is told apart from one issued
+	// right before it.
+	IssuedAtMillis int64 `json:"iat_ms,omitempty"`
 	jwt.StandardClaims
 }
 
+// ActorClaim is the RFC 8693 "act" claim. The user ID and name are private
+// additions so the actor can be logged without a lookup.
+type ActorClaim struct {
+	Subject  string `json:"sub"`
+	UserID   int    `json:"user_id"`
+	Username string `json:"username,omitempty"`
+}
+
+// Principal types
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
+
+// Principal is the authenticated caller, whichever credential it presented.
+// Service accounts carry the scopes of their API key as permissions.
+type Principal struct {
+	Type        string   `json:"type"`
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"permissions"`
+	APIKeyID    int      `json:"api_key_id,omitempty"`
+	// Actor is the real caller when a user is being impersonated.
+	Actor *Principal `json:"actor,omitempty"`
+}
+
+// TokenSubject describes who an access token is issued to.
+type TokenSubject struct {
+	UserID    int
+	Username  string
+	Email     string
+	Roles     []string
+	SessionID string
+	// Actor makes the token an impersonation token, which expires after
+	// the impersonation TTL.
+	Actor *ActorClaim
+}
+
 type AuthService struct {
-	secretKey []byte
-	logger    zerolog.Logger
+	issuer           string
+	secretKey        []byte
+	keys             *KeyManager
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
+	impersonationTTL time.Duration
+	revocations      *RevocationStore
+	sessions         *SessionStore
+	cookies          *CookieConfig
+	authorizer       *Authorizer
+	apiKeys          *APIKeyAuthenticator
+	certificates     *CertificateAuthenticator
+	audit            *AuditLog
+	passwords        passhash.PasswordHasher
+	logger           zerolog.Logger
 }
 
+// Authorization schemes
+const (
+	schemeBearer = "Bearer"
+	schemeAPIKey = "ApiKey"
+)
+
+var (
+	ErrTokenRevoked   = errors.New("token has been revoked")
+	ErrSessionRevoked = errors.New("session has been revoked")
+)
+
+var (
+	errMissingCredentials = errors.New("missing authorization header")
+	errInvalidAuthHeader  = errors.New("invalid authorization header format")
+	errMissingToken       = errors.New("missing token")
+)
+
 type LoginRequest struct {
 	Email    string `json:"email" validate:"required,email"`
 	Password string `json:"password" validate:"required"`
 }
 
 type LoginResponse struct {
-	Token     string    `json:"token"`
-	ExpiresAt time.Time `json:"expires_at"`
-	User      UserInfo  `json:"user"`
+	Token            string    `json:"token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshToken     string    `json:"refresh_token"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	User             UserInfo  `json:"user"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+type CSRFResponse struct {
+	CSRFToken string `json:"csrf_token"`
 }
 
 type UserInfo struct {
-	ID       int    `json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
+	ID       int      `json:"id"`
+	Username string   `json:"username"`
+	Email    string   `json:"email"`
+	Roles    []string `json:"roles,omitempty"`
 }
 
-func NewAuthService(logger zerolog.Logger) *AuthService {
-	secretKey := os.Getenv("JWT_SECRET_KEY")
-	if secretKey == "" {
-		// Generate a random secret key for development
-		// In production, this should be set as an environment variable
-		logger.Warn().Msg("JWT_SECRET_KEY not set, generating random key")
-		secretKey = generateRandomKey()
+func NewAuthService(cfg config.SecurityConfig, logger zerolog.Logger) (*AuthService, error) {
+	as := &AuthService{
+		issuer:           cfg.OAuthIssuer,
+		accessTokenTTL:   time.Duration(cfg.JWTExpiration) * time.Second,
+		refreshTokenTTL:  time.Duration(cfg.RefreshTokenTTL) * time.Second,
+		impersonationTTL: time.Duration(cfg.ImpersonationTTL) * time.Second,
+		logger:           logger,
+	}
+	if as.impersonationTTL <= 0 || as.impersonationTTL > as.accessTokenTTL {
+		as.impersonationTTL = as.accessTokenTTL
 	}
 	
-	return &AuthService{
-		secretKey: []byte(secretKey),
-		logger:    logger,
+	passwords, err := passhash.New(passhash.Config{
+		Algorithm: cfg.PasswordHashAlg,
+		Argon2: passhash.Argon2Params{
+			Memory:      uint32(cfg.Argon2Memory),
+			Iterations:  uint32(cfg.Argon2Iterations),
+			Parallelism: uint8(cfg.Argon2Parallelism),
+		},
+		BcryptCost: cfg.BcryptCost,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid password hashing configuration: %w", err)
 	}
+	as.passwords = passwords
+	
+	// Asymmetric keys take precedence; a shared secret is still accepted for
+	// verification so HS256 tokens keep working while migrating.
+	if len(cfg.JWTKeyFiles) > 0 || cfg.JWTKeyDir != "" {
+		keys, err := NewKeyManager(KeyManagerConfig{
+			Files:            cfg.JWTKeyFiles,
+			Dir:              cfg.JWTKeyDir,
+			Algorithm:        cfg.JWTSigningAlgorithm,
+			RotationInterval: time.Duration(cfg.JWTKeyRotation) * time.Second,
+			Prepublish:       time.Duration(cfg.JWTKeyPrepublish) * time.Second,
+			Retention:        time.Duration(cfg.JWTKeyRetention) * time.Second,
+		}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load signing keys: %w", err)
+		}
+		as.keys = keys
+	}
+	
+	if cfg.JWTSecret != "" {
+		as.secretKey = []byte(cfg.JWTSecret)
+	}
+	
+	if as.keys == nil && as.secretKey == nil {
+		if !cfg.Development {
+			return nil, fmt.Errorf("no JWT signing key configured: set JWT_KEY_FILES, JWT_KEY_DIR or JWT_SECRET_KEY")
+		}
+		
+		// Tokens signed with a random key do not survive a restart, so this
+		// is only allowed in development
+		logger.Warn().Msg("No JWT signing key configured, generating random key")
+		as.secretKey = []byte(generateRandomKey())
+	}
+	
+	return as, nil
+}
+
+func generateTokenID() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
 }
 
 func generateRandomKey() string {
@@ -68,118 +221,270 @@ func generateRandomKey() string {
 	return hex.EncodeToString(bytes)
 }
 
-func (as *AuthService) GenerateToken(userID int, username, email string) (string, time.Time, error) {
-	expirationTime := time.Now().Add(24 * time.Hour)
+// SetRevocationStore enables revocation checks in ValidateToken.
+func (as *AuthService) SetRevocationStore(store *RevocationStore) {
+	as.revocations = store
+}
+
+// SetSessionStore enables rejecting tokens of revoked sessions in
+// ValidateToken.
+func (as *AuthService) SetSessionStore(store *SessionStore) {
+	as.sessions = store
+}
+
+// SetAPIKeyAuthenticator enables API key authentication in AuthMiddleware.
+func (as *AuthService) SetAPIKeyAuthenticator(authenticator *APIKeyAuthenticator) {
+	as.apiKeys = authenticator
+}
+
+// SetCertificateAuthenticator enables authenticating requests that present
+// no other credential by their verified client certificate.
+func (as *AuthService) SetCertificateAuthenticator(authenticator *CertificateAuthenticator) {
+	as.certificates = authenticator
+}
+
+// SetAuditLog enables recording every request made with an impersonation
+// token.
+func (as *AuthService) SetAuditLog(audit *AuditLog) {
+	as.audit = audit
+}
+
+// SetAuthorizer enables resolving token roles to permissions.
+func (as *AuthService) SetAuthorizer(authorizer *Authorizer) {
+	as.authorizer = authorizer
+}
+
+func (as *AuthService) GenerateToken(subject TokenSubject) (string, time.Time, error) {
+	ttl := as.accessTokenTTL
+	if subject.Actor != nil {
+		ttl = as.impersonationTTL
+	}
+	now := time.Now()
+	expirationTime := now.Add(ttl)
+	
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
 	
 	claims := &JWTClaims{
-		UserID:   userID,
-		Username: username,
-		Email:    email,
+		UserID:         subject.UserID,
+		Username:       subject.Username,
+		Email:          subject.Email,
+		Roles:          subject.Roles,
+		SessionID:      subject.SessionID,
+		Actor:          subject.Actor,
+		IssuedAtMillis: now.UnixMilli(),
 		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
 			ExpiresAt: expirationTime.Unix(),
-			IssuedAt:  time.Now().Unix(),
+			IssuedAt:  now.Unix(),
 			Issuer:    "remus_synerge",
-			Subject:   fmt.Sprintf("user_%d", userID),
+			Subject:   UserSubject(subject.UserID),
 		},
 	}
 	
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(as.secretKey)
+	tokenString, err := as.SignClaims(claims)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+		return "", time.Time{}, err
 	}
 	
 	return tokenString, expirationTime, nil
 }
 
-func (as *AuthService) ValidateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+// SignClaims signs arbitrary claims with the active key.
+func (as *AuthService) SignClaims(claims jwt.Claims) (string, error) {
+	var token *jwt.Token
+	var key interface{}
+	
+	if as.keys != nil {
+		active := as.keys.ActiveKey()
+		token = jwt.NewWithClaims(jwt.GetSigningMethod(active.Algorithm), claims)
+		token.Header["kid"] = active.ID
+		key = active.Private
+	} else {
+		token = jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		key = as.secretKey
+	}
+	
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	
+	return tokenString, nil
+}
+
+// ParseClaims verifies the token signature and decodes it into claims.
+func (as *AuthService) ParseClaims(tokenString string, claims jwt.Claims) error {
+	token, err := jwt.ParseWithClaims(tokenString, claims, as.verificationKey)
+	if err != nil {
+		return fmt.Errorf("failed to parse token: %w", err)
+	}
+	if !token.Valid {
+		return fmt.Errorf("invalid token")
+	}
+	return nil
+}
+
+func (as *AuthService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && as.keys != nil {
+		key := as.keys.Lookup(kid)
+		if key == nil {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+		if token.Method.Alg() != key.Algorithm {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return as.secretKey, nil
-	})
+		return key.Public, nil
+	}
+	
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || as.secretKey == nil {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return as.secretKey, nil
+}
+
+func (as *AuthService) ValidateToken(tokenString string) (*JWTClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, as.verificationKey)
 	
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 	
-	if claims, ok := token.Claims.(*JWTClaims); ok && token.Valid {
-		return claims, nil
+	claims, ok := token.Claims.(*JWTClaims)
+	if !ok || !token.Valid {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	
+	// Tokens issued to OAuth clients are only valid at the client
+	if claims.Audience != "" {
+		return nil, fmt.Errorf("token was issued to an OAuth client")
+	}
+	
+	if as.revocations != nil && as.revocations.IsRevoked(claims) {
+		return nil, ErrTokenRevoked
+	}
+	
+	if as.sessions != nil && claims.SessionID != "" && as.sessions.IsRevoked(claims.SessionID) {
+		return nil, ErrSessionRevoked
 	}
 	
-	return nil, fmt.Errorf("invalid token claims")
+	return claims, nil
 }
 
-func (as *AuthService) HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", fmt.Errorf("failed to hash password: %w", err)
+// RevokeToken invalidates a single access token before its expiry.
+func (as *AuthService) RevokeToken(ctx context.Context, claims *JWTClaims) error {
+	if as.revocations == nil {
+		return fmt.Errorf("token revocation is not configured")
+	}
+	return as.revocations.Revoke(ctx, claims.Id, claims.UserID, time.Unix(claims.ExpiresAt, 0))
+}
+
+// RevokeAllTokens invalidates every access token issued to the user so far
+// and ends the user's sessions, so that they are no longer listed.
+func (as *AuthService) RevokeAllTokens(ctx context.Context, userID int) error {
+	if as.revocations == nil {
+		return fmt.Errorf("token revocation is not configured")
+	}
+	if err := as.revocations.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+	if as.sessions != nil {
+		if err := as.sessions.RevokeUser(ctx, userID); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+	return nil
+}
+
+func (as *AuthService) AccessTokenTTL() time.Duration {
+	return as.accessTokenTTL
+}
+
+// CanActAs reports whether principal holds every permission granted by
+// roles, so impersonating a user with those roles gains it nothing.
+func (as *AuthService) CanActAs(principal *Principal, roles []string) bool {
+	if as.authorizer == nil {
+		return false
+	}
+	for _, permission := range as.authorizer.Permissions(roles) {
+		if !HasPermission(principal.Permissions, permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// GenerateRefreshToken returns a new opaque refresh token together with the
+// hash that is persisted in its place.
+func (as *AuthService) GenerateRefreshToken() (string, string, time.Time, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", time.Time{}, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
-	return string(hashedBytes), nil
+
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+	return token, as.HashRefreshToken(token), time.Now().Add(as.refreshTokenTTL), nil
 }
 
-func (as *AuthService) ComparePassword(hashedPassword, password string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+func (as *AuthService) HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// PasswordHasher returns the hasher used for new passwords.
+func (as *AuthService) PasswordHasher() passhash.PasswordHasher {
+	return as.passwords
+}
+
+func (as *AuthService) HashPassword(password string) (string, error) {
+	return as.passwords.Hash(password)
+}
+
+// VerifyPassword reports whether password matches hashedPassword and, if
+// so, whether the hash is outdated and should be replaced.
+func (as *AuthService) VerifyPassword(hashedPassword, password string) (bool, bool, error) {
+	return as.passwords.Verify(password, hashedPassword)
 }
 
 func AuthMiddleware(authService *AuthService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				authService.logger.Warn().
-					Str("ip", getClientIP(r)).
-					Str("path", r.URL.Path).
-					Msg("Missing authorization header")
-				
-				sendUnauthorizedResponse(w, "Missing authorization header")
-				return
-			}
-			
-			// Check if the header starts with "Bearer "
-			const bearerPrefix = "Bearer "
-			if !strings.HasPrefix(authHeader, bearerPrefix) {
+			ctx, err := authService.authenticate(r)
+			if err != nil {
 				authService.logger.Warn().
+					Err(err).
 					Str("ip", getClientIP(r)).
 					Str("path", r.URL.Path).
-					Msg("Invalid authorization header format")
+					Msg("Authentication failed")
 				
-				sendUnauthorizedResponse(w, "Invalid authorization header format")
+				if errors.Is(err, ErrInvalidCSRFToken) {
+					sendForbiddenResponse(w, "Missing or invalid CSRF token")
+					return
+				}
+				sendUnauthorizedResponse(w, authErrorMessage(err))
 				return
 			}
 			
-			// Extract the token
-			tokenString := authHeader[len(bearerPrefix):]
-			if tokenString == "" {
-				sendUnauthorizedResponse(w, "Missing token")
-				return
+			principal, _ := GetPrincipalFromContext(ctx)
+			event := authService.logger.Debug().
+				Str("principal_type", principal.Type).
+				Int("principal_id", principal.ID).
+				Str("principal", principal.Name).
+				Str("path", r.URL.Path)
+			if principal.Actor != nil {
+				event = event.Int("actor_id", principal.Actor.ID).Str("actor", principal.Actor.Name)
 			}
+			event.Msg("Request authenticated")
 			
-			// Validate the token
-			claims, err := authService.ValidateToken(tokenString)
-			if err != nil {
-				authService.logger.Warn().
-					Err(err).
-					Str("ip", getClientIP(r)).
-					Str("path", r.URL.Path).
-					Msg("Invalid token")
-				
-				sendUnauthorizedResponse(w, "Invalid token")
+			if principal.Actor != nil && authService.audit != nil {
+				rw := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+				next.ServeHTTP(rw, r.WithContext(ctx))
+				authService.audit.RecordRequest(r, principal, rw.statusCode)
 				return
 			}
 			
-			// Add user info to request context
-			ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-			ctx = context.WithValue(ctx, "username", claims.Username)
-			ctx = context.WithValue(ctx, "email", claims.Email)
-			
-			authService.logger.Debug().
-				Int("user_id", claims.UserID).
-				Str("username", claims.Username).
-				Str("path", r.URL.Path).
-				Msg("User authenticated")
-			
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -188,42 +493,195 @@ func AuthMiddleware(authService *AuthService) func(http.Handler) http.Handler {
 func OptionalAuthMiddleware(authService *AuthService) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				// No auth header, continue without user context
-				next.ServeHTTP(w, r)
-				return
-			}
-			
-			const bearerPrefix = "Bearer "
-			if !strings.HasPrefix(authHeader, bearerPrefix) {
-				next.ServeHTTP(w, r)
-				return
-			}
-			
-			tokenString := authHeader[len(bearerPrefix):]
-			if tokenString == "" {
-				next.ServeHTTP(w, r)
-				return
-			}
-			
-			claims, err := authService.ValidateToken(tokenString)
+			ctx, err := authService.authenticate(r)
 			if err != nil {
-				// Invalid token, continue without user context
+				// Missing or invalid credentials, continue without a principal
 				next.ServeHTTP(w, r)
 				return
 			}
 			
-			// Add user info to request context
-			ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
-			ctx = context.WithValue(ctx, "username", claims.Username)
-			ctx = context.WithValue(ctx, "email", claims.Email)
-			
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// requestCredentials extracts the credential presented with the request:
+// a bearer token, or an API key sent as "Authorization: ApiKey <key>" or in
+// the X-API-Key header.
+func requestCredentials(r *http.Request) (string, string, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return schemeAPIKey, key, nil
+	}
+	
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", "", errMissingCredentials
+	}
+	
+	scheme, credential, found := strings.Cut(authHeader, " ")
+	if !found {
+		return "", "", errInvalidAuthHeader
+	}
+	
+	credential = strings.TrimSpace(credential)
+	switch {
+	case strings.EqualFold(scheme, schemeBearer):
+		scheme = schemeBearer
+	case strings.EqualFold(scheme, schemeAPIKey):
+		scheme = schemeAPIKey
+	default:
+		return "", "", errInvalidAuthHeader
+	}
+	
+	if credential == "" {
+		return "", "", errMissingToken
+	}
+	
+	return scheme, credential, nil
+}
+
+// authenticate resolves the request credentials to a principal and returns
+// a context carrying it, and the client certificate if one was verified.
+func (as *AuthService) authenticate(r *http.Request) (context.Context, error) {
+	certificate := clientCertificate(r)
+	ctx, err := as.authenticateCredentials(r, certificate)
+	if err != nil {
+		return nil, err
+	}
+	if certificate != nil {
+		ctx = context.WithValue(ctx, "client_certificate", certificate)
+	}
+	return ctx, nil
+}
+
+func (as *AuthService) authenticateCredentials(r *http.Request, certificate *CertificateIdentity) (context.Context, error) {
+	scheme, credential, err := requestCredentials(r)
+	if errors.Is(err, errMissingCredentials) {
+		// Headers take precedence over the browser session cookie, and
+		// both over the client certificate
+		scheme = schemeBearer
+		credential, err = as.accessTokenFromCookie(r)
+		if errors.Is(err, errMissingCredentials) && certificate != nil && as.certificates != nil {
+			return as.authenticateCertificate(r, certificate)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	if scheme == schemeAPIKey {
+		if as.apiKeys == nil {
+			return nil, ErrInvalidAPIKey
+		}
+		
+		principal, err := as.apiKeys.Authenticate(r.Context(), credential, remoteIP(r))
+		if err != nil {
+			return nil, err
+		}
+		return contextWithPrincipal(r.Context(), principal), nil
+	}
+	
+	claims, err := as.ValidateToken(credential)
+	if err != nil {
+		return nil, err
+	}
+	if as.sessions != nil && claims.SessionID != "" {
+		as.sessions.Touch(claims.SessionID)
+	}
+	return as.contextWithClaims(r.Context(), claims), nil
+}
+
+func (as *AuthService) authenticateCertificate(r *http.Request, certificate *CertificateIdentity) (context.Context, error) {
+	principal, err := as.certificates.Authenticate(r.Context(), certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := r.Context()
+	if principal.Type == PrincipalUser {
+		if as.authorizer != nil {
+			principal.Permissions = as.authorizer.Permissions(principal.Roles)
+		}
+		ctx = context.WithValue(ctx, "user_id", principal.ID)
+		ctx = context.WithValue(ctx, "username", principal.Name)
+	}
+	return contextWithPrincipal(ctx, principal), nil
+}
+
+func authErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, errMissingCredentials):
+		return "Missing authorization header"
+	case errors.Is(err, errInvalidAuthHeader):
+		return "Invalid authorization header format"
+	case errors.Is(err, errMissingToken):
+		return "Missing token"
+	case errors.Is(err, ErrTokenRevoked):
+		return "Token has been revoked"
+	case errors.Is(err, ErrSessionRevoked):
+		return "Session has been revoked"
+	case errors.Is(err, ErrAPIKeyRevoked):
+		return "API key has been revoked"
+	case errors.Is(err, ErrAPIKeyExpired):
+		return "API key has expired"
+	case errors.Is(err, ErrAPIKeyIPNotAllowed):
+		return "API key is not allowed from this address"
+	case errors.Is(err, ErrInvalidAPIKey):
+		return "Invalid API key"
+	case errors.Is(err, ErrCertificateNotBound):
+		return "Client certificate is not bound to an account"
+	default:
+		return "Invalid token"
+	}
+}
+
+// remoteIP returns the address of the connected peer. Unlike getClientIP it
+// ignores forwarding headers, which the client controls.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (as *AuthService) contextWithClaims(ctx context.Context, claims *JWTClaims) context.Context {
+	var permissions []string
+	if as.authorizer != nil {
+		permissions = as.authorizer.Permissions(claims.Roles)
+	}
+	
+	ctx = context.WithValue(ctx, "claims", claims)
+	ctx = context.WithValue(ctx, "user_id", claims.UserID)
+	ctx = context.WithValue(ctx, "username", claims.Username)
+	ctx = context.WithValue(ctx, "email", claims.Email)
+	
+	principal := &Principal{
+		Type:        PrincipalUser,
+		ID:          claims.UserID,
+		Name:        claims.Username,
+		Roles:       claims.Roles,
+		Permissions: permissions,
+	}
+	if claims.Actor != nil {
+		principal.Actor = &Principal{
+			Type: PrincipalUser,
+			ID:   claims.Actor.UserID,
+			Name: claims.Actor.Username,
+		}
+	}
+	return contextWithPrincipal(ctx, principal)
+}
+
+func contextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	if entry, ok := ctx.Value("request_log").(*requestLog); ok {
+		entry.setPrincipal(principal)
+	}
+	ctx = context.WithValue(ctx, "principal", principal)
+	ctx = context.WithValue(ctx, "permissions", principal.Permissions)
+	return ctx
+}
+
 func sendUnauthorizedResponse(w http.ResponseWriter, message string) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusUnauthorized)
@@ -234,6 +692,16 @@ func sendUnauthorizedResponse(w http.ResponseWriter, message string) {
 }
 
 // Helper functions to extract user info from context
+func GetPrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value("principal").(*Principal)
+	return principal, ok
+}
+
+func GetClaimsFromContext(ctx context.Context) (*JWTClaims, bool) {
+	claims, ok := ctx.Value("claims").(*JWTClaims)
+	return claims, ok
+}
+
 func GetUserIDFromContext(ctx context.Context) (int, bool) {
 	userID, ok := ctx.Value("user_id").(int)
 	return userID, ok
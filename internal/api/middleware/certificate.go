@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/repository"
+)
+
+var ErrCertificateNotBound = errors.New("client certificate is not bound to an account")
+
+// Certificate identity kinds, written as "<kind>:<value>", e.g.
+// "dns:billing.internal" or "uri:spiffe://example.org/billing".
+var certificateIdentityKinds = []string{"uri", "dns", "email", "ip", "cn"}
+
+// CertificateIdentity describes the verified client certificate of a
+// request. Names lists the identities the certificate can be bound by, most
+// specific first; Bound is the one that authenticated the request, if any.
+type CertificateIdentity struct {
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SerialNumber string    `json:"serial_number"`
+	Fingerprint  string    `json:"fingerprint"`
+	NotAfter     time.Time `json:"not_after"`
+	Names        []string  `json:"names"`
+	Bound        string    `json:"bound,omitempty"`
+}
+
+// NewCertificateIdentity describes cert. The subject common name is only a
+// fallback for certificates without SANs: a CA may put any common name on a
+// certificate issued for its SANs.
+func NewCertificateIdentity(cert *x509.Certificate) *CertificateIdentity {
+	sum := sha256.Sum256(cert.Raw)
+	identity := &CertificateIdentity{
+		Subject:      cert.Subject.String(),
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+		Fingerprint:  hex.EncodeToString(sum[:]),
+		NotAfter:     cert.NotAfter,
+	}
+
+	for _, uri := range cert.URIs {
+		identity.Names = append(identity.Names, "uri:"+uri.String())
+	}
+	for _, name := range cert.DNSNames {
+		identity.Names = append(identity.Names, "dns:"+strings.ToLower(name))
+	}
+	for _, email := range cert.EmailAddresses {
+		identity.Names = append(identity.Names, "email:"+strings.ToLower(email))
+	}
+	for _, ip := range cert.IPAddresses {
+		identity.Names = append(identity.Names, "ip:"+ip.String())
+	}
+	if len(identity.Names) == 0 && cert.Subject.CommonName != "" {
+		identity.Names = append(identity.Names, "cn:"+cert.Subject.CommonName)
+	}
+	return identity
+}
+
+// NormalizeCertificateIdentity validates an identity for a binding and puts
+// it in the form NewCertificateIdentity produces.
+func NormalizeCertificateIdentity(identity string) (string, error) {
+	kind, value, found := strings.Cut(strings.TrimSpace(identity), ":")
+	kind = strings.ToLower(kind)
+	if !found || value == "" {
+		return "", fmt.Errorf("identity must look like <kind>:<value>, with kind one of %s", strings.Join(certificateIdentityKinds, ", "))
+	}
+
+	switch kind {
+	case "dns", "email":
+		value = strings.ToLower(value)
+	case "ip":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", fmt.Errorf("invalid address: %s", value)
+		}
+		value = ip.String()
+	case "uri", "cn":
+	default:
+		return "", fmt.Errorf("unknown identity kind %q, must be one of %s", kind, strings.Join(certificateIdentityKinds, ", "))
+	}
+	return kind + ":" + value, nil
+}
+
+// clientCertificate returns the identity of the client certificate the TLS
+// handshake verified against the client CA bundle, or nil.
+func clientCertificate(r *http.Request) *CertificateIdentity {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return NewCertificateIdentity(r.TLS.VerifiedChains[0][0])
+}
+
+// CertificateAuthenticator resolves client certificates to the service
+// account or user they are bound to.
+type CertificateAuthenticator struct {
+	repo     repository.CertificateBindingRepository
+	roleRepo repository.RoleRepository
+	logger   zerolog.Logger
+}
+
+func NewCertificateAuthenticator(repo repository.CertificateBindingRepository, roleRepo repository.RoleRepository, logger zerolog.Logger) *CertificateAuthenticator {
+	return &CertificateAuthenticator{
+		repo:     repo,
+		roleRepo: roleRepo,
+		logger:   logger,
+	}
+}
+
+// Authenticate returns the principal identity is bound to and records the
+// name that matched. User principals are returned with their roles but
+// without permissions, which the caller resolves.
+func (a *CertificateAuthenticator) Authenticate(ctx context.Context, identity *CertificateIdentity) (*Principal, error) {
+	if len(identity.Names) == 0 {
+		return nil, ErrCertificateNotBound
+	}
+
+	binding, err := a.repo.FindCertificateBinding(ctx, identity.Names)
+	if errors.Is(err, repository.ErrCertificateBindingNotFound) {
+		return nil, ErrCertificateNotBound
+	}
+	if err != nil {
+		return nil, err
+	}
+	identity.Bound = binding.Identity
+
+	if binding.ServiceAccountID != nil {
+		return &Principal{
+			Type:        PrincipalService,
+			ID:          *binding.ServiceAccountID,
+			Name:        binding.PrincipalName,
+			Permissions: binding.Scopes,
+		}, nil
+	}
+
+	roles, err := a.roleRepo.GetUserRoles(ctx, *binding.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Principal{
+		Type:  PrincipalUser,
+		ID:    *binding.UserID,
+		Name:  binding.PrincipalName,
+		Roles: WithDefaultRole(roles),
+	}, nil
+}
+
+func GetClientCertificateFromContext(ctx context.Context) (*CertificateIdentity, bool) {
+	identity, ok := ctx.Value("client_certificate").(*CertificateIdentity)
+	return identity, ok
+}
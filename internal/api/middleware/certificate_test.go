@@ -0,0 +1,223 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/config"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+type mockCertificateBindingRepository struct {
+	bindings []*models.CertificateBinding
+}
+
+func (m *mockCertificateBindingRepository) CreateCertificateBinding(ctx context.Context, binding *models.CertificateBinding) error {
+	m.bindings = append(m.bindings, binding)
+	return nil
+}
+
+func (m *mockCertificateBindingRepository) FindCertificateBinding(ctx context.Context, identities []string) (*models.CertificateBinding, error) {
+	for _, identity := range identities {
+		for _, binding := range m.bindings {
+			if binding.Identity == identity {
+				return binding, nil
+			}
+		}
+	}
+	return nil, repository.ErrCertificateBindingNotFound
+}
+
+func (m *mockCertificateBindingRepository) ListCertificateBindings(ctx context.Context) ([]*models.CertificateBinding, error) {
+	return m.bindings, nil
+}
+
+func (m *mockCertificateBindingRepository) DeleteCertificateBinding(ctx context.Context, id int) error {
+	return nil
+}
+
+type mockUserRoleRepository struct {
+	repository.RoleRepository
+	roles map[int][]string
+}
+
+func (m *mockUserRoleRepository) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	return m.roles[userID], nil
+}
+
+func testClientCertificate(t *testing.T, template *x509.Certificate) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template.SerialNumber = big.NewInt(42)
+	template.NotBefore = time.Now().Add(-time.Minute)
+	template.NotAfter = time.Now().Add(time.Hour)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestNewCertificateIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	cert := testClientCertificate(t, &x509.Certificate{
+		Subject:        pkix.Name{CommonName: "billing", Organization: []string{"Example"}},
+		URIs:           []*url.URL{spiffe},
+		DNSNames:       []string{"Billing.Internal"},
+		EmailAddresses: []string{"ops@example.com"},
+	})
+
+	identity := NewCertificateIdentity(cert)
+	want := []string{"uri:spiffe://example.org/billing", "dns:billing.internal", "email:ops@example.com"}
+	if !reflect.DeepEqual(identity.Names, want) {
+		t.Errorf("expected names %v, got %v", want, identity.Names)
+	}
+	if identity.Subject != "CN=billing,O=Example" || identity.SerialNumber != "42" || len(identity.Fingerprint) != 64 {
+		t.Errorf("unexpected identity %+v", identity)
+	}
+
+	// The common name only counts when there are no SANs
+	cnOnly := NewCertificateIdentity(testClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}}))
+	if want := []string{"cn:billing"}; !reflect.DeepEqual(cnOnly.Names, want) {
+		t.Errorf("expected names %v, got %v", want, cnOnly.Names)
+	}
+
+	for input, want := range map[string]string{
+		"DNS:Billing.Internal": "dns:billing.internal",
+		"ip:2001:db8::0001":    "ip:2001:db8::1",
+		"cn:billing":           "cn:billing",
+	} {
+		if got, err := NormalizeCertificateIdentity(input); err != nil || got != want {
+			t.Errorf("NormalizeCertificateIdentity(%q) = %q, %v; want %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"billing", "subject:billing", "ip:not-an-ip", "dns:"} {
+		if _, err := NormalizeCertificateIdentity(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestAuthMiddleware_ClientCertificate(t *testing.T) {
+	authService, err := NewAuthService(config.SecurityConfig{JWTSecret: "test-secret", JWTExpiration: 900}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+	userID, accountID := 7, 3
+	bindings := &mockCertificateBindingRepository{bindings: []*models.CertificateBinding{
+		{ID: 1, Identity: "dns:billing.internal", ServiceAccountID: &accountID, Scopes: []string{"users:read"}, PrincipalName: "billing"},
+		{ID: 2, Identity: "cn:ops-console", UserID: &userID, PrincipalName: "ops"},
+	}}
+	roles := &mockUserRoleRepository{roles: map[int][]string{userID: {"admin"}}}
+	authService.SetCertificateAuthenticator(NewCertificateAuthenticator(bindings, roles, zerolog.Nop()))
+
+	serve := func(cert *x509.Certificate, token string) (*httptest.ResponseRecorder, *Principal, *CertificateIdentity) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		var principal *Principal
+		var identity *CertificateIdentity
+		rr := httptest.NewRecorder()
+		AuthMiddleware(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ = GetPrincipalFromContext(r.Context())
+			identity, _ = GetClientCertificateFromContext(r.Context())
+		})).ServeHTTP(rr, req)
+		return rr, principal, identity
+	}
+
+	service := testClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "billing"}, DNSNames: []string{"billing.internal"}})
+	rr, principal, identity := serve(service, "")
+	if rr.Code != http.StatusOK || principal == nil || principal.Type != PrincipalService || principal.ID != accountID {
+		t.Fatalf("expected the service account, got %d %+v", rr.Code, principal)
+	}
+	if !HasPermission(principal.Permissions, "users:read") || identity == nil || identity.Bound != "dns:billing.internal" {
+		t.Errorf("expected the binding's scopes and identity, got %+v %+v", principal, identity)
+	}
+
+	user := testClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ops-console"}})
+	_, principal, _ = serve(user, "")
+	if principal == nil || principal.Type != PrincipalUser || principal.ID != userID || principal.Roles[0] != DefaultRole {
+		t.Errorf("expected the bound user with their roles, got %+v", principal)
+	}
+
+	// A certificate issued for its SANs must not match a common name binding
+	withSANs := testClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ops-console"}, DNSNames: []string{"ops.example.com"}})
+	if rr, principal, _ := serve(withSANs, ""); rr.Code != http.StatusUnauthorized || principal != nil {
+		t.Errorf("expected a certificate with SANs to ignore its common name, got %d %+v", rr.Code, principal)
+	}
+
+	unbound := testClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}})
+	if rr, _, _ := serve(unbound, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unbound certificate to be rejected, got %d", rr.Code)
+	}
+
+	// A bearer token takes precedence, but the certificate is still exposed.
+	token, _, _ := authService.GenerateToken(TokenSubject{UserID: 1, Username: "alice"})
+	_, principal, identity = serve(unbound, token)
+	if principal == nil || principal.ID != 1 || identity == nil || identity.Subject != "CN=unknown" {
+		t.Errorf("expected the token user and the certificate, got %+v %+v", principal, identity)
+	}
+}
+
+func TestAuthMiddleware_ClientCertificateDeletedUser(t *testing.T) {
+	authService, err := NewAuthService(config.SecurityConfig{JWTSecret: "test-secret", JWTExpiration: 900}, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+	ctx := context.Background()
+	db := repository.NewMemoryDB()
+	users := repository.NewMemoryUserRepository(db)
+	bindings := repository.NewMemoryCertificateBindingRepository(db)
+	authService.SetCertificateAuthenticator(NewCertificateAuthenticator(bindings, repository.NewMemoryRoleRepository(db), zerolog.Nop()))
+
+	user, err := users.CreateUser(ctx, &models.User{Username: "ops", Email: "ops@example.com"})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := bindings.CreateCertificateBinding(ctx, &models.CertificateBinding{Identity: "cn:ops-console", UserID: &user.ID}); err != nil {
+		t.Fatalf("failed to bind certificate: %v", err)
+	}
+
+	cert := testClientCertificate(t, &x509.Certificate{Subject: pkix.Name{CommonName: "ops-console"}})
+	serve := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		rr := httptest.NewRecorder()
+		AuthMiddleware(authService)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("expected the bound user to authenticate, got %d", code)
+	}
+	if err := users.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatalf("failed to delete user: %v", err)
+	}
+	if code := serve(); code != http.StatusUnauthorized {
+		t.Errorf("expected a deleted user's certificate to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Cookies set in cookie auth mode. The access and refresh token cookies are
+// HttpOnly; the CSRF cookie is readable by scripts so that they can echo it
+// in CSRFHeader.
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFCookie         = "csrf_token"
+	CSRFHeader         = "X-CSRF-Token"
+)
+
+var ErrInvalidCSRFToken = errors.New("missing or invalid CSRF token")
+
+// CookieConfig enables browser sessions held in cookies instead of tokens
+// kept by JavaScript. RefreshPath limits where the browser sends the refresh
+// token cookie.
+type CookieConfig struct {
+	Domain      string
+	Secure      bool
+	SameSite    http.SameSite
+	RefreshPath string
+}
+
+// ParseSameSite converts "strict", "lax" or "none" to an http.SameSite.
+func ParseSameSite(value string) (http.SameSite, error) {
+	switch strings.ToLower(value) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax", "":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("invalid SameSite mode: %s", value)
+}
+
+// SetCookieConfig enables cookie auth: AuthMiddleware then also accepts the
+// access token cookie, with a double-submit CSRF check for unsafe methods.
+func (as *AuthService) SetCookieConfig(cfg *CookieConfig) {
+	as.cookies = cfg
+}
+
+// CookieAuthEnabled reports whether logins set session cookies.
+func (as *AuthService) CookieAuthEnabled() bool {
+	return as.cookies != nil
+}
+
+// SetSessionCookies stores the tokens of a login or refresh in cookies. The
+// CSRF token is kept across refreshes so that pages holding it keep
+// working; it is returned so it can also be sent in CSRFHeader.
+func (as *AuthService) SetSessionCookies(w http.ResponseWriter, r *http.Request, response *LoginResponse) (string, error) {
+	if as.cookies == nil {
+		return "", nil
+	}
+
+	csrfToken := ""
+	if cookie, err := r.Cookie(CSRFCookie); err == nil && cookie.Value != "" {
+		csrfToken = cookie.Value
+	} else {
+		token, err := generateTokenID()
+		if err != nil {
+			return "", err
+		}
+		csrfToken = token
+	}
+
+	http.SetCookie(w, as.cookie(AccessTokenCookie, response.Token, "/", response.ExpiresAt, true))
+	http.SetCookie(w, as.cookie(RefreshTokenCookie, response.RefreshToken, as.cookies.RefreshPath, response.RefreshExpiresAt, true))
+	http.SetCookie(w, as.cookie(CSRFCookie, csrfToken, "/", response.RefreshExpiresAt, false))
+	w.Header().Set(CSRFHeader, csrfToken)
+	return csrfToken, nil
+}
+
+// ClearSessionCookies removes the cookies set by SetSessionCookies.
+func (as *AuthService) ClearSessionCookies(w http.ResponseWriter) {
+	if as.cookies == nil {
+		return
+	}
+
+	expired := time.Unix(0, 0)
+	http.SetCookie(w, as.cookie(AccessTokenCookie, "", "/", expired, true))
+	http.SetCookie(w, as.cookie(RefreshTokenCookie, "", as.cookies.RefreshPath, expired, true))
+	http.SetCookie(w, as.cookie(CSRFCookie, "", "/", expired, false))
+}
+
+func (as *AuthService) cookie(name, value, path string, expires time.Time, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   as.cookies.Domain,
+		Expires:  expires,
+		Secure:   as.cookies.Secure,
+		HttpOnly: httpOnly,
+		SameSite: as.cookies.SameSite,
+	}
+	if value == "" {
+		cookie.MaxAge = -1
+	}
+	return cookie
+}
+
+// RefreshTokenFromCookie returns the refresh token cookie of a request
+// whose CSRF token checks out. Requests without the cookie return "" and
+// no error.
+func (as *AuthService) RefreshTokenFromCookie(r *http.Request) (string, error) {
+	if as.cookies == nil {
+		return "", nil
+	}
+	cookie, err := r.Cookie(RefreshTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return "", nil
+	}
+	if err := checkCSRF(r); err != nil {
+		return "", err
+	}
+	return cookie.Value, nil
+}
+
+// accessTokenFromCookie returns the access token cookie, checking the CSRF
+// token for methods that change state.
+func (as *AuthService) accessTokenFromCookie(r *http.Request) (string, error) {
+	if as.cookies == nil {
+		return "", errMissingCredentials
+	}
+	cookie, err := r.Cookie(AccessTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return "", errMissingCredentials
+	}
+	if !isSafeMethod(r.Method) {
+		if err := checkCSRF(r); err != nil {
+			return "", err
+		}
+	}
+	return cookie.Value, nil
+}
+
+// checkCSRF compares the CSRF header with the CSRF cookie. Another site can
+// make the browser send the cookie but can neither read it nor set the
+// header.
+func checkCSRF(r *http.Request) error {
+	cookie, err := r.Cookie(CSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return ErrInvalidCSRFToken
+	}
+	header := r.Header.Get(CSRFHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return ErrInvalidCSRFToken
+	}
+	return nil
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// loginStateAudience keeps login state tokens apart from access tokens,
+// which must not have an audience.
+const loginStateAudience = "federated_login"
+
+// LoginStateClaims carry the per-login secrets of an upstream OpenID Connect
+// login from the redirect to the provider until its callback.
+type LoginStateClaims struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	jwt.StandardClaims
+}
+
+// GenerateLoginState signs the claims for use as a short lived cookie.
+func (as *AuthService) GenerateLoginState(claims *LoginStateClaims, ttl time.Duration) (string, error) {
+	now := time.Now()
+	claims.Audience = loginStateAudience
+	claims.Issuer = as.issuer
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(ttl).Unix()
+	return as.SignClaims(claims)
+}
+
+func (as *AuthService) ValidateLoginState(tokenString string) (*LoginStateClaims, error) {
+	claims := &LoginStateClaims{}
+	if err := as.ParseClaims(tokenString, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Audience != loginStateAudience || claims.Issuer != as.issuer || claims.State == "" {
+		return nil, fmt.Errorf("invalid login state")
+	}
+	return claims, nil
+}
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+)
+
+// GetActorFromContext returns the real caller of a request made with an
+// impersonation token.
+func GetActorFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := GetPrincipalFromContext(ctx)
+	if !ok || principal.Actor == nil {
+		return nil, false
+	}
+	return principal.Actor, true
+}
+
+// RejectImpersonation blocks requests made with an impersonation token, for
+// actions only the account owner may take such as changing credentials.
+func RejectImpersonation(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, impersonated := GetActorFromContext(r.Context()); impersonated {
+			sendForbiddenResponse(w, "Not allowed while impersonating a user")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
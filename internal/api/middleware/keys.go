@@ -0,0 +1,542 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/rs/zerolog"
+)
+
+// SigningKey is an asymmetric JWT key. Keys loaded from a public key PEM
+// have no private half and are only used for verification.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	Public    crypto.PublicKey
+	CreatedAt time.Time
+}
+
+type KeyManagerConfig struct {
+	Files            []string
+	Dir              string
+	Algorithm        string
+	RotationInterval time.Duration
+	Prepublish       time.Duration
+	Retention        time.Duration
+}
+
+// KeyManager holds the JWT signing keys. A new key becomes the signing key
+// once it has been published for Prepublish, and a superseded key is kept
+// for verification for Retention after it stopped signing. When a key
+// directory and rotation interval are configured, a fresh key is written to
+// the directory whenever the newest key is older than the interval, so all
+// replicas sharing the directory converge on the same key set.
+type KeyManager struct {
+	mu     sync.RWMutex
+	keys   []*SigningKey
+	config KeyManagerConfig
+	logger zerolog.Logger
+}
+
+// algorithmHeader is the PEM header that records the algorithm of a
+// generated key, since an RSA key alone does not say which hash it signs with.
+const algorithmHeader = "Algorithm"
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// SigningMethodEdDSA implements Ed25519 signatures, which jwt-go v3 lacks.
+var SigningMethodEdDSA = &signingMethodEd25519{}
+
+type signingMethodEd25519 struct{}
+
+func (m *signingMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+func (m *signingMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return errors.New("ed25519: verification error")
+	}
+	return nil
+}
+
+func NewKeyManager(cfg KeyManagerConfig, logger zerolog.Logger) (*KeyManager, error) {
+	if cfg.Algorithm == "" {
+		cfg.Algorithm = "RS256"
+	}
+
+	km := &KeyManager{
+		config: cfg,
+		logger: logger,
+	}
+
+	if err := km.Reload(); err != nil {
+		return nil, err
+	}
+
+	if km.config.Dir != "" && km.config.RotationInterval > 0 {
+		if err := km.rotateIfDue(); err != nil {
+			return nil, err
+		}
+
+		// Start rotation goroutine
+		go km.rotationLoop()
+	}
+
+	if km.ActiveKey() == nil {
+		return nil, fmt.Errorf("no private signing key found")
+	}
+
+	return km, nil
+}
+
+func (km *KeyManager) rotationLoop() {
+	interval := km.config.RotationInterval
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := km.Reload(); err != nil {
+			km.logger.Error().Err(err).Msg("Failed to reload signing keys")
+			continue
+		}
+		if err := km.rotateIfDue(); err != nil {
+			km.logger.Error().Err(err).Msg("Failed to rotate signing key")
+		}
+	}
+}
+
+// Reload reads every configured key file and key directory entry.
+func (km *KeyManager) Reload() error {
+	files := append([]string{}, km.config.Files...)
+
+	if km.config.Dir != "" {
+		matches, err := filepath.Glob(filepath.Join(km.config.Dir, "*.pem"))
+		if err != nil {
+			return fmt.Errorf("failed to list key directory: %w", err)
+		}
+		files = append(files, matches...)
+	}
+
+	keys := make([]*SigningKey, 0, len(files))
+	seen := make(map[string]bool)
+	// RSA keys without an algorithm header sign with the configured RSA
+	// algorithm, or RS256 when another key type is configured.
+	rsaAlgorithm := "RS256"
+	if strings.HasPrefix(km.config.Algorithm, "RS") {
+		rsaAlgorithm = km.config.Algorithm
+	}
+
+	for _, file := range files {
+		key, err := loadSigningKey(file, rsaAlgorithm)
+		if err != nil {
+			return err
+		}
+		if seen[key.ID] {
+			continue
+		}
+		seen[key.ID] = true
+		keys = append(keys, key)
+	}
+
+	// Newest first
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.After(keys[j].CreatedAt)
+	})
+
+	km.mu.Lock()
+	km.keys = keys
+	km.mu.Unlock()
+
+	return nil
+}
+
+func (km *KeyManager) rotateIfDue() error {
+	km.mu.RLock()
+	var newest *SigningKey
+	for _, key := range km.keys {
+		if key.Private != nil {
+			newest = key
+			break
+		}
+	}
+	km.mu.RUnlock()
+
+	if newest != nil && time.Since(newest.CreatedAt) < km.config.RotationInterval {
+		return nil
+	}
+
+	key, err := GenerateSigningKey(km.config.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	path := filepath.Join(km.config.Dir, key.ID+".pem")
+	data := pem.EncodeToMemory(&pem.Block{
+		Type:    "PRIVATE KEY",
+		Headers: map[string]string{algorithmHeader: key.Algorithm},
+		Bytes:   der,
+	})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write signing key: %w", err)
+	}
+
+	km.logger.Info().
+		Str("kid", key.ID).
+		Str("alg", key.Algorithm).
+		Msg("Generated new signing key")
+
+	return km.Reload()
+}
+
+// ActiveKey returns the key new tokens are signed with.
+func (km *KeyManager) ActiveKey() *SigningKey {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	var fallback *SigningKey
+	for _, key := range km.keys {
+		if key.Private == nil {
+			continue
+		}
+		if fallback == nil {
+			fallback = key
+		}
+		if time.Since(key.CreatedAt) >= km.config.Prepublish {
+			return key
+		}
+	}
+
+	return fallback
+}
+
+// VerificationKeys returns the keys tokens may currently be verified with:
+// the active key, keys waiting to become active, and recently retired keys.
+func (km *KeyManager) VerificationKeys() []*SigningKey {
+	active := km.ActiveKey()
+
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	var keys []*SigningKey
+	var supersededAt time.Time
+	for _, key := range km.keys {
+		if active == nil || !key.CreatedAt.Before(active.CreatedAt) {
+			keys = append(keys, key)
+		} else if km.config.Retention <= 0 || time.Since(supersededAt) < km.config.Retention {
+			keys = append(keys, key)
+		}
+
+		// A key stops signing once its successor has been published long enough
+		supersededAt = key.CreatedAt.Add(km.config.Prepublish)
+	}
+
+	return keys
+}
+
+func (km *KeyManager) Lookup(kid string) *SigningKey {
+	for _, key := range km.VerificationKeys() {
+		if key.ID == kid {
+			return key
+		}
+	}
+	return nil
+}
+
+func (km *KeyManager) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range km.VerificationKeys() {
+		jwk, err := publicJWK(key.Public)
+		if err != nil {
+			continue
+		}
+		jwk.KeyID = key.ID
+		jwk.Use = "sig"
+		jwk.Algorithm = key.Algorithm
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// GenerateSigningKey creates a new key pair for the given JWS algorithm.
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case "RS256", "RS384", "RS512":
+		signer, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "ES256":
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case "ES384":
+		signer, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case "ES512":
+		signer, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case "EdDSA":
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	kid, err := keyThumbprint(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        kid,
+		Algorithm: algorithm,
+		Private:   signer,
+		Public:    signer.Public(),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+func loadSigningKey(path, rsaAlgorithm string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file %s: %w", path, err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat key file %s: %w", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found in %s", path)
+	}
+
+	key := &SigningKey{CreatedAt: info.ModTime()}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key in %s", path)
+		}
+		key.Private = signer
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+		}
+		key.Private = parsed
+	case "EC PRIVATE KEY":
+		parsed, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+		}
+		key.Private = parsed
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key file %s: %w", path, err)
+		}
+		key.Public = parsed
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q in %s", block.Type, path)
+	}
+
+	if key.Private != nil {
+		key.Public = key.Private.Public()
+	}
+
+	marked := block.Headers[algorithmHeader]
+	if marked != "" {
+		rsaAlgorithm = marked
+	}
+	key.Algorithm, err = algorithmForKey(key.Public, rsaAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if marked != "" && marked != key.Algorithm {
+		return nil, fmt.Errorf("%s: %s key is marked as %s", path, key.Algorithm, marked)
+	}
+
+	key.ID, err = keyThumbprint(key.Public)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return key, nil
+}
+
+// algorithmForKey returns the JWS algorithm of a key. Only RSA keys can
+// sign with more than one, so they take rsaAlgorithm.
+func algorithmForKey(publicKey crypto.PublicKey, rsaAlgorithm string) (string, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		switch rsaAlgorithm {
+		case "RS256", "RS384", "RS512":
+			return rsaAlgorithm, nil
+		}
+		return "", fmt.Errorf("unsupported RSA algorithm %s", rsaAlgorithm)
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		case elliptic.P521():
+			return "ES512", nil
+		}
+		return "", fmt.Errorf("unsupported elliptic curve %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", publicKey)
+}
+
+func publicJWK(publicKey crypto.PublicKey) (JWK, error) {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType: "RSA",
+			N:       encode(key.N.Bytes()),
+			E:       encode(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			KeyType: "EC",
+			Curve:   key.Curve.Params().Name,
+			X:       encode(padBytes(key.X.Bytes(), size)),
+			Y:       encode(padBytes(key.Y.Bytes(), size)),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       encode(key),
+		}, nil
+	}
+	return JWK{}, fmt.Errorf("unsupported key type %T", publicKey)
+}
+
+// keyThumbprint computes the RFC 7638 JWK thumbprint used as the kid, so
+// every replica derives the same ID for the same key.
+func keyThumbprint(publicKey crypto.PublicKey) (string, error) {
+	jwk, err := publicJWK(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	var members []string
+	switch jwk.KeyType {
+	case "RSA":
+		members = []string{`"e":"` + jwk.E + `"`, `"kty":"RSA"`, `"n":"` + jwk.N + `"`}
+	case "EC":
+		members = []string{`"crv":"` + jwk.Curve + `"`, `"kty":"EC"`, `"x":"` + jwk.X + `"`, `"y":"` + jwk.Y + `"`}
+	case "OKP":
+		members = []string{`"crv":"` + jwk.Curve + `"`, `"kty":"OKP"`, `"x":"` + jwk.X + `"`}
+	}
+
+	sum := sha256.Sum256([]byte("{" + strings.Join(members, ",") + "}"))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func padBytes(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
+
+// JWKS endpoint handler
+func JWKSHandler(authService *AuthService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		set := JWKSet{Keys: []JWK{}}
+		if authService.keys != nil {
+			set = authService.keys.JWKS()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		w.WriteHeader(http.StatusOK)
+
+		if err := json.NewEncoder(w).Encode(set); err != nil {
+			authService.logger.Error().Err(err).Msg("Failed to encode JWKS response")
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/config"
+)
+
+func writeTestKey(t *testing.T, dir, algorithm string, createdAt time.Time) *SigningKey {
+	key, err := GenerateSigningKey(algorithm)
+	if err != nil {
+		t.Fatalf("failed to generate %s key: %v", algorithm, err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		t.Fatalf("failed to encode key: %v", err)
+	}
+
+	path := filepath.Join(dir, key.ID+".pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("failed to write key: %v", err)
+	}
+	if err := os.Chtimes(path, createdAt, createdAt); err != nil {
+		t.Fatalf("failed to set key time: %v", err)
+	}
+
+	return key
+}
+
+func TestAuthService_AsymmetricSigning(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+
+	for _, algorithm := range []string{"RS256", "ES256", "EdDSA"} {
+		t.Run(algorithm, func(t *testing.T) {
+			dir := t.TempDir()
+			key := writeTestKey(t, dir, algorithm, time.Now().Add(-time.Hour))
+
+			authService, err := NewAuthService(config.SecurityConfig{
+				JWTKeyDir:     dir,
+				JWTExpiration: 900,
+			}, logger)
+			if err != nil {
+				t.Fatalf("failed to create auth service: %v", err)
+			}
+
+			token, _, err := authService.GenerateToken(TokenSubject{UserID: 1, Username: "testuser", Email: "test@example.com"})
+			if err != nil {
+				t.Fatalf("failed to generate token: %v", err)
+			}
+
+			claims, err := authService.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("failed to validate token: %v", err)
+			}
+			if claims.UserID != 1 {
+				t.Errorf("expected user ID 1, got %d", claims.UserID)
+			}
+
+			// A service holding only the JWKS can verify the token too
+			rr := httptest.NewRecorder()
+			JWKSHandler(authService)(rr, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+
+			var set JWKSet
+			if err := json.Unmarshal(rr.Body.Bytes(), &set); err != nil {
+				t.Fatalf("expected JWKS response, got: %s", rr.Body.String())
+			}
+			if len(set.Keys) != 1 || set.Keys[0].KeyID != key.ID || set.Keys[0].Algorithm != algorithm {
+				t.Errorf("expected JWKS with key %s (%s), got %+v", key.ID, algorithm, set.Keys)
+			}
+		})
+	}
+}
+
+func TestKeyManager_Rotation(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	dir := t.TempDir()
+	now := time.Now()
+
+	retired := writeTestKey(t, dir, "ES256", now.Add(-72*time.Hour))
+	previous := writeTestKey(t, dir, "ES256", now.Add(-26*time.Hour))
+	current := writeTestKey(t, dir, "ES256", now.Add(-2*time.Hour))
+	pending := writeTestKey(t, dir, "ES256", now.Add(-time.Minute))
+
+	km, err := NewKeyManager(KeyManagerConfig{
+		Dir:        dir,
+		Prepublish: 5 * time.Minute,
+		Retention:  24 * time.Hour,
+	}, logger)
+	if err != nil {
+		t.Fatalf("failed to create key manager: %v", err)
+	}
+
+	if active := km.ActiveKey(); active.ID != current.ID {
+		t.Errorf("expected active key %s, got %s", current.ID, active.ID)
+	}
+
+	tests := []struct {
+		name     string
+		key      *SigningKey
+		expected bool
+	}{
+		{name: "pending key is published", key: pending, expected: true},
+		{name: "active key is published", key: current, expected: true},
+		{name: "recently retired key is published", key: previous, expected: true},
+		{name: "expired key is dropped", key: retired, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if found := km.Lookup(tt.key.ID) != nil; found != tt.expected {
+				t.Errorf("expected lookup result %v, got %v", tt.expected, found)
+			}
+		})
+	}
+
+	// Rotation generates a new key once the newest one is older than the interval
+	km.config.RotationInterval = 30 * time.Second
+	if err := km.rotateIfDue(); err != nil {
+		t.Fatalf("failed to rotate: %v", err)
+	}
+	if keys := km.VerificationKeys(); len(keys) != 4 {
+		t.Errorf("expected 4 verification keys after rotation, got %d", len(keys))
+	}
+}
+
+func TestKeyManager_RSAAlgorithm(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+
+	// A generated key records its algorithm, so it survives a restart with
+	// a different JWT_SIGNING_ALG.
+	dir := t.TempDir()
+	km, err := NewKeyManager(KeyManagerConfig{Dir: dir, Algorithm: "RS384", RotationInterval: time.Hour}, logger)
+	if err != nil {
+		t.Fatalf("failed to create key manager: %v", err)
+	}
+	generated := km.ActiveKey()
+	if generated.Algorithm != "RS384" {
+		t.Fatalf("expected a generated RS384 key, got %s", generated.Algorithm)
+	}
+
+	reloaded, err := NewKeyManager(KeyManagerConfig{Dir: dir, Algorithm: "RS256"}, logger)
+	if err != nil {
+		t.Fatalf("failed to reload key manager: %v", err)
+	}
+	if key := reloaded.Lookup(generated.ID); key == nil || key.Algorithm != "RS384" {
+		t.Errorf("expected key %s to reload as RS384, got %+v", generated.ID, key)
+	}
+
+	// Keys without the header take the configured RSA algorithm
+	dir = t.TempDir()
+	key := writeTestKey(t, dir, "RS256", time.Now().Add(-time.Hour))
+	km, err = NewKeyManager(KeyManagerConfig{Dir: dir, Algorithm: "RS512"}, logger)
+	if err != nil {
+		t.Fatalf("failed to create key manager: %v", err)
+	}
+	if loaded := km.Lookup(key.ID); loaded == nil || loaded.Algorithm != "RS512" {
+		t.Errorf("expected key %s to load as RS512, got %+v", key.ID, loaded)
+	}
+}
+
+func TestAuthService_RequiresSigningKey(t *testing.T) {
+	logger := zerolog.New(zerolog.NewTestWriter(t))
+	if _, err := NewAuthService(config.SecurityConfig{}, logger); err == nil {
+		t.Error("expected an error when no signing key is configured")
+	}
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -24,6 +26,25 @@ func (rw *responseWriter) Write(b []byte) (int, error) {
 	return size, err
 }
 
+// requestLog carries the authenticated principal back to LoggingMiddleware,
+// which runs before AuthMiddleware and so cannot see the context it sets.
+type requestLog struct {
+	mu        sync.Mutex
+	principal *Principal
+}
+
+func (l *requestLog) setPrincipal(principal *Principal) {
+	l.mu.Lock()
+	l.principal = principal
+	l.mu.Unlock()
+}
+
+func (l *requestLog) getPrincipal() *Principal {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.principal
+}
+
 func LoggingMiddleware(logger zerolog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -50,7 +71,8 @@ func LoggingMiddleware(logger zerolog.Logger) func(http.Handler) http.Handler {
 				Msg("Request started")
 			
 			// Process request
-			next.ServeHTTP(rw, r)
+			entry := &requestLog{}
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), "request_log", entry)))
 			
 			// Calculate duration
 			duration := time.Since(start)
@@ -66,13 +88,21 @@ func LoggingMiddleware(logger zerolog.Logger) func(http.Handler) http.Handler {
 				Dur("duration", duration).
 				Str("user_agent", r.UserAgent())
 			
-			// Add user info if available from context
-			if userID, ok := GetUserIDFromContext(r.Context()); ok {
-				logEvent = logEvent.Int("user_id", userID)
+			// Add the authenticated caller, and the real actor when a user
+			// is being impersonated
+			if principal := entry.getPrincipal(); principal != nil {
+				if principal.Type == PrincipalUser {
+					logEvent = logEvent.Int("user_id", principal.ID).Str("username", principal.Name)
+				} else {
+					logEvent = logEvent.Str("principal_type", principal.Type).Int("principal_id", principal.ID)
+				}
+				if principal.Actor != nil {
+					logEvent = logEvent.Int("actor_id", principal.Actor.ID).Str("actor", principal.Actor.Name)
+				}
 			}
 			
-			if username, ok := GetUsernameFromContext(r.Context()); ok {
-				logEvent = logEvent.Str("username", username)
+			if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+				logEvent = logEvent.Str("client_cert", r.TLS.PeerCertificates[0].Subject.String())
 			}
 			
 			// Log with appropriate level based on status code
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/repository"
+)
+
+// LoginGuardConfig sets how quickly repeated login failures are slowed down.
+// The first FreeAttempts failures for an address (IPFreeAttempts for a client
+// IP) cost nothing; every further failure doubles the wait before the next
+// attempt, starting at BaseDelay and capped at MaxDelay. LockoutThreshold
+// failures lock the address for LockoutDuration. Counts start over once no
+// failure has been seen for FailureWindow.
+type LoginGuardConfig struct {
+	FreeAttempts     int
+	IPFreeAttempts   int
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	FailureWindow    time.Duration
+}
+
+// LoginGuard tracks failed logins per email address and per client IP in the
+// database, so limits hold across replicas and against attempts spread over
+// many IPs. Addresses are tracked whether or not they belong to an account,
+// so throttling does not reveal which accounts exist.
+type LoginGuard struct {
+	repo   repository.LoginThrottleRepository
+	config LoginGuardConfig
+	logger zerolog.Logger
+}
+
+func NewLoginGuard(repo repository.LoginThrottleRepository, config LoginGuardConfig, logger zerolog.Logger) *LoginGuard {
+	g := &LoginGuard{
+		repo:   repo,
+		config: config,
+		logger: logger,
+	}
+
+	go g.cleanupLoop()
+
+	return g
+}
+
+func (g *LoginGuard) cleanupLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if _, err := g.repo.DeleteStaleLoginThrottles(ctx, time.Now().Add(-g.config.FailureWindow)); err != nil {
+			g.logger.Error().Err(err).Msg("Failed to delete stale login throttles")
+		}
+		cancel()
+	}
+}
+
+// Check returns how long the client must wait before it may try to log in
+// as email; zero means the attempt is allowed.
+func (g *LoginGuard) Check(ctx context.Context, r *http.Request, email string) (time.Duration, error) {
+	accountKey, ipKey := accountThrottleKey(email), ipThrottleKey(remoteIP(r))
+	throttles, err := g.repo.GetLoginThrottles(ctx, []string{accountKey, ipKey})
+	if err != nil {
+		return 0, fmt.Errorf("failed to load login throttles: %w", err)
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, throttle := range throttles {
+		free := g.config.FreeAttempts
+		if throttle.Key == ipKey {
+			free = g.config.IPFreeAttempts
+		}
+
+		until := throttle.LastFailureAt.Add(g.delay(throttle.Failures, free))
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(until) {
+			until = *throttle.LockedUntil
+		}
+		if d := until.Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+// RecordFailure counts a failed attempt against the address and the client
+// IP. The IP is the connected peer's, as forwarding headers would let a client
+// pick a fresh one for every attempt. It returns true when this failure locked the address.
+func (g *LoginGuard) RecordFailure(ctx context.Context, r *http.Request, email string) (bool, error) {
+	now := time.Now()
+	resetBefore := now.Add(-g.config.FailureWindow)
+	ip := remoteIP(r)
+
+	if _, err := g.repo.RecordLoginFailure(ctx, ipThrottleKey(ip), now, resetBefore); err != nil {
+		return false, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	accountKey := accountThrottleKey(email)
+	throttle, err := g.repo.RecordLoginFailure(ctx, accountKey, now, resetBefore)
+	if err != nil {
+		return false, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	if g.config.LockoutThreshold <= 0 || throttle.Failures < g.config.LockoutThreshold {
+		return false, nil
+	}
+
+	if err := g.repo.LockLogin(ctx, accountKey, now.Add(g.config.LockoutDuration)); err != nil {
+		return false, fmt.Errorf("failed to lock login: %w", err)
+	}
+
+	g.logger.Warn().
+		Str("ip", ip).
+		Int("failures", throttle.Failures).
+		Dur("duration", g.config.LockoutDuration).
+		Msg("Login locked after repeated failures")
+	return true, nil
+}
+
+// Reset clears the failures and any lock for the address, after a
+// successful login or when the owner unlocks it by email. Failures counted
+// against client IPs are kept.
+func (g *LoginGuard) Reset(ctx context.Context, email string) error {
+	return g.repo.ClearLoginThrottle(ctx, accountThrottleKey(email))
+}
+
+// LockoutDuration is how long an address stays locked.
+func (g *LoginGuard) LockoutDuration() time.Duration {
+	return g.config.LockoutDuration
+}
+
+// delay is the wait imposed after the given number of failures.
+func (g *LoginGuard) delay(failures, free int) time.Duration {
+	if failures < free || g.config.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := g.config.BaseDelay
+	for i := free; i < failures && delay < g.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > g.config.MaxDelay {
+		delay = g.config.MaxDelay
+	}
+	return delay
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/models"
+)
+
+// Mock login throttle repository for testing
+type mockLoginThrottleRepository struct {
+	throttles map[string]*models.LoginThrottle
+}
+
+func (m *mockLoginThrottleRepository) GetLoginThrottles(ctx context.Context, keys []string) ([]*models.LoginThrottle, error) {
+	var throttles []*models.LoginThrottle
+	for _, key := range keys {
+		if throttle, exists := m.throttles[key]; exists {
+			throttles = append(throttles, throttle)
+		}
+	}
+	return throttles, nil
+}
+
+func (m *mockLoginThrottleRepository) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginThrottle, error) {
+	throttle, exists := m.throttles[key]
+	if !exists {
+		throttle = &models.LoginThrottle{Key: key}
+		m.throttles[key] = throttle
+	}
+	if throttle.LastFailureAt.Before(resetBefore) {
+		throttle.Failures = 0
+	}
+	throttle.Failures++
+	throttle.LastFailureAt = at
+	return throttle, nil
+}
+
+func (m *mockLoginThrottleRepository) LockLogin(ctx context.Context, key string, until time.Time) error {
+	m.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func (m *mockLoginThrottleRepository) ClearLoginThrottle(ctx context.Context, key string) error {
+	delete(m.throttles, key)
+	return nil
+}
+
+func (m *mockLoginThrottleRepository) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func TestLoginGuard(t *testing.T) {
+	repo := &mockLoginThrottleRepository{throttles: make(map[string]*models.LoginThrottle)}
+	guard := NewLoginGuard(repo, LoginGuardConfig{
+		FreeAttempts:     2,
+		IPFreeAttempts:   4,
+		BaseDelay:        time.Minute,
+		MaxDelay:         4 * time.Minute,
+		LockoutThreshold: 6,
+		LockoutDuration:  time.Hour,
+		FailureWindow:    24 * time.Hour,
+	}, zerolog.Nop())
+	ctx := context.Background()
+
+	attacker := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+	attacker.RemoteAddr = "203.0.113.7:4000"
+	other := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+	other.RemoteAddr = "198.51.100.1:4000"
+
+	// Expected wait before the next attempt after each failure.
+	expected := []time.Duration{0, time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute, time.Hour}
+	for i, want := range expected {
+		locked, err := guard.RecordFailure(ctx, attacker, "Victim@Example.com")
+		if err != nil {
+			t.Fatalf("failed to record failure: %v", err)
+		}
+		if locked != (i == len(expected)-1) {
+			t.Errorf("failure %d: expected locked=%v", i+1, !locked)
+		}
+
+		wait, _ := guard.Check(ctx, other, "victim@example.com")
+		if wait > want || wait < want-time.Second {
+			t.Errorf("failure %d: expected wait of about %v from another IP, got %v", i+1, want, wait)
+		}
+	}
+
+	// The attacker's IP is throttled for any address, with its own allowance.
+	if wait, _ := guard.Check(ctx, attacker, "someone-else@example.com"); wait <= 0 {
+		t.Error("expected attacker IP to be throttled")
+	}
+	if wait, _ := guard.Check(ctx, other, "someone-else@example.com"); wait != 0 {
+		t.Errorf("expected other addresses to be unaffected, got %v", wait)
+	}
+
+	if err := guard.Reset(ctx, "victim@example.com"); err != nil {
+		t.Fatalf("failed to reset: %v", err)
+	}
+	if wait, _ := guard.Check(ctx, other, "victim@example.com"); wait != 0 {
+		t.Errorf("expected reset to lift the lock, got %v", wait)
+	}
+}
+
+func TestLoginGuard_IgnoresForwardingHeaders(t *testing.T) {
+	repo := &mockLoginThrottleRepository{throttles: make(map[string]*models.LoginThrottle)}
+	guard := NewLoginGuard(repo, LoginGuardConfig{
+		FreeAttempts:   2,
+		IPFreeAttempts: 2,
+		BaseDelay:      time.Minute,
+		MaxDelay:       4 * time.Minute,
+		FailureWindow:  24 * time.Hour,
+	}, zerolog.Nop())
+	ctx := context.Background()
+
+	attempt := func(i int) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		req.Header.Set("X-Forwarded-For", fmt.Sprintf("192.0.2.%d", i))
+		req.Header.Set("X-Real-IP", fmt.Sprintf("192.0.2.%d", i))
+		return req
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := guard.RecordFailure(ctx, attempt(i), fmt.Sprintf("user%d@example.com", i)); err != nil {
+			t.Fatalf("failed to record failure: %v", err)
+		}
+	}
+
+	// A fresh forwarded address and account do not reset the IP throttle.
+	if wait, _ := guard.Check(ctx, attempt(99), "new@example.com"); wait <= 0 {
+		t.Error("expected rotating X-Forwarded-For to keep the IP throttled")
+	}
+}
@@ -19,6 +19,7 @@ type Metrics struct {
 	ErrorCount           int64
 	AverageResponseTime  time.Duration
 	StartTime            time.Time
+	databaseStats        func() map[string]interface{}
 	logger               zerolog.Logger
 }
 
@@ -32,6 +33,14 @@ func NewMetrics(logger zerolog.Logger) *Metrics {
 	}
 }
 
+// SetDatabaseStats adds the figures returned by stats, such as those of a
+// connection pool, to the metrics under "database".
+func (m *Metrics) SetDatabaseStats(stats func() map[string]interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.databaseStats = stats
+}
+
 func (m *Metrics) RecordRequest(method, path string, statusCode int, duration time.Duration) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -97,7 +106,7 @@ func (m *Metrics) GetMetrics() map[string]interface{} {
 		}
 	}
 	
-	return map[string]interface{}{
+	metrics := map[string]interface{}{
 		"uptime":                uptime.String(),
 		"total_requests":        m.TotalConnections,
 		"active_connections":    m.ActiveConnections,
@@ -107,6 +116,10 @@ func (m *Metrics) GetMetrics() map[string]interface{} {
 		"endpoints":            endpointStats,
 		"timestamp":            time.Now().Unix(),
 	}
+	if m.databaseStats != nil {
+		metrics["database"] = m.databaseStats()
+	}
+	return metrics
 }
 
 func (m *Metrics) LogMetrics() {
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	// mfaPendingAudience keeps MFA tokens apart from access tokens, which
+	// must not have an audience.
+	mfaPendingAudience = "mfa_pending"
+	mfaPendingTTL      = 5 * time.Minute
+)
+
+// MFAPendingClaims prove that a user passed the first login factor. They
+// are only accepted by the second step of the login.
+type MFAPendingClaims struct {
+	UserID         int   `json:"user_id"`
+	IssuedAtMillis int64 `json:"iat_ms,omitempty"`
+	jwt.StandardClaims
+}
+
+// MFAChallengeResponse is returned by login instead of a LoginResponse when
+// the user has two-factor authentication enabled.
+type MFAChallengeResponse struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (as *AuthService) GenerateMFAToken(userID int) (string, time.Time, error) {
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(mfaPendingTTL)
+	claims := &MFAPendingClaims{
+		UserID:         userID,
+		IssuedAtMillis: now.UnixMilli(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Audience:  mfaPendingAudience,
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    as.issuer,
+			Subject:   UserSubject(userID),
+		},
+	}
+
+	tokenString, err := as.SignClaims(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return tokenString, expiresAt, nil
+}
+
+func (as *AuthService) ValidateMFAToken(tokenString string) (*MFAPendingClaims, error) {
+	claims := &MFAPendingClaims{}
+	if err := as.ParseClaims(tokenString, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Audience != mfaPendingAudience || claims.Issuer != as.issuer || claims.UserID == 0 {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if as.revocations != nil && as.revocations.isRevoked(claims.Id, claims.UserID, issuedAtMillis(claims.IssuedAt, claims.IssuedAtMillis)) {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// OAuthClaims are carried by access tokens issued to OAuth clients. The
+// audience is always the client ID, which is what keeps these tokens out of
+// AuthMiddleware. Tokens from the client_credentials grant have no UserID.
+type OAuthClaims struct {
+	UserID         int    `json:"user_id,omitempty"`
+	ClientID       string `json:"client_id"`
+	Scope          string `json:"scope,omitempty"`
+	IssuedAtMillis int64  `json:"iat_ms,omitempty"`
+	jwt.StandardClaims
+}
+
+// IDTokenClaims is an OpenID Connect ID token.
+type IDTokenClaims struct {
+	Nonce             string `json:"nonce,omitempty"`
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	jwt.StandardClaims
+}
+
+// HasScope reports whether the space separated scope list contains scope.
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Fields(scopes) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func UserSubject(userID int) string {
+	return fmt.Sprintf("user_%d", userID)
+}
+
+// Issuer is the OAuth issuer identifier, used as iss in tokens for clients.
+func (as *AuthService) Issuer() string {
+	return as.issuer
+}
+
+// HasSigningKeys reports whether tokens are signed with asymmetric keys that
+// third parties can verify through the JWKS endpoint.
+func (as *AuthService) HasSigningKeys() bool {
+	return as.keys != nil
+}
+
+func (as *AuthService) SigningAlgorithm() string {
+	if as.keys != nil {
+		return as.keys.ActiveKey().Algorithm
+	}
+	return jwt.SigningMethodHS256.Alg()
+}
+
+// GenerateOAuthToken issues an access token to an OAuth client, on behalf of
+// userID or, if userID is zero, of the client itself.
+func (as *AuthService) GenerateOAuthToken(clientID string, userID int, scope string) (string, *OAuthClaims, error) {
+	jti, err := generateTokenID()
+	if err != nil {
+		return "", nil, err
+	}
+
+	now := time.Now()
+	subject := clientID
+	if userID != 0 {
+		subject = UserSubject(userID)
+	}
+
+	claims := &OAuthClaims{
+		UserID:         userID,
+		ClientID:       clientID,
+		Scope:          scope,
+		IssuedAtMillis: now.UnixMilli(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Audience:  clientID,
+			ExpiresAt: now.Add(as.accessTokenTTL).Unix(),
+			IssuedAt:  now.Unix(),
+			Issuer:    as.issuer,
+			Subject:   subject,
+		},
+	}
+
+	tokenString, err := as.SignClaims(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	return tokenString, claims, nil
+}
+
+// GenerateIDToken fills in the registered claims and signs an ID token for
+// the client. The caller sets the subject and any user claims.
+func (as *AuthService) GenerateIDToken(clientID string, claims *IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims.Issuer = as.issuer
+	claims.Audience = clientID
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(as.accessTokenTTL).Unix()
+	return as.SignClaims(claims)
+}
+
+// ValidateOAuthToken verifies an access token issued to an OAuth client.
+func (as *AuthService) ValidateOAuthToken(tokenString string) (*OAuthClaims, error) {
+	claims := &OAuthClaims{}
+	if err := as.ParseClaims(tokenString, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.ClientID == "" || claims.Audience != claims.ClientID || claims.Issuer != as.issuer {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+
+	if as.revocations != nil && as.revocations.isRevoked(claims.Id, claims.UserID, issuedAtMillis(claims.IssuedAt, claims.IssuedAtMillis)) {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// RevokeOAuthToken invalidates an OAuth access token issued for a user.
+func (as *AuthService) RevokeOAuthToken(ctx context.Context, claims *OAuthClaims) error {
+	if as.revocations == nil {
+		return fmt.Errorf("token revocation is not configured")
+	}
+	if claims.UserID == 0 {
+		return fmt.Errorf("client tokens cannot be revoked")
+	}
+	return as.revocations.Revoke(ctx, claims.Id, claims.UserID, time.Unix(claims.ExpiresAt, 0))
+}
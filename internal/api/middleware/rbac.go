@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/repository"
+)
+
+// DefaultRole is held implicitly by every account.
+const DefaultRole = "user"
+
+// WithDefaultRole returns roles with DefaultRole added if it is missing.
+func WithDefaultRole(roles []string) []string {
+	for _, role := range roles {
+		if role == DefaultRole {
+			return roles
+		}
+	}
+	return append([]string{DefaultRole}, roles...)
+}
+
+// Permissions checked by the route middleware. A role may also be granted
+// "*" for everything or "<resource>:*" for every action on a resource.
+const (
+	PermUsersRead        = "users:read"
+	PermUsersUpdate      = "users:update"
+	PermUsersDelete      = "users:delete"
+	PermUsersImpersonate = "users:impersonate"
+	PermRolesManage      = "roles:manage"
+
+	PermSessionsManage        = "sessions:manage"
+	PermServiceAccountsManage = "service_accounts:manage"
+	PermOAuthClientsManage    = "oauth_clients:manage"
+	PermCertificatesManage    = "certificates:manage"
+)
+
+// Authorizer resolves role names to permissions from an in-memory copy of
+// the role tables that is refreshed periodically.
+type Authorizer struct {
+	mu          sync.RWMutex
+	repo        repository.RoleRepository
+	permissions map[string][]string
+	interval    time.Duration
+	logger      zerolog.Logger
+}
+
+func NewAuthorizer(repo repository.RoleRepository, interval time.Duration, logger zerolog.Logger) *Authorizer {
+	a := &Authorizer{
+		repo:        repo,
+		permissions: make(map[string][]string),
+		interval:    interval,
+		logger:      logger,
+	}
+
+	if err := a.Sync(context.Background()); err != nil {
+		logger.Error().Err(err).Msg("Failed to load roles")
+	}
+
+	// Start sync goroutine
+	go a.syncLoop()
+
+	return a
+}
+
+func (a *Authorizer) syncLoop() {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := a.Sync(ctx); err != nil {
+			a.logger.Error().Err(err).Msg("Failed to sync roles")
+		}
+		cancel()
+	}
+}
+
+func (a *Authorizer) Sync(ctx context.Context) error {
+	roles, err := a.repo.ListRoles(ctx)
+	if err != nil {
+		return err
+	}
+
+	permissions := make(map[string][]string, len(roles))
+	for _, role := range roles {
+		permissions[role.Name] = role.Permissions
+	}
+
+	a.mu.Lock()
+	a.permissions = permissions
+	a.mu.Unlock()
+
+	return nil
+}
+
+// Permissions returns the union of the permissions granted by roles.
+func (a *Authorizer) Permissions(roles []string) []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	seen := make(map[string]bool)
+	var permissions []string
+	for _, role := range roles {
+		for _, permission := range a.permissions[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
+
+// HasPermission reports whether granted covers permission.
+func HasPermission(granted []string, permission string) bool {
+	resource := permission
+	if i := strings.Index(permission, ":"); i != -1 {
+		resource = permission[:i]
+	}
+
+	for _, p := range granted {
+		if p == "*" || p == permission || p == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission rejects requests whose principal lacks permission.
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			permissions, _ := GetPermissionsFromContext(r.Context())
+			if !HasPermission(permissions, permission) {
+				sendForbiddenResponse(w, "Insufficient permissions")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSelfOrPermission lets a user act on their own record, identified by
+// the route variable param, and otherwise requires permission.
+func RequireSelfOrPermission(param, permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if userID, ok := GetUserIDFromContext(r.Context()); ok && mux.Vars(r)[param] == strconv.Itoa(userID) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			RequirePermission(permission)(next).ServeHTTP(w, r)
+		})
+	}
+}
+
+func GetRolesFromContext(ctx context.Context) ([]string, bool) {
+	claims, ok := GetClaimsFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return claims.Roles, true
+}
+
+func GetPermissionsFromContext(ctx context.Context) ([]string, bool) {
+	permissions, ok := ctx.Value("permissions").([]string)
+	return permissions, ok
+}
+
+func sendForbiddenResponse(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":   "Forbidden",
+		"message": message,
+	})
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		granted    []string
+		permission string
+		expected   bool
+	}{
+		{name: "exact match", granted: []string{"users:delete"}, permission: "users:delete", expected: true},
+		{name: "global wildcard", granted: []string{"*"}, permission: "users:delete", expected: true},
+		{name: "resource wildcard", granted: []string{"users:*"}, permission: "users:delete", expected: true},
+		{name: "other resource wildcard", granted: []string{"roles:*"}, permission: "users:delete", expected: false},
+		{name: "other action", granted: []string{"users:read"}, permission: "users:delete", expected: false},
+		{name: "no permissions", granted: nil, permission: "users:read", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.granted, tt.permission); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequireSelfOrPermission(t *testing.T) {
+	handler := RequireSelfOrPermission("id", PermUsersDelete)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name           string
+		userID         int
+		permissions    []string
+		targetID       string
+		expectedStatus int
+	}{
+		{name: "own record", userID: 1, targetID: "1", expectedStatus: http.StatusNoContent},
+		{name: "other record without permission", userID: 1, targetID: "2", expectedStatus: http.StatusForbidden},
+		{name: "other record as admin", userID: 1, permissions: []string{"*"}, targetID: "2", expectedStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), "user_id", tt.userID)
+			ctx = context.WithValue(ctx, "permissions", tt.permissions)
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+tt.targetID, nil).WithContext(ctx)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.targetID})
+
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+		})
+	}
+}
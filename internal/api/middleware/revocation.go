@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// RevocationStore keeps an in-process copy of revoked token IDs and per-user
+// cutoffs so that token checks never hit the database. Revocations made by
+// this process are applied immediately; revocations made by other replicas
+// are picked up on the next sync.
+type RevocationStore struct {
+	mu         sync.RWMutex
+	repo       repository.TokenRevocationRepository
+	revoked    map[string]time.Time
+	validAfter map[int]time.Time
+	interval   time.Duration
+	tokenTTL   time.Duration
+	logger     zerolog.Logger
+}
+
+func NewRevocationStore(repo repository.TokenRevocationRepository, interval, tokenTTL time.Duration, logger zerolog.Logger) *RevocationStore {
+	s := &RevocationStore{
+		repo:       repo,
+		revoked:    make(map[string]time.Time),
+		validAfter: make(map[int]time.Time),
+		interval:   interval,
+		tokenTTL:   tokenTTL,
+		logger:     logger,
+	}
+
+	if err := s.Sync(context.Background()); err != nil {
+		logger.Error().Err(err).Msg("Failed to load token revocations")
+	}
+
+	// Start sync goroutine
+	go s.syncLoop()
+
+	return s
+}
+
+func (s *RevocationStore) syncLoop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := s.Sync(ctx); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to sync token revocations")
+		}
+		cancel()
+	}
+}
+
+// Sync reloads the revocation state from the database. Only revocations that
+// can still affect an unexpired token are kept.
+func (s *RevocationStore) Sync(ctx context.Context) error {
+	now := time.Now()
+
+	if _, err := s.repo.DeleteExpiredRevokedTokens(ctx, now); err != nil {
+		return err
+	}
+
+	tokens, err := s.repo.ListRevokedTokens(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	cutoffs, err := s.repo.ListTokensValidAfter(ctx, now.Add(-s.tokenTTL))
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]time.Time, len(tokens))
+	for _, token := range tokens {
+		revoked[token.JTI] = token.ExpiresAt
+	}
+
+	s.mu.Lock()
+	s.revoked = revoked
+	s.validAfter = cutoffs
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Revoke invalidates a single token by its jti.
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	err := s.repo.RevokeToken(ctx, &models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		RevokedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[jti] = expiresAt
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeAllForUser invalidates every token issued to the user up to now.
+func (s *RevocationStore) RevokeAllForUser(ctx context.Context, userID int) error {
+	now := time.Now()
+	if err := s.repo.SetTokensValidAfter(ctx, userID, now); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.validAfter[userID] = now
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *RevocationStore) IsRevoked(claims *JWTClaims) bool {
+	return s.isRevoked(claims.Id, claims.UserID, issuedAtMillis(claims.IssuedAt, claims.IssuedAtMillis))
+}
+
+// issuedAtMillis returns the issue time of a token in milliseconds. Tokens
+// from before the iat_ms claim only have whole seconds, and are taken to be
+// issued at the start of theirs, so a cutoff in the same second revokes them.
+func issuedAtMillis(issuedAt, issuedAtMillis int64) int64 {
+	if issuedAtMillis != 0 {
+		return issuedAtMillis
+	}
+	return issuedAt * 1000
+}
+
+func (s *RevocationStore) isRevoked(jti string, userID int, issuedAtMillis int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, revoked := s.revoked[jti]; revoked {
+		return true
+	}
+
+	if validAfter, exists := s.validAfter[userID]; exists && issuedAtMillis <= validAfter.UnixMilli() {
+		return true
+	}
+
+	return false
+}
@@ -2,12 +2,14 @@ package middleware
 
 import (
 	"context"
+	"mime"
 	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/rs/zerolog"
+	"remus_synerge/pkg/jsonpatch"
 )
 
 type RateLimiter struct {
@@ -125,18 +127,14 @@ func SecurityHeadersMiddleware(logger zerolog.Logger) func(http.Handler) http.Ha
 	}
 }
 
-func CORSMiddleware(logger zerolog.Logger) func(http.Handler) http.Handler {
+// CORSMiddleware lets the trusted origins call the API with credentials,
+// including session cookies. Credentialed responses must name the origin
+// rather than "*", so the allowed origin is echoed back.
+func CORSMiddleware(allowedOrigins []string, logger zerolog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Allow specific origins in production
 			origin := r.Header.Get("Origin")
 			if origin != "" {
-				// In production, replace with your actual domains
-				allowedOrigins := []string{
-					"http://localhost:3000",
-					"https://yourdomain.com",
-				}
-				
 				for _, allowed := range allowedOrigins {
 					if origin == allowed {
 						w.Header().Set("Access-Control-Allow-Origin", origin)
@@ -144,9 +142,11 @@ func CORSMiddleware(logger zerolog.Logger) func(http.Handler) http.Handler {
 					}
 				}
 			}
+			w.Header().Add("Vary", "Origin")
 			
-			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, If-Match, If-None-Match, "+CSRFHeader)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Link, X-Total-Count, "+CSRFHeader)
 			w.Header().Set("Access-Control-Allow-Credentials", "true")
 			w.Header().Set("Access-Control-Max-Age", "86400")
 			
@@ -199,10 +199,10 @@ func RequestValidationMiddleware(logger zerolog.Logger) func(http.Handler) http.
 				return
 			}
 			
-			// Validate content type for POST/PUT requests
-			if r.Method == "POST" || r.Method == "PUT" {
+			// Validate content type for POST/PUT/PATCH requests
+			if r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" {
 				contentType := r.Header.Get("Content-Type")
-				if contentType != "" && !strings.HasPrefix(contentType, "application/json") {
+				if contentType != "" && !strings.HasPrefix(contentType, "application/json") && !isFormEndpoint(r, contentType) && !isPatchDocument(r, contentType) {
 					logger.Warn().
 						Str("content_type", contentType).
 						Str("ip", getClientIP(r)).
@@ -220,6 +220,18 @@ func RequestValidationMiddleware(logger zerolog.Logger) func(http.Handler) http.
 	}
 }
 
+// OAuth endpoints take form-encoded bodies as required by RFC 6749.
+func isFormEndpoint(r *http.Request, contentType string) bool {
+	return strings.HasPrefix(r.URL.Path, "/oauth/") && strings.HasPrefix(contentType, "application/x-www-form-urlencoded")
+}
+
+// PATCH bodies may be JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902)
+// documents.
+func isPatchDocument(r *http.Request, contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return r.Method == "PATCH" && err == nil && (mediaType == jsonpatch.MergePatchMediaType || mediaType == jsonpatch.JSONPatchMediaType)
+}
+
 func TimeoutMiddleware(timeout time.Duration, logger zerolog.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
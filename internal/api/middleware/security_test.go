@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	handler := CORSMiddleware([]string{"https://app.example.com"}, zerolog.Nop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	serve := func(origin string) http.Header {
+		req := httptest.NewRequest(http.MethodOptions, "/api/v1/users", nil)
+		req.Header.Set("Origin", origin)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Header()
+	}
+
+	header := serve("https://app.example.com")
+	if got := header.Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("expected trusted origin to be echoed, got %q", got)
+	}
+	if header.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Error("expected credentials to be allowed")
+	}
+	if !strings.Contains(header.Get("Access-Control-Allow-Headers"), CSRFHeader) {
+		t.Error("expected the CSRF header to be allowed")
+	}
+	if exposed := header.Get("Access-Control-Expose-Headers"); !strings.Contains(exposed, CSRFHeader) || !strings.Contains(exposed, "ETag") {
+		t.Errorf("expected the CSRF header and ETag to be exposed, got %q", exposed)
+	}
+
+	if got := serve("https://evil.example.com").Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected untrusted origin to be refused, got %q", got)
+	}
+}
+
+func TestRequestValidationMiddleware_ContentType(t *testing.T) {
+	handler := RequestValidationMiddleware(zerolog.Nop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, tt := range []struct {
+		method, contentType string
+		want                int
+	}{
+		{http.MethodPost, "application/json; charset=utf-8", http.StatusOK},
+		{http.MethodPost, "text/plain", http.StatusUnsupportedMediaType},
+		{http.MethodPatch, "application/merge-patch+json", http.StatusOK},
+		{http.MethodPatch, "application/json-patch+json; charset=utf-8", http.StatusOK},
+		{http.MethodPatch, "text/plain", http.StatusUnsupportedMediaType},
+		{http.MethodPut, "application/merge-patch+json", http.StatusUnsupportedMediaType},
+	} {
+		req := httptest.NewRequest(tt.method, "/api/v1/users/1", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", tt.contentType)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != tt.want {
+			t.Errorf("%s with %s: expected status %d, got %d", tt.method, tt.contentType, tt.want, rr.Code)
+		}
+	}
+}
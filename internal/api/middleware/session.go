@@ -0,0 +1,223 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/models"
+	"remus_synerge/internal/repository"
+)
+
+// SessionStore records logins as sessions and keeps an in-process copy of
+// revoked session IDs, like RevocationStore does for tokens, so that access
+// tokens can be checked against their session without a database round
+// trip. Session use is collected in memory and written on each sync.
+type SessionStore struct {
+	mu       sync.RWMutex
+	repo     repository.SessionRepository
+	revoked  map[string]bool
+	seen     map[string]time.Time
+	interval time.Duration
+	tokenTTL time.Duration
+	logger   zerolog.Logger
+}
+
+func NewSessionStore(repo repository.SessionRepository, interval, tokenTTL time.Duration, logger zerolog.Logger) *SessionStore {
+	s := &SessionStore{
+		repo:     repo,
+		revoked:  make(map[string]bool),
+		seen:     make(map[string]time.Time),
+		interval: interval,
+		tokenTTL: tokenTTL,
+		logger:   logger,
+	}
+
+	if err := s.Sync(context.Background()); err != nil {
+		logger.Error().Err(err).Msg("Failed to load revoked sessions")
+	}
+
+	go s.syncLoop()
+	go s.cleanupLoop()
+
+	return s
+}
+
+func (s *SessionStore) syncLoop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := s.Sync(ctx); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to sync sessions")
+		}
+		cancel()
+	}
+}
+
+func (s *SessionStore) cleanupLoop() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if _, err := s.repo.DeleteStaleSessions(ctx, time.Now().Add(-s.tokenTTL)); err != nil {
+			s.logger.Error().Err(err).Msg("Failed to delete stale sessions")
+		}
+		cancel()
+	}
+}
+
+// Sync writes pending last-seen times and reloads the sessions revoked
+// recently enough that one of their access tokens may still be unexpired.
+func (s *SessionStore) Sync(ctx context.Context) error {
+	s.mu.Lock()
+	seen := s.seen
+	s.seen = make(map[string]time.Time)
+	s.mu.Unlock()
+
+	if len(seen) > 0 {
+		if err := s.repo.TouchSessions(ctx, seen); err != nil {
+			// Keep the times for the next attempt unless newer ones arrived.
+			s.mu.Lock()
+			for id, at := range seen {
+				if at.After(s.seen[id]) {
+					s.seen[id] = at
+				}
+			}
+			s.mu.Unlock()
+			return err
+		}
+	}
+
+	ids, err := s.repo.ListRevokedSessions(ctx, time.Now().Add(-s.tokenTTL))
+	if err != nil {
+		return err
+	}
+
+	revoked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		revoked[id] = true
+	}
+
+	s.mu.Lock()
+	s.revoked = revoked
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Start records a new session for the login made with r.
+func (s *SessionStore) Start(ctx context.Context, r *http.Request, userID int, id string) (*models.Session, error) {
+	now := time.Now()
+	userAgent := r.UserAgent()
+	session := &models.Session{
+		ID:          id,
+		UserID:      userID,
+		DeviceLabel: DeviceLabel(userAgent),
+		UserAgent:   userAgent,
+		IPAddress:   getClientIP(r),
+		CreatedAt:   now,
+		LastSeenAt:  now,
+	}
+	if err := s.repo.CreateSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Touch notes that the session was just used.
+func (s *SessionStore) Touch(id string) {
+	s.mu.Lock()
+	s.seen[id] = time.Now()
+	s.mu.Unlock()
+}
+
+// Revoke ends a session: its refresh tokens stop working at once and its
+// access tokens are rejected by this process immediately and by other
+// replicas after their next sync.
+func (s *SessionStore) Revoke(ctx context.Context, id string) error {
+	if err := s.repo.RevokeSession(ctx, id, time.Now()); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.revoked[id] = true
+	delete(s.seen, id)
+	s.mu.Unlock()
+
+	return nil
+}
+
+// RevokeUser ends every session of the user, as Revoke does for one.
+func (s *SessionStore) RevokeUser(ctx context.Context, userID int) error {
+	ids, err := s.repo.RevokeUserSessions(ctx, userID, time.Now())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	for _, id := range ids {
+		s.revoked[id] = true
+		delete(s.seen, id)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *SessionStore) IsRevoked(id string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.revoked[id]
+}
+
+// DeviceLabel describes the browser and operating system of a user agent,
+// e.g. "Firefox on Windows", for showing sessions to their owner.
+func DeviceLabel(userAgent string) string {
+	browser := matchFirst(userAgent, [][2]string{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"CriOS/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+		{"okhttp", "Android app"},
+		{"Go-http-client", "Go client"},
+	})
+	system := matchFirst(userAgent, [][2]string{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	})
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+// matchFirst returns the label of the first pattern found in s. Order
+// matters: Edge and Opera user agents also claim to be Chrome and Safari.
+func matchFirst(s string, patterns [][2]string) string {
+	for _, pattern := range patterns {
+		if strings.Contains(s, pattern[0]) {
+			return pattern[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import "testing"
+
+func TestDeviceLabel(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0":          "Edge on Windows",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0":                                                       "Firefox on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0 Mobile/15E148 Safari/604.1": "Chrome on iOS",
+		"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                                  "Chrome on Linux",
+		"curl/8.4.0": "curl",
+		"":           "Unknown device",
+	}
+
+	for userAgent, want := range tests {
+		if got := DeviceLabel(userAgent); got != want {
+			t.Errorf("DeviceLabel(%q) = %q, want %q", userAgent, got, want)
+		}
+	}
+}
@@ -7,12 +7,13 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/rs/zerolog"
 	"remus_synerge/internal/api/handlers"
 	"remus_synerge/internal/api/middleware"
 	"remus_synerge/internal/config"
 	"remus_synerge/internal/repository"
+	"remus_synerge/pkg/mailer"
+	"remus_synerge/pkg/passpolicy"
 )
 
 type Server struct {
@@ -23,19 +24,130 @@ type Server struct {
 	authService *middleware.AuthService
 }
 
-func New(cfg *config.Config, db *pgxpool.Pool, logger zerolog.Logger) *Server {
+func New(cfg *config.Config, repos *repository.Repositories, logger zerolog.Logger) (*Server, error) {
 	// Initialize metrics
 	metrics := middleware.NewMetrics(logger)
 	
 	// Initialize authentication service
-	authService := middleware.NewAuthService(logger)
+	authService, err := middleware.NewAuthService(cfg.Security, logger)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Repositories, backed by Postgres or kept in memory
+	userRepo := repos.Users
+	refreshTokenRepo := repos.RefreshTokens
+	revocationRepo := repos.TokenRevocations
+	roleRepo := repos.Roles
+	apiKeyRepo := repos.APIKeys
+	oauthRepo := repos.OAuth
+	identityRepo := repos.Identities
+	mfaRepo := repos.MFA
+	userTokenRepo := repos.UserTokens
+	loginThrottleRepo := repos.LoginThrottles
+	sessionRepo := repos.Sessions
+	auditRepo := repos.Audit
+	certificateBindingRepo := repos.CertificateBindings
+	
+	// Keep revoked tokens in memory so auth checks avoid a database round trip
+	revocationStore := middleware.NewRevocationStore(
+		revocationRepo,
+		time.Duration(cfg.Security.RevocationSync)*time.Second,
+		authService.AccessTokenTTL(),
+		logger,
+	)
+	authService.SetRevocationStore(revocationStore)
+	
+	// Record logins as sessions; tokens of a revoked session are rejected
+	sessionStore := middleware.NewSessionStore(
+		sessionRepo,
+		time.Duration(cfg.Security.RevocationSync)*time.Second,
+		authService.AccessTokenTTL(),
+		logger,
+	)
+	authService.SetSessionStore(sessionStore)
+	
+	// Audit trail for impersonation
+	auditLog := middleware.NewAuditLog(auditRepo, logger)
+	authService.SetAuditLog(auditLog)
+	
+	// Browser sessions held in HttpOnly cookies
+	if cfg.Security.CookieAuth {
+		cookies, err := newCookieConfig(cfg.Security)
+		if err != nil {
+			return nil, err
+		}
+		authService.SetCookieConfig(cookies)
+	}
 	
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(db)
+	// Resolve token roles to permissions from a cached copy of the role tables
+	authorizer := middleware.NewAuthorizer(roleRepo, time.Duration(cfg.Security.RoleSync)*time.Second, logger)
+	authService.SetAuthorizer(authorizer)
+	
+	// Accept service account API keys alongside access tokens
+	authService.SetAPIKeyAuthenticator(middleware.NewAPIKeyAuthenticator(apiKeyRepo, logger))
+	
+	// Client certificates, verified during the TLS handshake, authenticate
+	// requests that carry no other credential
+	tlsConfig, err := newTLSConfig(cfg.Server)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil && tlsConfig.ClientCAs != nil {
+		authService.SetCertificateAuthenticator(middleware.NewCertificateAuthenticator(certificateBindingRepo, roleRepo, logger))
+	}
+	
+	// Slow down and lock out repeated failed logins per address and per IP
+	loginGuard := middleware.NewLoginGuard(loginThrottleRepo, middleware.LoginGuardConfig{
+		FreeAttempts:     cfg.Security.LoginFreeAttempts,
+		IPFreeAttempts:   cfg.Security.LoginIPFreeAttempts,
+		BaseDelay:        time.Duration(cfg.Security.LoginBackoffBase) * time.Second,
+		MaxDelay:         time.Duration(cfg.Security.LoginBackoffMax) * time.Second,
+		LockoutThreshold: cfg.Security.LoginLockoutAttempts,
+		LockoutDuration:  time.Duration(cfg.Security.LoginLockoutDuration) * time.Second,
+		FailureWindow:    time.Duration(cfg.Security.LoginFailureWindow) * time.Second,
+	}, logger)
+	
+	// Outgoing email for account recovery and verification
+	mail, err := newMailer(cfg.Mail, logger)
+	if err != nil {
+		return nil, err
+	}
+	mailTemplates, err := mailer.LoadTemplates(cfg.Mail.TemplateDir)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Requirements for new passwords
+	passwordPolicy, err := newPasswordPolicy(cfg.Security, logger)
+	if err != nil {
+		return nil, err
+	}
 	
 	// Initialize handlers
-	userHandler := handlers.NewUserHandler(userRepo, logger)
-	authHandler := handlers.NewAuthHandler(userRepo, authService, logger)
+	userHandler := handlers.NewUserHandler(userRepo, authService.PasswordHasher(), logger)
+	authHandler := handlers.NewAuthHandler(userRepo, refreshTokenRepo, roleRepo, mfaRepo, authService, logger)
+	roleHandler := handlers.NewRoleHandler(roleRepo, userRepo, logger)
+	serviceAccountHandler := handlers.NewServiceAccountHandler(apiKeyRepo, logger)
+	oauthClientHandler := handlers.NewOAuthClientHandler(oauthRepo, logger)
+	certificateHandler := handlers.NewCertificateHandler(certificateBindingRepo, apiKeyRepo, userRepo, roleRepo, authService, logger)
+	federationHandler := handlers.NewFederationHandler(authHandler, identityRepo, cfg.Security.OIDCProviders, logger)
+	sessionHandler := handlers.NewSessionHandler(sessionRepo, sessionStore, logger)
+	impersonationHandler := handlers.NewImpersonationHandler(authHandler, auditLog, logger)
+	mfaHandler := handlers.NewMFAHandler(mfaRepo, cfg.Security.MFAIssuer, logger)
+	accountHandler := handlers.NewAccountHandler(userRepo, userTokenRepo, refreshTokenRepo, authService, mail, mailTemplates,
+		cfg.Mail.LinkBaseURL,
+		time.Duration(cfg.Security.PasswordResetTTL)*time.Second,
+		time.Duration(cfg.Security.EmailVerificationTTL)*time.Second,
+		logger)
+	userHandler.SetEmailVerifier(accountHandler)
+	userHandler.SetPasswordPolicy(passwordPolicy)
+	userHandler.SetTokenRevoker(authService)
+	accountHandler.SetPasswordPolicy(passwordPolicy)
+	authHandler.RequireVerifiedEmail(cfg.Security.RequireVerifiedEmail)
+	authHandler.SetLoginGuard(loginGuard, accountHandler)
+	authHandler.SetSessionStore(sessionStore)
+	accountHandler.SetLoginGuard(loginGuard)
 	
 	// Create router
 	r := mux.NewRouter()
@@ -46,18 +158,49 @@ func New(cfg *config.Config, db *pgxpool.Pool, logger zerolog.Logger) *Server {
 	// Global middleware (applied to all routes)
 	r.Use(middleware.RecoveryMiddleware(logger))
 	r.Use(middleware.SecurityHeadersMiddleware(logger))
-	r.Use(middleware.CORSMiddleware(logger))
+	r.Use(middleware.CORSMiddleware(cfg.Security.TrustedOrigins, logger))
 	r.Use(middleware.LoggingMiddleware(logger))
 	r.Use(middleware.MetricsMiddleware(metrics))
 	r.Use(middleware.RateLimitMiddleware(rateLimiter))
 	r.Use(middleware.RequestValidationMiddleware(logger))
 	r.Use(middleware.TimeoutMiddleware(30*time.Second, logger))
 	
+	// Key discovery for services verifying our tokens
+	r.HandleFunc("/.well-known/jwks.json", middleware.JWKSHandler(authService)).Methods("GET")
+	
+	// OAuth 2.0 / OpenID Connect provider. Relying parties verify ID tokens
+	// through the JWKS, so a shared HMAC secret is not enough.
+	if authService.HasSigningKeys() {
+		oauthHandler := handlers.NewOAuthHandler(oauthRepo, userRepo, refreshTokenRepo, authService, cfg.Security.OAuthLoginURL, logger)
+		
+		r.HandleFunc("/.well-known/openid-configuration", oauthHandler.Discovery).Methods("GET")
+		oauthRouter := r.PathPrefix("/oauth").Subrouter()
+		oauthRouter.Handle("/authorize", middleware.OptionalAuthMiddleware(authService)(notImpersonating(oauthHandler.Authorize))).Methods("GET")
+		oauthRouter.Handle("/authorize", middleware.AuthMiddleware(authService)(notImpersonating(oauthHandler.ApproveAuthorization))).Methods("POST")
+		oauthRouter.HandleFunc("/token", oauthHandler.Token).Methods("POST")
+		oauthRouter.HandleFunc("/introspect", oauthHandler.Introspect).Methods("POST")
+		oauthRouter.HandleFunc("/revoke", oauthHandler.Revoke).Methods("POST")
+		oauthRouter.HandleFunc("/userinfo", oauthHandler.UserInfo).Methods("GET", "POST")
+	} else {
+		logger.Warn().Msg("OAuth provider disabled: configure JWT_KEY_FILES or JWT_KEY_DIR to enable it")
+	}
+	
 	// Public routes (no authentication required)
 	publicRouter := r.PathPrefix("/api/v1").Subrouter()
 	publicRouter.HandleFunc("/health", middleware.HealthCheckHandler(metrics)).Methods("GET")
 	publicRouter.HandleFunc("/metrics", middleware.MetricsHandler(metrics)).Methods("GET")
 	publicRouter.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
+	publicRouter.HandleFunc("/auth/login/mfa", authHandler.LoginMFA).Methods("POST")
+	publicRouter.HandleFunc("/auth/password/forgot", accountHandler.ForgotPassword).Methods("POST")
+	publicRouter.HandleFunc("/auth/password/reset", accountHandler.ResetPassword).Methods("POST")
+	publicRouter.HandleFunc("/auth/email/verify", accountHandler.VerifyEmail).Methods("POST")
+	publicRouter.HandleFunc("/auth/email/resend", accountHandler.ResendVerification).Methods("POST")
+	publicRouter.HandleFunc("/auth/unlock", accountHandler.UnlockAccount).Methods("POST")
+	publicRouter.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST")
+	publicRouter.HandleFunc("/auth/csrf", authHandler.CSRFToken).Methods("GET")
+	publicRouter.HandleFunc("/auth/oidc/providers", federationHandler.ListProviders).Methods("GET")
+	publicRouter.HandleFunc("/auth/oidc/{provider}/login", federationHandler.Login).Methods("GET")
+	publicRouter.HandleFunc("/auth/oidc/{provider}/callback", federationHandler.Callback).Methods("GET")
 	publicRouter.HandleFunc("/users", userHandler.CreateUser).Methods("POST") // User registration
 	
 	// Protected routes (authentication required)
@@ -65,13 +208,70 @@ func New(cfg *config.Config, db *pgxpool.Pool, logger zerolog.Logger) *Server {
 	protectedRouter.Use(middleware.AuthMiddleware(authService))
 	
 	// Auth routes
-	protectedRouter.HandleFunc("/auth/refresh", authHandler.RefreshToken).Methods("POST")
 	protectedRouter.HandleFunc("/auth/profile", authHandler.GetProfile).Methods("GET")
+	protectedRouter.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	protectedRouter.HandleFunc("/auth/logout-all", authHandler.LogoutAll).Methods("POST")
+	protectedRouter.HandleFunc("/auth/identities", federationHandler.ListIdentities).Methods("GET")
+	protectedRouter.HandleFunc("/auth/sessions", sessionHandler.ListSessions).Methods("GET")
+	protectedRouter.HandleFunc("/auth/sessions/{sessionId}", sessionHandler.RevokeSession).Methods("DELETE")
+	
+	// Two-factor authentication routes
+	protectedRouter.HandleFunc("/auth/mfa", mfaHandler.GetStatus).Methods("GET")
+	protectedRouter.Handle("/auth/mfa/totp", notImpersonating(mfaHandler.EnrollTOTP)).Methods("POST")
+	protectedRouter.Handle("/auth/mfa/totp/verify", notImpersonating(mfaHandler.ConfirmTOTP)).Methods("POST")
+	protectedRouter.Handle("/auth/mfa/totp/disable", notImpersonating(mfaHandler.DisableTOTP)).Methods("POST")
+	protectedRouter.Handle("/auth/mfa/recovery-codes", notImpersonating(mfaHandler.RegenerateRecoveryCodes)).Methods("POST")
+	
+	// User routes: users may act on their own record, anyone else needs the permission
+	protectedRouter.Handle("/users", middleware.RequirePermission(middleware.PermUsersRead)(http.HandlerFunc(userHandler.ListUsers))).Methods("GET")
+	protectedRouter.HandleFunc("/users/search", userHandler.SearchUsers).Methods("GET")
+	protectedRouter.Handle("/users/{id:[0-9]+}", selfOrPermission(middleware.PermUsersRead, userHandler.GetUser)).Methods("GET")
+	protectedRouter.Handle("/users/{id:[0-9]+}", selfOrPermission(middleware.PermUsersUpdate, userHandler.UpdateUser)).Methods("PUT")
+	protectedRouter.Handle("/users/{id:[0-9]+}", selfOrPermission(middleware.PermUsersUpdate, userHandler.PatchUser)).Methods("PATCH")
+	protectedRouter.Handle("/users/{id:[0-9]+}", selfOrPermission(middleware.PermUsersDelete, userHandler.DeleteUser)).Methods("DELETE")
+	protectedRouter.Handle("/users/{id:[0-9]+}/restore", middleware.RequirePermission(middleware.PermUsersDelete)(http.HandlerFunc(userHandler.RestoreUser))).Methods("POST")
+	
+	// Role management routes
+	roleRouter := protectedRouter.PathPrefix("/roles").Subrouter()
+	roleRouter.Use(middleware.RequirePermission(middleware.PermRolesManage))
+	roleRouter.HandleFunc("", roleHandler.ListRoles).Methods("GET")
+	
+	userRoleRouter := protectedRouter.PathPrefix("/users/{id:[0-9]+}/roles").Subrouter()
+	userRoleRouter.Use(middleware.RequirePermission(middleware.PermRolesManage))
+	userRoleRouter.HandleFunc("", roleHandler.GetUserRoles).Methods("GET")
+	userRoleRouter.HandleFunc("", roleHandler.SetUserRoles).Methods("PUT")
+	
+	protectedRouter.Handle("/users/{id:[0-9]+}/impersonate", middleware.RequirePermission(middleware.PermUsersImpersonate)(
+		notImpersonating(impersonationHandler.Impersonate))).Methods("POST")
+	
+	userSessionRouter := protectedRouter.PathPrefix("/users/{id:[0-9]+}/sessions").Subrouter()
+	userSessionRouter.Use(middleware.RequirePermission(middleware.PermSessionsManage))
+	userSessionRouter.HandleFunc("", sessionHandler.ListUserSessions).Methods("GET")
+	userSessionRouter.HandleFunc("/{sessionId}", sessionHandler.RevokeUserSession).Methods("DELETE")
+	
+	// Service account routes
+	serviceAccountRouter := protectedRouter.PathPrefix("/service-accounts").Subrouter()
+	serviceAccountRouter.Use(middleware.RequirePermission(middleware.PermServiceAccountsManage))
+	serviceAccountRouter.HandleFunc("", serviceAccountHandler.CreateServiceAccount).Methods("POST")
+	serviceAccountRouter.HandleFunc("", serviceAccountHandler.ListServiceAccounts).Methods("GET")
+	serviceAccountRouter.HandleFunc("/{id:[0-9]+}", serviceAccountHandler.DeleteServiceAccount).Methods("DELETE")
+	serviceAccountRouter.HandleFunc("/{id:[0-9]+}/keys", serviceAccountHandler.CreateAPIKey).Methods("POST")
+	serviceAccountRouter.HandleFunc("/{id:[0-9]+}/keys", serviceAccountHandler.ListAPIKeys).Methods("GET")
+	serviceAccountRouter.HandleFunc("/{id:[0-9]+}/keys/{keyId:[0-9]+}", serviceAccountHandler.RevokeAPIKey).Methods("DELETE")
 	
-	// User routes
-	protectedRouter.HandleFunc("/users/{id:[0-9]+}", userHandler.GetUser).Methods("GET")
-	protectedRouter.HandleFunc("/users/{id:[0-9]+}", userHandler.UpdateUser).Methods("PUT")
-	protectedRouter.HandleFunc("/users/{id:[0-9]+}", userHandler.DeleteUser).Methods("DELETE")
+	// OAuth client registry
+	oauthClientRouter := protectedRouter.PathPrefix("/oauth/clients").Subrouter()
+	oauthClientRouter.Use(middleware.RequirePermission(middleware.PermOAuthClientsManage))
+	oauthClientRouter.HandleFunc("", oauthClientHandler.CreateClient).Methods("POST")
+	oauthClientRouter.HandleFunc("", oauthClientHandler.ListClients).Methods("GET")
+	oauthClientRouter.HandleFunc("/{clientId}", oauthClientHandler.DeleteClient).Methods("DELETE")
+	
+	// Client certificate bindings
+	certificateRouter := protectedRouter.PathPrefix("/certificate-bindings").Subrouter()
+	certificateRouter.Use(middleware.RequirePermission(middleware.PermCertificatesManage))
+	certificateRouter.HandleFunc("", certificateHandler.CreateBinding).Methods("POST")
+	certificateRouter.HandleFunc("", certificateHandler.ListBindings).Methods("GET")
+	certificateRouter.HandleFunc("/{id:[0-9]+}", certificateHandler.DeleteBinding).Methods("DELETE")
 	
 	// Static file serving
 	staticDir := "/static/"
@@ -82,6 +282,7 @@ func New(cfg *config.Config, db *pgxpool.Pool, logger zerolog.Logger) *Server {
 	srv := &http.Server{
 		Addr:              addr,
 		Handler:           r,
+		TLSConfig:         tlsConfig,
 		ReadTimeout:       15 * time.Second,
 		WriteTimeout:      15 * time.Second,
 		IdleTimeout:       60 * time.Second,
@@ -99,29 +300,174 @@ func New(cfg *config.Config, db *pgxpool.Pool, logger zerolog.Logger) *Server {
 		}
 	}()
 	
+	// Deleted users can be restored until they are purged
+	if cfg.Security.DeletedUserRetention > 0 {
+		go purgeDeletedUsers(userRepo, time.Duration(cfg.Security.DeletedUserRetention)*time.Second, logger)
+	}
+	
 	return &Server{
 		router:      r,
 		server:      srv,
 		logger:      logger,
 		metrics:     metrics,
 		authService: authService,
+	}, nil
+}
+
+func newMailer(cfg config.MailConfig, logger zerolog.Logger) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		return mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     cfg.SMTPHost,
+			Port:     cfg.SMTPPort,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		})
+	case "file":
+		return mailer.NewFileMailer(cfg.FileDir, cfg.From)
+	case "log", "":
+		logger.Warn().Msg("Emails are logged, not sent: set MAIL_DRIVER=smtp to deliver them")
+		return mailer.NewLogMailer(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver: %s", cfg.Driver)
+	}
+}
+
+// newPasswordPolicy builds the password policy, loading the breached
+// password corpus if one is configured.
+func newPasswordPolicy(cfg config.SecurityConfig, logger zerolog.Logger) (*passpolicy.Policy, error) {
+	policy := &passpolicy.Policy{
+		MinLength: cfg.PasswordMinLength,
+		MaxLength: cfg.PasswordMaxLength,
+		MinScore:  cfg.PasswordMinScore,
+	}
+	if cfg.BreachedPasswords == "" {
+		logger.Warn().Msg("Breached password screening is disabled: set BREACHED_PASSWORDS_FILE to enable it")
+		return policy, nil
+	}
+
+	corpus, err := passpolicy.OpenCorpus(cfg.BreachedPasswords)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached password corpus: %w", err)
+	}
+	logger.Info().Int("passwords", corpus.Len()).Msg("Loaded breached password corpus")
+	policy.Breached = corpus
+	return policy, nil
+}
+
+// newCookieConfig builds the cookie settings for cookie auth mode. The
+// refresh token cookie is only sent to the auth endpoints.
+func newCookieConfig(cfg config.SecurityConfig) (*middleware.CookieConfig, error) {
+	sameSite, err := middleware.ParseSameSite(cfg.CookieSameSite)
+	if err != nil {
+		return nil, err
 	}
+	// Browsers drop SameSite=None cookies that are not Secure
+	if sameSite == http.SameSiteNoneMode && !cfg.CookieSecure {
+		return nil, fmt.Errorf("COOKIE_SAMESITE=none requires COOKIE_SECURE=true")
+	}
+
+	return &middleware.CookieConfig{
+		Domain:      cfg.CookieDomain,
+		Secure:      cfg.CookieSecure,
+		SameSite:    sameSite,
+		RefreshPath: "/api/v1/auth",
+	}, nil
+}
+
+// purgeDeletedUsers permanently removes users once they have been deleted
+// for longer than retention.
+func purgeDeletedUsers(repo repository.UserRepository, retention time.Duration, logger zerolog.Logger) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		purged, err := repo.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+		cancel()
+		if err != nil {
+			logger.Error().Err(err).Msg("Failed to purge deleted users")
+			continue
+		}
+		if purged > 0 {
+			logger.Info().Int64("purged", purged).Dur("retention", retention).Msg("Purged deleted users")
+		}
+	}
+}
+
+func selfOrPermission(permission string, handler http.HandlerFunc) http.Handler {
+	return middleware.RequireSelfOrPermission("id", permission)(handler)
+}
+
+func notImpersonating(handler http.HandlerFunc) http.Handler {
+	return middleware.RejectImpersonation(handler)
 }
 
 func (s *Server) Start() error {
 	s.logger.Info().Msgf("Server starting on %s", s.server.Addr)
 	s.logger.Info().Msg("Available endpoints:")
 	s.logger.Info().Msg("  Public:")
+	s.logger.Info().Msg("    GET  /.well-known/jwks.json")
+	s.logger.Info().Msg("    GET  /.well-known/openid-configuration")
+	s.logger.Info().Msg("    GET  /oauth/authorize")
+	s.logger.Info().Msg("    POST /oauth/token")
+	s.logger.Info().Msg("    POST /oauth/introspect")
+	s.logger.Info().Msg("    POST /oauth/revoke")
+	s.logger.Info().Msg("    GET  /oauth/userinfo")
 	s.logger.Info().Msg("    GET  /api/v1/health")
 	s.logger.Info().Msg("    GET  /api/v1/metrics")
 	s.logger.Info().Msg("    POST /api/v1/auth/login")
+	s.logger.Info().Msg("    POST /api/v1/auth/login/mfa")
+	s.logger.Info().Msg("    POST /api/v1/auth/password/forgot")
+	s.logger.Info().Msg("    POST /api/v1/auth/password/reset")
+	s.logger.Info().Msg("    POST /api/v1/auth/email/verify")
+	s.logger.Info().Msg("    POST /api/v1/auth/email/resend")
+	s.logger.Info().Msg("    POST /api/v1/auth/unlock")
+	s.logger.Info().Msg("    POST /api/v1/auth/refresh")
+	s.logger.Info().Msg("    GET  /api/v1/auth/csrf")
+	s.logger.Info().Msg("    GET  /api/v1/auth/oidc/providers")
+	s.logger.Info().Msg("    GET  /api/v1/auth/oidc/{provider}/login")
+	s.logger.Info().Msg("    GET  /api/v1/auth/oidc/{provider}/callback")
 	s.logger.Info().Msg("    POST /api/v1/users (registration)")
 	s.logger.Info().Msg("  Protected:")
-	s.logger.Info().Msg("    POST /api/v1/auth/refresh")
 	s.logger.Info().Msg("    GET  /api/v1/auth/profile")
+	s.logger.Info().Msg("    POST /api/v1/auth/logout")
+	s.logger.Info().Msg("    POST /api/v1/auth/logout-all")
+	s.logger.Info().Msg("    GET  /api/v1/auth/identities")
+	s.logger.Info().Msg("    GET  /api/v1/auth/sessions")
+	s.logger.Info().Msg("    DELETE /api/v1/auth/sessions/{sessionId}")
+	s.logger.Info().Msg("    GET  /api/v1/auth/mfa")
+	s.logger.Info().Msg("    POST /api/v1/auth/mfa/totp")
+	s.logger.Info().Msg("    POST /api/v1/auth/mfa/totp/verify")
+	s.logger.Info().Msg("    POST /api/v1/auth/mfa/totp/disable")
+	s.logger.Info().Msg("    POST /api/v1/auth/mfa/recovery-codes")
+	s.logger.Info().Msg("    GET  /api/v1/users")
+	s.logger.Info().Msg("    GET  /api/v1/users/search")
 	s.logger.Info().Msg("    GET  /api/v1/users/{id}")
 	s.logger.Info().Msg("    PUT  /api/v1/users/{id}")
+	s.logger.Info().Msg("    PATCH /api/v1/users/{id}")
 	s.logger.Info().Msg("    DELETE /api/v1/users/{id}")
+	s.logger.Info().Msg("    POST /api/v1/users/{id}/restore")
+	s.logger.Info().Msg("    GET  /api/v1/roles")
+	s.logger.Info().Msg("    GET  /api/v1/users/{id}/roles")
+	s.logger.Info().Msg("    PUT  /api/v1/users/{id}/roles")
+	s.logger.Info().Msg("    POST /api/v1/users/{id}/impersonate")
+	s.logger.Info().Msg("    GET  /api/v1/users/{id}/sessions")
+	s.logger.Info().Msg("    DELETE /api/v1/users/{id}/sessions/{sessionId}")
+	s.logger.Info().Msg("    POST /api/v1/service-accounts")
+	s.logger.Info().Msg("    GET  /api/v1/service-accounts")
+	s.logger.Info().Msg("    DELETE /api/v1/service-accounts/{id}")
+	s.logger.Info().Msg("    POST /api/v1/service-accounts/{id}/keys")
+	s.logger.Info().Msg("    GET  /api/v1/service-accounts/{id}/keys")
+	s.logger.Info().Msg("    DELETE /api/v1/service-accounts/{id}/keys/{keyId}")
+	s.logger.Info().Msg("    POST /oauth/authorize")
+	s.logger.Info().Msg("    POST /api/v1/oauth/clients")
+	s.logger.Info().Msg("    GET  /api/v1/oauth/clients")
+	s.logger.Info().Msg("    DELETE /api/v1/oauth/clients/{clientId}")
+	s.logger.Info().Msg("    POST /api/v1/certificate-bindings")
+	s.logger.Info().Msg("    GET  /api/v1/certificate-bindings")
+	s.logger.Info().Msg("    DELETE /api/v1/certificate-bindings/{id}")
 	
 	// Try to enable HTTPS if TLS cert and key are available
 	if tlsCert := s.server.TLSConfig; tlsCert != nil {
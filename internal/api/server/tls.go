@@ -0,0 +1,67 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"remus_synerge/internal/config"
+)
+
+// newTLSConfig loads the server certificate and, for mutual TLS, the CA
+// bundle client certificates are verified against. It returns nil when
+// HTTPS is disabled.
+func newTLSConfig(cfg config.ServerConfig) (*tls.Config, error) {
+	clientAuth, err := parseClientAuth(cfg.ClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.EnableHTTPS {
+		if clientAuth != tls.NoClientCert {
+			return nil, fmt.Errorf("TLS_CLIENT_AUTH=%s requires ENABLE_HTTPS=true", cfg.ClientAuth)
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+	}
+
+	if clientAuth != tls.NoClientCert {
+		if cfg.ClientCAFile == "" {
+			return nil, fmt.Errorf("TLS_CLIENT_AUTH=%s requires TLS_CLIENT_CA_FILE", cfg.ClientAuth)
+		}
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA bundle %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+
+	return tlsConfig, nil
+}
+
+// parseClientAuth maps the TLS_CLIENT_AUTH modes to the handshake policy.
+// "optional" still rejects certificates that do not verify.
+func parseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "none", "":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "required":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("invalid TLS_CLIENT_AUTH mode: %s", mode)
+}
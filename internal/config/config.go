@@ -11,6 +11,7 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	Security SecurityConfig
+	Mail     MailConfig
 }
 
 type ServerConfig struct {
@@ -22,12 +23,15 @@ type ServerConfig struct {
 	MaxHeaderBytes    int
 	TLSCertFile       string
 	TLSKeyFile        string
+	ClientCAFile      string
+	ClientAuth        string
 	EnableHTTPS       bool
 	EnableMetrics     bool
 	StaticDir         string
 }
 
 type DatabaseConfig struct {
+	Driver          string
 	Host            string
 	Port            int
 	User            string
@@ -35,18 +39,91 @@ type DatabaseConfig struct {
 	Name            string
 	SSLMode         string
 	MaxConnections  int
+	MinConnections  int
 	MaxIdleTime     int
 	MaxLifetime     int
+	HealthCheckPeriod int
+	ConnectTimeout  int
+	StatementTimeout int
+	ApplicationName string
+	MigrateOnBoot   bool
 }
 
 type SecurityConfig struct {
-	JWTSecret         string
-	JWTExpiration     int
-	RateLimitRequests int
-	RateLimitWindow   int
-	EnableRateLimit   bool
-	EnableCORS        bool
-	TrustedOrigins    []string
+	JWTSecret            string
+	JWTKeyFiles          []string
+	JWTKeyDir            string
+	JWTSigningAlgorithm  string
+	JWTKeyRotation       int
+	JWTKeyPrepublish     int
+	JWTKeyRetention      int
+	JWTExpiration        int
+	RefreshTokenTTL      int
+	RevocationSync       int
+	RoleSync             int
+	RateLimitRequests    int
+	RateLimitWindow      int
+	EnableRateLimit      bool
+	EnableCORS           bool
+	TrustedOrigins       []string
+	OAuthIssuer          string
+	OAuthLoginURL        string
+	OIDCProviders        []OIDCProviderConfig
+	MFAIssuer            string
+	RequireVerifiedEmail bool
+	PasswordResetTTL     int
+	EmailVerificationTTL int
+	LoginFreeAttempts    int
+	LoginIPFreeAttempts  int
+	LoginBackoffBase     int
+	LoginBackoffMax      int
+	LoginLockoutAttempts int
+	LoginLockoutDuration int
+	LoginFailureWindow   int
+	PasswordHashAlg      string
+	Argon2Memory         int
+	Argon2Iterations     int
+	Argon2Parallelism    int
+	BcryptCost           int
+	PasswordMinLength    int
+	PasswordMaxLength    int
+	PasswordMinScore     int
+	BreachedPasswords    string
+	CookieAuth           bool
+	CookieDomain         string
+	CookieSecure         bool
+	CookieSameSite       string
+	ImpersonationTTL     int
+	DeletedUserRetention int
+	// Development (APP_ENV=development) lets the server start without a
+	// JWT signing key.
+	Development          bool
+}
+
+// MailConfig selects how email is delivered: "smtp", "file" (one .eml file
+// per message in FileDir) or "log".
+type MailConfig struct {
+	Driver       string
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	FileDir      string
+	TemplateDir  string
+	LinkBaseURL  string
+}
+
+// OIDCProviderConfig is an upstream OpenID Connect provider users can sign
+// in with. Provider names appear in URLs and in user_identities.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	AllowSignup  bool
 }
 
 // Load Configuration from environment variables
@@ -61,8 +138,37 @@ func Load() (*Config, error) {
 	maxConnections, _ := strconv.Atoi(getEnv("DB_MAX_CONNECTIONS", "25"))
 	maxIdleTime, _ := strconv.Atoi(getEnv("DB_MAX_IDLE_TIME", "300"))
 	maxLifetime, _ := strconv.Atoi(getEnv("DB_MAX_LIFETIME", "1800"))
+	minConnections, _ := strconv.Atoi(getEnv("DB_MIN_CONNECTIONS", "0"))
+	healthCheckPeriod, _ := strconv.Atoi(getEnv("DB_HEALTH_CHECK_PERIOD", "30"))
+	connectTimeout, _ := strconv.Atoi(getEnv("DB_CONNECT_TIMEOUT", "10"))
+	statementTimeout, _ := strconv.Atoi(getEnv("DB_STATEMENT_TIMEOUT", "0"))
 	
-	jwtExpiration, _ := strconv.Atoi(getEnv("JWT_EXPIRATION", "86400"))
+	jwtExpiration, _ := strconv.Atoi(getEnv("JWT_EXPIRATION", "900"))
+	refreshTokenTTL, _ := strconv.Atoi(getEnv("REFRESH_TOKEN_TTL", "2592000"))
+	revocationSync, _ := strconv.Atoi(getEnv("REVOCATION_SYNC_INTERVAL", "30"))
+	roleSync, _ := strconv.Atoi(getEnv("ROLE_SYNC_INTERVAL", "60"))
+	jwtKeyRotation, _ := strconv.Atoi(getEnv("JWT_KEY_ROTATION_INTERVAL", "0"))
+	jwtKeyPrepublish, _ := strconv.Atoi(getEnv("JWT_KEY_PREPUBLISH", "300"))
+	jwtKeyRetention, _ := strconv.Atoi(getEnv("JWT_KEY_RETENTION", "86400"))
+	passwordResetTTL, _ := strconv.Atoi(getEnv("PASSWORD_RESET_TTL", "3600"))
+	emailVerificationTTL, _ := strconv.Atoi(getEnv("EMAIL_VERIFICATION_TTL", "86400"))
+	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	loginFreeAttempts, _ := strconv.Atoi(getEnv("LOGIN_FREE_ATTEMPTS", "3"))
+	loginIPFreeAttempts, _ := strconv.Atoi(getEnv("LOGIN_IP_FREE_ATTEMPTS", "20"))
+	loginBackoffBase, _ := strconv.Atoi(getEnv("LOGIN_BACKOFF_BASE", "1"))
+	loginBackoffMax, _ := strconv.Atoi(getEnv("LOGIN_BACKOFF_MAX", "300"))
+	loginLockoutAttempts, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_ATTEMPTS", "10"))
+	loginLockoutDuration, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_DURATION", "900"))
+	loginFailureWindow, _ := strconv.Atoi(getEnv("LOGIN_FAILURE_WINDOW", "3600"))
+	argon2Memory, _ := strconv.Atoi(getEnv("ARGON2_MEMORY", "65536"))
+	argon2Iterations, _ := strconv.Atoi(getEnv("ARGON2_ITERATIONS", "3"))
+	argon2Parallelism, _ := strconv.Atoi(getEnv("ARGON2_PARALLELISM", "4"))
+	bcryptCost, _ := strconv.Atoi(getEnv("BCRYPT_COST", "10"))
+	passwordMinLength, _ := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "8"))
+	passwordMaxLength, _ := strconv.Atoi(getEnv("PASSWORD_MAX_LENGTH", "128"))
+	passwordMinScore, _ := strconv.Atoi(getEnv("PASSWORD_MIN_SCORE", "2"))
+	impersonationTTL, _ := strconv.Atoi(getEnv("IMPERSONATION_TTL", "600"))
+	deletedUserRetention, _ := strconv.Atoi(getEnv("DELETED_USER_RETENTION", "2592000"))
 	rateLimitRequests, _ := strconv.Atoi(getEnv("RATE_LIMIT_REQUESTS", "100"))
 	rateLimitWindow, _ := strconv.Atoi(getEnv("RATE_LIMIT_WINDOW", "60"))
 	
@@ -70,10 +176,15 @@ func Load() (*Config, error) {
 	enableMetrics := getEnv("ENABLE_METRICS", "true") == "true"
 	enableRateLimit := getEnv("ENABLE_RATE_LIMIT", "true") == "true"
 	enableCORS := getEnv("ENABLE_CORS", "true") == "true"
+	requireVerifiedEmail := getEnv("REQUIRE_EMAIL_VERIFICATION", "false") == "true"
+	cookieAuth := getEnv("COOKIE_AUTH", "false") == "true"
+	cookieSecure := getEnv("COOKIE_SECURE", "true") == "true"
 	
 	// Parse trusted origins
 	trustedOrigins := parseTrustedOrigins(getEnv("TRUSTED_ORIGINS", "http://localhost:3000"))
 
+	oauthIssuer := strings.TrimSuffix(getEnv("OAUTH_ISSUER", "http://localhost:8080"), "/")
+
 	return &Config{
 		Server: ServerConfig{
 			Address:        getEnv("SERVER_ADDRESS", "0.0.0.0"),
@@ -84,11 +195,14 @@ func Load() (*Config, error) {
 			MaxHeaderBytes: maxHeaderBytes,
 			TLSCertFile:    getEnv("TLS_CERT_FILE", ""),
 			TLSKeyFile:     getEnv("TLS_KEY_FILE", ""),
+			ClientCAFile:   getEnv("TLS_CLIENT_CA_FILE", ""),
+			ClientAuth:     getEnv("TLS_CLIENT_AUTH", "none"),
 			EnableHTTPS:    enableHTTPS,
 			EnableMetrics:  enableMetrics,
 			StaticDir:      getEnv("STATIC_DIR", "./static"),
 		},
 		Database: DatabaseConfig{
+			Driver:         getEnv("DB_DRIVER", "postgres"),
 			Host:           getEnv("DB_HOST", "localhost"),
 			Port:           dbPort,
 			User:           getEnv("DB_USER", "postgres"),
@@ -96,17 +210,73 @@ func Load() (*Config, error) {
 			Name:           getEnv("DB_NAME", "remus_synerge"),
 			SSLMode:        getEnv("DB_SSLMODE", "disable"),
 			MaxConnections: maxConnections,
+			MinConnections: minConnections,
 			MaxIdleTime:    maxIdleTime,
 			MaxLifetime:    maxLifetime,
+			HealthCheckPeriod: healthCheckPeriod,
+			ConnectTimeout: connectTimeout,
+			StatementTimeout: statementTimeout,
+			ApplicationName: getEnv("DB_APPLICATION_NAME", "remus_synerge"),
+			MigrateOnBoot:  getEnv("DB_MIGRATE_ON_BOOT", "false") == "true",
 		},
 		Security: SecurityConfig{
-			JWTSecret:         getEnv("JWT_SECRET_KEY", ""),
-			JWTExpiration:     jwtExpiration,
-			RateLimitRequests: rateLimitRequests,
-			RateLimitWindow:   rateLimitWindow,
-			EnableRateLimit:   enableRateLimit,
-			EnableCORS:        enableCORS,
-			TrustedOrigins:    trustedOrigins,
+			JWTSecret:            getEnv("JWT_SECRET_KEY", ""),
+			JWTKeyFiles:          parseList(getEnv("JWT_KEY_FILES", "")),
+			JWTKeyDir:            getEnv("JWT_KEY_DIR", ""),
+			JWTSigningAlgorithm:  getEnv("JWT_SIGNING_ALG", "RS256"),
+			JWTKeyRotation:       jwtKeyRotation,
+			JWTKeyPrepublish:     jwtKeyPrepublish,
+			JWTKeyRetention:      jwtKeyRetention,
+			JWTExpiration:        jwtExpiration,
+			RefreshTokenTTL:      refreshTokenTTL,
+			RevocationSync:       revocationSync,
+			RoleSync:             roleSync,
+			RateLimitRequests:    rateLimitRequests,
+			RateLimitWindow:      rateLimitWindow,
+			EnableRateLimit:      enableRateLimit,
+			EnableCORS:           enableCORS,
+			TrustedOrigins:       trustedOrigins,
+			OAuthIssuer:          oauthIssuer,
+			OAuthLoginURL:        getEnv("OAUTH_LOGIN_URL", ""),
+			OIDCProviders:        parseOIDCProviders(getEnv("OIDC_PROVIDERS", ""), oauthIssuer),
+			MFAIssuer:            getEnv("MFA_ISSUER", "Remus Synerge"),
+			RequireVerifiedEmail: requireVerifiedEmail,
+			PasswordResetTTL:     passwordResetTTL,
+			EmailVerificationTTL: emailVerificationTTL,
+			LoginFreeAttempts:    loginFreeAttempts,
+			LoginIPFreeAttempts:  loginIPFreeAttempts,
+			LoginBackoffBase:     loginBackoffBase,
+			LoginBackoffMax:      loginBackoffMax,
+			LoginLockoutAttempts: loginLockoutAttempts,
+			LoginLockoutDuration: loginLockoutDuration,
+			LoginFailureWindow:   loginFailureWindow,
+			PasswordHashAlg:      getEnv("PASSWORD_HASH_ALG", "argon2id"),
+			Argon2Memory:         argon2Memory,
+			Argon2Iterations:     argon2Iterations,
+			Argon2Parallelism:    argon2Parallelism,
+			BcryptCost:           bcryptCost,
+			Development:          getEnv("APP_ENV", "") == "development",
+			PasswordMinLength:    passwordMinLength,
+			PasswordMaxLength:    passwordMaxLength,
+			PasswordMinScore:     passwordMinScore,
+			BreachedPasswords:    getEnv("BREACHED_PASSWORDS_FILE", ""),
+			CookieAuth:           cookieAuth,
+			CookieDomain:         getEnv("COOKIE_DOMAIN", ""),
+			CookieSecure:         cookieSecure,
+			CookieSameSite:       getEnv("COOKIE_SAMESITE", "lax"),
+			ImpersonationTTL:     impersonationTTL,
+			DeletedUserRetention: deletedUserRetention,
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "Remus Synerge <no-reply@localhost>"),
+			SMTPHost:     getEnv("SMTP_HOST", ""),
+			SMTPPort:     smtpPort,
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			FileDir:      getEnv("MAIL_FILE_DIR", "./mail"),
+			TemplateDir:  getEnv("MAIL_TEMPLATE_DIR", ""),
+			LinkBaseURL:  getEnv("MAIL_LINK_BASE_URL", "http://localhost:3000"),
 		},
 	}, nil
 }
@@ -125,11 +295,37 @@ func parseTrustedOrigins(origins string) []string {
 		return []string{}
 	}
 	
+	return parseList(origins)
+}
+
+// Helper function to read upstream OIDC providers. Each name in the list is
+// configured through OIDC_<NAME>_* variables; the callback URL defaults to
+// this server's own callback endpoint.
+func parseOIDCProviders(names string, baseURL string) []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, name := range parseList(names) {
+		name = strings.ToLower(name)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(getEnv(prefix+"ISSUER", ""), "/"),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", baseURL+"/api/v1/auth/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+			AllowSignup:  getEnv(prefix+"ALLOW_SIGNUP", "true") == "true",
+		})
+	}
+	return providers
+}
+
+// Helper function to parse a comma-separated list, skipping empty entries
+func parseList(value string) []string {
 	var result []string
-	for _, origin := range strings.Split(origins, ",") {
-		origin = strings.TrimSpace(origin)
-		if origin != "" {
-			result = append(result, origin)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
 		}
 	}
 	
@@ -0,0 +1,25 @@
+-- internal/migrations/0001_baseline.down.sql
+--
+-- Drops the whole schema, and every row in it. The pg_trgm extension is
+-- left in place, since other objects in the database may use it.
+
+DROP TABLE IF EXISTS
+    certificate_bindings,
+    audit_events,
+    sessions,
+    login_throttles,
+    user_tokens,
+    mfa_recovery_codes,
+    user_mfa,
+    user_identities,
+    oauth_authorization_codes,
+    oauth_clients,
+    api_keys,
+    service_accounts,
+    user_roles,
+    role_permissions,
+    roles,
+    revoked_tokens,
+    refresh_tokens,
+    users
+CASCADE;
@@ -0,0 +1,23 @@
+// internal/migrations/migrations.go
+
+// Package migrations embeds the database schema migrations. Create new ones
+// with "main migrate create <name>"; never edit one that has been released.
+package migrations
+
+import (
+	"embed"
+
+	"remus_synerge/pkg/migrate"
+)
+
+// Dir is where "migrate create" writes new migrations, relative to the
+// repository root.
+const Dir = "internal/migrations"
+
+//go:embed *.sql
+var files embed.FS
+
+// Load returns the embedded migrations in version order.
+func Load() ([]migrate.Migration, error) {
+	return migrate.Load(files)
+}
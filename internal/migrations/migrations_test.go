@@ -0,0 +1,18 @@
+package migrations
+
+import "testing"
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load()
+	if err != nil {
+		t.Fatalf("failed to load the embedded migrations: %v", err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("expected migration %d to have version %d, got %s", i, i+1, migration)
+		}
+		if migration.Down == "" {
+			t.Errorf("expected %s to have a down script", migration)
+		}
+	}
+}
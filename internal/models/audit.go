@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Audit event actions
+const (
+	AuditImpersonationStart   = "impersonation.start"
+	AuditImpersonationRequest = "impersonation.request"
+)
+
+// AuditEvent records an action taken by ActorID that affected, or was taken
+// on behalf of, UserID. Request fields are empty for events not tied to a
+// single request.
+type AuditEvent struct {
+	ID        int64     `json:"id" db:"id"`
+	Action    string    `json:"action" db:"action"`
+	ActorID   int       `json:"actor_id" db:"actor_id"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	Method    string    `json:"method,omitempty" db:"method"`
+	Path      string    `json:"path,omitempty" db:"path"`
+	Status    int       `json:"status,omitempty" db:"status"`
+	IPAddress string    `json:"ip_address,omitempty" db:"ip_address"`
+	Reason    string    `json:"reason,omitempty" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
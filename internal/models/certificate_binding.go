@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// CertificateBinding maps a client certificate identity, such as
+// "dns:billing.internal", to the service account or user it authenticates
+// as. Service accounts act with the binding's scopes, as with API keys;
+// users act with their roles.
+type CertificateBinding struct {
+	ID               int       `json:"id" db:"id"`
+	Identity         string    `json:"identity" db:"identity"`
+	ServiceAccountID *int      `json:"service_account_id,omitempty" db:"service_account_id"`
+	UserID           *int      `json:"user_id,omitempty" db:"user_id"`
+	Scopes           []string  `json:"scopes" db:"scopes"`
+	CreatedBy        *int      `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	// PrincipalName is the name of the bound service account or user.
+	PrincipalName string `json:"principal_name" db:"-"`
+}
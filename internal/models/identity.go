@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an upstream OpenID Connect
+// provider. Subject is the provider's stable "sub" claim; Email is what the
+// provider last asserted and is informational only.
+type UserIdentity struct {
+	ID          int        `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	Provider    string     `json:"provider" db:"provider"`
+	Subject     string     `json:"subject" db:"subject"`
+	Email       string     `json:"email" db:"email"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty" db:"last_login_at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// LoginThrottle counts recent failed logins for one key, either an email
+// address or a client IP. LockedUntil is only set for addresses.
+type LoginThrottle struct {
+	Key           string     `json:"key" db:"key"`
+	Failures      int        `json:"failures" db:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at" db:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// UserMFA is a user's TOTP enrollment. It exists but is not enabled between
+// enrollment and the first verified code. LastUsedStep is the most recent
+// accepted time step, kept so a code cannot be used twice.
+type UserMFA struct {
+	UserID       int        `json:"user_id" db:"user_id"`
+	Secret       string     `json:"-" db:"secret"`
+	Enabled      bool       `json:"enabled" db:"enabled"`
+	LastUsedStep int64      `json:"-" db:"last_used_step"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	EnabledAt    *time.Time `json:"enabled_at,omitempty" db:"enabled_at"`
+}
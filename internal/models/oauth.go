@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// OAuthClient is an application registered to use this server as its
+// identity provider. Public clients have no secret and must use PKCE.
+type OAuthClient struct {
+	ID           int       `json:"id" db:"id"`
+	ClientID     string    `json:"client_id" db:"client_id"`
+	SecretHash   string    `json:"-" db:"secret_hash"`
+	Name         string    `json:"name" db:"name"`
+	RedirectURIs []string  `json:"redirect_uris" db:"redirect_uris"`
+	GrantTypes   []string  `json:"grant_types" db:"grant_types"`
+	Scopes       []string  `json:"scopes" db:"scopes"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// AuthorizationCode is a single-use code issued by the authorization
+// endpoint. Tokens issued for it join FamilyID so that a replayed code can
+// revoke them.
+type AuthorizationCode struct {
+	ID            int        `json:"id" db:"id"`
+	CodeHash      string     `json:"-" db:"code_hash"`
+	ClientID      string     `json:"client_id" db:"client_id"`
+	UserID        int        `json:"user_id" db:"user_id"`
+	RedirectURI   string     `json:"redirect_uri" db:"redirect_uri"`
+	Scope         string     `json:"scope" db:"scope"`
+	Nonce         string     `json:"nonce,omitempty" db:"nonce"`
+	CodeChallenge string     `json:"-" db:"code_challenge"`
+	FamilyID      string     `json:"-" db:"family_id"`
+	ExpiresAt     time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UsedAt        *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
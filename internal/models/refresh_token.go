@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// RefreshToken is a single opaque refresh token. Tokens issued from the same
+// login share a FamilyID so that a replayed token can revoke the whole chain.
+// Tokens issued to OAuth clients carry the client ID and granted scope; first
+// party tokens leave both empty.
+type RefreshToken struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	FamilyID  string     `json:"family_id" db:"family_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ParentID  *int       `json:"parent_id,omitempty" db:"parent_id"`
+	ClientID  string     `json:"client_id,omitempty" db:"client_id"`
+	Scope     string     `json:"scope,omitempty" db:"scope"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
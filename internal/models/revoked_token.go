@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// RevokedToken records an access token that was revoked before its expiry.
+type RevokedToken struct {
+	JTI       string    `json:"jti" db:"jti"`
+	UserID    int       `json:"user_id" db:"user_id"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	RevokedAt time.Time `json:"revoked_at" db:"revoked_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type Role struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	Permissions []string  `json:"permissions"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
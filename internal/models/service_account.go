@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// ServiceAccount is a non-human principal that authenticates with API keys.
+type ServiceAccount struct {
+	ID          int       `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	CreatedBy   *int      `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+}
+
+// APIKey is a long-lived credential for a service account. Only the hash of
+// the key is stored; Prefix identifies the key without revealing it.
+type APIKey struct {
+	ID               int        `json:"id" db:"id"`
+	ServiceAccountID int        `json:"service_account_id" db:"service_account_id"`
+	Name             string     `json:"name" db:"name"`
+	Prefix           string     `json:"prefix" db:"prefix"`
+	KeyHash          string     `json:"-" db:"key_hash"`
+	Scopes           []string   `json:"scopes" db:"scopes"`
+	AllowedCIDRs     []string   `json:"allowed_cidrs" db:"allowed_cidrs"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt       *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Session is a single login on one device. Its ID is shared by the refresh
+// token family and, as the sid claim, by every access token of the login.
+type Session struct {
+	ID          string     `json:"id" db:"id"`
+	UserID      int        `json:"user_id" db:"user_id"`
+	DeviceLabel string     `json:"device_label" db:"device_label"`
+	UserAgent   string     `json:"user_agent" db:"user_agent"`
+	IPAddress   string     `json:"ip_address" db:"ip_address"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	LastSeenAt  time.Time  `json:"last_seen_at" db:"last_seen_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
@@ -9,4 +9,12 @@ type User struct {
 	Password  string    `json:"-" db:"password"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	// EmailVerifiedAt is nil until the user proves control of Email.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	// DeletedAt is set while the user is deleted but not yet purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Version is bumped by every update and serves as the user's ETag.
+	Version int `json:"-" db:"version"`
+	// DisplayName is optional; nil when the user has not set one.
+	DisplayName *string `json:"display_name" db:"display_name"`
 }
\ No newline at end of file
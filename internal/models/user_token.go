@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeAccountUnlock     = "account_unlock"
+)
+
+// UserToken is a single-use token sent to a user by email. Only its hash is
+// stored. Email is the address the token was sent to, so that a token stops
+// working when the user changes address.
+type UserToken struct {
+	ID        int        `json:"id" db:"id"`
+	UserID    int        `json:"user_id" db:"user_id"`
+	Purpose   string     `json:"purpose" db:"purpose"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	Email     string     `json:"email" db:"email"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+}
@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+var (
+	ErrServiceAccountNotFound = fmt.Errorf("service account %w", ErrNotFound)
+	ErrServiceAccountExists   = errors.New("service account already exists")
+	ErrAPIKeyNotFound         = fmt.Errorf("api key %w", ErrNotFound)
+)
+
+type APIKeyRepository interface {
+	CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error
+	GetServiceAccountByID(ctx context.Context, id int) (*models.ServiceAccount, error)
+	ListServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error)
+	DeleteServiceAccount(ctx context.Context, id int) error
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	// GetAPIKeyByHash returns the key regardless of expiry or revocation.
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, serviceAccountID int) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, serviceAccountID, keyID int) error
+	TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryAPIKeyRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryAPIKeyRepository(db *MemoryDB) APIKeyRepository {
+	return &memoryAPIKeyRepo{db: db}
+}
+
+func copyServiceAccount(account *models.ServiceAccount) *models.ServiceAccount {
+	copied := *account
+	copied.CreatedBy = copyInt(account.CreatedBy)
+	return &copied
+}
+
+func copyAPIKey(key *models.APIKey) *models.APIKey {
+	copied := *key
+	copied.Scopes = copyStrings(key.Scopes)
+	copied.AllowedCIDRs = copyStrings(key.AllowedCIDRs)
+	copied.ExpiresAt = copyTime(key.ExpiresAt)
+	copied.LastUsedAt = copyTime(key.LastUsedAt)
+	copied.RevokedAt = copyTime(key.RevokedAt)
+	return &copied
+}
+
+func (r *memoryAPIKeyRepo) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, other := range r.db.serviceAccounts {
+		if other.Name == account.Name {
+			return ErrServiceAccountExists
+		}
+	}
+	account.CreatedAt = time.Now()
+	account.ID = r.db.nextID("service_accounts")
+	r.db.serviceAccounts[account.ID] = copyServiceAccount(account)
+	return nil
+}
+
+func (r *memoryAPIKeyRepo) GetServiceAccountByID(ctx context.Context, id int) (*models.ServiceAccount, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	account, ok := r.db.serviceAccounts[id]
+	if !ok {
+		return nil, ErrServiceAccountNotFound
+	}
+	return copyServiceAccount(account), nil
+}
+
+func (r *memoryAPIKeyRepo) ListServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	accounts := []*models.ServiceAccount{}
+	for _, account := range r.db.serviceAccounts {
+		accounts = append(accounts, copyServiceAccount(account))
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].Name < accounts[j].Name })
+	return accounts, nil
+}
+
+func (r *memoryAPIKeyRepo) DeleteServiceAccount(ctx context.Context, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.serviceAccounts[id]; !ok {
+		return ErrServiceAccountNotFound
+	}
+	delete(r.db.serviceAccounts, id)
+	for keyID, key := range r.db.apiKeys {
+		if key.ServiceAccountID == id {
+			delete(r.db.apiKeys, keyID)
+		}
+	}
+	for bindingID, binding := range r.db.certificateBindings {
+		if binding.ServiceAccountID != nil && *binding.ServiceAccountID == id {
+			delete(r.db.certificateBindings, bindingID)
+		}
+	}
+	return nil
+}
+
+func (r *memoryAPIKeyRepo) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, other := range r.db.apiKeys {
+		if other.KeyHash == key.KeyHash {
+			return &ErrConflict{Field: "key_hash"}
+		}
+	}
+	key.CreatedAt = time.Now()
+	key.ID = r.db.nextID("api_keys")
+	r.db.apiKeys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+func (r *memoryAPIKeyRepo) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, key := range r.db.apiKeys {
+		if key.KeyHash == keyHash {
+			return copyAPIKey(key), nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+func (r *memoryAPIKeyRepo) ListAPIKeys(ctx context.Context, serviceAccountID int) ([]*models.APIKey, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	keys := []*models.APIKey{}
+	for _, key := range r.db.apiKeys {
+		if key.ServiceAccountID == serviceAccountID {
+			keys = append(keys, copyAPIKey(key))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepo) RevokeAPIKey(ctx context.Context, serviceAccountID, keyID int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	key, ok := r.db.apiKeys[keyID]
+	if !ok || key.ServiceAccountID != serviceAccountID || key.RevokedAt != nil {
+		return ErrAPIKeyNotFound
+	}
+	now := time.Now()
+	key.RevokedAt = &now
+	return nil
+}
+
+func (r *memoryAPIKeyRepo) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if key, ok := r.db.apiKeys[keyID]; ok {
+		key.LastUsedAt = copyTime(&usedAt)
+	}
+	return nil
+}
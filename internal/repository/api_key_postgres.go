@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type apiKeyRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyRepository(db *pgxpool.Pool) APIKeyRepository {
+	return &apiKeyRepo{db: db}
+}
+
+func (r *apiKeyRepo) CreateServiceAccount(ctx context.Context, account *models.ServiceAccount) error {
+	query := `INSERT INTO service_accounts (name, description, created_by, created_at)
+			  VALUES ($1, $2, $3, $4)
+			  ON CONFLICT (name) DO NOTHING
+			  RETURNING id`
+
+	account.CreatedAt = time.Now()
+	err := r.db.QueryRow(ctx, query, account.Name, account.Description, account.CreatedBy, account.CreatedAt).Scan(&account.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrServiceAccountExists
+	}
+	return err
+}
+
+func (r *apiKeyRepo) GetServiceAccountByID(ctx context.Context, id int) (*models.ServiceAccount, error) {
+	query := `SELECT id, name, description, created_by, created_at FROM service_accounts WHERE id = $1`
+	account := &models.ServiceAccount{}
+	err := r.db.QueryRow(ctx, query, id).Scan(&account.ID, &account.Name, &account.Description, &account.CreatedBy, &account.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+func (r *apiKeyRepo) ListServiceAccounts(ctx context.Context) ([]*models.ServiceAccount, error) {
+	query := `SELECT id, name, description, created_by, created_at FROM service_accounts ORDER BY name`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []*models.ServiceAccount{}
+	for rows.Next() {
+		account := &models.ServiceAccount{}
+		if err := rows.Scan(&account.ID, &account.Name, &account.Description, &account.CreatedBy, &account.CreatedAt); err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+func (r *apiKeyRepo) DeleteServiceAccount(ctx context.Context, id int) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM service_accounts WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrServiceAccountNotFound
+	}
+	return nil
+}
+
+func (r *apiKeyRepo) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	query := `INSERT INTO api_keys (service_account_id, name, prefix, key_hash, scopes, allowed_cidrs, expires_at, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	key.CreatedAt = time.Now()
+	return r.db.QueryRow(ctx, query, key.ServiceAccountID, key.Name, key.Prefix, key.KeyHash,
+		key.Scopes, key.AllowedCIDRs, key.ExpiresAt, key.CreatedAt).Scan(&key.ID)
+}
+
+const apiKeyColumns = `id, service_account_id, name, prefix, key_hash, scopes, allowed_cidrs,
+			  expires_at, last_used_at, created_at, revoked_at`
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	key := &models.APIKey{}
+	err := row.Scan(&key.ID, &key.ServiceAccountID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes, &key.AllowedCIDRs,
+		&key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt, &key.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (r *apiKeyRepo) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	key, err := scanAPIKey(r.db.QueryRow(ctx, query, keyHash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	return key, err
+}
+
+func (r *apiKeyRepo) ListAPIKeys(ctx context.Context, serviceAccountID int) ([]*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE service_account_id = $1 ORDER BY created_at`
+	rows, err := r.db.Query(ctx, query, serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *apiKeyRepo) RevokeAPIKey(ctx context.Context, serviceAccountID, keyID int) error {
+	query := `UPDATE api_keys SET revoked_at = NOW()
+			  WHERE id = $1 AND service_account_id = $2 AND revoked_at IS NULL`
+	tag, err := r.db.Exec(ctx, query, keyID, serviceAccountID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func (r *apiKeyRepo) TouchAPIKey(ctx context.Context, keyID int, usedAt time.Time) error {
+	_, err := r.db.Exec(ctx, `UPDATE api_keys SET last_used_at = $1 WHERE id = $2`, usedAt, keyID)
+	return err
+}
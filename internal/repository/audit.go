@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+
+	"remus_synerge/internal/models"
+)
+
+type AuditRepository interface {
+	// RecordEvent appends an event to the audit trail and sets its ID.
+	RecordEvent(ctx context.Context, event *models.AuditEvent) error
+}
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryAuditRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryAuditRepository(db *MemoryDB) AuditRepository {
+	return &memoryAuditRepo{db: db}
+}
+
+func (r *memoryAuditRepo) RecordEvent(ctx context.Context, event *models.AuditEvent) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	event.ID = int64(r.db.nextID("audit_events"))
+	copied := *event
+	r.db.auditEvents = append(r.db.auditEvents, &copied)
+	return nil
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type auditRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditRepository(db *pgxpool.Pool) AuditRepository {
+	return &auditRepo{db: db}
+}
+
+func (r *auditRepo) RecordEvent(ctx context.Context, event *models.AuditEvent) error {
+	query := `INSERT INTO audit_events (action, actor_id, user_id, method, path, status, ip_address, reason, created_at)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			   RETURNING id`
+	return r.db.QueryRow(ctx, query, event.Action, event.ActorID, event.UserID, event.Method, event.Path,
+		event.Status, event.IPAddress, event.Reason, event.CreatedAt).Scan(&event.ID)
+}
@@ -0,0 +1,23 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"remus_synerge/internal/models"
+)
+
+var (
+	ErrCertificateBindingNotFound = fmt.Errorf("certificate binding %w", ErrNotFound)
+	ErrCertificateBindingExists   = errors.New("certificate identity is already bound")
+)
+
+type CertificateBindingRepository interface {
+	CreateCertificateBinding(ctx context.Context, binding *models.CertificateBinding) error
+	// FindCertificateBinding returns the binding of the first of identities
+	// that is bound. Bindings of soft-deleted users are skipped.
+	FindCertificateBinding(ctx context.Context, identities []string) (*models.CertificateBinding, error)
+	ListCertificateBindings(ctx context.Context) ([]*models.CertificateBinding, error)
+	DeleteCertificateBinding(ctx context.Context, id int) error
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryCertificateBindingRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryCertificateBindingRepository(db *MemoryDB) CertificateBindingRepository {
+	return &memoryCertificateBindingRepo{db: db}
+}
+
+// certificateBinding copies a stored binding and fills in the name of the
+// principal it is bound to.
+func (db *MemoryDB) certificateBinding(binding *models.CertificateBinding) *models.CertificateBinding {
+	copied := *binding
+	copied.ServiceAccountID = copyInt(binding.ServiceAccountID)
+	copied.UserID = copyInt(binding.UserID)
+	copied.Scopes = copyStrings(binding.Scopes)
+	copied.CreatedBy = copyInt(binding.CreatedBy)
+	copied.PrincipalName = ""
+	if binding.ServiceAccountID != nil {
+		if account, ok := db.serviceAccounts[*binding.ServiceAccountID]; ok {
+			copied.PrincipalName = account.Name
+		}
+	} else if binding.UserID != nil {
+		if user, ok := db.users[*binding.UserID]; ok {
+			copied.PrincipalName = user.Username
+		}
+	}
+	return &copied
+}
+
+func (r *memoryCertificateBindingRepo) CreateCertificateBinding(ctx context.Context, binding *models.CertificateBinding) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, other := range r.db.certificateBindings {
+		if other.Identity == binding.Identity {
+			return ErrCertificateBindingExists
+		}
+	}
+	binding.CreatedAt = time.Now()
+	binding.ID = r.db.nextID("certificate_bindings")
+	stored := r.db.certificateBinding(binding)
+	stored.PrincipalName = ""
+	r.db.certificateBindings[binding.ID] = stored
+	return nil
+}
+
+func (r *memoryCertificateBindingRepo) FindCertificateBinding(ctx context.Context, identities []string) (*models.CertificateBinding, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, identity := range identities {
+		for _, binding := range r.db.certificateBindings {
+			if binding.Identity != identity {
+				continue
+			}
+			if binding.UserID != nil {
+				if user, ok := r.db.users[*binding.UserID]; ok && user.DeletedAt != nil {
+					continue
+				}
+			}
+			return r.db.certificateBinding(binding), nil
+		}
+	}
+	return nil, ErrCertificateBindingNotFound
+}
+
+func (r *memoryCertificateBindingRepo) ListCertificateBindings(ctx context.Context) ([]*models.CertificateBinding, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	bindings := []*models.CertificateBinding{}
+	for _, binding := range r.db.certificateBindings {
+		bindings = append(bindings, r.db.certificateBinding(binding))
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i].Identity < bindings[j].Identity })
+	return bindings, nil
+}
+
+func (r *memoryCertificateBindingRepo) DeleteCertificateBinding(ctx context.Context, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.certificateBindings[id]; !ok {
+		return ErrCertificateBindingNotFound
+	}
+	delete(r.db.certificateBindings, id)
+	return nil
+}
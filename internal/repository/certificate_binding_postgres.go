@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type certificateBindingRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewCertificateBindingRepository(db *pgxpool.Pool) CertificateBindingRepository {
+	return &certificateBindingRepo{db: db}
+}
+
+const certificateBindingColumns = `b.id, b.identity, b.service_account_id, b.user_id, b.scopes, b.created_by, b.created_at,
+			  COALESCE(sa.name, u.username, '')
+			  FROM certificate_bindings b
+			  LEFT JOIN service_accounts sa ON sa.id = b.service_account_id
+			  LEFT JOIN users u ON u.id = b.user_id`
+
+func (r *certificateBindingRepo) CreateCertificateBinding(ctx context.Context, binding *models.CertificateBinding) error {
+	query := `INSERT INTO certificate_bindings (identity, service_account_id, user_id, scopes, created_by, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  ON CONFLICT (identity) DO NOTHING
+			  RETURNING id`
+
+	binding.CreatedAt = time.Now()
+	err := r.db.QueryRow(ctx, query, binding.Identity, binding.ServiceAccountID, binding.UserID, binding.Scopes,
+		binding.CreatedBy, binding.CreatedAt).Scan(&binding.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCertificateBindingExists
+	}
+	return err
+}
+
+func (r *certificateBindingRepo) FindCertificateBinding(ctx context.Context, identities []string) (*models.CertificateBinding, error) {
+	// Bindings of soft-deleted users stop working at once, not at the purge.
+	query := `SELECT ` + certificateBindingColumns + `
+			  WHERE b.identity = ANY($1) AND (b.user_id IS NULL OR u.deleted_at IS NULL)
+			  ORDER BY array_position($1, b.identity::text)
+			  LIMIT 1`
+	binding, err := scanCertificateBinding(r.db.QueryRow(ctx, query, identities))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCertificateBindingNotFound
+	}
+	return binding, err
+}
+
+func (r *certificateBindingRepo) ListCertificateBindings(ctx context.Context) ([]*models.CertificateBinding, error) {
+	query := `SELECT ` + certificateBindingColumns + ` ORDER BY b.identity`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := []*models.CertificateBinding{}
+	for rows.Next() {
+		binding, err := scanCertificateBinding(rows)
+		if err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, binding)
+	}
+	return bindings, rows.Err()
+}
+
+func (r *certificateBindingRepo) DeleteCertificateBinding(ctx context.Context, id int) error {
+	query := `DELETE FROM certificate_bindings WHERE id = $1`
+	result, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrCertificateBindingNotFound
+	}
+	return nil
+}
+
+func scanCertificateBinding(row pgx.Row) (*models.CertificateBinding, error) {
+	binding := &models.CertificateBinding{}
+	err := row.Scan(&binding.ID, &binding.Identity, &binding.ServiceAccountID, &binding.UserID, &binding.Scopes,
+		&binding.CreatedBy, &binding.CreatedAt, &binding.PrincipalName)
+	if err != nil {
+		return nil, err
+	}
+	return binding, nil
+}
@@ -0,0 +1,25 @@
+package repository
+
+import "errors"
+
+var (
+	// ErrNotFound means the record does not exist. The not-found errors of
+	// each repository, such as ErrUserNotFound, wrap it.
+	ErrNotFound = errors.New("not found")
+	// ErrUnavailable means the database could not be reached, timed out or
+	// could not complete the transaction. Retrying later may succeed.
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// ErrConflict means a write would break a uniqueness rule. Field names the
+// conflicting field, e.g. "email", or is empty if it is not known.
+type ErrConflict struct {
+	Field string
+}
+
+func (e *ErrConflict) Error() string {
+	if e.Field == "" {
+		return "conflicts with an existing record"
+	}
+	return e.Field + " is already taken"
+}
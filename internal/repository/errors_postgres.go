@@ -0,0 +1,52 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// uniqueFields names the field each unique constraint protects.
+var uniqueFields = map[string]string{
+	"idx_users_username_active": "username",
+	"idx_users_email_active":    "email",
+}
+
+// dbError translates errors from pgx into the errors of this package:
+// ErrNotFound for pgx.ErrNoRows, *ErrConflict for unique violations (23505),
+// and ErrUnavailable for serialization failures (40001), deadlocks,
+// timeouts and lost connections. Anything else is returned unchanged.
+func dbError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505":
+			return &ErrConflict{Field: uniqueFields[pgErr.ConstraintName]}
+		case pgErr.Code == "40001", pgErr.Code == "40P01",
+			// Too many connections, and the server shutting down or starting up
+			pgErr.Code == "53300", strings.HasPrefix(pgErr.Code, "57P"),
+			// Connection exceptions
+			strings.HasPrefix(pgErr.Code, "08"):
+			return fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var netErr net.Error
+	if pgconn.Timeout(err) || errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) || pgconn.SafeToRetry(err) {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
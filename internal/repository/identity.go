@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+var (
+	ErrIdentityNotFound = fmt.Errorf("identity %w", ErrNotFound)
+	ErrIdentityExists   = errors.New("identity already linked")
+)
+
+type IdentityRepository interface {
+	// CreateIdentity returns ErrIdentityExists if the provider subject is
+	// already linked to a user.
+	CreateIdentity(ctx context.Context, identity *models.UserIdentity) error
+	GetIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error)
+	ListUserIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error)
+	UpdateIdentityLogin(ctx context.Context, id int, email string, loginAt time.Time) error
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryIdentityRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryIdentityRepository(db *MemoryDB) IdentityRepository {
+	return &memoryIdentityRepo{db: db}
+}
+
+func copyIdentity(identity *models.UserIdentity) *models.UserIdentity {
+	copied := *identity
+	copied.LastLoginAt = copyTime(identity.LastLoginAt)
+	return &copied
+}
+
+func (r *memoryIdentityRepo) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, other := range r.db.identities {
+		if other.Provider == identity.Provider && other.Subject == identity.Subject {
+			return ErrIdentityExists
+		}
+	}
+	identity.CreatedAt = time.Now()
+	identity.ID = r.db.nextID("user_identities")
+	r.db.identities[identity.ID] = copyIdentity(identity)
+	return nil
+}
+
+func (r *memoryIdentityRepo) GetIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, identity := range r.db.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return copyIdentity(identity), nil
+		}
+	}
+	return nil, ErrIdentityNotFound
+}
+
+func (r *memoryIdentityRepo) ListUserIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	identities := []*models.UserIdentity{}
+	for _, identity := range r.db.identities {
+		if identity.UserID == userID {
+			identities = append(identities, copyIdentity(identity))
+		}
+	}
+	sort.Slice(identities, func(i, j int) bool {
+		if identities[i].Provider != identities[j].Provider {
+			return identities[i].Provider < identities[j].Provider
+		}
+		return identities[i].CreatedAt.Before(identities[j].CreatedAt)
+	})
+	return identities, nil
+}
+
+func (r *memoryIdentityRepo) UpdateIdentityLogin(ctx context.Context, id int, email string, loginAt time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	identity, ok := r.db.identities[id]
+	if !ok {
+		return ErrIdentityNotFound
+	}
+	identity.Email = email
+	identity.LastLoginAt = copyTime(&loginAt)
+	return nil
+}
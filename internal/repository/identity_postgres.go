@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type identityRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityRepository(db *pgxpool.Pool) IdentityRepository {
+	return &identityRepo{db: db}
+}
+
+func (r *identityRepo) CreateIdentity(ctx context.Context, identity *models.UserIdentity) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email, created_at, last_login_at)
+			  VALUES ($1, $2, $3, $4, $5, $6)
+			  ON CONFLICT (provider, subject) DO NOTHING RETURNING id`
+
+	identity.CreatedAt = time.Now()
+	err := r.db.QueryRow(ctx, query, identity.UserID, identity.Provider, identity.Subject,
+		identity.Email, identity.CreatedAt, identity.LastLoginAt).Scan(&identity.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrIdentityExists
+	}
+	return err
+}
+
+const identityColumns = `id, user_id, provider, subject, email, created_at, last_login_at`
+
+func scanIdentity(row pgx.Row) (*models.UserIdentity, error) {
+	identity := &models.UserIdentity{}
+	err := row.Scan(&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&identity.Email, &identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *identityRepo) GetIdentity(ctx context.Context, provider, subject string) (*models.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE provider = $1 AND subject = $2`
+	identity, err := scanIdentity(r.db.QueryRow(ctx, query, provider, subject))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	return identity, err
+}
+
+func (r *identityRepo) ListUserIdentities(ctx context.Context, userID int) ([]*models.UserIdentity, error) {
+	query := `SELECT ` + identityColumns + ` FROM user_identities WHERE user_id = $1 ORDER BY provider, created_at`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []*models.UserIdentity{}
+	for rows.Next() {
+		identity, err := scanIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *identityRepo) UpdateIdentityLogin(ctx context.Context, id int, email string, loginAt time.Time) error {
+	tag, err := r.db.Exec(ctx, `UPDATE user_identities SET email = $2, last_login_at = $3 WHERE id = $1`, id, email, loginAt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrIdentityNotFound
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type LoginThrottleRepository interface {
+	// GetLoginThrottles returns the state of the given keys; keys without
+	// recorded failures are left out.
+	GetLoginThrottles(ctx context.Context, keys []string) ([]*models.LoginThrottle, error)
+	// RecordLoginFailure counts a failure and returns the new state. The
+	// count starts over if the previous failure was before resetBefore.
+	RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginThrottle, error)
+	LockLogin(ctx context.Context, key string, until time.Time) error
+	ClearLoginThrottle(ctx context.Context, key string) error
+	DeleteStaleLoginThrottles(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryLoginThrottleRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryLoginThrottleRepository(db *MemoryDB) LoginThrottleRepository {
+	return &memoryLoginThrottleRepo{db: db}
+}
+
+func copyLoginThrottle(throttle *models.LoginThrottle) *models.LoginThrottle {
+	copied := *throttle
+	copied.LockedUntil = copyTime(throttle.LockedUntil)
+	return &copied
+}
+
+func (r *memoryLoginThrottleRepo) GetLoginThrottles(ctx context.Context, keys []string) ([]*models.LoginThrottle, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var throttles []*models.LoginThrottle
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if throttle, ok := r.db.loginThrottles[key]; ok && !seen[key] {
+			seen[key] = true
+			throttles = append(throttles, copyLoginThrottle(throttle))
+		}
+	}
+	return throttles, nil
+}
+
+func (r *memoryLoginThrottleRepo) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginThrottle, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	throttle, ok := r.db.loginThrottles[key]
+	switch {
+	case !ok:
+		throttle = &models.LoginThrottle{Key: key, Failures: 1}
+		r.db.loginThrottles[key] = throttle
+	case throttle.LastFailureAt.Before(resetBefore):
+		throttle.Failures = 1
+	default:
+		throttle.Failures++
+	}
+	throttle.LastFailureAt = at
+	return copyLoginThrottle(throttle), nil
+}
+
+func (r *memoryLoginThrottleRepo) LockLogin(ctx context.Context, key string, until time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if throttle, ok := r.db.loginThrottles[key]; ok {
+		throttle.LockedUntil = copyTime(&until)
+	}
+	return nil
+}
+
+func (r *memoryLoginThrottleRepo) ClearLoginThrottle(ctx context.Context, key string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	delete(r.db.loginThrottles, key)
+	return nil
+}
+
+func (r *memoryLoginThrottleRepo) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var deleted int64
+	for key, throttle := range r.db.loginThrottles {
+		if throttle.LastFailureAt.Before(before) && (throttle.LockedUntil == nil || throttle.LockedUntil.Before(before)) {
+			delete(r.db.loginThrottles, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type loginThrottleRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewLoginThrottleRepository(db *pgxpool.Pool) LoginThrottleRepository {
+	return &loginThrottleRepo{db: db}
+}
+
+func (r *loginThrottleRepo) GetLoginThrottles(ctx context.Context, keys []string) ([]*models.LoginThrottle, error) {
+	query := `SELECT key, failures, last_failure_at, locked_until FROM login_throttles WHERE key = ANY($1)`
+	rows, err := r.db.Query(ctx, query, keys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var throttles []*models.LoginThrottle
+	for rows.Next() {
+		throttle := &models.LoginThrottle{}
+		if err := rows.Scan(&throttle.Key, &throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil); err != nil {
+			return nil, err
+		}
+		throttles = append(throttles, throttle)
+	}
+	return throttles, rows.Err()
+}
+
+func (r *loginThrottleRepo) RecordLoginFailure(ctx context.Context, key string, at, resetBefore time.Time) (*models.LoginThrottle, error) {
+	query := `INSERT INTO login_throttles (key, failures, last_failure_at)
+			   VALUES ($1, 1, $2)
+			   ON CONFLICT (key) DO UPDATE SET
+			       failures = CASE WHEN login_throttles.last_failure_at < $3 THEN 1 ELSE login_throttles.failures + 1 END,
+			       last_failure_at = EXCLUDED.last_failure_at
+			   RETURNING key, failures, last_failure_at, locked_until`
+
+	throttle := &models.LoginThrottle{}
+	err := r.db.QueryRow(ctx, query, key, at, resetBefore).Scan(
+		&throttle.Key, &throttle.Failures, &throttle.LastFailureAt, &throttle.LockedUntil)
+	if err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+func (r *loginThrottleRepo) LockLogin(ctx context.Context, key string, until time.Time) error {
+	_, err := r.db.Exec(ctx, `UPDATE login_throttles SET locked_until = $1 WHERE key = $2`, until, key)
+	return err
+}
+
+func (r *loginThrottleRepo) ClearLoginThrottle(ctx context.Context, key string) error {
+	_, err := r.db.Exec(ctx, `DELETE FROM login_throttles WHERE key = $1`, key)
+	return err
+}
+
+func (r *loginThrottleRepo) DeleteStaleLoginThrottles(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM login_throttles
+			  WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $1)`
+	tag, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+// MemoryDB holds the tables of the in-memory repositories. It is meant for
+// development and tests: nothing is persisted, and one lock serializes every
+// operation, which makes each of them atomic.
+//
+// Unique constraints are enforced as in the SQL schema, and deleting a row
+// removes or clears the rows that reference it, as ON DELETE does. Other
+// foreign keys are not checked. Text is ordered by byte value rather than by
+// the database collation.
+type MemoryDB struct {
+	mu        sync.Mutex
+	sequences map[string]int
+
+	users               map[int]*models.User
+	tokensValidAfter    map[int]time.Time
+	refreshTokens       map[int]*models.RefreshToken
+	revokedTokens       map[string]*models.RevokedToken
+	roles               []*models.Role
+	userRoles           map[int][]int
+	serviceAccounts     map[int]*models.ServiceAccount
+	apiKeys             map[int]*models.APIKey
+	oauthClients        map[string]*models.OAuthClient
+	authorizationCodes  map[int]*models.AuthorizationCode
+	identities          map[int]*models.UserIdentity
+	mfa                 map[int]*models.UserMFA
+	recoveryCodes       map[int][]*memoryRecoveryCode
+	userTokens          map[int]*models.UserToken
+	loginThrottles      map[string]*models.LoginThrottle
+	sessions            map[string]*models.Session
+	auditEvents         []*models.AuditEvent
+	certificateBindings map[int]*models.CertificateBinding
+}
+
+// NewMemoryDB returns an empty store holding the built-in roles, like a
+// freshly migrated database.
+func NewMemoryDB() *MemoryDB {
+	db := &MemoryDB{
+		sequences:           make(map[string]int),
+		users:               make(map[int]*models.User),
+		tokensValidAfter:    make(map[int]time.Time),
+		refreshTokens:       make(map[int]*models.RefreshToken),
+		revokedTokens:       make(map[string]*models.RevokedToken),
+		userRoles:           make(map[int][]int),
+		serviceAccounts:     make(map[int]*models.ServiceAccount),
+		apiKeys:             make(map[int]*models.APIKey),
+		oauthClients:        make(map[string]*models.OAuthClient),
+		authorizationCodes:  make(map[int]*models.AuthorizationCode),
+		identities:          make(map[int]*models.UserIdentity),
+		mfa:                 make(map[int]*models.UserMFA),
+		recoveryCodes:       make(map[int][]*memoryRecoveryCode),
+		userTokens:          make(map[int]*models.UserToken),
+		loginThrottles:      make(map[string]*models.LoginThrottle),
+		sessions:            make(map[string]*models.Session),
+		certificateBindings: make(map[int]*models.CertificateBinding),
+	}
+
+	// Every account implicitly holds the "user" role; "admin" holds every permission.
+	now := time.Now()
+	db.roles = []*models.Role{
+		{ID: db.nextID("roles"), Name: "admin", Description: "Full access to every resource", Permissions: []string{"*"}, CreatedAt: now},
+		{ID: db.nextID("roles"), Name: "user", Description: "Default role held by every account", Permissions: []string{}, CreatedAt: now},
+	}
+	return db
+}
+
+// NewMemoryRepositories returns every repository backed by one new
+// MemoryDB.
+func NewMemoryRepositories() *Repositories {
+	db := NewMemoryDB()
+	return &Repositories{
+		Users:               NewMemoryUserRepository(db),
+		RefreshTokens:       NewMemoryRefreshTokenRepository(db),
+		TokenRevocations:    NewMemoryTokenRevocationRepository(db),
+		Roles:               NewMemoryRoleRepository(db),
+		APIKeys:             NewMemoryAPIKeyRepository(db),
+		OAuth:               NewMemoryOAuthRepository(db),
+		Identities:          NewMemoryIdentityRepository(db),
+		MFA:                 NewMemoryMFARepository(db),
+		UserTokens:          NewMemoryUserTokenRepository(db),
+		LoginThrottles:      NewMemoryLoginThrottleRepository(db),
+		Sessions:            NewMemorySessionRepository(db),
+		Audit:               NewMemoryAuditRepository(db),
+		CertificateBindings: NewMemoryCertificateBindingRepository(db),
+	}
+}
+
+// nextID returns the next value of the table's ID sequence.
+func (db *MemoryDB) nextID(table string) int {
+	db.sequences[table]++
+	return db.sequences[table]
+}
+
+// deleteUser removes a user along with the rows that reference it.
+func (db *MemoryDB) deleteUser(id int) {
+	delete(db.users, id)
+	delete(db.tokensValidAfter, id)
+	delete(db.userRoles, id)
+	delete(db.mfa, id)
+	delete(db.recoveryCodes, id)
+
+	for tokenID, token := range db.refreshTokens {
+		if token.UserID == id {
+			delete(db.refreshTokens, tokenID)
+		}
+	}
+	for jti, token := range db.revokedTokens {
+		if token.UserID == id {
+			delete(db.revokedTokens, jti)
+		}
+	}
+	for codeID, code := range db.authorizationCodes {
+		if code.UserID == id {
+			delete(db.authorizationCodes, codeID)
+		}
+	}
+	for identityID, identity := range db.identities {
+		if identity.UserID == id {
+			delete(db.identities, identityID)
+		}
+	}
+	for tokenID, token := range db.userTokens {
+		if token.UserID == id {
+			delete(db.userTokens, tokenID)
+		}
+	}
+	for sessionID, session := range db.sessions {
+		if session.UserID == id {
+			delete(db.sessions, sessionID)
+		}
+	}
+	for bindingID, binding := range db.certificateBindings {
+		if binding.UserID != nil && *binding.UserID == id {
+			delete(db.certificateBindings, bindingID)
+		} else if binding.CreatedBy != nil && *binding.CreatedBy == id {
+			binding.CreatedBy = nil
+		}
+	}
+	for _, account := range db.serviceAccounts {
+		if account.CreatedBy != nil && *account.CreatedBy == id {
+			account.CreatedBy = nil
+		}
+	}
+}
+
+// Stored rows are copied on the way in and out, so callers cannot change
+// them behind the repository's back.
+
+func copyTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	copied := *t
+	return &copied
+}
+
+func copyInt(i *int) *int {
+	if i == nil {
+		return nil
+	}
+	copied := *i
+	return &copied
+}
+
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	copied := *s
+	return &copied
+}
+
+func copyStrings(s []string) []string {
+	if s == nil {
+		return nil
+	}
+	return append([]string{}, s...)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"remus_synerge/internal/models"
+)
+
+var (
+	ErrMFANotFound         = fmt.Errorf("mfa enrollment %w", ErrNotFound)
+	ErrMFACodeReused       = errors.New("mfa code already used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code invalid or already used")
+)
+
+type MFARepository interface {
+	GetMFA(ctx context.Context, userID int) (*models.UserMFA, error)
+	// SaveMFASecret starts a new, not yet enabled enrollment, replacing any
+	// earlier unfinished one.
+	SaveMFASecret(ctx context.Context, userID int, secret string) error
+	// EnableMFA enables the enrollment and stores its first recovery codes.
+	EnableMFA(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error
+	DisableMFA(ctx context.Context, userID int) error
+	// UseTOTPStep records an accepted time step. It returns ErrMFACodeReused
+	// unless the step is later than any accepted before.
+	UseTOTPStep(ctx context.Context, userID int, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int, codeHash string) error
+	CountRecoveryCodes(ctx context.Context, userID int) (int, error)
+}
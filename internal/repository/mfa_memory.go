@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryMFARepo struct {
+	db *MemoryDB
+}
+
+// memoryRecoveryCode is a row of mfa_recovery_codes.
+type memoryRecoveryCode struct {
+	codeHash string
+	usedAt   *time.Time
+}
+
+func NewMemoryMFARepository(db *MemoryDB) MFARepository {
+	return &memoryMFARepo{db: db}
+}
+
+func copyMFA(mfa *models.UserMFA) *models.UserMFA {
+	copied := *mfa
+	copied.EnabledAt = copyTime(mfa.EnabledAt)
+	return &copied
+}
+
+func (r *memoryMFARepo) GetMFA(ctx context.Context, userID int) (*models.UserMFA, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	mfa, ok := r.db.mfa[userID]
+	if !ok {
+		return nil, ErrMFANotFound
+	}
+	return copyMFA(mfa), nil
+}
+
+func (r *memoryMFARepo) SaveMFASecret(ctx context.Context, userID int, secret string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if mfa, ok := r.db.mfa[userID]; ok && mfa.Enabled {
+		return nil
+	}
+	r.db.mfa[userID] = &models.UserMFA{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+func (r *memoryMFARepo) EnableMFA(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	mfa, ok := r.db.mfa[userID]
+	if !ok || mfa.Enabled {
+		return ErrMFANotFound
+	}
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.EnabledAt = &now
+	mfa.LastUsedStep = step
+	r.db.replaceRecoveryCodes(userID, recoveryCodeHashes)
+	return nil
+}
+
+func (r *memoryMFARepo) DisableMFA(ctx context.Context, userID int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.mfa[userID]; !ok {
+		return ErrMFANotFound
+	}
+	delete(r.db.mfa, userID)
+	delete(r.db.recoveryCodes, userID)
+	return nil
+}
+
+func (r *memoryMFARepo) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	mfa, ok := r.db.mfa[userID]
+	if !ok || mfa.LastUsedStep >= step {
+		return ErrMFACodeReused
+	}
+	mfa.LastUsedStep = step
+	return nil
+}
+
+func (r *memoryMFARepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.replaceRecoveryCodes(userID, codeHashes)
+	return nil
+}
+
+func (db *MemoryDB) replaceRecoveryCodes(userID int, codeHashes []string) {
+	codes := make([]*memoryRecoveryCode, 0, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		codes = append(codes, &memoryRecoveryCode{codeHash: codeHash})
+	}
+	db.recoveryCodes[userID] = codes
+}
+
+func (r *memoryMFARepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, code := range r.db.recoveryCodes[userID] {
+		if code.codeHash == codeHash && code.usedAt == nil {
+			now := time.Now()
+			code.usedAt = &now
+			return nil
+		}
+	}
+	return ErrRecoveryCodeInvalid
+}
+
+func (r *memoryMFARepo) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	count := 0
+	for _, code := range r.db.recoveryCodes[userID] {
+		if code.usedAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
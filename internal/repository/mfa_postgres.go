@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type mfaRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewMFARepository(db *pgxpool.Pool) MFARepository {
+	return &mfaRepo{db: db}
+}
+
+func (r *mfaRepo) GetMFA(ctx context.Context, userID int) (*models.UserMFA, error) {
+	query := `SELECT user_id, secret, enabled, last_used_step, created_at, enabled_at
+			  FROM user_mfa WHERE user_id = $1`
+
+	mfa := &models.UserMFA{}
+	err := r.db.QueryRow(ctx, query, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled,
+		&mfa.LastUsedStep, &mfa.CreatedAt, &mfa.EnabledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrMFANotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+func (r *mfaRepo) SaveMFASecret(ctx context.Context, userID int, secret string) error {
+	query := `INSERT INTO user_mfa (user_id, secret, enabled, last_used_step, created_at)
+			  VALUES ($1, $2, FALSE, 0, $3)
+			  ON CONFLICT (user_id) DO UPDATE
+			  SET secret = EXCLUDED.secret, last_used_step = 0, created_at = EXCLUDED.created_at
+			  WHERE user_mfa.enabled = FALSE`
+
+	_, err := r.db.Exec(ctx, query, userID, secret, time.Now())
+	return err
+}
+
+func (r *mfaRepo) EnableMFA(ctx context.Context, userID int, step int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE user_mfa SET enabled = TRUE, enabled_at = $2, last_used_step = $3
+							  WHERE user_id = $1 AND enabled = FALSE`, userID, time.Now(), step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFANotFound
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *mfaRepo) DisableMFA(ctx context.Context, userID int) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFANotFound
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (r *mfaRepo) UseTOTPStep(ctx context.Context, userID int, step int64) error {
+	tag, err := r.db.Exec(ctx, `UPDATE user_mfa SET last_used_step = $2
+								WHERE user_id = $1 AND last_used_step < $2`, userID, step)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrMFACodeReused
+	}
+	return nil
+}
+
+func (r *mfaRepo) ReplaceRecoveryCodes(ctx context.Context, userID int, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID int, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	query := `INSERT INTO mfa_recovery_codes (user_id, code_hash, created_at)
+			  SELECT $1, code_hash, $3 FROM unnest($2::text[]) AS code_hash`
+	_, err := tx.Exec(ctx, query, userID, codeHashes, time.Now())
+	return err
+}
+
+func (r *mfaRepo) UseRecoveryCode(ctx context.Context, userID int, codeHash string) error {
+	tag, err := r.db.Exec(ctx, `UPDATE mfa_recovery_codes SET used_at = $3
+								WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`, userID, codeHash, time.Now())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+func (r *mfaRepo) CountRecoveryCodes(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRow(ctx, `SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL`, userID).Scan(&count)
+	return count, err
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+var (
+	ErrOAuthClientNotFound       = fmt.Errorf("oauth client %w", ErrNotFound)
+	ErrAuthorizationCodeNotFound = fmt.Errorf("authorization code %w", ErrNotFound)
+	ErrAuthorizationCodeUsed     = errors.New("authorization code already used")
+)
+
+type OAuthRepository interface {
+	CreateClient(ctx context.Context, client *models.OAuthClient) error
+	GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error)
+	ListClients(ctx context.Context) ([]*models.OAuthClient, error)
+	DeleteClient(ctx context.Context, clientID string) error
+	CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error
+	// GetAuthorizationCode returns a code, used or not, without using it up,
+	// so that it can be checked before it is consumed.
+	GetAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+	// ConsumeAuthorizationCode marks the code used and returns it. A code that
+	// was already used is returned together with ErrAuthorizationCodeUsed.
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error)
+	DeleteExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryOAuthRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryOAuthRepository(db *MemoryDB) OAuthRepository {
+	return &memoryOAuthRepo{db: db}
+}
+
+func copyOAuthClient(client *models.OAuthClient) *models.OAuthClient {
+	copied := *client
+	copied.RedirectURIs = copyStrings(client.RedirectURIs)
+	copied.GrantTypes = copyStrings(client.GrantTypes)
+	copied.Scopes = copyStrings(client.Scopes)
+	return &copied
+}
+
+func copyAuthorizationCode(code *models.AuthorizationCode) *models.AuthorizationCode {
+	copied := *code
+	copied.UsedAt = copyTime(code.UsedAt)
+	return &copied
+}
+
+func (r *memoryOAuthRepo) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, exists := r.db.oauthClients[client.ClientID]; exists {
+		return &ErrConflict{Field: "client_id"}
+	}
+	client.CreatedAt = time.Now()
+	client.ID = r.db.nextID("oauth_clients")
+	r.db.oauthClients[client.ClientID] = copyOAuthClient(client)
+	return nil
+}
+
+func (r *memoryOAuthRepo) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	client, ok := r.db.oauthClients[clientID]
+	if !ok {
+		return nil, ErrOAuthClientNotFound
+	}
+	return copyOAuthClient(client), nil
+}
+
+func (r *memoryOAuthRepo) ListClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	clients := []*models.OAuthClient{}
+	for _, client := range r.db.oauthClients {
+		clients = append(clients, copyOAuthClient(client))
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Name != clients[j].Name {
+			return clients[i].Name < clients[j].Name
+		}
+		return clients[i].ID < clients[j].ID
+	})
+	return clients, nil
+}
+
+func (r *memoryOAuthRepo) DeleteClient(ctx context.Context, clientID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, ok := r.db.oauthClients[clientID]; !ok {
+		return ErrOAuthClientNotFound
+	}
+	delete(r.db.oauthClients, clientID)
+	for id, code := range r.db.authorizationCodes {
+		if code.ClientID == clientID {
+			delete(r.db.authorizationCodes, id)
+		}
+	}
+	return nil
+}
+
+func (r *memoryOAuthRepo) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, other := range r.db.authorizationCodes {
+		if other.CodeHash == code.CodeHash {
+			return &ErrConflict{Field: "code_hash"}
+		}
+	}
+	code.CreatedAt = time.Now()
+	code.ID = r.db.nextID("oauth_authorization_codes")
+	r.db.authorizationCodes[code.ID] = copyAuthorizationCode(code)
+	return nil
+}
+
+func (r *memoryOAuthRepo) GetAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, code := range r.db.authorizationCodes {
+		if code.CodeHash == codeHash {
+			return copyAuthorizationCode(code), nil
+		}
+	}
+	return nil, ErrAuthorizationCodeNotFound
+}
+
+func (r *memoryOAuthRepo) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, code := range r.db.authorizationCodes {
+		if code.CodeHash != codeHash {
+			continue
+		}
+		if code.UsedAt != nil {
+			return copyAuthorizationCode(code), ErrAuthorizationCodeUsed
+		}
+		now := time.Now()
+		code.UsedAt = &now
+		return copyAuthorizationCode(code), nil
+	}
+	return nil, ErrAuthorizationCodeNotFound
+}
+
+func (r *memoryOAuthRepo) DeleteExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var deleted int64
+	for id, code := range r.db.authorizationCodes {
+		if code.ExpiresAt.Before(now) {
+			delete(r.db.authorizationCodes, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type oauthRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewOAuthRepository(db *pgxpool.Pool) OAuthRepository {
+	return &oauthRepo{db: db}
+}
+
+func (r *oauthRepo) CreateClient(ctx context.Context, client *models.OAuthClient) error {
+	query := `INSERT INTO oauth_clients (client_id, secret_hash, name, redirect_uris, grant_types, scopes, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+
+	client.CreatedAt = time.Now()
+	return r.db.QueryRow(ctx, query, client.ClientID, client.SecretHash, client.Name,
+		client.RedirectURIs, client.GrantTypes, client.Scopes, client.CreatedAt).Scan(&client.ID)
+}
+
+const oauthClientColumns = `id, client_id, secret_hash, name, redirect_uris, grant_types, scopes, created_at`
+
+func scanOAuthClient(row pgx.Row) (*models.OAuthClient, error) {
+	client := &models.OAuthClient{}
+	err := row.Scan(&client.ID, &client.ClientID, &client.SecretHash, &client.Name,
+		&client.RedirectURIs, &client.GrantTypes, &client.Scopes, &client.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (r *oauthRepo) GetClient(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE client_id = $1`
+	client, err := scanOAuthClient(r.db.QueryRow(ctx, query, clientID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOAuthClientNotFound
+	}
+	return client, err
+}
+
+func (r *oauthRepo) ListClients(ctx context.Context) ([]*models.OAuthClient, error) {
+	query := `SELECT ` + oauthClientColumns + ` FROM oauth_clients ORDER BY name`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []*models.OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+func (r *oauthRepo) DeleteClient(ctx context.Context, clientID string) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM oauth_clients WHERE client_id = $1`, clientID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOAuthClientNotFound
+	}
+	return nil
+}
+
+func (r *oauthRepo) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	query := `INSERT INTO oauth_authorization_codes
+			  (code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, family_id, expires_at, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+
+	code.CreatedAt = time.Now()
+	return r.db.QueryRow(ctx, query, code.CodeHash, code.ClientID, code.UserID, code.RedirectURI, code.Scope,
+		code.Nonce, code.CodeChallenge, code.FamilyID, code.ExpiresAt, code.CreatedAt).Scan(&code.ID)
+}
+
+func (r *oauthRepo) GetAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	query := `SELECT id, code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, family_id,
+			  expires_at, created_at, used_at
+			  FROM oauth_authorization_codes WHERE code_hash = $1`
+	code := &models.AuthorizationCode{}
+	err := r.db.QueryRow(ctx, query, codeHash).Scan(&code.ID, &code.CodeHash, &code.ClientID, &code.UserID,
+		&code.RedirectURI, &code.Scope, &code.Nonce, &code.CodeChallenge, &code.FamilyID,
+		&code.ExpiresAt, &code.CreatedAt, &code.UsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return code, nil
+}
+
+func (r *oauthRepo) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*models.AuthorizationCode, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	query := `SELECT id, code_hash, client_id, user_id, redirect_uri, scope, nonce, code_challenge, family_id,
+			  expires_at, created_at, used_at
+			  FROM oauth_authorization_codes WHERE code_hash = $1 FOR UPDATE`
+	code := &models.AuthorizationCode{}
+	err = tx.QueryRow(ctx, query, codeHash).Scan(&code.ID, &code.CodeHash, &code.ClientID, &code.UserID,
+		&code.RedirectURI, &code.Scope, &code.Nonce, &code.CodeChallenge, &code.FamilyID,
+		&code.ExpiresAt, &code.CreatedAt, &code.UsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if code.UsedAt != nil {
+		return code, ErrAuthorizationCodeUsed
+	}
+
+	now := time.Now()
+	if _, err := tx.Exec(ctx, `UPDATE oauth_authorization_codes SET used_at = $1 WHERE id = $2`, now, code.ID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	code.UsedAt = &now
+	return code, nil
+}
+
+func (r *oauthRepo) DeleteExpiredAuthorizationCodes(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM oauth_authorization_codes WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
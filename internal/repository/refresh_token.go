@@ -0,0 +1,28 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"remus_synerge/internal/models"
+)
+
+var (
+	ErrRefreshTokenNotFound = fmt.Errorf("refresh token %w", ErrNotFound)
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenRevoked  = errors.New("refresh token revoked")
+	ErrRefreshTokenReused   = errors.New("refresh token reuse detected")
+)
+
+type RefreshTokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (*models.RefreshToken, error)
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	// RotateRefreshToken consumes the token identified by tokenHash and stores
+	// next in the same family. Presenting an already consumed token revokes
+	// the whole family and returns ErrRefreshTokenReused. The presented token
+	// must belong to next.ClientID; an empty next.Scope keeps the current one.
+	RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID int) error
+}
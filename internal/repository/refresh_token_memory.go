@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryRefreshTokenRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryRefreshTokenRepository(db *MemoryDB) RefreshTokenRepository {
+	return &memoryRefreshTokenRepo{db: db}
+}
+
+func copyRefreshToken(token *models.RefreshToken) *models.RefreshToken {
+	copied := *token
+	copied.ParentID = copyInt(token.ParentID)
+	copied.UsedAt = copyTime(token.UsedAt)
+	copied.RevokedAt = copyTime(token.RevokedAt)
+	return &copied
+}
+
+func (db *MemoryDB) insertRefreshToken(token *models.RefreshToken) error {
+	if _, exists := db.refreshTokenByHash(token.TokenHash); exists {
+		return &ErrConflict{Field: "token_hash"}
+	}
+	token.ID = db.nextID("refresh_tokens")
+	db.refreshTokens[token.ID] = copyRefreshToken(token)
+	return nil
+}
+
+func (db *MemoryDB) refreshTokenByHash(tokenHash string) (*models.RefreshToken, bool) {
+	for _, token := range db.refreshTokens {
+		if token.TokenHash == tokenHash {
+			return token, true
+		}
+	}
+	return nil, false
+}
+
+// revokeRefreshTokenFamily revokes the tokens of a family that are not
+// revoked yet.
+func (db *MemoryDB) revokeRefreshTokenFamily(familyID string, at time.Time) {
+	for _, token := range db.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = copyTime(&at)
+		}
+	}
+}
+
+func (r *memoryRefreshTokenRepo) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (*models.RefreshToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	token.CreatedAt = time.Now()
+	if err := r.db.insertRefreshToken(token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *memoryRefreshTokenRepo) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	token, ok := r.db.refreshTokenByHash(tokenHash)
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	return copyRefreshToken(token), nil
+}
+
+func (r *memoryRefreshTokenRepo) RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	current, ok := r.db.refreshTokenByHash(tokenHash)
+	if !ok || current.ClientID != next.ClientID {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	now := time.Now()
+	switch {
+	case current.RevokedAt != nil:
+		return copyRefreshToken(current), ErrRefreshTokenRevoked
+	case current.UsedAt != nil:
+		r.db.revokeRefreshTokenFamily(current.FamilyID, now)
+		return copyRefreshToken(current), ErrRefreshTokenReused
+	case !now.Before(current.ExpiresAt):
+		return copyRefreshToken(current), ErrRefreshTokenExpired
+	}
+
+	parentID := current.ID
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	next.ParentID = &parentID
+	next.CreatedAt = now
+	if next.Scope == "" {
+		next.Scope = current.Scope
+	}
+	if err := r.db.insertRefreshToken(next); err != nil {
+		return nil, err
+	}
+	current.UsedAt = &now
+
+	return next, nil
+}
+
+func (r *memoryRefreshTokenRepo) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.revokeRefreshTokenFamily(familyID, time.Now())
+	return nil
+}
+
+func (r *memoryRefreshTokenRepo) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.db.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = copyTime(&now)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type refreshTokenRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRefreshTokenRepository(db *pgxpool.Pool) RefreshTokenRepository {
+	return &refreshTokenRepo{db: db}
+}
+
+func (r *refreshTokenRepo) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (*models.RefreshToken, error) {
+	query := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, parent_id, client_id, scope, expires_at, created_at)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+
+	token.CreatedAt = time.Now()
+	err := r.db.QueryRow(ctx, query, token.UserID, token.FamilyID, token.TokenHash, token.ParentID,
+		token.ClientID, token.Scope, token.ExpiresAt, token.CreatedAt).Scan(&token.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (r *refreshTokenRepo) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `SELECT id, user_id, family_id, token_hash, parent_id, client_id, scope, expires_at, created_at, used_at, revoked_at
+			  FROM refresh_tokens WHERE token_hash = $1`
+	token := &models.RefreshToken{}
+	err := r.db.QueryRow(ctx, query, tokenHash).Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.ParentID, &token.ClientID, &token.Scope, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *refreshTokenRepo) RotateRefreshToken(ctx context.Context, tokenHash string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the presented token so concurrent refreshes of the same token are
+	// serialized; the loser sees used_at set and trips reuse detection.
+	query := `SELECT id, user_id, family_id, token_hash, parent_id, client_id, scope, expires_at, created_at, used_at, revoked_at
+			  FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+	current := &models.RefreshToken{}
+	err = tx.QueryRow(ctx, query, tokenHash).Scan(&current.ID, &current.UserID, &current.FamilyID, &current.TokenHash,
+		&current.ParentID, &current.ClientID, &current.Scope, &current.ExpiresAt, &current.CreatedAt, &current.UsedAt, &current.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A token presented by the wrong client is treated as unknown and left
+	// untouched
+	if current.ClientID != next.ClientID {
+		return nil, ErrRefreshTokenNotFound
+	}
+
+	now := time.Now()
+	switch {
+	case current.RevokedAt != nil:
+		return current, ErrRefreshTokenRevoked
+	case current.UsedAt != nil:
+		revoke := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+		if _, err := tx.Exec(ctx, revoke, now, current.FamilyID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		return current, ErrRefreshTokenReused
+	case !now.Before(current.ExpiresAt):
+		return current, ErrRefreshTokenExpired
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+	next.ParentID = &current.ID
+	next.CreatedAt = now
+	if next.Scope == "" {
+		next.Scope = current.Scope
+	}
+
+	insert := `INSERT INTO refresh_tokens (user_id, family_id, token_hash, parent_id, client_id, scope, expires_at, created_at)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	err = tx.QueryRow(ctx, insert, next.UserID, next.FamilyID, next.TokenHash, next.ParentID,
+		next.ClientID, next.Scope, next.ExpiresAt, next.CreatedAt).Scan(&next.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = $1 WHERE id = $2`, now, current.ID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return next, nil
+}
+
+func (r *refreshTokenRepo) RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.Exec(ctx, query, familyID)
+	return err
+}
+
+func (r *refreshTokenRepo) RevokeUserRefreshTokens(ctx context.Context, userID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.Exec(ctx, query, userID)
+	return err
+}
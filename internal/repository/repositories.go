@@ -0,0 +1,19 @@
+package repository
+
+// Repositories holds one implementation of every repository, all sharing
+// the same database.
+type Repositories struct {
+	Users               UserRepository
+	RefreshTokens       RefreshTokenRepository
+	TokenRevocations    TokenRevocationRepository
+	Roles               RoleRepository
+	APIKeys             APIKeyRepository
+	OAuth               OAuthRepository
+	Identities          IdentityRepository
+	MFA                 MFARepository
+	UserTokens          UserTokenRepository
+	LoginThrottles      LoginThrottleRepository
+	Sessions            SessionRepository
+	Audit               AuditRepository
+	CertificateBindings CertificateBindingRepository
+}
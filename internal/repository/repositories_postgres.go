@@ -0,0 +1,22 @@
+package repository
+
+import "github.com/jackc/pgx/v4/pgxpool"
+
+// NewPostgresRepositories returns every repository backed by db.
+func NewPostgresRepositories(db *pgxpool.Pool) *Repositories {
+	return &Repositories{
+		Users:               NewUserRepository(db),
+		RefreshTokens:       NewRefreshTokenRepository(db),
+		TokenRevocations:    NewTokenRevocationRepository(db),
+		Roles:               NewRoleRepository(db),
+		APIKeys:             NewAPIKeyRepository(db),
+		OAuth:               NewOAuthRepository(db),
+		Identities:          NewIdentityRepository(db),
+		MFA:                 NewMFARepository(db),
+		UserTokens:          NewUserTokenRepository(db),
+		LoginThrottles:      NewLoginThrottleRepository(db),
+		Sessions:            NewSessionRepository(db),
+		Audit:               NewAuditRepository(db),
+		CertificateBindings: NewCertificateBindingRepository(db),
+	}
+}
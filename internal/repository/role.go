@@ -0,0 +1,17 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+
+	"remus_synerge/internal/models"
+)
+
+var ErrRoleNotFound = fmt.Errorf("role %w", ErrNotFound)
+
+type RoleRepository interface {
+	ListRoles(ctx context.Context) ([]*models.Role, error)
+	GetUserRoles(ctx context.Context, userID int) ([]string, error)
+	// SetUserRoles replaces the user's explicitly granted roles.
+	SetUserRoles(ctx context.Context, userID int, roles []string) error
+}
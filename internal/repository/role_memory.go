@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryRoleRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryRoleRepository(db *MemoryDB) RoleRepository {
+	return &memoryRoleRepo{db: db}
+}
+
+func (r *memoryRoleRepo) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var roles []*models.Role
+	for _, role := range r.db.roles {
+		copied := *role
+		copied.Permissions = copyStrings(role.Permissions)
+		sort.Strings(copied.Permissions)
+		roles = append(roles, &copied)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (r *memoryRoleRepo) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	roles := []string{}
+	for _, roleID := range r.db.userRoles[userID] {
+		for _, role := range r.db.roles {
+			if role.ID == roleID {
+				roles = append(roles, role.Name)
+			}
+		}
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+func (r *memoryRoleRepo) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var roleIDs []int
+	for _, role := range r.db.roles {
+		for _, name := range roles {
+			if role.Name == name {
+				roleIDs = append(roleIDs, role.ID)
+				break
+			}
+		}
+	}
+	if len(roleIDs) != len(roles) {
+		return ErrRoleNotFound
+	}
+
+	if len(roleIDs) == 0 {
+		delete(r.db.userRoles, userID)
+	} else {
+		r.db.userRoles[userID] = roleIDs
+	}
+	return nil
+}
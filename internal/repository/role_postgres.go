@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type roleRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewRoleRepository(db *pgxpool.Pool) RoleRepository {
+	return &roleRepo{db: db}
+}
+
+func (r *roleRepo) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	query := `SELECT r.id, r.name, r.description, r.created_at,
+			  COALESCE(array_agg(rp.permission ORDER BY rp.permission) FILTER (WHERE rp.permission IS NOT NULL), '{}')
+			  FROM roles r
+			  LEFT JOIN role_permissions rp ON rp.role_id = r.id
+			  GROUP BY r.id
+			  ORDER BY r.name`
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*models.Role
+	for rows.Next() {
+		role := &models.Role{}
+		if err := rows.Scan(&role.ID, &role.Name, &role.Description, &role.CreatedAt, &role.Permissions); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *roleRepo) GetUserRoles(ctx context.Context, userID int) ([]string, error) {
+	query := `SELECT r.name FROM user_roles ur
+			  JOIN roles r ON r.id = ur.role_id
+			  WHERE ur.user_id = $1
+			  ORDER BY r.name`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []string{}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *roleRepo) SetUserRoles(ctx context.Context, userID int, roles []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_roles WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+
+	if len(roles) > 0 {
+		query := `INSERT INTO user_roles (user_id, role_id)
+				  SELECT $1, id FROM roles WHERE name = ANY($2)`
+		tag, err := tx.Exec(ctx, query, userID, roles)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != int64(len(roles)) {
+			return ErrRoleNotFound
+		}
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+var ErrSessionNotFound = fmt.Errorf("session %w", ErrNotFound)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *models.Session) error
+	GetSession(ctx context.Context, id string) (*models.Session, error)
+	// ListUserSessions returns the sessions of a user that are not revoked
+	// and still hold a usable refresh token, most recently used first.
+	ListUserSessions(ctx context.Context, userID int) ([]*models.Session, error)
+	// TouchSessions moves last_seen_at forward to the given times.
+	TouchSessions(ctx context.Context, seen map[string]time.Time) error
+	// RevokeSession marks the session revoked and revokes its refresh tokens.
+	RevokeSession(ctx context.Context, id string, at time.Time) error
+	// RevokeUserSessions revokes every session of a user that is not revoked
+	// yet, with their refresh tokens, and returns their IDs.
+	RevokeUserSessions(ctx context.Context, userID int, at time.Time) ([]string, error)
+	// ListRevokedSessions returns the IDs of sessions revoked after since.
+	ListRevokedSessions(ctx context.Context, since time.Time) ([]string, error)
+	// DeleteStaleSessions removes sessions revoked before the cutoff and
+	// sessions unused since then that can no longer be refreshed.
+	DeleteStaleSessions(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memorySessionRepo struct {
+	db *MemoryDB
+}
+
+func NewMemorySessionRepository(db *MemoryDB) SessionRepository {
+	return &memorySessionRepo{db: db}
+}
+
+func copySession(session *models.Session) *models.Session {
+	copied := *session
+	copied.RevokedAt = copyTime(session.RevokedAt)
+	return &copied
+}
+
+// hasLiveRefreshToken reports whether the session can still be refreshed.
+func (db *MemoryDB) hasLiveRefreshToken(sessionID string, now time.Time) bool {
+	for _, token := range db.refreshTokens {
+		if token.FamilyID == sessionID && token.UsedAt == nil && token.RevokedAt == nil && token.ExpiresAt.After(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memorySessionRepo) CreateSession(ctx context.Context, session *models.Session) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, exists := r.db.sessions[session.ID]; exists {
+		return &ErrConflict{Field: "id"}
+	}
+	r.db.sessions[session.ID] = copySession(session)
+	return nil
+}
+
+func (r *memorySessionRepo) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	session, ok := r.db.sessions[id]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return copySession(session), nil
+}
+
+func (r *memorySessionRepo) ListUserSessions(ctx context.Context, userID int) ([]*models.Session, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	var sessions []*models.Session
+	for _, session := range r.db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil && r.db.hasLiveRefreshToken(session.ID, now) {
+			sessions = append(sessions, copySession(session))
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt) })
+	return sessions, nil
+}
+
+func (r *memorySessionRepo) TouchSessions(ctx context.Context, seen map[string]time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for id, at := range seen {
+		if session, ok := r.db.sessions[id]; ok && session.LastSeenAt.Before(at) {
+			session.LastSeenAt = at
+		}
+	}
+	return nil
+}
+
+func (r *memorySessionRepo) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	session, ok := r.db.sessions[id]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt == nil {
+		session.RevokedAt = copyTime(&at)
+	}
+	r.db.revokeRefreshTokenFamily(id, at)
+	return nil
+}
+
+func (r *memorySessionRepo) RevokeUserSessions(ctx context.Context, userID int, at time.Time) ([]string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var ids []string
+	for id, session := range r.db.sessions {
+		if session.UserID == userID && session.RevokedAt == nil {
+			session.RevokedAt = copyTime(&at)
+			r.db.revokeRefreshTokenFamily(id, at)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memorySessionRepo) ListRevokedSessions(ctx context.Context, since time.Time) ([]string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var ids []string
+	for id, session := range r.db.sessions {
+		if session.RevokedAt != nil && session.RevokedAt.After(since) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *memorySessionRepo) DeleteStaleSessions(ctx context.Context, before time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	var deleted int64
+	for id, session := range r.db.sessions {
+		revoked := session.RevokedAt != nil && session.RevokedAt.Before(before)
+		abandoned := session.RevokedAt == nil && session.LastSeenAt.Before(before) && !r.db.hasLiveRefreshToken(id, now)
+		if revoked || abandoned {
+			delete(r.db.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
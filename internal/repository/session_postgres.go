@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type sessionRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepository(db *pgxpool.Pool) SessionRepository {
+	return &sessionRepo{db: db}
+}
+
+// liveRefreshToken matches sessions that can still be refreshed.
+const liveRefreshToken = `EXISTS (SELECT 1 FROM refresh_tokens t
+			   WHERE t.family_id = s.id AND t.used_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > NOW())`
+
+func (r *sessionRepo) CreateSession(ctx context.Context, session *models.Session) error {
+	query := `INSERT INTO sessions (id, user_id, device_label, user_agent, ip_address, created_at, last_seen_at)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.Exec(ctx, query, session.ID, session.UserID, session.DeviceLabel, session.UserAgent,
+		session.IPAddress, session.CreatedAt, session.LastSeenAt)
+	return err
+}
+
+func (r *sessionRepo) GetSession(ctx context.Context, id string) (*models.Session, error) {
+	query := `SELECT id, user_id, device_label, user_agent, ip_address, created_at, last_seen_at, revoked_at
+			  FROM sessions WHERE id = $1`
+	session := &models.Session{}
+	err := r.db.QueryRow(ctx, query, id).Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.UserAgent,
+		&session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *sessionRepo) ListUserSessions(ctx context.Context, userID int) ([]*models.Session, error) {
+	query := `SELECT s.id, s.user_id, s.device_label, s.user_agent, s.ip_address, s.created_at, s.last_seen_at, s.revoked_at
+			  FROM sessions s
+			  WHERE s.user_id = $1 AND s.revoked_at IS NULL AND ` + liveRefreshToken + `
+			  ORDER BY s.last_seen_at DESC`
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session := &models.Session{}
+		if err := rows.Scan(&session.ID, &session.UserID, &session.DeviceLabel, &session.UserAgent,
+			&session.IPAddress, &session.CreatedAt, &session.LastSeenAt, &session.RevokedAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sessionRepo) TouchSessions(ctx context.Context, seen map[string]time.Time) error {
+	ids := make([]string, 0, len(seen))
+	times := make([]time.Time, 0, len(seen))
+	for id, at := range seen {
+		ids = append(ids, id)
+		times = append(times, at)
+	}
+
+	query := `UPDATE sessions s SET last_seen_at = v.seen_at
+			  FROM unnest($1::text[], $2::timestamptz[]) AS v(id, seen_at)
+			  WHERE s.id = v.id AND s.last_seen_at < v.seen_at`
+	_, err := r.db.Exec(ctx, query, ids, times)
+	return err
+}
+
+func (r *sessionRepo) RevokeSession(ctx context.Context, id string, at time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE sessions SET revoked_at = COALESCE(revoked_at, $2) WHERE id = $1`, id, at)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+
+	query := `UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, id, at); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *sessionRepo) RevokeUserSessions(ctx context.Context, userID int, at time.Time) ([]string, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `UPDATE sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL RETURNING id`, userID, at)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query := `UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = ANY($1) AND revoked_at IS NULL`
+	if _, err := tx.Exec(ctx, query, ids, at); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func (r *sessionRepo) ListRevokedSessions(ctx context.Context, since time.Time) ([]string, error) {
+	rows, err := r.db.Query(ctx, `SELECT id FROM sessions WHERE revoked_at > $1`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (r *sessionRepo) DeleteStaleSessions(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM sessions s
+			  WHERE s.revoked_at < $1
+			     OR (s.revoked_at IS NULL AND s.last_seen_at < $1 AND NOT ` + liveRefreshToken + `)`
+	tag, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,18 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type TokenRevocationRepository interface {
+	RevokeToken(ctx context.Context, token *models.RevokedToken) error
+	// ListRevokedTokens returns revocations for tokens that have not yet expired.
+	ListRevokedTokens(ctx context.Context, now time.Time) ([]*models.RevokedToken, error)
+	DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error)
+	SetTokensValidAfter(ctx context.Context, userID int, validAfter time.Time) error
+	// ListTokensValidAfter returns the per-user cutoffs set after since.
+	ListTokensValidAfter(ctx context.Context, since time.Time) (map[int]time.Time, error)
+}
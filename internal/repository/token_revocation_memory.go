@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryTokenRevocationRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryTokenRevocationRepository(db *MemoryDB) TokenRevocationRepository {
+	return &memoryTokenRevocationRepo{db: db}
+}
+
+func (r *memoryTokenRevocationRepo) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, exists := r.db.revokedTokens[token.JTI]; !exists {
+		copied := *token
+		r.db.revokedTokens[token.JTI] = &copied
+	}
+	return nil
+}
+
+func (r *memoryTokenRevocationRepo) ListRevokedTokens(ctx context.Context, now time.Time) ([]*models.RevokedToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var tokens []*models.RevokedToken
+	for _, token := range r.db.revokedTokens {
+		if token.ExpiresAt.After(now) {
+			copied := *token
+			tokens = append(tokens, &copied)
+		}
+	}
+	return tokens, nil
+}
+
+func (r *memoryTokenRevocationRepo) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var deleted int64
+	for jti, token := range r.db.revokedTokens {
+		if !token.ExpiresAt.After(now) {
+			delete(r.db.revokedTokens, jti)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *memoryTokenRevocationRepo) SetTokensValidAfter(ctx context.Context, userID int, validAfter time.Time) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if _, exists := r.db.users[userID]; exists {
+		r.db.tokensValidAfter[userID] = validAfter
+	}
+	return nil
+}
+
+func (r *memoryTokenRevocationRepo) ListTokensValidAfter(ctx context.Context, since time.Time) (map[int]time.Time, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	cutoffs := make(map[int]time.Time)
+	for userID, validAfter := range r.db.tokensValidAfter {
+		if validAfter.After(since) {
+			cutoffs[userID] = validAfter
+		}
+	}
+	return cutoffs, nil
+}
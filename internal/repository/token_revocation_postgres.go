@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type tokenRevocationRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewTokenRevocationRepository(db *pgxpool.Pool) TokenRevocationRepository {
+	return &tokenRevocationRepo{db: db}
+}
+
+func (r *tokenRevocationRepo) RevokeToken(ctx context.Context, token *models.RevokedToken) error {
+	query := `INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+			   VALUES ($1, $2, $3, $4) ON CONFLICT (jti) DO NOTHING`
+	_, err := r.db.Exec(ctx, query, token.JTI, token.UserID, token.ExpiresAt, token.RevokedAt)
+	return err
+}
+
+func (r *tokenRevocationRepo) ListRevokedTokens(ctx context.Context, now time.Time) ([]*models.RevokedToken, error) {
+	query := `SELECT jti, user_id, expires_at, revoked_at FROM revoked_tokens WHERE expires_at > $1`
+	rows, err := r.db.Query(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*models.RevokedToken
+	for rows.Next() {
+		token := &models.RevokedToken{}
+		if err := rows.Scan(&token.JTI, &token.UserID, &token.ExpiresAt, &token.RevokedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (r *tokenRevocationRepo) DeleteExpiredRevokedTokens(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *tokenRevocationRepo) SetTokensValidAfter(ctx context.Context, userID int, validAfter time.Time) error {
+	query := `UPDATE users SET tokens_valid_after = $1 WHERE id = $2`
+	_, err := r.db.Exec(ctx, query, validAfter, userID)
+	return err
+}
+
+func (r *tokenRevocationRepo) ListTokensValidAfter(ctx context.Context, since time.Time) (map[int]time.Time, error) {
+	query := `SELECT id, tokens_valid_after FROM users WHERE tokens_valid_after > $1`
+	rows, err := r.db.Query(ctx, query, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cutoffs := make(map[int]time.Time)
+	for rows.Next() {
+		var userID int
+		var validAfter time.Time
+		if err := rows.Scan(&userID, &validAfter); err != nil {
+			return nil, err
+		}
+		cutoffs[userID] = validAfter
+	}
+	return cutoffs, rows.Err()
+}
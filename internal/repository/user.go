@@ -2,13 +2,151 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
 	"remus_synerge/internal/models"
 )
 
+var (
+	ErrUserNotFound = fmt.Errorf("user %w", ErrNotFound)
+	// ErrUserVersionConflict means the user changed since it was read.
+	ErrUserVersionConflict = errors.New("user was modified concurrently")
+)
+
+// UserRepository reads and writes users. Deleted users are kept until
+// purged, but every method other than RestoreUser and PurgeDeletedUsers
+// treats them as gone, and ListUsers only returns them when asked for
+// UserStatusDeleted.
+//
+// Writes that would give two active users the same username or email fail
+// with an *ErrConflict naming the field. Database failures worth retrying
+// wrap ErrUnavailable.
 type UserRepository interface {
 	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
 	GetUserByID(ctx context.Context, id int) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	// ListUsers returns one page of the users matching filter.
+	ListUsers(ctx context.Context, filter UserListFilter) (*UserPage, error)
+	// SearchUsers returns one page of the users whose username or email
+	// matches the search, best match first.
+	SearchUsers(ctx context.Context, search UserSearch) (*UserSearchPage, error)
+	// UpdateUser saves user if it is still at user.Version, and bumps the
+	// version. It returns ErrUserVersionConflict if the user has changed
+	// since it was read.
 	UpdateUser(ctx context.Context, user *models.User) (*models.User, error)
+	// UpdatePassword replaces only the password hash, e.g. when upgrading
+	// an outdated hash at login, and bumps the version. It returns
+	// ErrUserVersionConflict if the hash is no longer oldHash, so that a
+	// password changed in the meantime is not overwritten.
+	UpdatePassword(ctx context.Context, id int, oldHash, newHash string) error
+	// DeleteUser marks the user deleted, freeing its username and email.
 	DeleteUser(ctx context.Context, id int) error
-}
\ No newline at end of file
+	// RestoreUser undoes DeleteUser. It fails with an *ErrConflict if the
+	// username or email has been taken since.
+	RestoreUser(ctx context.Context, id int) (*models.User, error)
+	// PurgeDeletedUsers permanently removes users deleted before the cutoff,
+	// along with the data that references them.
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Fields users can be sorted by
+const (
+	UserSortID        = "id"
+	UserSortUsername  = "username"
+	UserSortEmail     = "email"
+	UserSortCreatedAt = "created_at"
+)
+
+var UserSortFields = []string{UserSortID, UserSortUsername, UserSortEmail, UserSortCreatedAt}
+
+// User statuses to filter by
+const (
+	UserStatusVerified   = "verified"
+	UserStatusUnverified = "unverified"
+	UserStatusDeleted    = "deleted"
+)
+
+var UserStatuses = []string{UserStatusVerified, UserStatusUnverified, UserStatusDeleted}
+
+// UserListFilter selects a page of users. Users are ordered by SortBy and
+// then by ID, and the page starts right after the After cursor. Prefixes
+// match case-insensitively; zero values do not filter.
+type UserListFilter struct {
+	UsernamePrefix string
+	EmailPrefix    string
+	CreatedAfter   *time.Time // inclusive
+	CreatedBefore  *time.Time // exclusive
+	Status         string
+	SortBy         string
+	Descending     bool
+	After          *UserCursor
+	Limit          int
+	// IncludeTotal counts every matching user, ignoring After and Limit.
+	IncludeTotal bool
+}
+
+// UserCursor is a keyset position: the sort value and ID of the last user
+// on the previous page.
+type UserCursor struct {
+	Value string
+	ID    int
+}
+
+type UserPage struct {
+	Users []*models.User
+	// Next is nil on the last page.
+	Next  *UserCursor
+	Total *int
+}
+
+// NewUserCursor returns the position of user in a list sorted by sortBy.
+func NewUserCursor(user *models.User, sortBy string) *UserCursor {
+	cursor := &UserCursor{ID: user.ID}
+	switch sortBy {
+	case UserSortUsername:
+		cursor.Value = user.Username
+	case UserSortEmail:
+		cursor.Value = user.Email
+	case UserSortCreatedAt:
+		cursor.Value = user.CreatedAt.UTC().Format(time.RFC3339Nano)
+	default:
+		cursor.Value = strconv.Itoa(user.ID)
+	}
+	return cursor
+}
+
+// UserSearch finds users by the words of Query, matching whole words, word
+// prefixes and, with trigram similarity, misspellings.
+type UserSearch struct {
+	Query string
+	// UserID limits the search to one user when set.
+	UserID *int
+	// After continues from a previous page. Its Value is the rank of the
+	// last result.
+	After *UserCursor
+	Limit int
+}
+
+type UserSearchResult struct {
+	User *models.User
+	Rank float64
+}
+
+type UserSearchPage struct {
+	Results []*UserSearchResult
+	// Next is nil on the last page.
+	Next *UserCursor
+}
+
+// SearchTerms splits a search query into lowercase words of letters and
+// digits, the units SearchUsers matches on.
+func SearchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
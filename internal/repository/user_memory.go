@@ -0,0 +1,449 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryUserRepo struct {
+	db *MemoryDB
+}
+
+// NewMemoryUserRepository returns a UserRepository that keeps users in db.
+func NewMemoryUserRepository(db *MemoryDB) UserRepository {
+	return &memoryUserRepo{db: db}
+}
+
+func copyUser(user *models.User) *models.User {
+	copied := *user
+	copied.EmailVerifiedAt = copyTime(user.EmailVerifiedAt)
+	copied.DeletedAt = copyTime(user.DeletedAt)
+	copied.DisplayName = copyString(user.DisplayName)
+	return &copied
+}
+
+// checkUser enforces the column lengths of the users table and the unique
+// indexes on the username and email of active users. id is the user being
+// written, 0 for a new one.
+func (db *MemoryDB) checkUser(user *models.User, id int) error {
+	for _, column := range []struct {
+		name  string
+		value string
+		limit int
+	}{
+		{"username", user.Username, 255},
+		{"email", user.Email, 255},
+		{"password", user.Password, 255},
+		{"display_name", stringValue(user.DisplayName), 100},
+	} {
+		if utf8.RuneCountInString(column.value) > column.limit {
+			return fmt.Errorf("%s is longer than %d characters", column.name, column.limit)
+		}
+	}
+
+	for _, other := range db.users {
+		if other.ID == id || other.DeletedAt != nil {
+			continue
+		}
+		if other.Username == user.Username {
+			return &ErrConflict{Field: "username"}
+		}
+		if other.Email == user.Email {
+			return &ErrConflict{Field: "email"}
+		}
+	}
+	return nil
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (r *memoryUserRepo) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if err := r.db.checkUser(user, 0); err != nil {
+		return nil, err
+	}
+	user.ID = r.db.nextID("users")
+	user.Version = 1
+	user.DeletedAt = nil
+	r.db.users[user.ID] = copyUser(user)
+	return user, nil
+}
+
+// activeUser returns the stored user unless it is missing or deleted.
+func (db *MemoryDB) activeUser(id int) (*models.User, bool) {
+	user, ok := db.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, false
+	}
+	return user, true
+}
+
+func (r *memoryUserRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.activeUser(id)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (r *memoryUserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, user := range r.db.users {
+		if user.Email == email && user.DeletedAt == nil {
+			return copyUser(user), nil
+		}
+	}
+	return nil, ErrUserNotFound
+}
+
+// compareUsers orders users by sortBy and then by ID.
+func compareUsers(a, b *models.User, sortBy string) int {
+	c := 0
+	switch sortBy {
+	case UserSortUsername:
+		c = strings.Compare(a.Username, b.Username)
+	case UserSortEmail:
+		c = strings.Compare(a.Email, b.Email)
+	case UserSortCreatedAt:
+		if a.CreatedAt.Before(b.CreatedAt) {
+			c = -1
+		} else if a.CreatedAt.After(b.CreatedAt) {
+			c = 1
+		}
+	}
+	if c == 0 && a.ID != b.ID {
+		c = 1
+		if a.ID < b.ID {
+			c = -1
+		}
+	}
+	return c
+}
+
+func (r *memoryUserRepo) ListUsers(ctx context.Context, filter UserListFilter) (*UserPage, error) {
+	sortBy := filter.SortBy
+	if sortBy == "" {
+		sortBy = UserSortID
+	}
+	switch sortBy {
+	case UserSortID, UserSortUsername, UserSortEmail, UserSortCreatedAt:
+	default:
+		return nil, fmt.Errorf("cannot sort users by %q", sortBy)
+	}
+	switch filter.Status {
+	case "", UserStatusVerified, UserStatusUnverified, UserStatusDeleted:
+	default:
+		return nil, fmt.Errorf("unknown user status %q", filter.Status)
+	}
+
+	// The cursor becomes a user that sorts where the previous page ended
+	var after *models.User
+	if filter.After != nil {
+		after = &models.User{ID: filter.After.ID, Username: filter.After.Value, Email: filter.After.Value}
+		if sortBy == UserSortCreatedAt {
+			at, err := time.Parse(time.RFC3339Nano, filter.After.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cursor: %w", err)
+			}
+			after.CreatedAt = at
+		}
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var users []*models.User
+	for _, user := range r.db.users {
+		if userMatches(user, filter) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		c := compareUsers(users[i], users[j], sortBy)
+		return c < 0 != filter.Descending
+	})
+
+	page := &UserPage{Users: []*models.User{}}
+	if filter.IncludeTotal {
+		total := len(users)
+		page.Total = &total
+	}
+	for _, user := range users {
+		if after != nil {
+			c := compareUsers(user, after, sortBy)
+			if c == 0 || c < 0 != filter.Descending {
+				continue
+			}
+		}
+		if len(page.Users) == filter.Limit {
+			page.Next = NewUserCursor(page.Users[len(page.Users)-1], sortBy)
+			break
+		}
+		page.Users = append(page.Users, copyUser(user))
+	}
+	return page, nil
+}
+
+// userMatches applies every condition of filter but the cursor and limit.
+func userMatches(user *models.User, filter UserListFilter) bool {
+	if !strings.HasPrefix(strings.ToLower(user.Username), strings.ToLower(filter.UsernamePrefix)) ||
+		!strings.HasPrefix(strings.ToLower(user.Email), strings.ToLower(filter.EmailPrefix)) {
+		return false
+	}
+	if filter.CreatedAfter != nil && user.CreatedAt.Before(*filter.CreatedAfter) {
+		return false
+	}
+	if filter.CreatedBefore != nil && !user.CreatedAt.Before(*filter.CreatedBefore) {
+		return false
+	}
+	switch filter.Status {
+	case UserStatusVerified:
+		return user.DeletedAt == nil && user.EmailVerifiedAt != nil
+	case UserStatusUnverified:
+		return user.DeletedAt == nil && user.EmailVerifiedAt == nil
+	case UserStatusDeleted:
+		return user.DeletedAt != nil
+	}
+	return user.DeletedAt == nil
+}
+
+// wordSimilarityThreshold is the pg_trgm default the <% operator uses.
+const wordSimilarityThreshold = 0.6
+
+// SearchUsers follows the SQL query: every term must be a prefix of a word
+// of the username or email, or the whole query must be similar enough to
+// either of them. Ranks approximate those of Postgres, with a fixed 0.1
+// standing in for ts_rank, so they order results alike but differ in value.
+func (r *memoryUserRepo) SearchUsers(ctx context.Context, search UserSearch) (*UserSearchPage, error) {
+	terms := SearchTerms(search.Query)
+	if len(terms) == 0 {
+		return &UserSearchPage{Results: []*UserSearchResult{}}, nil
+	}
+	query := strings.Join(terms, " ")
+
+	var afterRank float64
+	if search.After != nil {
+		var err error
+		afterRank, err = strconv.ParseFloat(search.After.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+	}
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var results []*UserSearchResult
+	for _, user := range r.db.users {
+		if user.DeletedAt != nil || (search.UserID != nil && user.ID != *search.UserID) {
+			continue
+		}
+
+		words := SearchTerms(user.Username + " " + user.Email)
+		prefixMatch := true
+		for _, term := range terms {
+			if !hasWordWithPrefix(words, term) {
+				prefixMatch = false
+				break
+			}
+		}
+		usernameSimilarity := wordSimilarity(query, strings.ToLower(user.Username))
+		emailSimilarity := wordSimilarity(query, strings.ToLower(user.Email))
+		if !prefixMatch && usernameSimilarity < wordSimilarityThreshold && emailSimilarity < wordSimilarityThreshold {
+			continue
+		}
+
+		rank := usernameSimilarity
+		if emailSimilarity > rank {
+			rank = emailSimilarity
+		}
+		if prefixMatch {
+			rank += 0.1
+		}
+		if search.After != nil && (rank > afterRank || (rank == afterRank && user.ID <= search.After.ID)) {
+			continue
+		}
+		results = append(results, &UserSearchResult{User: user, Rank: rank})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].User.ID < results[j].User.ID
+	})
+
+	page := &UserSearchPage{Results: []*UserSearchResult{}}
+	for _, result := range results {
+		if len(page.Results) == search.Limit {
+			last := page.Results[len(page.Results)-1]
+			page.Next = &UserCursor{Value: strconv.FormatFloat(last.Rank, 'g', -1, 64), ID: last.User.ID}
+			break
+		}
+		page.Results = append(page.Results, &UserSearchResult{User: copyUser(result.User), Rank: result.Rank})
+	}
+	return page, nil
+}
+
+func hasWordWithPrefix(words []string, prefix string) bool {
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// trigrams returns the trigrams of s in order, as pg_trgm extracts them:
+// each word of letters and digits is padded with two spaces in front and
+// one behind.
+func trigrams(s string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			result = append(result, string(padded[i:i+3]))
+		}
+	}
+	return result
+}
+
+// wordSimilarity is pg_trgm's word_similarity: the greatest similarity
+// between the trigrams of query and those of any continuous extent of
+// target.
+func wordSimilarity(query, target string) float64 {
+	wanted := make(map[string]bool)
+	for _, trigram := range trigrams(query) {
+		wanted[trigram] = true
+	}
+	if len(wanted) == 0 {
+		return 0
+	}
+
+	ordered := trigrams(target)
+	best := 0.0
+	for i := range ordered {
+		seen := make(map[string]bool)
+		common := 0
+		for _, trigram := range ordered[i:] {
+			if seen[trigram] {
+				continue
+			}
+			seen[trigram] = true
+			if wanted[trigram] {
+				common++
+			}
+			if similarity := float64(common) / float64(len(wanted)+len(seen)-common); similarity > best {
+				best = similarity
+			}
+		}
+	}
+	return best
+}
+
+func (r *memoryUserRepo) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	stored, ok := r.db.activeUser(user.ID)
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if stored.Version != user.Version {
+		return nil, ErrUserVersionConflict
+	}
+	if err := r.db.checkUser(user, user.ID); err != nil {
+		return nil, err
+	}
+
+	updated := copyUser(user)
+	updated.CreatedAt = stored.CreatedAt
+	updated.DeletedAt = nil
+	updated.Version = stored.Version + 1
+	r.db.users[user.ID] = updated
+
+	user.Version = updated.Version
+	return user, nil
+}
+
+func (r *memoryUserRepo) UpdatePassword(ctx context.Context, id int, oldHash, newHash string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.activeUser(id)
+	if !ok || user.Password != oldHash {
+		return ErrUserVersionConflict
+	}
+	if utf8.RuneCountInString(newHash) > 255 {
+		return fmt.Errorf("password is longer than 255 characters")
+	}
+	user.Password = newHash
+	user.Version++
+	return nil
+}
+
+func (r *memoryUserRepo) DeleteUser(ctx context.Context, id int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.activeUser(id)
+	if !ok {
+		return ErrUserNotFound
+	}
+	now := time.Now()
+	user.DeletedAt = &now
+	user.Version++
+	return nil
+}
+
+func (r *memoryUserRepo) RestoreUser(ctx context.Context, id int) (*models.User, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	user, ok := r.db.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := r.db.checkUser(user, id); err != nil {
+		return nil, err
+	}
+	user.DeletedAt = nil
+	user.UpdatedAt = time.Now()
+	user.Version++
+	return copyUser(user), nil
+}
+
+func (r *memoryUserRepo) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var purged int64
+	for id, user := range r.db.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(before) {
+			r.db.deleteUser(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
@@ -2,7 +2,13 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"remus_synerge/internal/models"
 )
@@ -15,14 +21,23 @@ func NewUserRepository(db *pgxpool.Pool) UserRepository {
 	return &userRepo{db: db}
 }
 
+// userColumns are the columns scanUser reads, in order.
+const userColumns = `id, username, email, password, created_at, updated_at, email_verified_at, deleted_at, version, display_name`
+
+func scanUser(row pgx.Row, user *models.User, extra ...interface{}) error {
+	dest := []interface{}{&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.EmailVerifiedAt, &user.DeletedAt, &user.Version, &user.DisplayName}
+	return row.Scan(append(dest, extra...)...)
+}
+
 func (r *userRepo) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
-	query := `INSERT INTO users (username, email, password, created_at, updated_at)
-			   VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	query := `INSERT INTO users (username, email, password, created_at, updated_at, email_verified_at, display_name)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, version`
 	
 	var id int
-	err := r.db.QueryRow(ctx, query, user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt).Scan(&id)
+	err := r.db.QueryRow(ctx, query, user.Username, user.Email, user.Password, user.CreatedAt, user.UpdatedAt, user.EmailVerifiedAt,
+		user.DisplayName).Scan(&id, &user.Version)
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	
 	user.ID = id
@@ -30,38 +45,295 @@ func (r *userRepo) CreateUser(ctx context.Context, user *models.User) (*models.U
 }
 
 func (r *userRepo) GetUserByID(ctx context.Context, id int) (*models.User, error) {
-	query := `SELECT id, username, email, password, created_at, updated_at FROM users WHERE id = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE id = $1 AND deleted_at IS NULL`
 	user := &models.User{}
-	err := r.db.QueryRow(ctx, query, id).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(r.db.QueryRow(ctx, query, id), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return user, nil
 }
 
 func (r *userRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `SELECT id, username, email, password, created_at, updated_at FROM users WHERE email = $1`
+	query := `SELECT ` + userColumns + ` FROM users WHERE email = $1 AND deleted_at IS NULL`
 	user := &models.User{}
-	err := r.db.QueryRow(ctx, query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt)
+	err := scanUser(r.db.QueryRow(ctx, query, email), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	return user, nil
 }
 
+// userSortColumns whitelists the columns ListUsers can order by.
+var userSortColumns = map[string]string{
+	UserSortID:        "id",
+	UserSortUsername:  "username",
+	UserSortEmail:     "email",
+	UserSortCreatedAt: "created_at",
+}
+
+func (r *userRepo) ListUsers(ctx context.Context, filter UserListFilter) (*UserPage, error) {
+	sortBy := filter.SortBy
+	if sortBy == "" {
+		sortBy = UserSortID
+	}
+	column, ok := userSortColumns[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("cannot sort users by %q", sortBy)
+	}
+
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.UsernamePrefix != "" {
+		conditions = append(conditions, "lower(username) LIKE "+arg(likePrefix(filter.UsernamePrefix)))
+	}
+	if filter.EmailPrefix != "" {
+		conditions = append(conditions, "lower(email) LIKE "+arg(likePrefix(filter.EmailPrefix)))
+	}
+	if filter.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= "+arg(*filter.CreatedAfter))
+	}
+	if filter.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*filter.CreatedBefore))
+	}
+	switch filter.Status {
+	case "":
+		conditions = append(conditions, "deleted_at IS NULL")
+	case UserStatusVerified:
+		conditions = append(conditions, "deleted_at IS NULL", "email_verified_at IS NOT NULL")
+	case UserStatusUnverified:
+		conditions = append(conditions, "deleted_at IS NULL", "email_verified_at IS NULL")
+	case UserStatusDeleted:
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	default:
+		return nil, fmt.Errorf("unknown user status %q", filter.Status)
+	}
+
+	page := &UserPage{}
+	if filter.IncludeTotal {
+		query := `SELECT COUNT(*) FROM users` + whereClause(conditions)
+		var total int
+		if err := r.db.QueryRow(ctx, query, args...).Scan(&total); err != nil {
+			return nil, dbError(err)
+		}
+		page.Total = &total
+	}
+
+	direction, compare := "ASC", ">"
+	if filter.Descending {
+		direction, compare = "DESC", "<"
+	}
+	if filter.After != nil {
+		if sortBy == UserSortID {
+			conditions = append(conditions, "id "+compare+" "+arg(filter.After.ID))
+		} else {
+			var value interface{} = filter.After.Value
+			if sortBy == UserSortCreatedAt {
+				at, err := time.Parse(time.RFC3339Nano, filter.After.Value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid cursor: %w", err)
+				}
+				value = at
+			}
+			conditions = append(conditions, fmt.Sprintf("(%s, id) %s (%s, %s)", column, compare, arg(value), arg(filter.After.ID)))
+		}
+	}
+
+	// One extra row tells whether there is a next page
+	order := column + " " + direction
+	if sortBy != UserSortID {
+		order += ", id " + direction
+	}
+	query := `SELECT ` + userColumns + ` FROM users` +
+		whereClause(conditions) + ` ORDER BY ` + order + ` LIMIT ` + arg(filter.Limit+1)
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	page.Users = []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		if err := scanUser(rows, user); err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	if len(page.Users) > filter.Limit {
+		page.Users = page.Users[:filter.Limit]
+		page.Next = NewUserCursor(page.Users[len(page.Users)-1], sortBy)
+	}
+	return page, nil
+}
+
+func (r *userRepo) SearchUsers(ctx context.Context, search UserSearch) (*UserSearchPage, error) {
+	terms := SearchTerms(search.Query)
+	if len(terms) == 0 {
+		return &UserSearchPage{Results: []*UserSearchResult{}}, nil
+	}
+
+	// Every word must match as a prefix; terms only hold letters and digits,
+	// so they cannot break the tsquery syntax
+	prefixes := make([]string, len(terms))
+	for i, term := range terms {
+		prefixes[i] = term + ":*"
+	}
+	args := []interface{}{strings.Join(prefixes, " & "), strings.Join(terms, " ")}
+
+	conditions := []string{
+		"deleted_at IS NULL",
+		`(search_vector @@ to_tsquery('simple', $1) OR $2 <% lower(username) OR $2 <% lower(email))`,
+	}
+	if search.UserID != nil {
+		args = append(args, *search.UserID)
+		conditions = append(conditions, "id = $"+strconv.Itoa(len(args)))
+	}
+	var after []string
+	if search.After != nil {
+		rank, err := strconv.ParseFloat(search.After.Value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor: %w", err)
+		}
+		args = append(args, rank, search.After.ID)
+		after = append(after, fmt.Sprintf("(rank < $%d OR (rank = $%d AND id > $%d))", len(args)-1, len(args)-1, len(args)))
+	}
+	args = append(args, search.Limit+1)
+
+	query := `SELECT ` + userColumns + `, rank FROM (
+				  SELECT ` + userColumns + `,
+						 (ts_rank(search_vector, to_tsquery('simple', $1)) +
+						  GREATEST(word_similarity($2, lower(username)), word_similarity($2, lower(email))))::float8 AS rank
+				  FROM users` + whereClause(conditions) + `
+			  ) matches` + whereClause(after) + `
+			  ORDER BY rank DESC, id ASC
+			  LIMIT $` + strconv.Itoa(len(args))
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, dbError(err)
+	}
+	defer rows.Close()
+
+	page := &UserSearchPage{Results: []*UserSearchResult{}}
+	for rows.Next() {
+		result := &UserSearchResult{User: &models.User{}}
+		if err := scanUser(rows, result.User, &result.Rank); err != nil {
+			return nil, err
+		}
+		page.Results = append(page.Results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, dbError(err)
+	}
+
+	if len(page.Results) > search.Limit {
+		page.Results = page.Results[:search.Limit]
+		last := page.Results[len(page.Results)-1]
+		page.Next = &UserCursor{Value: strconv.FormatFloat(last.Rank, 'g', -1, 64), ID: last.User.ID}
+	}
+	return page, nil
+}
+
+// likePrefix matches values starting with prefix, in any case.
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
 func (r *userRepo) UpdateUser(ctx context.Context, user *models.User) (*models.User, error) {
-	query := `UPDATE users SET username = $1, email = $2, password = $3, updated_at = $4 WHERE id = $5`
+	query := `UPDATE users SET username = $1, email = $2, password = $3, updated_at = $4, email_verified_at = $5, display_name = $6,
+			   version = version + 1
+			   WHERE id = $7 AND version = $8 AND deleted_at IS NULL RETURNING version`
 	
-	_, err := r.db.Exec(ctx, query, user.Username, user.Email, user.Password, user.UpdatedAt, user.ID)
+	err := r.db.QueryRow(ctx, query, user.Username, user.Email, user.Password, user.UpdatedAt, user.EmailVerifiedAt, user.DisplayName,
+		user.ID, user.Version).Scan(&user.Version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// Either the user is gone, or someone else updated it first
+		var exists bool
+		query := `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1 AND deleted_at IS NULL)`
+		if err := r.db.QueryRow(ctx, query, user.ID).Scan(&exists); err != nil {
+			return nil, dbError(err)
+		}
+		if exists {
+			return nil, ErrUserVersionConflict
+		}
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
-		return nil, err
+		return nil, dbError(err)
 	}
 	
 	return user, nil
 }
 
+func (r *userRepo) UpdatePassword(ctx context.Context, id int, oldHash, newHash string) error {
+	query := `UPDATE users SET password = $1, version = version + 1
+			  WHERE id = $2 AND password = $3 AND deleted_at IS NULL`
+	tag, err := r.db.Exec(ctx, query, newHash, id, oldHash)
+	if err != nil {
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserVersionConflict
+	}
+	return nil
+}
+
 func (r *userRepo) DeleteUser(ctx context.Context, id int) error {
-	query := `DELETE FROM users WHERE id = $1`
-	_, err := r.db.Exec(ctx, query, id)
-	return err
-}
\ No newline at end of file
+	query := `UPDATE users SET deleted_at = NOW(), version = version + 1 WHERE id = $1 AND deleted_at IS NULL`
+	tag, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return dbError(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *userRepo) RestoreUser(ctx context.Context, id int) (*models.User, error) {
+	// The unique indexes on active users reject names taken in the meantime
+	query := `UPDATE users SET deleted_at = NULL, updated_at = NOW(), version = version + 1
+			  WHERE id = $1 AND deleted_at IS NOT NULL
+			  RETURNING ` + userColumns
+	user := &models.User{}
+	err := scanUser(r.db.QueryRow(ctx, query, id), user)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, dbError(err)
+	}
+	return user, nil
+}
+
+func (r *userRepo) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM users WHERE deleted_at < $1`
+	tag, err := r.db.Exec(ctx, query, before)
+	if err != nil {
+		return 0, dbError(err)
+	}
+	return tag.RowsAffected(), nil
+}
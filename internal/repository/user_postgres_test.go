@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
+	"remus_synerge/internal/migrations"
+	"remus_synerge/pkg/migrate"
+)
+
+// TestPostgresUserRepository runs against the database in
+// TEST_DATABASE_URL, which it migrates and whose users it deletes.
+func TestPostgresUserRepository(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("set TEST_DATABASE_URL to run against Postgres")
+	}
+
+	ctx := context.Background()
+	db, err := pgxpool.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	known, err := migrations.Load()
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+	if _, err := migrate.New(db, known, zerolog.Nop()).Up(ctx, migrate.Options{}); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	testUserRepository(t, func(t *testing.T) UserRepository {
+		if _, err := db.Exec(ctx, `TRUNCATE users RESTART IDENTITY CASCADE`); err != nil {
+			t.Fatalf("failed to empty the users table: %v", err)
+		}
+		return NewUserRepository(db)
+	})
+}
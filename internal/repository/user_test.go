@@ -0,0 +1,382 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	testUserRepository(t, func(t *testing.T) UserRepository {
+		return NewMemoryUserRepository(NewMemoryDB())
+	})
+}
+
+// testUserRepository checks the behaviour every UserRepository must share.
+// newRepo returns a repository without any users.
+func testUserRepository(t *testing.T, newRepo func(t *testing.T) UserRepository) {
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	create := func(t *testing.T, repo UserRepository, username, email string, createdAt time.Time) *models.User {
+		t.Helper()
+		user, err := repo.CreateUser(ctx, &models.User{Username: username, Email: email, Password: "hash", CreatedAt: createdAt, UpdatedAt: createdAt})
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", username, err)
+		}
+		return user
+	}
+	conflict := func(err error) string {
+		var conflict *ErrConflict
+		if !errors.As(err, &conflict) {
+			return fmt.Sprintf("no conflict (%v)", err)
+		}
+		return conflict.Field
+	}
+
+	t.Run("create and get", func(t *testing.T) {
+		repo := newRepo(t)
+		displayName := "Alice"
+		user, err := repo.CreateUser(ctx, &models.User{Username: "alice", Email: "alice@example.com", Password: "hash",
+			CreatedAt: start, UpdatedAt: start, EmailVerifiedAt: &start, DisplayName: &displayName})
+		if err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+		if user.ID == 0 || user.Version != 1 {
+			t.Errorf("expected an ID and version 1, got %+v", user)
+		}
+
+		got, err := repo.GetUserByID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("failed to get user: %v", err)
+		}
+		if got.Username != "alice" || got.Email != "alice@example.com" || got.Password != "hash" || !got.CreatedAt.Equal(start) ||
+			got.EmailVerifiedAt == nil || got.DisplayName == nil || *got.DisplayName != "Alice" || got.DeletedAt != nil || got.Version != 1 {
+			t.Errorf("unexpected user %+v", got)
+		}
+		if got, err := repo.GetUserByEmail(ctx, "alice@example.com"); err != nil || got.ID != user.ID {
+			t.Errorf("expected the user by email, got %+v, %v", got, err)
+		}
+
+		// Changing a returned user does not change the stored one
+		got.Username = "mallory"
+		if got, _ := repo.GetUserByID(ctx, user.ID); got.Username != "alice" {
+			t.Errorf("expected the stored user to be unchanged, got %s", got.Username)
+		}
+
+		if _, err := repo.GetUserByID(ctx, user.ID+1); !errors.Is(err, ErrUserNotFound) || !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+		if _, err := repo.GetUserByEmail(ctx, "ALICE@example.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected emails to match exactly, got %v", err)
+		}
+	})
+
+	t.Run("unique username and email", func(t *testing.T) {
+		repo := newRepo(t)
+		create(t, repo, "alice", "alice@example.com", start)
+		bob := create(t, repo, "bob", "bob@example.com", start)
+
+		if _, err := repo.CreateUser(ctx, &models.User{Username: "alice", Email: "other@example.com", Password: "hash"}); conflict(err) != "username" {
+			t.Errorf("expected a username conflict, got %s", conflict(err))
+		}
+		if _, err := repo.CreateUser(ctx, &models.User{Username: "other", Email: "alice@example.com", Password: "hash"}); conflict(err) != "email" {
+			t.Errorf("expected an email conflict, got %s", conflict(err))
+		}
+
+		bob.Email = "alice@example.com"
+		if _, err := repo.UpdateUser(ctx, bob); conflict(err) != "email" {
+			t.Errorf("expected an email conflict, got %s", conflict(err))
+		}
+		if got, _ := repo.GetUserByID(ctx, bob.ID); got.Email != "bob@example.com" || got.Version != 1 {
+			t.Errorf("expected the failed update to leave bob alone, got %+v", got)
+		}
+
+		// Case matters, as in the unique indexes
+		if _, err := repo.CreateUser(ctx, &models.User{Username: "Alice", Email: "Alice@example.com", Password: "hash"}); err != nil {
+			t.Errorf("expected names differing in case to be allowed, got %v", err)
+		}
+		if _, err := repo.CreateUser(ctx, &models.User{Username: strings.Repeat("a", 256), Email: "long@example.com", Password: "hash"}); err == nil {
+			t.Error("expected a username longer than the column to be rejected")
+		}
+	})
+
+	t.Run("optimistic concurrency", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "alice", "alice@example.com", start)
+
+		first, _ := repo.GetUserByID(ctx, alice.ID)
+		second, _ := repo.GetUserByID(ctx, alice.ID)
+		first.Username = "alice1"
+		if updated, err := repo.UpdateUser(ctx, first); err != nil || updated.Version != 2 {
+			t.Fatalf("expected the update to bump the version, got %+v, %v", updated, err)
+		}
+		second.Username = "alice2"
+		if _, err := repo.UpdateUser(ctx, second); !errors.Is(err, ErrUserVersionConflict) {
+			t.Errorf("expected ErrUserVersionConflict, got %v", err)
+		}
+		if got, _ := repo.GetUserByID(ctx, alice.ID); got.Username != "alice1" || got.Version != 2 {
+			t.Errorf("expected the first update to stick, got %+v", got)
+		}
+
+		missing := &models.User{ID: alice.ID + 1, Username: "ghost", Email: "ghost@example.com", Version: 1}
+		if _, err := repo.UpdateUser(ctx, missing); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected ErrUserNotFound, got %v", err)
+		}
+
+		stored, _ := repo.GetUserByID(ctx, alice.ID)
+		if err := repo.UpdatePassword(ctx, alice.ID, stored.Password, "new-hash"); err != nil {
+			t.Fatalf("failed to update password: %v", err)
+		}
+		if got, _ := repo.GetUserByID(ctx, alice.ID); got.Password != "new-hash" || got.Username != "alice1" || got.Version != 3 {
+			t.Errorf("expected only the password and version to change, got %+v", got)
+		}
+
+		// A rehash must not overwrite a password changed since it was read
+		if err := repo.UpdatePassword(ctx, alice.ID, stored.Password, "stale-rehash"); !errors.Is(err, ErrUserVersionConflict) {
+			t.Errorf("expected ErrUserVersionConflict, got %v", err)
+		}
+		if got, _ := repo.GetUserByID(ctx, alice.ID); got.Password != "new-hash" {
+			t.Errorf("expected the newer password to stick, got %q", got.Password)
+		}
+	})
+
+	t.Run("soft delete and restore", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "alice", "alice@example.com", start)
+
+		if err := repo.DeleteUser(ctx, alice.ID); err != nil {
+			t.Fatalf("failed to delete user: %v", err)
+		}
+		if _, err := repo.GetUserByID(ctx, alice.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected a deleted user to be hidden, got %v", err)
+		}
+		if _, err := repo.GetUserByEmail(ctx, "alice@example.com"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected a deleted user to be hidden by email, got %v", err)
+		}
+		alice.Version = 2
+		if _, err := repo.UpdateUser(ctx, alice); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected a deleted user not to be updated, got %v", err)
+		}
+		if err := repo.DeleteUser(ctx, alice.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected deleting twice to fail, got %v", err)
+		}
+
+		// The name is free for reuse, and then blocks the restore
+		other := create(t, repo, "alice", "other@example.com", start)
+		if _, err := repo.RestoreUser(ctx, alice.ID); conflict(err) != "username" {
+			t.Errorf("expected a username conflict, got %s", conflict(err))
+		}
+		if err := repo.DeleteUser(ctx, other.ID); err != nil {
+			t.Fatalf("failed to delete user: %v", err)
+		}
+
+		restored, err := repo.RestoreUser(ctx, alice.ID)
+		if err != nil {
+			t.Fatalf("failed to restore user: %v", err)
+		}
+		if restored.DeletedAt != nil || restored.Version != 3 || restored.Username != "alice" {
+			t.Errorf("unexpected restored user %+v", restored)
+		}
+		if _, err := repo.RestoreUser(ctx, alice.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected restoring an active user to fail, got %v", err)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "alice", "alice@example.com", start)
+		bob := create(t, repo, "bob", "bob@example.com", start)
+		create(t, repo, "carol", "carol@example.com", start)
+		repo.DeleteUser(ctx, alice.ID)
+		repo.DeleteUser(ctx, bob.ID)
+
+		if purged, err := repo.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+			t.Errorf("expected recently deleted users to be kept, got %d, %v", purged, err)
+		}
+		if purged, err := repo.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute)); err != nil || purged != 2 {
+			t.Errorf("expected 2 users to be purged, got %d, %v", purged, err)
+		}
+		if _, err := repo.RestoreUser(ctx, alice.ID); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("expected a purged user to be gone, got %v", err)
+		}
+		page, _ := repo.ListUsers(ctx, UserListFilter{Limit: 10, IncludeTotal: true})
+		if *page.Total != 1 {
+			t.Errorf("expected the active user to remain, got %d", *page.Total)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		repo := newRepo(t)
+		names := []string{"alice", "bob", "alfred", "carol", "albert"}
+		for i, name := range names {
+			user := create(t, repo, name, name+"@example.com", start.AddDate(0, 0, i))
+			if i%2 == 0 {
+				user.EmailVerifiedAt = &start
+				if _, err := repo.UpdateUser(ctx, user); err != nil {
+					t.Fatalf("failed to verify %s: %v", name, err)
+				}
+			}
+		}
+		carol, _ := repo.GetUserByEmail(ctx, "carol@example.com")
+		repo.DeleteUser(ctx, carol.ID)
+
+		usernames := func(users []*models.User) string {
+			var got []string
+			for _, user := range users {
+				got = append(got, user.Username)
+			}
+			return strings.Join(got, ",")
+		}
+		walk := func(filter UserListFilter) string {
+			var pages []string
+			for {
+				page, err := repo.ListUsers(ctx, filter)
+				if err != nil {
+					t.Fatalf("failed to list users: %v", err)
+				}
+				pages = append(pages, usernames(page.Users))
+				if page.Next == nil {
+					return strings.Join(pages, "|")
+				}
+				filter.After = page.Next
+			}
+		}
+
+		for _, tt := range []struct {
+			filter UserListFilter
+			want   string
+		}{
+			{UserListFilter{Limit: 2}, "alice,bob|alfred,albert"},
+			{UserListFilter{Limit: 3, SortBy: UserSortUsername}, "albert,alfred,alice|bob"},
+			{UserListFilter{Limit: 3, SortBy: UserSortEmail, Descending: true}, "bob,alice,alfred|albert"},
+			{UserListFilter{Limit: 2, SortBy: UserSortCreatedAt, Descending: true}, "albert,alfred|bob,alice"},
+			{UserListFilter{Limit: 10, UsernamePrefix: "AL"}, "alice,alfred,albert"},
+			{UserListFilter{Limit: 10, EmailPrefix: "b"}, "bob"},
+			{UserListFilter{Limit: 10, CreatedAfter: timePtr(start.AddDate(0, 0, 1)), CreatedBefore: timePtr(start.AddDate(0, 0, 4))}, "bob,alfred"},
+			{UserListFilter{Limit: 10, Status: UserStatusVerified}, "alice,alfred,albert"},
+			{UserListFilter{Limit: 10, Status: UserStatusUnverified}, "bob"},
+			{UserListFilter{Limit: 10, Status: UserStatusDeleted}, "carol"},
+		} {
+			if got := walk(tt.filter); got != tt.want {
+				t.Errorf("ListUsers(%+v) = %s, want %s", tt.filter, got, tt.want)
+			}
+		}
+
+		page, err := repo.ListUsers(ctx, UserListFilter{Limit: 1, UsernamePrefix: "al", IncludeTotal: true})
+		if err != nil || page.Total == nil || *page.Total != 3 || len(page.Users) != 1 {
+			t.Errorf("expected a total of 3 with one user, got %+v, %v", page, err)
+		}
+
+		for _, filter := range []UserListFilter{
+			{Limit: 10, SortBy: "password"},
+			{Limit: 10, Status: "banned"},
+			{Limit: 10, SortBy: UserSortCreatedAt, After: &UserCursor{Value: "yesterday", ID: 1}},
+		} {
+			if _, err := repo.ListUsers(ctx, filter); err == nil {
+				t.Errorf("expected %+v to be rejected", filter)
+			}
+		}
+	})
+
+	t.Run("search", func(t *testing.T) {
+		repo := newRepo(t)
+		john := create(t, repo, "john_doe", "jd@example.com", start)
+		mary := create(t, repo, "mary", "john.smith@example.com", start)
+		create(t, repo, "bob", "bob@example.com", start)
+		christopher := create(t, repo, "christopher", "chris@example.com", start)
+		gone := create(t, repo, "johnny", "johnny@example.com", start)
+		repo.DeleteUser(ctx, gone.ID)
+
+		ids := func(search UserSearch) []int {
+			var found []int
+			for {
+				page, err := repo.SearchUsers(ctx, search)
+				if err != nil {
+					t.Fatalf("failed to search for %q: %v", search.Query, err)
+				}
+				for _, result := range page.Results {
+					found = append(found, result.User.ID)
+				}
+				if page.Next == nil {
+					return found
+				}
+				search.After = page.Next
+			}
+		}
+
+		if got := ids(UserSearch{Query: "JOHN", Limit: 1}); fmt.Sprint(got) != fmt.Sprint([]int{john.ID, mary.ID}) &&
+			fmt.Sprint(got) != fmt.Sprint([]int{mary.ID, john.ID}) {
+			t.Errorf("expected john_doe and mary once each, got %v", got)
+		}
+		if got := ids(UserSearch{Query: "john smi", Limit: 10}); fmt.Sprint(got) != fmt.Sprint([]int{mary.ID}) {
+			t.Errorf("expected every word to match, got %v", got)
+		}
+		if got := ids(UserSearch{Query: "kristopher", Limit: 10}); fmt.Sprint(got) != fmt.Sprint([]int{christopher.ID}) {
+			t.Errorf("expected a misspelling to match, got %v", got)
+		}
+		if got := ids(UserSearch{Query: "john", UserID: &mary.ID, Limit: 10}); fmt.Sprint(got) != fmt.Sprint([]int{mary.ID}) {
+			t.Errorf("expected the search to be limited to mary, got %v", got)
+		}
+		if got := ids(UserSearch{Query: "!!!", Limit: 10}); len(got) != 0 {
+			t.Errorf("expected no results without search terms, got %v", got)
+		}
+		if _, err := repo.SearchUsers(ctx, UserSearch{Query: "john", After: &UserCursor{Value: "high", ID: 1}, Limit: 10}); err == nil {
+			t.Error("expected an invalid cursor to be rejected")
+		}
+	})
+
+	t.Run("concurrent writes", func(t *testing.T) {
+		repo := newRepo(t)
+		alice := create(t, repo, "alice", "alice@example.com", start)
+
+		const writers = 8
+		var wg sync.WaitGroup
+		createErrs := make(chan error, writers)
+		updateErrs := make(chan error, writers)
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, err := repo.CreateUser(ctx, &models.User{Username: "bob", Email: fmt.Sprintf("bob%d@example.com", i), Password: "hash"})
+				createErrs <- err
+
+				update := &models.User{ID: alice.ID, Username: fmt.Sprintf("alice%d", i), Email: "alice@example.com", Password: "hash", Version: 1}
+				_, err = repo.UpdateUser(ctx, update)
+				updateErrs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(createErrs)
+		close(updateErrs)
+
+		created, updated := 0, 0
+		for err := range createErrs {
+			if err == nil {
+				created++
+			} else if conflict(err) != "username" {
+				t.Errorf("expected a username conflict, got %v", err)
+			}
+		}
+		for err := range updateErrs {
+			if err == nil {
+				updated++
+			} else if !errors.Is(err, ErrUserVersionConflict) {
+				t.Errorf("expected a version conflict, got %v", err)
+			}
+		}
+		if created != 1 || updated != 1 {
+			t.Errorf("expected exactly one create and one update to win, got %d and %d", created, updated)
+		}
+	})
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
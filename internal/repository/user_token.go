@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+var ErrUserTokenNotFound = errors.New("token not found, expired or already used")
+
+type UserTokenRepository interface {
+	// CreateUserToken stores a token and invalidates earlier unused tokens
+	// of the same user and purpose.
+	CreateUserToken(ctx context.Context, token *models.UserToken) error
+	// GetUserToken returns an unused, unexpired token without using it up,
+	// or returns ErrUserTokenNotFound.
+	GetUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error)
+	// ConsumeUserToken marks an unused, unexpired token as used and returns
+	// it, or returns ErrUserTokenNotFound.
+	ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error)
+	DeleteExpiredUserTokens(ctx context.Context, now time.Time) (int64, error)
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"remus_synerge/internal/models"
+)
+
+type memoryUserTokenRepo struct {
+	db *MemoryDB
+}
+
+func NewMemoryUserTokenRepository(db *MemoryDB) UserTokenRepository {
+	return &memoryUserTokenRepo{db: db}
+}
+
+func copyUserToken(token *models.UserToken) *models.UserToken {
+	copied := *token
+	copied.UsedAt = copyTime(token.UsedAt)
+	return &copied
+}
+
+func (r *memoryUserTokenRepo) CreateUserToken(ctx context.Context, token *models.UserToken) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, other := range r.db.userTokens {
+		if other.TokenHash == token.TokenHash {
+			return &ErrConflict{Field: "token_hash"}
+		}
+	}
+
+	token.CreatedAt = time.Now()
+	for _, other := range r.db.userTokens {
+		if other.UserID == token.UserID && other.Purpose == token.Purpose && other.UsedAt == nil {
+			other.UsedAt = copyTime(&token.CreatedAt)
+		}
+	}
+	token.ID = r.db.nextID("user_tokens")
+	r.db.userTokens[token.ID] = copyUserToken(token)
+	return nil
+}
+
+func (r *memoryUserTokenRepo) GetUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.db.userTokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			return copyUserToken(token), nil
+		}
+	}
+	return nil, ErrUserTokenNotFound
+}
+
+func (r *memoryUserTokenRepo) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	now := time.Now()
+	for _, token := range r.db.userTokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			token.UsedAt = &now
+			return copyUserToken(token), nil
+		}
+	}
+	return nil, ErrUserTokenNotFound
+}
+
+func (r *memoryUserTokenRepo) DeleteExpiredUserTokens(ctx context.Context, now time.Time) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	var deleted int64
+	for id, token := range r.db.userTokens {
+		if token.ExpiresAt.Before(now) {
+			delete(r.db.userTokens, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"remus_synerge/internal/models"
+)
+
+type userTokenRepo struct {
+	db *pgxpool.Pool
+}
+
+func NewUserTokenRepository(db *pgxpool.Pool) UserTokenRepository {
+	return &userTokenRepo{db: db}
+}
+
+func (r *userTokenRepo) CreateUserToken(ctx context.Context, token *models.UserToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	token.CreatedAt = time.Now()
+	_, err = tx.Exec(ctx, `UPDATE user_tokens SET used_at = $3
+						   WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`,
+		token.UserID, token.Purpose, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at, created_at)
+			  VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	err = tx.QueryRow(ctx, query, token.UserID, token.Purpose, token.TokenHash, token.Email,
+		token.ExpiresAt, token.CreatedAt).Scan(&token.ID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *userTokenRepo) GetUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	query := `SELECT id, user_id, purpose, token_hash, email, expires_at, created_at, used_at FROM user_tokens
+			  WHERE purpose = $1 AND token_hash = $2 AND used_at IS NULL AND expires_at > $3`
+
+	token := &models.UserToken{}
+	err := r.db.QueryRow(ctx, query, purpose, tokenHash, time.Now()).Scan(&token.ID, &token.UserID, &token.Purpose,
+		&token.TokenHash, &token.Email, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *userTokenRepo) ConsumeUserToken(ctx context.Context, purpose, tokenHash string) (*models.UserToken, error) {
+	query := `UPDATE user_tokens SET used_at = $3
+			  WHERE purpose = $1 AND token_hash = $2 AND used_at IS NULL AND expires_at > $3
+			  RETURNING id, user_id, purpose, token_hash, email, expires_at, created_at, used_at`
+
+	token := &models.UserToken{}
+	err := r.db.QueryRow(ctx, query, purpose, tokenHash, time.Now()).Scan(&token.ID, &token.UserID, &token.Purpose,
+		&token.TokenHash, &token.Email, &token.ExpiresAt, &token.CreatedAt, &token.UsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *userTokenRepo) DeleteExpiredUserTokens(ctx context.Context, now time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM user_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -3,15 +3,24 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/rs/zerolog"
 	"remus_synerge/internal/api/server"
 	"remus_synerge/internal/config"
+	"remus_synerge/internal/migrations"
+	"remus_synerge/internal/repository"
 	"remus_synerge/pkg/database"
 	"remus_synerge/pkg/logger"
+	"remus_synerge/pkg/migrate"
 )
 
 func main() {
@@ -24,15 +33,56 @@ func main() {
 		l.Fatal().Err(err).Msg("Failed to load configuration")
 	}
 
-	// Initialize database connection
-	db, err := database.NewPostgresClient(cfg.Database)
-	if err != nil {
-		l.Fatal().Err(err).Msg("Failed to connect to database")
+	// "main migrate ..." manages the schema instead of serving
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(cfg, l, os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Initialize the data store
+	var repos *repository.Repositories
+	var databaseStats func() map[string]interface{}
+	switch cfg.Database.Driver {
+	case "memory":
+		l.Warn().Msg("Data is kept in memory and lost on exit: set DB_DRIVER=postgres to persist it")
+		repos = repository.NewMemoryRepositories()
+	case "postgres":
+		db, err := database.NewPostgresClient(cfg.Database)
+		if err != nil {
+			l.Fatal().Err(err).Msg("Failed to connect to database")
+		}
+		defer db.Close()
+
+		// Bring the schema up to date before serving, if enabled
+		if cfg.Database.MigrateOnBoot {
+			known, err := migrations.Load()
+			if err != nil {
+				l.Fatal().Err(err).Msg("Failed to load migrations")
+			}
+			applied, err := migrate.New(db, known, l).Up(context.Background(), migrate.Options{})
+			if err != nil {
+				l.Fatal().Err(err).Msg("Failed to migrate database")
+			}
+			l.Info().Int("applied", len(applied)).Msg("Database schema is up to date")
+		}
+
+		repos = repository.NewPostgresRepositories(db)
+		databaseStats = func() map[string]interface{} { return database.PoolStats(db) }
+	default:
+		l.Fatal().Msgf("Unknown database driver: %s", cfg.Database.Driver)
 	}
-	defer db.Close()
 
 	// Create and start the server
-	srv := server.New(cfg, db, l)
+	srv, err := server.New(cfg, repos, l)
+	if err != nil {
+		l.Fatal().Err(err).Msg("Failed to create server")
+	}
+	if databaseStats != nil {
+		srv.GetMetrics().SetDatabaseStats(databaseStats)
+	}
 
 	// Start server in a goroutine
 	go func() {
@@ -57,4 +107,93 @@ func main() {
 	}
 
 	l.Info().Msg("Server exiting")
+}
+
+// runMigrate implements "migrate up|down|status|create".
+func runMigrate(cfg *config.Config, l zerolog.Logger, args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	steps := flags.Int("steps", 0, "migrations to apply (default all) or roll back (default 1)")
+	dryRun := flags.Bool("dry-run", false, "print the SQL instead of running it")
+	dir := flags.String("dir", migrations.Dir, "directory create writes to")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s migrate up|down|status|create [flags] [name]\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 {
+		flags.Usage()
+		return errors.New("missing command")
+	}
+	command := args[0]
+	if command != "up" && command != "down" && command != "status" && command != "create" {
+		flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	if command == "create" {
+		if flags.NArg() != 1 {
+			return errors.New("create takes the name of the migration")
+		}
+		up, down, err := migrate.Create(*dir, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created %s\nCreated %s\n", up, down)
+		return nil
+	}
+
+	if cfg.Database.Driver != "postgres" {
+		return fmt.Errorf("migrations need DB_DRIVER=postgres, not %q", cfg.Database.Driver)
+	}
+	known, err := migrations.Load()
+	if err != nil {
+		return err
+	}
+	// Schema changes may run far longer than DB_STATEMENT_TIMEOUT allows
+	dbConfig := cfg.Database
+	dbConfig.StatementTimeout = 0
+	db, err := database.NewPostgresClient(dbConfig)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	migrator := migrate.New(db, known, l)
+	opts := migrate.Options{Steps: *steps, DryRun: *dryRun, Output: os.Stdout}
+
+	switch command {
+	case "up", "down":
+		run, done := migrator.Up, "Applied"
+		if command == "down" {
+			run, done = migrator.Down, "Rolled back"
+		}
+		migrated, err := run(ctx, opts)
+		if err != nil {
+			return err
+		}
+		// The summary goes to stderr, so dry runs can pipe the SQL
+		if *dryRun {
+			done = "Would have " + strings.ToLower(done)
+		}
+		fmt.Fprintf(os.Stderr, "%s %d migration(s)\n", done, len(migrated))
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "MIGRATION\tSTATE\tAPPLIED AT")
+		for _, s := range statuses {
+			appliedAt := "-"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Migration, s.State, appliedAt)
+		}
+		return w.Flush()
+	}
+	return nil
 }
\ No newline at end of file
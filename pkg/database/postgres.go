@@ -4,32 +4,21 @@ package database
 import (
 	"context"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"remus_synerge/internal/config"
 )
 
 // NewPostgresClient creates a new PostgreSQL connection pool.
 func NewPostgresClient(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.Name, cfg.SSLMode)
-
-	config, err := pgxpool.ParseConfig(connString)
+	config, err := poolConfig(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse database config: %w", err)
+		return nil, err
 	}
 
-	// Configure connection pool
-	config.MaxConns = int32(cfg.MaxConnections)
-	config.MaxConnIdleTime = time.Duration(cfg.MaxIdleTime) * time.Second
-	config.MaxConnLifetime = time.Duration(cfg.MaxLifetime) * time.Second
-	config.HealthCheckPeriod = 30 * time.Second
-	
-	// Set connection timeouts
-	config.ConnConfig.ConnectTimeout = 10 * time.Second
-	config.ConnConfig.RuntimeParams["application_name"] = "remus_synerge"
-
 	pool, err := pgxpool.ConnectConfig(context.Background(), config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
@@ -38,7 +27,7 @@ func NewPostgresClient(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
 	// Ping the database to ensure the connection is established.
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	
+
 	if err := pool.Ping(ctx); err != nil {
 		pool.Close()
 		return nil, fmt.Errorf("failed to ping postgres: %w", err)
@@ -46,3 +35,77 @@ func NewPostgresClient(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
 
 	return pool, nil
 }
+
+// poolConfig turns the database settings into a pool configuration.
+func poolConfig(cfg config.DatabaseConfig) (*pgxpool.Config, error) {
+	switch {
+	case cfg.MaxConnections < 1:
+		return nil, fmt.Errorf("DB_MAX_CONNECTIONS must be at least 1, got %d", cfg.MaxConnections)
+	case cfg.MinConnections < 0 || cfg.MinConnections > cfg.MaxConnections:
+		return nil, fmt.Errorf("DB_MIN_CONNECTIONS must be between 0 and DB_MAX_CONNECTIONS, got %d", cfg.MinConnections)
+	case cfg.HealthCheckPeriod < 1:
+		return nil, fmt.Errorf("DB_HEALTH_CHECK_PERIOD must be at least 1 second, got %d", cfg.HealthCheckPeriod)
+	}
+
+	connString := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quote(cfg.Host), cfg.Port, quote(cfg.User), quote(cfg.Password), quote(cfg.Name), quote(cfg.SSLMode))
+
+	config, err := pgxpool.ParseConfig(connString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse database config: %w", err)
+	}
+
+	// Configure connection pool
+	config.MaxConns = int32(cfg.MaxConnections)
+	config.MinConns = int32(cfg.MinConnections)
+	config.MaxConnIdleTime = time.Duration(cfg.MaxIdleTime) * time.Second
+	config.MaxConnLifetime = time.Duration(cfg.MaxLifetime) * time.Second
+	config.HealthCheckPeriod = time.Duration(cfg.HealthCheckPeriod) * time.Second
+
+	// Set connection timeouts
+	config.ConnConfig.ConnectTimeout = time.Duration(cfg.ConnectTimeout) * time.Second
+	config.ConnConfig.RuntimeParams["application_name"] = cfg.ApplicationName
+
+	// Session settings are applied with SET rather than as startup
+	// parameters, which connection poolers such as PgBouncer reject. A zero
+	// statement timeout keeps the server's own setting.
+	statementTimeout := time.Duration(cfg.StatementTimeout) * time.Second
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		if statementTimeout <= 0 {
+			return nil
+		}
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET statement_timeout = %d", statementTimeout.Milliseconds())); err != nil {
+			return fmt.Errorf("failed to set statement timeout: %w", err)
+		}
+		return nil
+	}
+
+	return config, nil
+}
+
+// quote escapes a value for a keyword/value connection string, so that
+// passwords with spaces or quotes survive.
+func quote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// PoolStats reports the state of a connection pool for the metrics
+// endpoint. wait_count counts acquires that found no idle connection;
+// pgxpool does not time those on their own, so only the total time spent in
+// every acquire is reported.
+func PoolStats(pool *pgxpool.Pool) map[string]interface{} {
+	stat := pool.Stat()
+	return map[string]interface{}{
+		"acquired_connections":     stat.AcquiredConns(),
+		"idle_connections":         stat.IdleConns(),
+		"constructing_connections": stat.ConstructingConns(),
+		"total_connections":        stat.TotalConns(),
+		"max_connections":          stat.MaxConns(),
+		"acquire_count":            stat.AcquireCount(),
+		"canceled_acquire_count":   stat.CanceledAcquireCount(),
+		"wait_count":               stat.EmptyAcquireCount(),
+		"acquire_duration":         stat.AcquireDuration().String(),
+	}
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"remus_synerge/internal/config"
+)
+
+func testDatabaseConfig() config.DatabaseConfig {
+	return config.DatabaseConfig{
+		Host:              "db.internal",
+		Port:              5433,
+		User:              "app",
+		Password:          `it's a \secret`,
+		Name:              "remus_synerge",
+		SSLMode:           "disable",
+		MaxConnections:    20,
+		MinConnections:    2,
+		MaxIdleTime:       300,
+		MaxLifetime:       1800,
+		HealthCheckPeriod: 15,
+		ConnectTimeout:    5,
+		StatementTimeout:  30,
+		ApplicationName:   "remus_synerge-test",
+	}
+}
+
+func TestPoolConfig(t *testing.T) {
+	config, err := poolConfig(testDatabaseConfig())
+	if err != nil {
+		t.Fatalf("poolConfig() error = %v", err)
+	}
+
+	conn := config.ConnConfig
+	if conn.Host != "db.internal" || conn.Port != 5433 || conn.User != "app" || conn.Database != "remus_synerge" {
+		t.Errorf("connection = %s@%s:%d/%s", conn.User, conn.Host, conn.Port, conn.Database)
+	}
+	if conn.Password != `it's a \secret` {
+		t.Errorf("Password = %q, want it unchanged", conn.Password)
+	}
+	if conn.ConnectTimeout != 5*time.Second {
+		t.Errorf("ConnectTimeout = %v, want 5s", conn.ConnectTimeout)
+	}
+	if got := conn.RuntimeParams["application_name"]; got != "remus_synerge-test" {
+		t.Errorf("application_name = %q, want remus_synerge-test", got)
+	}
+	if config.MaxConns != 20 || config.MinConns != 2 {
+		t.Errorf("MaxConns, MinConns = %d, %d, want 20, 2", config.MaxConns, config.MinConns)
+	}
+	if config.MaxConnIdleTime != 5*time.Minute || config.MaxConnLifetime != 30*time.Minute {
+		t.Errorf("MaxConnIdleTime, MaxConnLifetime = %v, %v", config.MaxConnIdleTime, config.MaxConnLifetime)
+	}
+	if config.HealthCheckPeriod != 15*time.Second {
+		t.Errorf("HealthCheckPeriod = %v, want 15s", config.HealthCheckPeriod)
+	}
+	if config.AfterConnect == nil {
+		t.Error("AfterConnect is not set")
+	}
+}
+
+func TestPoolConfig_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*config.DatabaseConfig)
+	}{
+		{"no connections", func(cfg *config.DatabaseConfig) { cfg.MaxConnections = 0 }},
+		{"negative minimum", func(cfg *config.DatabaseConfig) { cfg.MinConnections = -1 }},
+		{"minimum above maximum", func(cfg *config.DatabaseConfig) { cfg.MinConnections = 21 }},
+		{"no health checks", func(cfg *config.DatabaseConfig) { cfg.HealthCheckPeriod = 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testDatabaseConfig()
+			tt.modify(&cfg)
+			if _, err := poolConfig(cfg); err == nil {
+				t.Error("poolConfig() succeeded, want an error")
+			}
+		})
+	}
+}
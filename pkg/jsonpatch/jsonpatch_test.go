@@ -0,0 +1,120 @@
+package jsonpatch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func decode(t *testing.T, data string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		t.Fatalf("invalid JSON %s: %v", data, err)
+	}
+	return value
+}
+
+// Examples from RFC 6902 appendix A.
+func TestPatch_Apply(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+	}{
+		{"add member", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{"add element", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{"append element", `{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{"remove member", `{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{"remove element", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{"replace", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{"move member", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			`{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{"move element", `{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{"copy", `{"foo":{"bar":1}}`, `[{"op":"copy","from":"/foo","path":"/baz"},{"op":"replace","path":"/baz/bar","value":2}]`, `{"foo":{"bar":1},"baz":{"bar":2}}`},
+		{"test", `{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{"escaped pointer", `{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10},{"op":"remove","path":"/~1"}]`, `{"~1":10}`},
+		{"null value", `{"foo":"bar"}`, `[{"op":"replace","path":"/foo","value":null}]`, `{"foo":null}`},
+		{"whole document", `{"foo":"bar"}`, `[{"op":"replace","path":"","value":[1]}]`, `[1]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patch, err := DecodePatch([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("failed to decode patch: %v", err)
+			}
+			got, err := patch.Apply(decode(t, tt.doc))
+			if err != nil {
+				t.Fatalf("failed to apply patch: %v", err)
+			}
+			if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestPatch_Errors(t *testing.T) {
+	for _, patch := range []string{
+		`{"op":"add"}`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"frobnicate","path":"/a"}]`,
+		`[{"op":"remove","path":"a"}]`,
+		`[{"op":"move","from":"b","path":"/a"}]`,
+	} {
+		if _, err := DecodePatch([]byte(patch)); !errors.Is(err, ErrInvalidPatch) {
+			t.Errorf("expected %s to be invalid, got %v", patch, err)
+		}
+	}
+
+	doc := `{"foo":{"bar":1},"list":[1,2]}`
+	for patch, wantTestFailure := range map[string]bool{
+		`[{"op":"test","path":"/foo/bar","value":"1"}]`:     true,
+		`[{"op":"remove","path":"/missing"}]`:               false,
+		`[{"op":"replace","path":"/missing","value":1}]`:    false,
+		`[{"op":"add","path":"/missing/bar","value":1}]`:    false,
+		`[{"op":"add","path":"/list/3","value":1}]`:         false,
+		`[{"op":"add","path":"/list/01","value":1}]`:        false,
+		`[{"op":"remove","path":"/list/-0"}]`:               false,
+		`[{"op":"move","from":"/foo","path":"/foo/baz"}]`:   false,
+		`[{"op":"add","path":"/foo/bar/baz","value":true}]`: false,
+	} {
+		parsed, err := DecodePatch([]byte(patch))
+		if err != nil {
+			t.Fatalf("failed to decode %s: %v", patch, err)
+		}
+		_, err = parsed.Apply(decode(t, doc))
+		if err == nil || errors.Is(err, ErrTestFailed) != wantTestFailure {
+			t.Errorf("unexpected error for %s: %v", patch, err)
+		}
+	}
+}
+
+// Examples from RFC 7396 appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"c"}`, `{"a":["b"]}`, `{"a":["b"]}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`["a","b"]`, `["c","d"]`, `["c","d"]`},
+		{`{"a":"b"}`, `["c"]`, `["c"]`},
+		{`{"a":"foo"}`, `null`, `null`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		got := MergePatch(decode(t, tt.target), decode(t, tt.patch))
+		if want := decode(t, tt.want); !reflect.DeepEqual(got, want) {
+			t.Errorf("MergePatch(%s, %s) = %v, want %v", tt.target, tt.patch, got, want)
+		}
+	}
+}
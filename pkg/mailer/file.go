@@ -0,0 +1,57 @@
+// pkg/mailer/file.go
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// FileMailer writes each message as an .eml file, for development and tests.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+func (m *FileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := build(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0o600)
+}
+
+// LogMailer logs messages instead of sending them. The body is logged at
+// debug level since it contains single-use links.
+type LogMailer struct {
+	logger zerolog.Logger
+}
+
+func NewLogMailer(logger zerolog.Logger) *LogMailer {
+	return &LogMailer{logger: logger}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg *Message) error {
+	m.logger.Info().Str("to", msg.To).Str("subject", msg.Subject).Msg("Email not sent (log mailer)")
+	m.logger.Debug().Str("to", msg.To).Msg(msg.Text)
+	return nil
+}
@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"context"
+	"mime"
+	"net/mail"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTemplates_Render(t *testing.T) {
+	templates, err := LoadTemplates("")
+	if err != nil {
+		t.Fatalf("failed to load templates: %v", err)
+	}
+
+	msg, err := templates.Render(TemplatePasswordReset, "jane@example.com", &TemplateData{
+		Username:  "<jane>",
+		Link:      "https://app.example.com/reset-password?token=abc&x=1",
+		ExpiresIn: "1 hour",
+	})
+	if err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	if msg.Subject != "Reset your password" {
+		t.Errorf("unexpected subject: %q", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "Hi <jane>,") || !strings.Contains(msg.Text, "token=abc&x=1") {
+		t.Errorf("unexpected text body: %s", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, "Hi &lt;jane&gt;,") || !strings.Contains(msg.HTML, "token=abc&amp;x=1") {
+		t.Errorf("expected escaped html body: %s", msg.HTML)
+	}
+
+	if _, err := templates.Render("unknown", "jane@example.com", &TemplateData{}); err == nil {
+		t.Error("expected unknown template to fail")
+	}
+}
+
+func TestFileMailer_Send(t *testing.T) {
+	dir := t.TempDir()
+	m, err := NewFileMailer(dir, "Remus <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("failed to create mailer: %v", err)
+	}
+
+	err = m.Send(context.Background(), &Message{To: "jane@example.com", Subject: "Grüße", Text: "plain", HTML: "<p>html</p>"})
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if err := m.Send(context.Background(), &Message{To: "jane@example.com\r\nBcc: x@example.com", Subject: "x"}); err == nil {
+		t.Error("expected header injection to be rejected")
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected one message, got %d", len(entries))
+	}
+	f, _ := os.Open(dir + "/" + entries[0].Name())
+	defer f.Close()
+
+	parsed, err := mail.ReadMessage(f)
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if subject != "Grüße" || !strings.HasPrefix(parsed.Header.Get("Content-Type"), "multipart/alternative") {
+		t.Errorf("unexpected headers: %v", parsed.Header)
+	}
+}
@@ -0,0 +1,107 @@
+// pkg/mailer/templates.go
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	texttemplate "text/template"
+)
+
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplatePasswordReset = "password_reset"
+	TemplateAccountUnlock = "account_unlock"
+)
+
+//go:embed templates
+var defaultTemplates embed.FS
+
+// TemplateData is passed to every template.
+type TemplateData struct {
+	Username  string
+	Email     string
+	Link      string
+	ExpiresIn string
+}
+
+type messageTemplate struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates renders messages from <name>.txt, which defines "subject" and
+// "body", and an optional <name>.html.
+type Templates struct {
+	messages map[string]*messageTemplate
+}
+
+// LoadTemplates parses the templates in dir, or the built-in ones if dir is
+// empty. A directory must provide every message.
+func LoadTemplates(dir string) (*Templates, error) {
+	var fsys fs.FS
+	if dir == "" {
+		sub, err := fs.Sub(defaultTemplates, "templates")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	} else {
+		fsys = os.DirFS(dir)
+	}
+
+	templates := &Templates{messages: make(map[string]*messageTemplate)}
+	for _, name := range []string{TemplateVerifyEmail, TemplatePasswordReset, TemplateAccountUnlock} {
+		text, err := texttemplate.ParseFS(fsys, name+".txt")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s template: %w", name, err)
+		}
+		if text.Lookup("subject") == nil || text.Lookup("body") == nil {
+			return nil, fmt.Errorf("%s.txt must define subject and body", name)
+		}
+
+		message := &messageTemplate{text: text}
+		if _, err := fs.Stat(fsys, name+".html"); err == nil {
+			if message.html, err = htmltemplate.ParseFS(fsys, name+".html"); err != nil {
+				return nil, fmt.Errorf("failed to parse %s html template: %w", name, err)
+			}
+		}
+		templates.messages[name] = message
+	}
+	return templates, nil
+}
+
+// Render builds the message called name for the recipient.
+func (t *Templates) Render(name, to string, data *TemplateData) (*Message, error) {
+	message, exists := t.messages[name]
+	if !exists {
+		return nil, fmt.Errorf("unknown template: %s", name)
+	}
+
+	var subject, text bytes.Buffer
+	if err := message.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return nil, err
+	}
+	if err := message.text.ExecuteTemplate(&text, "body", data); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    text.String(),
+	}
+
+	if message.html != nil {
+		var html bytes.Buffer
+		if err := message.html.Execute(&html, data); err != nil {
+			return nil, err
+		}
+		msg.HTML = html.String()
+	}
+	return msg, nil
+}
@@ -0,0 +1,425 @@
+// pkg/migrate/migrate.go
+
+// Package migrate applies versioned SQL migrations to PostgreSQL. A
+// migration is a pair of files, <version>_<name>.up.sql and an optional
+// <version>_<name>.down.sql, applied in version order and recorded in the
+// schema_migrations table. Runners hold a session advisory lock, so replicas
+// booting at the same time apply each migration once. Migrations run without
+// a statement timeout, since rewriting a large table may take longer than
+// queries are normally allowed to.
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrChecksumMismatch means an applied migration's up script has been
+	// edited since. Migrations must not change once applied; add a new one.
+	ErrChecksumMismatch = errors.New("applied migration has changed")
+	// ErrIrreversible means a migration to roll back has no down script.
+	ErrIrreversible = errors.New("migration cannot be rolled back")
+)
+
+// Migration states reported by Status.
+const (
+	StateApplied = "applied"
+	StatePending = "pending"
+	// StateDrifted is an applied migration whose up script has changed.
+	StateDrifted = "drifted"
+	// StateMissing is an applied migration this build does not know about,
+	// typically because a newer release applied it.
+	StateMissing = "missing"
+)
+
+const table = "schema_migrations"
+
+var fileName = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one schema change. Checksum identifies the up script.
+type Migration struct {
+	Version  int64
+	Name     string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status describes a migration as the database sees it. Missing migrations
+// only have a Version and Name.
+type Status struct {
+	Migration
+	State     string
+	AppliedAt *time.Time
+}
+
+// Options control Up and Down. Steps limits how many migrations run: zero
+// means all pending ones for Up and the last applied one for Down. With
+// DryRun, the SQL is written to Output instead of being run.
+type Options struct {
+	Steps  int
+	DryRun bool
+	Output io.Writer
+}
+
+// Load reads the migrations in the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("%s: migrations must be named <version>_<name>.up.sql or <version>_<name>.down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("%s: invalid version", entry.Name())
+		}
+		body, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[2] {
+			return nil, fmt.Errorf("%s: version %d is also used by %s", entry.Name(), version, migration)
+		}
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if strings.TrimSpace(migration.Up) == "" {
+			return nil, fmt.Errorf("%s has no up script", migration)
+		}
+		sum := sha256.Sum256([]byte(migration.Up))
+		migration.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Create writes empty up and down scripts to dir for a migration numbered
+// after the highest one there, and returns their paths.
+func Create(dir, name string) (string, string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migration name must contain letters or digits")
+	}
+	existing, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	version := int64(1)
+	if len(existing) > 0 {
+		version = existing[len(existing)-1].Version + 1
+	}
+
+	base := Migration{Version: version, Name: name}.String()
+	var paths []string
+	for _, direction := range []string{"up", "down"} {
+		path := filepath.Join(dir, base+"."+direction+".sql")
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", err
+		}
+		_, err = fmt.Fprintf(f, "-- %s.%s.sql\n\n", base, direction)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", "", err
+		}
+		paths = append(paths, path)
+	}
+	return paths[0], paths[1], nil
+}
+
+// Migrator applies migrations to a database.
+type Migrator struct {
+	db         *pgxpool.Pool
+	migrations []Migration
+	logger     zerolog.Logger
+}
+
+func New(db *pgxpool.Pool, migrations []Migration, logger zerolog.Logger) *Migrator {
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+		logger:     logger,
+	}
+}
+
+// Status lists the known migrations and any applied ones missing from this
+// build, by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		applied, err := appliedMigrations(ctx, conn)
+		statuses = status(m.migrations, applied)
+		return err
+	})
+	return statuses, err
+}
+
+// Up applies pending migrations in version order, each in its own
+// transaction, and returns those it applied.
+func (m *Migrator) Up(ctx context.Context, opts Options) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		statuses, err := m.checkedStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if !opts.DryRun {
+			query := `
+				CREATE TABLE IF NOT EXISTS schema_migrations (
+					version BIGINT PRIMARY KEY,
+					name TEXT NOT NULL,
+					checksum TEXT NOT NULL,
+					applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+				)`
+			if _, err := conn.Exec(ctx, query); err != nil {
+				return fmt.Errorf("failed to create %s: %w", table, err)
+			}
+		}
+
+		for _, s := range statuses {
+			if s.State == StateMissing {
+				m.logger.Warn().Int64("version", s.Version).Str("name", s.Name).Msg("Database has a migration this build does not know")
+			}
+			if s.State != StatePending || (opts.Steps > 0 && len(done) == opts.Steps) {
+				continue
+			}
+			record := `INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)`
+			if err := m.run(ctx, conn, opts, s.Migration, "up", s.Up, record, s.Version, s.Name, s.Checksum); err != nil {
+				return err
+			}
+			done = append(done, s.Migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down rolls back applied migrations, latest first, and returns those it
+// rolled back.
+func (m *Migrator) Down(ctx context.Context, opts Options) ([]Migration, error) {
+	steps := opts.Steps
+	if steps <= 0 {
+		steps = 1
+	}
+
+	var done []Migration
+	err := m.locked(ctx, func(conn *pgxpool.Conn) error {
+		statuses, err := m.checkedStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0 && len(done) < steps; i-- {
+			s := statuses[i]
+			switch s.State {
+			case StatePending:
+				continue
+			case StateMissing:
+				return fmt.Errorf("%w: %s is not part of this build", ErrIrreversible, s.Migration)
+			}
+			if strings.TrimSpace(s.Down) == "" {
+				return fmt.Errorf("%w: %s has no down script", ErrIrreversible, s.Migration)
+			}
+			record := `DELETE FROM schema_migrations WHERE version = $1`
+			if err := m.run(ctx, conn, opts, s.Migration, "down", s.Down, record, s.Version); err != nil {
+				return err
+			}
+			done = append(done, s.Migration)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// locked runs fn on a connection holding the migration lock, with the
+// statement timeout lifted for as long as it holds it.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// The connection goes back to the pool, so restore its setting after,
+	// or drop it if that fails
+	var timeout string
+	if err := conn.QueryRow(ctx, `SHOW statement_timeout`).Scan(&timeout); err != nil {
+		return fmt.Errorf("failed to read statement timeout: %w", err)
+	}
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return fmt.Errorf("failed to lift statement timeout: %w", err)
+	}
+	defer func() {
+		restore := `SELECT set_config('statement_timeout', $1, false)`
+		if _, err := conn.Exec(context.Background(), restore, timeout); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	// Session locks outlive transactions, and wait for other runners
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock(hashtext($1))`, table); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, table)
+
+	return fn(conn)
+}
+
+// checkedStatus returns the status of every migration, refusing to go on
+// if applied migrations have been edited.
+func (m *Migrator) checkedStatus(ctx context.Context, conn *pgxpool.Conn) ([]Status, error) {
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	statuses := status(m.migrations, applied)
+
+	var drifted []string
+	for _, s := range statuses {
+		if s.State == StateDrifted {
+			drifted = append(drifted, s.Migration.String())
+		}
+	}
+	if len(drifted) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrChecksumMismatch, strings.Join(drifted, ", "))
+	}
+	return statuses, nil
+}
+
+// run executes script and the bookkeeping statement record in one
+// transaction, or prints script for a dry run.
+func (m *Migrator) run(ctx context.Context, conn *pgxpool.Conn, opts Options, migration Migration, direction, script, record string, args ...interface{}) error {
+	if opts.DryRun {
+		_, err := fmt.Fprintf(opts.Output, "-- %s (%s)\n%s\n\n", migration, direction, strings.TrimSpace(script))
+		return err
+	}
+
+	start := time.Now()
+	err := conn.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// Without arguments, Exec uses the simple protocol, which allows
+		// several statements
+		if _, err := tx.Exec(ctx, script); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, record, args...)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s (%s) failed: %w", migration, direction, err)
+	}
+
+	m.logger.Info().
+		Int64("version", migration.Version).
+		Str("name", migration.Name).
+		Str("direction", direction).
+		Dur("duration", time.Since(start)).
+		Msg("Migration applied")
+	return nil
+}
+
+// appliedMigrations reads schema_migrations, which does not exist before
+// the first migration.
+func appliedMigrations(ctx context.Context, conn *pgxpool.Conn) ([]Status, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", table, err)
+	}
+	if !exists {
+		return nil, nil
+	}
+
+	query := `SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version`
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var applied []Status
+	for rows.Next() {
+		var s Status
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &s.Checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		s.AppliedAt = &appliedAt
+		applied = append(applied, s)
+	}
+	return applied, rows.Err()
+}
+
+// status merges the known migrations with the applied ones.
+func status(migrations []Migration, applied []Status) []Status {
+	byVersion := make(map[int64]Status, len(applied))
+	for _, s := range applied {
+		byVersion[s.Version] = s
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		s := Status{Migration: migration, State: StatePending}
+		if record, ok := byVersion[migration.Version]; ok {
+			s.AppliedAt = record.AppliedAt
+			s.State = StateApplied
+			if record.Checksum != migration.Checksum {
+				s.State = StateDrifted
+			}
+			delete(byVersion, migration.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, record := range byVersion {
+		statuses = append(statuses, Status{
+			Migration: Migration{Version: record.Version, Name: record.Name},
+			State:     StateMissing,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses
+}
@@ -0,0 +1,138 @@
+package migrate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0002_add_bio.up.sql":    {Data: []byte("ALTER TABLE users ADD COLUMN bio TEXT;")},
+		"0002_add_bio.down.sql":  {Data: []byte("ALTER TABLE users DROP COLUMN bio;")},
+		"0001_baseline.up.sql":   {Data: []byte("CREATE TABLE users (id SERIAL);")},
+		"10_later.up.sql":        {Data: []byte("SELECT 1;")},
+		"README.md":              {Data: []byte("not a migration")},
+		"fixtures/0003_x.up.sql": {Data: []byte("ignored")},
+	})
+	if err != nil {
+		t.Fatalf("failed to load migrations: %v", err)
+	}
+
+	var names []string
+	for _, migration := range migrations {
+		names = append(names, migration.String())
+	}
+	if got := strings.Join(names, " "); got != "0001_baseline 0002_add_bio 0010_later" {
+		t.Fatalf("expected migrations in version order, got %s", got)
+	}
+	if migrations[0].Down != "" || migrations[1].Down == "" || len(migrations[1].Checksum) != 64 {
+		t.Errorf("unexpected migrations %+v", migrations)
+	}
+
+	for name, files := range map[string]fstest.MapFS{
+		"bad name":        {"0001-baseline.up.sql": {Data: []byte("SELECT 1;")}},
+		"zero version":    {"0_baseline.up.sql": {Data: []byte("SELECT 1;")}},
+		"reused version":  {"0001_a.up.sql": {Data: []byte("SELECT 1;")}, "0001_b.up.sql": {Data: []byte("SELECT 1;")}},
+		"down without up": {"0001_a.down.sql": {Data: []byte("SELECT 1;")}},
+		"empty up script": {"0001_a.up.sql": {Data: []byte("\n")}},
+	} {
+		if _, err := Load(files); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	known := []Migration{
+		{Version: 1, Name: "baseline", Checksum: "a"},
+		{Version: 2, Name: "add_bio", Checksum: "b"},
+		{Version: 4, Name: "add_index", Checksum: "d"},
+	}
+	at := time.Now()
+	applied := []Status{
+		{Migration: Migration{Version: 1, Name: "baseline", Checksum: "a"}, AppliedAt: &at},
+		{Migration: Migration{Version: 2, Name: "add_bio", Checksum: "edited"}, AppliedAt: &at},
+		{Migration: Migration{Version: 3, Name: "from_newer_release", Checksum: "c"}, AppliedAt: &at},
+	}
+
+	var got []string
+	for _, s := range status(known, applied) {
+		got = append(got, s.Migration.String()+"="+s.State)
+	}
+	want := "0001_baseline=applied 0002_add_bio=drifted 0003_from_newer_release=missing 0004_add_index=pending"
+	if strings.Join(got, " ") != want {
+		t.Errorf("expected %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "0007_existing.up.sql"), []byte("SELECT 1;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	up, down, err := Create(dir, "Add user bio!")
+	if err != nil {
+		t.Fatalf("failed to create migration: %v", err)
+	}
+	if filepath.Base(up) != "0008_add_user_bio.up.sql" || filepath.Base(down) != "0008_add_user_bio.down.sql" {
+		t.Errorf("unexpected files %s, %s", up, down)
+	}
+	if _, err := Load(os.DirFS(dir)); err != nil {
+		t.Errorf("expected the new migration to load, got %v", err)
+	}
+
+	if _, _, err := Create(dir, "!!!"); err == nil {
+		t.Error("expected a name without letters or digits to be rejected")
+	}
+}
+
+// TestUpIgnoresStatementTimeout runs against the database in
+// TEST_DATABASE_URL, in a migrate_test schema that it recreates.
+func TestUpIgnoresStatementTimeout(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("set TEST_DATABASE_URL to run against Postgres")
+	}
+
+	ctx := context.Background()
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	config.MaxConns = 1
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		_, err := conn.Exec(ctx, `SET search_path = migrate_test; SET statement_timeout = 100`)
+		return err
+	}
+	db, err := pgxpool.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(ctx, `DROP SCHEMA IF EXISTS migrate_test CASCADE; CREATE SCHEMA migrate_test`); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	defer db.Exec(ctx, `DROP SCHEMA migrate_test CASCADE`)
+
+	slow := []Migration{{Version: 1, Name: "slow", Up: "SELECT pg_sleep(0.3);", Checksum: "slow"}}
+	if _, err := New(db, slow, zerolog.Nop()).Up(ctx, Options{}); err != nil {
+		t.Fatalf("expected a migration slower than the statement timeout to succeed: %v", err)
+	}
+
+	// The pooled connection gets its timeout back
+	var timeout string
+	if err := db.QueryRow(ctx, `SHOW statement_timeout`).Scan(&timeout); err != nil || timeout != "100ms" {
+		t.Errorf("expected statement timeout 100ms after migrating, got %q: %v", timeout, err)
+	}
+}
@@ -0,0 +1,265 @@
+// pkg/oidc/idtoken.go
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// clockSkew is tolerated between this server and the provider.
+const clockSkew = time.Minute
+
+// allowedAlgorithms excludes HMAC and "none"; ID tokens from the provider
+// must be signed with one of its published keys.
+var allowedAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// Claims are the verified claims of an ID token.
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          []string `json:"aud"`
+	AuthorizedParty   string   `json:"azp,omitempty"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	EmailVerified     bool     `json:"email_verified,omitempty"`
+	Name              string   `json:"name,omitempty"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+}
+
+// UnmarshalJSON accepts aud as a string or an array and email_verified as a
+// boolean or the string "true", both of which occur in the wild.
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	type plain Claims
+	aux := struct {
+		*plain
+		Audience      interface{} `json:"aud"`
+		EmailVerified interface{} `json:"email_verified"`
+	}{plain: (*plain)(c)}
+
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	switch aud := aux.Audience.(type) {
+	case string:
+		c.Audience = []string{aud}
+	case []interface{}:
+		c.Audience = nil
+		for _, v := range aud {
+			if s, ok := v.(string); ok {
+				c.Audience = append(c.Audience, s)
+			}
+		}
+	}
+
+	switch verified := aux.EmailVerified.(type) {
+	case bool:
+		c.EmailVerified = verified
+	case string:
+		c.EmailVerified = verified == "true"
+	}
+	return nil
+}
+
+// Valid checks the time based claims. It is called by the JWT parser.
+func (c *Claims) Valid() error {
+	now := time.Now()
+	if c.ExpiresAt == 0 || now.After(time.Unix(c.ExpiresAt, 0).Add(clockSkew)) {
+		return errors.New("id token is expired")
+	}
+	if c.IssuedAt != 0 && now.Add(clockSkew).Before(time.Unix(c.IssuedAt, 0)) {
+		return errors.New("id token is issued in the future")
+	}
+	return nil
+}
+
+// VerifyIDToken checks the signature of an ID token against the provider's
+// JWKS, its issuer, audience and nonce.
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*Claims, error) {
+	claims := &Claims{}
+	parser := &jwt.Parser{ValidMethods: allowedAlgorithms}
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.verificationKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	if claims.Issuer != p.metadata.Issuer {
+		return nil, fmt.Errorf("id token issuer %q does not match %q", claims.Issuer, p.metadata.Issuer)
+	}
+	if !containsString(claims.Audience, p.config.ClientID) {
+		return nil, errors.New("id token was not issued for this client")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID {
+		return nil, errors.New("id token was issued for another authorized party")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id token has no subject")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.New("id token nonce does not match")
+	}
+
+	return claims, nil
+}
+
+// verificationKey returns the provider key with the given ID, refetching the
+// JWKS when the key is unknown so that provider key rotation is picked up.
+func (p *Provider) verificationKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+
+	if time.Since(p.keysFetchedAt) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	p.keysFetchedAt = time.Now()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch provider keys: %w", err)
+	}
+	p.keys = keys
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey must be called with p.mu held. A token without a key ID is only
+// accepted when the provider publishes a single key.
+func (p *Provider) lookupKey(kid string) crypto.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key.publicKey
+		}
+	}
+	if key, ok := p.keys[kid]; ok {
+		return key.publicKey
+	}
+	return nil
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	publicKey crypto.PublicKey
+}
+
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]jsonWebKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.metadata.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := doJSON(p.client, req, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]jsonWebKey)
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := key.parse()
+		if err != nil {
+			// Skip keys of types we do not support rather than failing
+			// the whole set.
+			continue
+		}
+		key.publicKey = publicKey
+		keys[key.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) parse() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
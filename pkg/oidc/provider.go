@@ -0,0 +1,204 @@
+// pkg/oidc/provider.go
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config registers this application as a client of an upstream provider.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata is the part of the provider's discovery document that is used
+// here.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint,omitempty"`
+}
+
+// Token is a successful response from the provider's token endpoint.
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+}
+
+// Provider is a discovered upstream OpenID Connect provider.
+type Provider struct {
+	config   Config
+	metadata Metadata
+	client   *http.Client
+
+	mu            sync.Mutex
+	keys          map[string]jsonWebKey
+	keysFetchedAt time.Time
+}
+
+// keyRefreshInterval limits how often an unknown key ID triggers a JWKS
+// fetch, so forged tokens cannot be used to hammer the provider.
+const keyRefreshInterval = time.Minute
+
+// NewProvider fetches the discovery document of cfg.Issuer. A nil client
+// uses a client with a 10 second timeout.
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata Metadata
+	if err := doJSON(client, req, &metadata); err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	// The issuer in the document must match exactly, see OpenID Connect
+	// Discovery section 4.3.
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", metadata.Issuer, cfg.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+
+	return &Provider{
+		config:   cfg,
+		metadata: metadata,
+		client:   client,
+	}, nil
+}
+
+func (p *Provider) Metadata() Metadata {
+	return p.metadata
+}
+
+// AuthCodeURL returns the URL to send the user to. The code challenge is
+// always S256.
+func (p *Provider) AuthCodeURL(state, nonce, codeChallenge string) string {
+	scopes := p.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems an authorization code at the token endpoint.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	if p.config.ClientSecret == "" {
+		form.Set("client_id", p.config.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if p.config.ClientSecret != "" {
+		// client_secret_basic requires the credentials to be form encoded
+		// before they are base64 encoded.
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	var token Token
+	if err := doJSON(p.client, req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange failed: %w", err)
+	}
+	if token.IDToken == "" {
+		return nil, errors.New("token response did not contain an id_token")
+	}
+	return &token, nil
+}
+
+// doJSON performs the request and decodes a JSON response. OAuth error
+// responses are turned into errors carrying the error code.
+func doJSON(client *http.Client, req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return fmt.Errorf("%s returned %s: %s", req.URL.Path, oauthErr.Error, oauthErr.Description)
+		}
+		return fmt.Errorf("%s returned status %d", req.URL.Path, resp.StatusCode)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// RandomString returns a URL safe random string with n bytes of entropy,
+// suitable for state, nonce and PKCE verifier values.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge for verifier.
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,103 @@
+package oidc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"remus_synerge/pkg/oidc/oidctest"
+)
+
+func TestProvider_VerifyIDToken(t *testing.T) {
+	issuer := oidctest.NewIssuer("remus", "secret")
+	defer issuer.Close()
+
+	provider, err := NewProvider(context.Background(), Config{
+		Issuer:      issuer.URL,
+		ClientID:    "remus",
+		RedirectURL: "http://localhost/callback",
+	}, nil)
+	if err != nil {
+		t.Fatalf("discovery failed: %v", err)
+	}
+
+	now := time.Now()
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":            issuer.URL,
+			"sub":            "emp-1",
+			"aud":            "remus",
+			"exp":            now.Add(time.Minute).Unix(),
+			"iat":            now.Unix(),
+			"nonce":          "n-1",
+			"email":          "test@example.com",
+			"email_verified": "true",
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(claims jwt.MapClaims)
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", modify: func(jwt.MapClaims) {}},
+		{name: "audience array", modify: func(c jwt.MapClaims) { c["aud"] = []string{"remus"} }},
+		{name: "wrong issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: true},
+		{name: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "other" }, wantErr: true},
+		{name: "other authorized party", modify: func(c jwt.MapClaims) {
+			c["aud"] = []string{"remus", "other"}
+			c["azp"] = "other"
+		}, wantErr: true},
+		{name: "wrong nonce", modify: func(c jwt.MapClaims) { c["nonce"] = "n-2" }, wantErr: true},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = now.Add(-time.Hour).Unix() }, wantErr: true},
+		{name: "missing subject", modify: func(c jwt.MapClaims) { delete(c, "sub") }, wantErr: true},
+		{name: "unsigned", token: unsignedToken(t, validClaims()), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				claims := validClaims()
+				tt.modify(claims)
+				token = issuer.SignIDToken(claims)
+			}
+
+			claims, err := provider.VerifyIDToken(context.Background(), token, "n-1")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected verification to fail")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if claims.Subject != "emp-1" || !claims.EmailVerified {
+				t.Errorf("unexpected claims: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestNewProvider_IssuerMismatch(t *testing.T) {
+	issuer := oidctest.NewIssuer("remus", "secret")
+	defer issuer.Close()
+
+	// The discovery document is served, but claims a different issuer.
+	_, err := NewProvider(context.Background(), Config{Issuer: strings.Replace(issuer.URL, "127.0.0.1", "localhost", 1)}, nil)
+	if err == nil {
+		t.Fatal("expected issuer mismatch to be rejected")
+	}
+}
+
+func unsignedToken(t *testing.T, claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("failed to build token: %v", err)
+	}
+	return token
+}
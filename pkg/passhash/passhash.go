@@ -0,0 +1,203 @@
+// pkg/passhash/passhash.go
+
+// Package passhash hashes passwords with argon2id or bcrypt. Argon2id hashes
+// are stored in PHC string format, e.g.
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<hash>; bcrypt hashes use their own
+// $2a$ format. Either kind can be verified whichever algorithm new hashes use.
+package passhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var ErrUnknownHash = errors.New("unrecognized password hash")
+
+// PasswordHasher creates and checks password hashes.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash and, if so, whether hash
+	// should be replaced because it was made with another algorithm or
+	// other parameters than new hashes.
+	Verify(password, hash string) (match bool, rehash bool, err error)
+}
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the second recommended option of RFC 9106.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 4,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// Config selects the algorithm for new hashes. Zero values fall back to
+// argon2id, DefaultArgon2Params and bcrypt.DefaultCost.
+type Config struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+type hasher struct {
+	algorithm  string
+	argon2     Argon2Params
+	bcryptCost int
+}
+
+func New(cfg Config) (PasswordHasher, error) {
+	h := &hasher{
+		algorithm:  cfg.Algorithm,
+		argon2:     cfg.Argon2,
+		bcryptCost: cfg.BcryptCost,
+	}
+
+	if h.algorithm == "" {
+		h.algorithm = Argon2id
+	}
+	if h.argon2.Memory == 0 {
+		h.argon2.Memory = DefaultArgon2Params.Memory
+	}
+	if h.argon2.Iterations == 0 {
+		h.argon2.Iterations = DefaultArgon2Params.Iterations
+	}
+	if h.argon2.Parallelism == 0 {
+		h.argon2.Parallelism = DefaultArgon2Params.Parallelism
+	}
+	if h.argon2.SaltLength == 0 {
+		h.argon2.SaltLength = DefaultArgon2Params.SaltLength
+	}
+	if h.argon2.KeyLength == 0 {
+		h.argon2.KeyLength = DefaultArgon2Params.KeyLength
+	}
+	if h.bcryptCost == 0 {
+		h.bcryptCost = bcrypt.DefaultCost
+	}
+
+	switch h.algorithm {
+	case Argon2id:
+		if h.argon2.Memory < 8*uint32(h.argon2.Parallelism) {
+			return nil, fmt.Errorf("argon2id memory must be at least 8 KiB per lane")
+		}
+	case Bcrypt:
+		if h.bcryptCost < bcrypt.MinCost || h.bcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm: %s", h.algorithm)
+	}
+
+	return h, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.algorithm == Bcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, h.argon2.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.Iterations, h.argon2.Memory, h.argon2.Parallelism, h.argon2.KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		Argon2id, argon2.Version, h.argon2.Memory, h.argon2.Iterations, h.argon2.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *hasher) Verify(password, hash string) (bool, bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$"+Argon2id+"$"):
+		params, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false, err
+		}
+		computed := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false, nil
+		}
+		return true, h.algorithm != Argon2id || params != h.argon2, nil
+
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost([]byte(hash))
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.algorithm != Bcrypt || cost != h.bcryptCost, nil
+	}
+
+	return false, false, ErrUnknownHash
+}
+
+// decodeArgon2id parses $argon2id$v=19$m=...,t=...,p=...$<salt>$<key>.
+func decodeArgon2id(hash string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	if params.Iterations == 0 || params.Parallelism == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
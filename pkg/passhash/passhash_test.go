@@ -0,0 +1,81 @@
+package passhash
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testParams = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1}
+
+func TestHasher_Argon2id(t *testing.T) {
+	hasher, err := New(Config{Argon2: testParams})
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected hash format: %s", hash)
+	}
+
+	if match, rehash, err := hasher.Verify("correct horse", hash); !match || rehash || err != nil {
+		t.Errorf("expected match without rehash, got match=%v rehash=%v err=%v", match, rehash, err)
+	}
+	if match, _, err := hasher.Verify("wrong horse", hash); match || err != nil {
+		t.Errorf("expected mismatch, got match=%v err=%v", match, err)
+	}
+
+	stronger, _ := New(Config{Argon2: Argon2Params{Memory: 128, Iterations: 2, Parallelism: 1}})
+	if match, rehash, _ := stronger.Verify("correct horse", hash); !match || !rehash {
+		t.Errorf("expected outdated parameters to need a rehash, got match=%v rehash=%v", match, rehash)
+	}
+}
+
+func TestHasher_Bcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("failed to hash: %v", err)
+	}
+
+	argon, _ := New(Config{Argon2: testParams})
+	if match, rehash, err := argon.Verify("correct horse", string(legacy)); !match || !rehash || err != nil {
+		t.Errorf("expected bcrypt hash to match and need a rehash, got match=%v rehash=%v err=%v", match, rehash, err)
+	}
+	if match, _, err := argon.Verify("wrong horse", string(legacy)); match || err != nil {
+		t.Errorf("expected mismatch, got match=%v err=%v", match, err)
+	}
+
+	bcryptHasher, err := New(Config{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatalf("failed to create hasher: %v", err)
+	}
+	if match, rehash, _ := bcryptHasher.Verify("correct horse", string(legacy)); !match || rehash {
+		t.Errorf("expected match without rehash, got match=%v rehash=%v", match, rehash)
+	}
+}
+
+func TestHasher_InvalidHashes(t *testing.T) {
+	hasher, _ := New(Config{Argon2: testParams})
+
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$aGFzaA",
+	} {
+		if match, _, err := hasher.Verify("password", hash); match || err == nil {
+			t.Errorf("expected %q to be rejected with an error, got match=%v err=%v", hash, match, err)
+		}
+	}
+
+	if _, err := New(Config{Algorithm: "md5"}); err == nil {
+		t.Error("expected unknown algorithm to be rejected")
+	}
+}
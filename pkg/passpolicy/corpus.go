@@ -0,0 +1,214 @@
+package passpolicy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A corpus file is an 8-byte header followed by the sorted, distinct
+// leading bytes of the SHA-1 of every breached password:
+//
+//	"RSBC" | version (1) | prefix length | 2 reserved bytes | prefixes...
+//
+// Eight-byte prefixes make false positives vanishingly rare while taking
+// less than half the space of full hashes. Lookups binary search the file
+// on disk, so even large corpora cost no memory.
+const (
+	corpusMagic         = "RSBC"
+	corpusVersion       = 1
+	corpusHeaderSize    = 8
+	DefaultPrefixLength = 8
+)
+
+var ErrInvalidCorpus = errors.New("not a breached password corpus")
+
+// Corpus is a breached password corpus opened with OpenCorpus. It is safe
+// for concurrent use.
+type Corpus struct {
+	file         *os.File
+	prefixLength int
+	count        int
+}
+
+// OpenCorpus opens a corpus file written by BuildCorpus.
+func OpenCorpus(path string) (*Corpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	corpus, err := newCorpus(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return corpus, nil
+}
+
+func newCorpus(file *os.File) (*Corpus, error) {
+	header := make([]byte, corpusHeaderSize)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, ErrInvalidCorpus
+	}
+	if string(header[:4]) != corpusMagic {
+		return nil, ErrInvalidCorpus
+	}
+	if header[4] != corpusVersion {
+		return nil, fmt.Errorf("unsupported corpus version %d", header[4])
+	}
+	prefixLength := int(header[5])
+	if prefixLength < 1 || prefixLength > sha1.Size {
+		return nil, ErrInvalidCorpus
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size() - corpusHeaderSize
+	if size%int64(prefixLength) != 0 {
+		return nil, fmt.Errorf("%w: truncated", ErrInvalidCorpus)
+	}
+
+	return &Corpus{
+		file:         file,
+		prefixLength: prefixLength,
+		count:        int(size / int64(prefixLength)),
+	}, nil
+}
+
+// Contains reports whether password is in the corpus.
+func (c *Corpus) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	return c.containsHash(sum[:c.prefixLength])
+}
+
+func (c *Corpus) containsHash(prefix []byte) (bool, error) {
+	entry := make([]byte, c.prefixLength)
+	var readErr error
+	read := func(i int) []byte {
+		if readErr == nil {
+			_, readErr = c.file.ReadAt(entry, corpusHeaderSize+int64(i)*int64(c.prefixLength))
+		}
+		return entry
+	}
+
+	i := sort.Search(c.count, func(i int) bool {
+		return bytes.Compare(read(i), prefix) >= 0
+	})
+	if readErr != nil {
+		return false, readErr
+	}
+	if i == c.count {
+		return false, nil
+	}
+	found := bytes.Equal(read(i), prefix)
+	return found, readErr
+}
+
+// Len returns the number of entries in the corpus.
+func (c *Corpus) Len() int {
+	return c.count
+}
+
+func (c *Corpus) Close() error {
+	return c.file.Close()
+}
+
+// BuildOptions control BuildCorpus.
+type BuildOptions struct {
+	// PrefixLength is the number of hash bytes stored per entry; zero means
+	// DefaultPrefixLength.
+	PrefixLength int
+	// MinCount skips hashes seen fewer times than this in a Have I Been
+	// Pwned style "HASH:COUNT" list.
+	MinCount int
+}
+
+// BuildCorpus reads breached passwords from r and writes a corpus to w. Each
+// line is either a hex SHA-1 hash, optionally followed by ":count" as in
+// the Have I Been Pwned downloads, or a plaintext password. It returns the
+// number of entries written.
+func BuildCorpus(w io.Writer, r io.Reader, opts BuildOptions) (int, error) {
+	prefixLength := opts.PrefixLength
+	if prefixLength == 0 {
+		prefixLength = DefaultPrefixLength
+	}
+	if prefixLength < 1 || prefixLength > sha1.Size {
+		return 0, fmt.Errorf("prefix length must be between 1 and %d", sha1.Size)
+	}
+
+	var prefixes []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if text == "" {
+			continue
+		}
+
+		sum, count, err := parseCorpusLine(text)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		if count < opts.MinCount {
+			continue
+		}
+		prefixes = append(prefixes, string(sum[:prefixLength]))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	sort.Strings(prefixes)
+
+	bw := bufio.NewWriter(w)
+	header := []byte(corpusMagic + "\x00\x00\x00\x00")
+	header[4] = corpusVersion
+	header[5] = byte(prefixLength)
+	if _, err := bw.Write(header); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for i, prefix := range prefixes {
+		if i > 0 && prefix == prefixes[i-1] {
+			continue
+		}
+		if _, err := bw.WriteString(prefix); err != nil {
+			return 0, err
+		}
+		written++
+	}
+	return written, bw.Flush()
+}
+
+// parseCorpusLine returns the hash of a corpus input line and its count,
+// which is 1 when the line has none.
+func parseCorpusLine(line string) ([]byte, int, error) {
+	hash, countStr, hasCount := strings.Cut(line, ":")
+	if len(hash) == 2*sha1.Size {
+		if sum, err := hex.DecodeString(hash); err == nil {
+			count := 1
+			if hasCount {
+				count, err = strconv.Atoi(strings.TrimSpace(countStr))
+				if err != nil {
+					return nil, 0, fmt.Errorf("invalid count %q", countStr)
+				}
+			}
+			return sum, count, nil
+		}
+	}
+
+	sum := sha1.Sum([]byte(line))
+	return sum[:], 1, nil
+}
@@ -0,0 +1,608 @@
+package passpolicy
+
+import (
+	"math"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Match patterns
+const (
+	patternDictionary = "dictionary"
+	patternSpatial    = "spatial"
+	patternSequence   = "sequence"
+	patternRepeat     = "repeat"
+	patternDate       = "date"
+	patternBruteforce = "bruteforce"
+)
+
+// maxWordLength bounds dictionary lookups; longer entries are not matched.
+const maxWordLength = 32
+
+// Dictionary names
+const (
+	dictPasswords  = "passwords"
+	dictEnglish    = "english"
+	dictUserInputs = "user_inputs"
+)
+
+// match is a guessable part of a password, runes i through j inclusive.
+type match struct {
+	i, j       int
+	pattern    string
+	token      string
+	guesses    float64
+	dictionary string
+	rank       int
+	reversed   bool
+	l33t       bool
+	turns      int
+}
+
+// omnimatch finds every dictionary, spatial, sequence, repeat and date match
+// in password.
+func omnimatch(password []rune, dictionaries map[string]map[string]int) []*match {
+	var matches []*match
+	matches = append(matches, dictionaryMatches(password, dictionaries)...)
+	matches = append(matches, reverseDictionaryMatches(password, dictionaries)...)
+	matches = append(matches, l33tMatches(password, dictionaries)...)
+	matches = append(matches, spatialMatches(password)...)
+	matches = append(matches, sequenceMatches(password)...)
+	matches = append(matches, repeatMatches(password, dictionaries)...)
+	matches = append(matches, dateMatches(password)...)
+	return matches
+}
+
+func dictionaryMatches(password []rune, dictionaries map[string]map[string]int) []*match {
+	lower := []rune(strings.ToLower(string(password)))
+	if len(lower) != len(password) {
+		// Lowercasing changed the length; index positions would not line up.
+		return nil
+	}
+
+	var matches []*match
+	for name, ranked := range dictionaries {
+		for i := range lower {
+			for j := i; j < len(lower) && j-i < maxWordLength; j++ {
+				word := string(lower[i : j+1])
+				rank, ok := ranked[word]
+				if !ok {
+					continue
+				}
+				token := string(password[i : j+1])
+				matches = append(matches, &match{
+					i:          i,
+					j:          j,
+					pattern:    patternDictionary,
+					token:      token,
+					dictionary: name,
+					rank:       rank,
+					guesses:    float64(rank) * uppercaseVariations(token),
+				})
+			}
+		}
+	}
+	return matches
+}
+
+func reverseDictionaryMatches(password []rune, dictionaries map[string]map[string]int) []*match {
+	n := len(password)
+	reversed := make([]rune, n)
+	for i, r := range password {
+		reversed[n-1-i] = r
+	}
+
+	var matches []*match
+	for _, m := range dictionaryMatches(reversed, dictionaries) {
+		// Palindromes are already found by the forward pass.
+		if len([]rune(m.token)) < 2 {
+			continue
+		}
+		m.i, m.j = n-1-m.j, n-1-m.i
+		m.token = string(password[m.i : m.j+1])
+		m.reversed = true
+		m.guesses *= 2
+		if m.token == reverseString(m.token) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// l33tTable lists common substitutions for each letter.
+var l33tTable = map[rune][]rune{
+	'a': {'4', '@'},
+	'b': {'8'},
+	'c': {'(', '{', '[', '<'},
+	'e': {'3'},
+	'g': {'6', '9'},
+	'i': {'1', '!', '|'},
+	'l': {'1', '|', '7'},
+	'o': {'0'},
+	's': {'$', '5'},
+	't': {'+', '7'},
+	'x': {'%'},
+	'z': {'2'},
+}
+
+// l33tMatches finds dictionary words written with substitutions such as
+// "p@ssw0rd". Characters that stand for several letters are tried with each.
+func l33tMatches(password []rune, dictionaries map[string]map[string]int) []*match {
+	candidates := map[rune][]rune{}
+	for _, r := range password {
+		if _, seen := candidates[r]; seen {
+			continue
+		}
+		for letter, subs := range l33tTable {
+			for _, sub := range subs {
+				if sub == r {
+					candidates[r] = append(candidates[r], letter)
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var matches []*match
+	for _, subs := range substitutionMaps(candidates) {
+		translated := make([]rune, len(password))
+		for i, r := range password {
+			if letter, ok := subs[r]; ok {
+				translated[i] = letter
+			} else {
+				translated[i] = r
+			}
+		}
+
+		for _, m := range dictionaryMatches(translated, dictionaries) {
+			token := password[m.i : m.j+1]
+			used := map[rune]rune{}
+			for _, r := range token {
+				if letter, ok := subs[r]; ok {
+					used[r] = letter
+				}
+			}
+			// Single characters such as "1" are not words.
+			if len(used) == 0 || len(token) < 2 {
+				continue
+			}
+			m.token = string(token)
+			m.l33t = true
+			m.guesses *= l33tVariations(token, used)
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// substitutionMaps expands the possible letters for each substituted
+// character into every combination, capped to keep the search small.
+func substitutionMaps(candidates map[rune][]rune) []map[rune]rune {
+	maps := []map[rune]rune{{}}
+	for sub, letters := range candidates {
+		var next []map[rune]rune
+		for _, existing := range maps {
+			for _, letter := range letters {
+				m := make(map[rune]rune, len(existing)+1)
+				for k, v := range existing {
+					m[k] = v
+				}
+				m[sub] = letter
+				next = append(next, m)
+			}
+		}
+		maps = next
+		if len(maps) > 64 {
+			maps = maps[:64]
+		}
+	}
+	return maps
+}
+
+func l33tVariations(token []rune, used map[rune]rune) float64 {
+	variations := 1.0
+	for sub, letter := range used {
+		subbed, unsubbed := 0, 0
+		for _, r := range token {
+			switch {
+			case r == sub:
+				subbed++
+			case unicode.ToLower(r) == letter:
+				unsubbed++
+			}
+		}
+		if subbed == 0 || unsubbed == 0 {
+			variations *= 2
+			continue
+		}
+		possibilities := 0.0
+		for i := 1; i <= minInt(subbed, unsubbed); i++ {
+			possibilities += nCk(subbed+unsubbed, i)
+		}
+		variations *= possibilities
+	}
+	return variations
+}
+
+func uppercaseVariations(token string) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		switch {
+		case unicode.IsUpper(r):
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		}
+	}
+	if upper == 0 {
+		return 1
+	}
+
+	runes := []rune(token)
+	firstUpper := unicode.IsUpper(runes[0]) && upper == 1
+	lastUpper := unicode.IsUpper(runes[len(runes)-1]) && upper == 1
+	if lower == 0 || firstUpper || lastUpper {
+		return 2
+	}
+
+	variations := 0.0
+	for i := 1; i <= minInt(upper, lower); i++ {
+		variations += nCk(upper+lower, i)
+	}
+	return variations
+}
+
+// keyboard maps each key of a US QWERTY keyboard to its position. Rows are
+// offset so that neighbours on adjacent rows differ by one in x.
+var keyboard = func() map[rune][3]int {
+	rows := []struct {
+		keys, shifted string
+		offset        int
+	}{
+		{"`1234567890-=", "~!@#$%^&*()_+", 0},
+		{"qwertyuiop[]\\", "QWERTYUIOP{}|", 3},
+		{"asdfghjkl;'", "ASDFGHJKL:\"", 4},
+		{"zxcvbnm,./", "ZXCVBNM<>?", 5},
+	}
+
+	keys := map[rune][3]int{}
+	for y, row := range rows {
+		shifted := []rune(row.shifted)
+		for c, key := range []rune(row.keys) {
+			x := row.offset + 2*c
+			keys[key] = [3]int{x, y, 0}
+			keys[shifted[c]] = [3]int{x, y, 1}
+		}
+	}
+	return keys
+}()
+
+const (
+	keyboardStartingPositions = 94
+	keyboardAverageDegree     = 4.6
+)
+
+// spatialMatches finds runs of three or more neighbouring keys such as
+// "qwerty" or "zxcvb".
+func spatialMatches(password []rune) []*match {
+	var matches []*match
+	i := 0
+	for i < len(password)-2 {
+		j, turns, shifted := i, 0, 0
+		lastDirection := [2]int{}
+		if key, ok := keyboard[password[i]]; ok && key[2] == 1 {
+			shifted++
+		}
+
+		for j+1 < len(password) {
+			current, ok1 := keyboard[password[j]]
+			next, ok2 := keyboard[password[j+1]]
+			if !ok1 || !ok2 {
+				break
+			}
+			dx, dy := next[0]-current[0], next[1]-current[1]
+			adjacent := (dy == 0 && (dx == 2 || dx == -2)) || ((dy == 1 || dy == -1) && (dx == 1 || dx == -1))
+			if !adjacent {
+				break
+			}
+			if direction := [2]int{dx, dy}; direction != lastDirection {
+				turns++
+				lastDirection = direction
+			}
+			if next[2] == 1 {
+				shifted++
+			}
+			j++
+		}
+
+		if j-i >= 2 {
+			token := string(password[i : j+1])
+			matches = append(matches, &match{
+				i:       i,
+				j:       j,
+				pattern: patternSpatial,
+				token:   token,
+				turns:   turns,
+				guesses: spatialGuesses(j-i+1, turns, shifted),
+			})
+			i = j
+			continue
+		}
+		i++
+	}
+	return matches
+}
+
+func spatialGuesses(length, turns, shifted int) float64 {
+	guesses := 0.0
+	for i := 2; i <= length; i++ {
+		for j := 1; j <= minInt(turns, i-1); j++ {
+			guesses += nCk(i-1, j-1) * keyboardStartingPositions * math.Pow(keyboardAverageDegree, float64(j))
+		}
+	}
+
+	unshifted := length - shifted
+	switch {
+	case shifted == 0:
+	case unshifted == 0:
+		guesses *= 2
+	default:
+		variations := 0.0
+		for i := 1; i <= minInt(shifted, unshifted); i++ {
+			variations += nCk(shifted+unshifted, i)
+		}
+		guesses *= variations
+	}
+	return guesses
+}
+
+// sequenceMatches finds runs of three or more characters of one class with
+// a constant step, such as "abc", "7531" or "ZYX".
+func sequenceMatches(password []rune) []*match {
+	var matches []*match
+	n := len(password)
+	i := 0
+	for i < n-2 {
+		delta := int(password[i+1]) - int(password[i])
+		if delta == 0 || delta > 5 || delta < -5 || charClass(password[i]) == 0 || charClass(password[i]) != charClass(password[i+1]) {
+			i++
+			continue
+		}
+
+		j := i + 1
+		for j+1 < n && int(password[j+1])-int(password[j]) == delta && charClass(password[j+1]) == charClass(password[i]) {
+			j++
+		}
+		if j-i < 2 {
+			i++
+			continue
+		}
+
+		first := password[i]
+		base := 26.0
+		switch {
+		case strings.ContainsRune("aAzZ019", first):
+			base = 4
+		case unicode.IsDigit(first):
+			base = 10
+		}
+		if delta < 0 {
+			base *= 2
+		}
+
+		matches = append(matches, &match{
+			i:       i,
+			j:       j,
+			pattern: patternSequence,
+			token:   string(password[i : j+1]),
+			guesses: base * float64(j-i+1),
+		})
+		i = j + 1
+	}
+	return matches
+}
+
+func charClass(r rune) int {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return 1
+	case r >= 'A' && r <= 'Z':
+		return 2
+	case r >= '0' && r <= '9':
+		return 3
+	}
+	return 0
+}
+
+// repeatMatches finds a unit repeated back to back, such as "aaa" or
+// "abcabc". The guesses are those of the unit times the repetitions.
+func repeatMatches(password []rune, dictionaries map[string]map[string]int) []*match {
+	var matches []*match
+	n := len(password)
+	i := 0
+	for i < n-1 {
+		bestUnit, bestCount := 0, 0
+		for unit := 1; i+2*unit <= n; unit++ {
+			count := 1
+			for i+(count+1)*unit <= n && string(password[i+count*unit:i+(count+1)*unit]) == string(password[i:i+unit]) {
+				count++
+			}
+			if count >= 2 && unit*count > bestUnit*bestCount {
+				bestUnit, bestCount = unit, count
+			}
+		}
+		if bestCount < 2 {
+			i++
+			continue
+		}
+
+		j := i + bestUnit*bestCount - 1
+		base := mostGuessable(password[i:i+bestUnit], dictionaries).guesses
+		matches = append(matches, &match{
+			i:       i,
+			j:       j,
+			pattern: patternRepeat,
+			token:   string(password[i : j+1]),
+			guesses: base * float64(bestCount),
+		})
+		i = j + 1
+	}
+	return matches
+}
+
+const minYearSpace = 20
+
+func yearGuesses(year int) float64 {
+	space := year - time.Now().Year()
+	if space < 0 {
+		space = -space
+	}
+	if space < minYearSpace {
+		space = minYearSpace
+	}
+	return float64(space)
+}
+
+// dateMatches finds years from 1900 to 2049 and day-month-year dates written
+// as 6 or 8 digits, or with a separator such as "1/2/1990".
+func dateMatches(password []rune) []*match {
+	var matches []*match
+	n := len(password)
+
+	for i := 0; i < n; i++ {
+		for j := i + 3; j < n && j-i < 10; j++ {
+			token := string(password[i : j+1])
+
+			if isDigits(token) {
+				switch len(token) {
+				case 4:
+					if year := atoi(token); year >= 1900 && year <= 2049 {
+						matches = append(matches, &match{i: i, j: j, pattern: patternDate, token: token, guesses: yearGuesses(year)})
+					}
+				case 6, 8:
+					if year, ok := parseDigitDate(token); ok {
+						matches = append(matches, &match{i: i, j: j, pattern: patternDate, token: token, guesses: 365 * yearGuesses(year)})
+					}
+				}
+				continue
+			}
+
+			if year, ok := parseSeparatedDate(token); ok {
+				matches = append(matches, &match{i: i, j: j, pattern: patternDate, token: token, guesses: 4 * 365 * yearGuesses(year)})
+			}
+		}
+	}
+	return matches
+}
+
+// parseDigitDate tries ddmmyyyy, mmddyyyy and yyyymmdd for 8 digits, and
+// ddmmyy, mmddyy and yymmdd for 6.
+func parseDigitDate(token string) (int, bool) {
+	yearLen := len(token) - 4
+	splits := [][3]string{
+		{token[:2], token[2:4], token[4:]},
+		{token[2:4], token[:2], token[4:]},
+		{token[yearLen+2:], token[yearLen : yearLen+2], token[:yearLen]},
+	}
+	for _, split := range splits {
+		if year, ok := validDate(atoi(split[0]), atoi(split[1]), atoi(split[2])); ok {
+			return year, true
+		}
+	}
+	return 0, false
+}
+
+func parseSeparatedDate(token string) (int, bool) {
+	separator := ""
+	for _, r := range token {
+		if !unicode.IsDigit(r) {
+			separator = string(r)
+			break
+		}
+	}
+	if separator == "" || !strings.Contains(" /\\_.-", separator) {
+		return 0, false
+	}
+
+	parts := strings.Split(token, separator)
+	if len(parts) != 3 {
+		return 0, false
+	}
+	for _, part := range parts {
+		if part == "" || len(part) > 4 || !isDigits(part) {
+			return 0, false
+		}
+	}
+
+	a, b, c := atoi(parts[0]), atoi(parts[1]), atoi(parts[2])
+	if len(parts[0]) == 4 {
+		return validDate(c, b, a)
+	}
+	if year, ok := validDate(a, b, c); ok {
+		return year, true
+	}
+	return validDate(b, a, c)
+}
+
+func validDate(day, month, year int) (int, bool) {
+	if day < 1 || day > 31 || month < 1 || month > 12 {
+		return 0, false
+	}
+	switch {
+	case year < 50:
+		year += 2000
+	case year < 100:
+		year += 1900
+	}
+	if year < 1900 || year > 2049 {
+		return 0, false
+	}
+	return year, true
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func atoi(s string) int {
+	n := 0
+	for _, r := range s {
+		n = n*10 + int(r-'0')
+	}
+	return n
+}
+
+func nCk(n, k int) float64 {
+	if k > n {
+		return 0
+	}
+	result := 1.0
+	for i := 1; i <= k; i++ {
+		result *= float64(n-k+i) / float64(i)
+	}
+	return result
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func reverseString(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
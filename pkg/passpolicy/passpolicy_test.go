@@ -0,0 +1,138 @@
+package passpolicy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		password string
+		maxScore int
+		minScore int
+		warning  string
+	}{
+		{password: "password", maxScore: 0, warning: "top-100 common password"},
+		{password: "P@ssw0rd", maxScore: 1, warning: "similar to a commonly used password"},
+		{password: "qwertyuiop", maxScore: 0},
+		{password: "zxcvfr", maxScore: 1, warning: "keyboard patterns"},
+		{password: "abcdefgh", maxScore: 0, warning: "sequences"},
+		{password: "aaaaaaaaaa", maxScore: 0, warning: "repeated"},
+		{password: "12/25/1990", maxScore: 1, warning: "dates"},
+		{password: "x7#Kq9!vLp2@", minScore: 4},
+		{password: "N3w-Secur3-Passphrase!", minScore: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			estimation := Estimate(tt.password)
+			if estimation.Score > tt.maxScore && tt.minScore == 0 {
+				t.Errorf("expected score at most %d, got %d (%g guesses)", tt.maxScore, estimation.Score, estimation.Guesses)
+			}
+			if estimation.Score < tt.minScore {
+				t.Errorf("expected score at least %d, got %d (%g guesses)", tt.minScore, estimation.Score, estimation.Guesses)
+			}
+			if !strings.Contains(estimation.Warning, tt.warning) {
+				t.Errorf("expected warning containing %q, got %q", tt.warning, estimation.Warning)
+			}
+		})
+	}
+
+	if weak, strong := Estimate("marvin1985", "marvin"), Estimate("marvin1985"); weak.Guesses >= strong.Guesses {
+		t.Errorf("expected user inputs to lower the estimate, got %g and %g", weak.Guesses, strong.Guesses)
+	}
+}
+
+type breachList map[string]bool
+
+func (b breachList) Contains(password string) (bool, error) {
+	return b[password], nil
+}
+
+func TestPolicy_Check(t *testing.T) {
+	policy := &Policy{
+		MinLength: 8,
+		MaxLength: 64,
+		MinScore:  3,
+		Breached:  breachList{"Tr0ub4dor&3": true},
+	}
+
+	tests := []struct {
+		password string
+		reason   string
+	}{
+		{password: "short", reason: "at least 8 characters"},
+		{password: strings.Repeat("x7#Kq9!v", 9), reason: "at most 64 characters"},
+		{password: "Quentin-x7#Kq9!v", reason: "username or email"},
+		{password: "x7#Kq9!v-Q.Tarantino@Example.com", reason: "username or email"},
+		{password: "password123", reason: "too easy to guess"},
+		{password: "Tr0ub4dor&3", reason: "data breach"},
+		{password: "x7#Kq9!vLp2@"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			err := policy.Check(tt.password, "quentin", "q.tarantino@example.com")
+			if tt.reason == "" {
+				if err != nil {
+					t.Fatalf("expected password to be accepted, got %v", err)
+				}
+				return
+			}
+			if !IsViolation(err) || !strings.Contains(err.Error(), tt.reason) {
+				t.Fatalf("expected violation %q, got %v", tt.reason, err)
+			}
+		})
+	}
+}
+
+func TestCorpus(t *testing.T) {
+	// "hunter2" as a Have I Been Pwned line, the others as plaintext.
+	input := "F3BBBD66A63D4BF1747940578EC3D0103530E21D:17043\n" +
+		"letmein\n" +
+		"letmein\n" +
+		"rare-password\n"
+
+	path := filepath.Join(t.TempDir(), "breached.bin")
+	var buf bytes.Buffer
+	count, err := BuildCorpus(&buf, strings.NewReader(input), BuildOptions{})
+	if err != nil {
+		t.Fatalf("failed to build corpus: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("expected 3 distinct entries, got %d", count)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	corpus, err := OpenCorpus(path)
+	if err != nil {
+		t.Fatalf("failed to open corpus: %v", err)
+	}
+	defer corpus.Close()
+
+	if corpus.Len() != 3 {
+		t.Errorf("expected 3 entries, got %d", corpus.Len())
+	}
+	for password, want := range map[string]bool{"hunter2": true, "letmein": true, "rare-password": true, "hunter3": false, "": false} {
+		if got, err := corpus.Contains(password); got != want || err != nil {
+			t.Errorf("Contains(%q) = %v, %v; want %v", password, got, err, want)
+		}
+	}
+
+	buf.Reset()
+	if count, _ := BuildCorpus(&buf, strings.NewReader(input), BuildOptions{MinCount: 10}); count != 1 {
+		t.Errorf("expected only the frequent hash to be kept, got %d entries", count)
+	}
+
+	if err := os.WriteFile(path, []byte("not a corpus"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenCorpus(path); err == nil {
+		t.Error("expected an invalid file to be rejected")
+	}
+}
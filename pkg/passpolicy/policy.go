@@ -0,0 +1,116 @@
+// pkg/passpolicy/policy.go
+
+// Package passpolicy decides whether a password is acceptable: it checks the
+// length, estimates how easy the password is to guess, rejects passwords
+// built from the user's own name or email address, and screens them
+// against a local corpus of breached passwords.
+package passpolicy
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// BreachChecker reports whether a password is known to have leaked.
+type BreachChecker interface {
+	Contains(password string) (bool, error)
+}
+
+// Policy is a set of password requirements. Zero fields are not enforced.
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// MinScore is the lowest acceptable Estimate score, 0 to 4.
+	MinScore int
+	Breached BreachChecker
+}
+
+// Violation is returned by Check when a password does not meet the policy.
+// Its message is meant for the user.
+type Violation struct {
+	Reason string
+}
+
+func (v *Violation) Error() string {
+	return v.Reason
+}
+
+// IsViolation reports whether err is a policy violation rather than a
+// failure to check the password.
+func IsViolation(err error) bool {
+	var violation *Violation
+	return errors.As(err, &violation)
+}
+
+// Default returns the policy used when none is configured.
+func Default() *Policy {
+	return &Policy{MinLength: 8}
+}
+
+// Check returns a *Violation if password does not meet the policy.
+// userInputs are the username, email address and similar values the
+// password must not be based on; empty values are ignored.
+func (p *Policy) Check(password string, userInputs ...string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return &Violation{Reason: fmt.Sprintf("password must be at least %d characters", p.MinLength)}
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return &Violation{Reason: fmt.Sprintf("password must be at most %d characters", p.MaxLength)}
+	}
+
+	inputs := expandUserInputs(userInputs)
+	lower := strings.ToLower(password)
+	for _, input := range inputs {
+		if strings.Contains(lower, input) {
+			return &Violation{Reason: "password must not contain your username or email address"}
+		}
+	}
+
+	if p.MinScore > 0 {
+		estimation := Estimate(password, inputs...)
+		if estimation.Score < p.MinScore {
+			reason := "password is too easy to guess"
+			if estimation.Warning != "" {
+				reason += ": " + estimation.Warning
+			}
+			return &Violation{Reason: reason}
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+		if err != nil {
+			return fmt.Errorf("failed to check breached passwords: %w", err)
+		}
+		if breached {
+			return &Violation{Reason: "password has appeared in a data breach; choose a different one"}
+		}
+	}
+	return nil
+}
+
+// minInputLength keeps short names like "al" from ruling out every
+// password that happens to contain them.
+const minInputLength = 3
+
+// expandUserInputs lowercases the inputs and adds the local part of email
+// addresses.
+func expandUserInputs(userInputs []string) []string {
+	var inputs []string
+	add := func(input string) {
+		if utf8.RuneCountInString(input) >= minInputLength {
+			inputs = append(inputs, input)
+		}
+	}
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		add(input)
+		if local, _, found := strings.Cut(input, "@"); found {
+			add(local)
+		}
+	}
+	return inputs
+}
@@ -0,0 +1,270 @@
+package passpolicy
+
+import (
+	"bufio"
+	"embed"
+	"math"
+	"strings"
+)
+
+//go:embed data
+var dataFS embed.FS
+
+// Scores returned by Estimate, from "too guessable" to "very unguessable".
+const (
+	ScoreTooGuessable = iota
+	ScoreVeryGuessable
+	ScoreSomewhatGuessable
+	ScoreSafelyUnguessable
+	ScoreVeryUnguessable
+)
+
+const (
+	bruteforceCardinality = 10
+	minGuessesSingleChar  = 10
+	minGuessesMultiChar   = 50
+	// minGuessesBeforeGrowingSequence penalises splitting a password into
+	// many short matches.
+	minGuessesBeforeGrowingSequence = 10000
+)
+
+// Estimation is the result of Estimate.
+type Estimation struct {
+	Guesses float64
+	Score   int
+	Warning string
+}
+
+var builtinDictionaries = map[string]map[string]int{
+	dictPasswords: loadRankedList("data/common_passwords.txt"),
+	dictEnglish:   loadRankedList("data/english_words.txt"),
+}
+
+// loadRankedList reads one entry per line, most common first.
+func loadRankedList(name string) map[string]int {
+	f, err := dataFS.Open(name)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	ranked := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		word := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if word == "" {
+			continue
+		}
+		if _, exists := ranked[word]; !exists {
+			ranked[word] = len(ranked) + 1
+		}
+	}
+	return ranked
+}
+
+// Estimate estimates how many guesses an attacker needs for password, in the
+// manner of zxcvbn: the password is split into the sequence of known
+// patterns (common passwords, words, keyboard walks, sequences, repeats,
+// dates) and random characters that is cheapest to guess. userInputs such as
+// the username are treated as the most likely words of all.
+func Estimate(password string, userInputs ...string) Estimation {
+	dictionaries := make(map[string]map[string]int, len(builtinDictionaries)+1)
+	for name, ranked := range builtinDictionaries {
+		dictionaries[name] = ranked
+	}
+
+	inputs := make(map[string]int)
+	for _, input := range userInputs {
+		input = strings.ToLower(strings.TrimSpace(input))
+		if input != "" {
+			if _, exists := inputs[input]; !exists {
+				inputs[input] = len(inputs) + 1
+			}
+		}
+	}
+	dictionaries[dictUserInputs] = inputs
+
+	result := mostGuessable([]rune(password), dictionaries)
+	score := guessesToScore(result.guesses)
+
+	estimation := Estimation{Guesses: result.guesses, Score: score}
+	if score <= ScoreSomewhatGuessable {
+		estimation.Warning = warning(result.sequence, len(result.sequence) == 1)
+	}
+	return estimation
+}
+
+func guessesToScore(guesses float64) int {
+	const delta = 5
+	switch {
+	case guesses < 1e3+delta:
+		return ScoreTooGuessable
+	case guesses < 1e6+delta:
+		return ScoreVeryGuessable
+	case guesses < 1e8+delta:
+		return ScoreSomewhatGuessable
+	case guesses < 1e10+delta:
+		return ScoreSafelyUnguessable
+	}
+	return ScoreVeryUnguessable
+}
+
+type guessResult struct {
+	guesses  float64
+	sequence []*match
+}
+
+// mostGuessable finds the sequence of non-overlapping matches, filled in
+// with brute force, that needs the fewest guesses overall. For a sequence
+// of l matches the total is l! * product(guesses) plus a penalty that grows
+// with l; the factorial accounts for the attacker not knowing the order.
+func mostGuessable(password []rune, dictionaries map[string]map[string]int) guessResult {
+	n := len(password)
+	if n == 0 {
+		return guessResult{guesses: 1}
+	}
+
+	matchesByEnd := make([][]*match, n)
+	for _, m := range omnimatch(password, dictionaries) {
+		minGuesses := 1.0
+		if m.j-m.i+1 < n {
+			minGuesses = minGuessesMultiChar
+			if m.i == m.j {
+				minGuesses = minGuessesSingleChar
+			}
+		}
+		m.guesses = math.Max(m.guesses, minGuesses)
+		matchesByEnd[m.j] = append(matchesByEnd[m.j], m)
+	}
+
+	// best[k][l] is the best sequence of l matches covering runes 0..k.
+	type entry struct {
+		m  *match
+		pi float64
+		g  float64
+	}
+	best := make([]map[int]entry, n)
+	for k := range best {
+		best[k] = make(map[int]entry)
+	}
+
+	update := func(m *match, l int) {
+		k := m.j
+		pi := m.guesses
+		if l > 1 {
+			pi *= best[m.i-1][l-1].pi
+		}
+		g := factorial(l)*pi + math.Pow(minGuessesBeforeGrowingSequence, float64(l-1))
+		for otherL, other := range best[k] {
+			if otherL <= l && other.g <= g {
+				return
+			}
+		}
+		best[k][l] = entry{m: m, pi: pi, g: g}
+	}
+
+	bruteforce := func(i, j int) *match {
+		length := j - i + 1
+		guesses := math.Pow(bruteforceCardinality, float64(length))
+		minGuesses := float64(minGuessesMultiChar + 1)
+		if length == 1 {
+			minGuesses = minGuessesSingleChar + 1
+		}
+		return &match{
+			i:       i,
+			j:       j,
+			pattern: patternBruteforce,
+			token:   string(password[i : j+1]),
+			guesses: math.Max(guesses, minGuesses),
+		}
+	}
+
+	for k := 0; k < n; k++ {
+		for _, m := range matchesByEnd[k] {
+			if m.i == 0 {
+				update(m, 1)
+				continue
+			}
+			for l := range best[m.i-1] {
+				update(m, l+1)
+			}
+		}
+
+		update(bruteforce(0, k), 1)
+		for i := 1; i <= k; i++ {
+			for l, previous := range best[i-1] {
+				// Adjacent brute force runs are one run.
+				if previous.m.pattern == patternBruteforce {
+					continue
+				}
+				update(bruteforce(i, k), l+1)
+			}
+		}
+	}
+
+	bestL, bestG := 0, math.Inf(1)
+	for l, candidate := range best[n-1] {
+		if candidate.g < bestG || bestL == 0 {
+			bestL, bestG = l, candidate.g
+		}
+	}
+
+	sequence := make([]*match, bestL)
+	k := n - 1
+	for l := bestL; l > 0; l-- {
+		m := best[k][l].m
+		sequence[l-1] = m
+		k = m.i - 1
+	}
+	return guessResult{guesses: bestG, sequence: sequence}
+}
+
+func factorial(n int) float64 {
+	result := 1.0
+	for i := 2; i <= n; i++ {
+		result *= float64(i)
+	}
+	return result
+}
+
+// warning describes the longest match of a weak password.
+func warning(sequence []*match, whole bool) string {
+	var longest *match
+	for _, m := range sequence {
+		if longest == nil || m.j-m.i > longest.j-longest.i {
+			longest = m
+		}
+	}
+	if longest == nil {
+		return ""
+	}
+
+	switch longest.pattern {
+	case patternDictionary:
+		switch longest.dictionary {
+		case dictPasswords:
+			if whole && !longest.l33t && !longest.reversed && longest.rank <= 100 {
+				return "this is a top-100 common password"
+			}
+			return "this is similar to a commonly used password"
+		case dictUserInputs:
+			return "passwords based on your name or email address are easy to guess"
+		}
+		if whole {
+			return "a word by itself is easy to guess"
+		}
+		return "common words are easy to guess, even with substitutions such as '@' for 'a'"
+	case patternSpatial:
+		if longest.turns == 1 {
+			return "straight rows of keys are easy to guess"
+		}
+		return "short keyboard patterns are easy to guess"
+	case patternRepeat:
+		return "repeated characters or words are easy to guess"
+	case patternSequence:
+		return "sequences like abc or 6543 are easy to guess"
+	case patternDate:
+		return "dates and years are easy to guess"
+	}
+	return ""
+}
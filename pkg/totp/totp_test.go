@@ -0,0 +1,62 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits.
+func TestCode_RFC6238(t *testing.T) {
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" // "12345678901234567890"
+
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(secret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("time %d: expected %s, got %s", tt.unix, tt.code, code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("failed to generate secret: %v", err)
+	}
+
+	now := time.Unix(1700000000, 0)
+	previous, _ := Code(secret, Step(now)-1)
+	stale, _ := Code(secret, Step(now)-2)
+
+	if step, ok := Validate(secret, previous, now, 1); !ok || step != Step(now)-1 {
+		t.Errorf("expected previous step to validate, got %d %v", step, ok)
+	}
+	if _, ok := Validate(secret, stale, now, 1); ok {
+		t.Error("expected code outside the skew window to be rejected")
+	}
+	if _, ok := Validate(secret, "12345", now, 1); ok {
+		t.Error("expected short code to be rejected")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Remus Synerge", "jane@example.com", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/Remus%20Synerge:jane@example.com?") || !strings.Contains(uri, "secret=ABC") {
+		t.Errorf("unexpected uri: %s", uri)
+	}
+}